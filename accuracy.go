@@ -0,0 +1,107 @@
+package garbage
+
+import (
+	"fmt"
+	"math"
+)
+
+// accuracyComment prefixes the note on the accuracy of the profile, written
+// in the footer of the text format and the comments of the protocol buffer.
+const accuracyComment = "accuracy: "
+
+// confidenceZ is the z-score of the 95% confidence interval of Margin.
+const confidenceZ = 1.96
+
+// Accuracy estimates the error in the total garbage of a profile. The memory
+// profile samples about one allocation per runtime.MemProfileRate bytes, so
+// a profile of few samples is noisy; and the garbage of a window of few GC
+// cycles, or of cycles that vary widely, may not be representative of the
+// process. Errors are relative to the total garbage bytes.
+type Accuracy struct {
+	// Samples is the number of sampled garbage objects the profile rests
+	// on. It is estimated from the values of a profile that was scaled.
+	Samples float64
+
+	// Cycles is the number of GC cycles observed.
+	Cycles int
+
+	// SamplingError is the relative standard error from sampling: about
+	// one over the square root of Samples, or zero if every allocation is
+	// sampled.
+	SamplingError float64
+
+	// CycleError is the relative standard error of the mean garbage of the
+	// cycles observed, or zero with fewer than two cycles.
+	CycleError float64
+}
+
+// Error returns the relative standard error of the total garbage, combining
+// the sampling and cycle errors.
+func (a Accuracy) Error() float64 {
+	return math.Sqrt(a.SamplingError*a.SamplingError + a.CycleError*a.CycleError)
+}
+
+// Margin returns the half-width of the 95% confidence interval of the total
+// garbage, relative to it. A change in garbage between two profiles is
+// unlikely to be noise if it is larger than the margins of both combined,
+// the square root of the sum of their squares.
+func (a Accuracy) Margin() float64 {
+	return confidenceZ * a.Error()
+}
+
+// Accuracy returns the estimated accuracy of the total garbage of the
+// profile, or false if it has no garbage.
+func (p *Profile) Accuracy() (Accuracy, bool) {
+	a := Accuracy{Cycles: len(p.Cycles)}
+	for _, r := range p.Records {
+		a.Samples += p.samples(r)
+	}
+	if a.Samples <= 0 {
+		return Accuracy{}, false
+	}
+	if p.Rate > 1 {
+		a.SamplingError = 1 / math.Sqrt(a.Samples)
+	}
+
+	if k := len(p.Cycles); k > 1 {
+		var sum, sumSq float64
+		for _, c := range p.Cycles {
+			b := float64(c.Bytes)
+			sum += b
+			sumSq += b * b
+		}
+		mean := sum / float64(k)
+		if mean > 0 {
+			variance := (sumSq - sum*mean) / float64(k-1)
+			if variance > 0 {
+				a.CycleError = math.Sqrt(variance/float64(k)) / mean
+			}
+		}
+	}
+	return a, true
+}
+
+// samples returns the number of sampled objects of r. The values of a scaled
+// profile are inverted as scaleHeapSample scaled them.
+func (p *Profile) samples(r Record) float64 {
+	objects := float64(r.Objects)
+	if p.perSecond {
+		objects *= p.Duration.Seconds()
+	}
+	if !p.scaled || p.Rate <= 1 || r.Objects <= 0 {
+		return objects
+	}
+	size := float64(r.Bytes) / float64(r.Objects)
+	return objects * (1 - math.Exp(-size/float64(p.Rate)))
+}
+
+// accuracyNote returns the note on the accuracy of the profile, or "" if it
+// has no garbage.
+func (p *Profile) accuracyNote() string {
+	a, ok := p.Accuracy()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%s±%.1f%% at 95%% confidence (%.0f samples, %d GC cycles)",
+		accuracyComment, 100*a.Margin(), a.Samples, a.Cycles)
+}
@@ -0,0 +1,52 @@
+package garbage
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccuracy(t *testing.T) {
+	p := &Profile{
+		Rate:     512 * 1024,
+		Duration: 10 * time.Second,
+		Records:  []Record{{Objects: 60, Bytes: 60 << 10}, {Objects: 40, Bytes: 40 << 10}},
+		Cycles:   []Cycle{{Bytes: 90}, {Bytes: 110}, {Bytes: 100}, {Bytes: 100}},
+	}
+
+	a, ok := p.Accuracy()
+	if !ok {
+		t.Fatal("want accuracy")
+	}
+	if a.Samples != 100 || a.Cycles != 4 {
+		t.Errorf("want 100 samples over 4 cycles, got %v over %d", a.Samples, a.Cycles)
+	}
+	if math.Abs(a.SamplingError-0.1) > 1e-9 {
+		t.Errorf("want sampling error 0.1, got %v", a.SamplingError)
+	}
+	// The cycles vary with a standard deviation of about 8.2%.
+	if want := math.Sqrt(200.0/3/4) / 100; math.Abs(a.CycleError-want) > 1e-9 {
+		t.Errorf("want cycle error %v, got %v", want, a.CycleError)
+	}
+	if a.Margin() <= 1.96*a.SamplingError {
+		t.Errorf("want margin above the sampling error alone, got %v", a.Margin())
+	}
+
+	// Normalizing the profile keeps the samples it rests on.
+	if b, _ := p.PerSecond().Accuracy(); math.Abs(b.Samples-a.Samples) > 1 {
+		t.Errorf("want %v samples once normalized, got %v", a.Samples, b.Samples)
+	}
+
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "# accuracy: ±") {
+		t.Errorf("missing accuracy note:\n%s", text)
+	}
+
+	if _, ok := new(Profile).Accuracy(); ok {
+		t.Error("want no accuracy without garbage")
+	}
+}
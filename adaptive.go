@@ -0,0 +1,74 @@
+package garbage
+
+import (
+	"strconv"
+	"strings"
+)
+
+// adaptiveWarmup is the number of cycles an adaptive subscription reads one
+// at a time to learn the baseline of the garbage rate.
+const adaptiveWarmup = 5
+
+const strideComment = "stride: "
+
+// adapt lets s read the memory profile up to every maxStride GC cycles while
+// the garbage rate is quiet. It starts reading every cycle.
+func (c *collector) adapt(s *subscription, maxStride int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.adaptive, s.stride = maxStride, 1
+}
+
+// adjust adapts the stride of s to the garbage rate of cycle: back to every
+// cycle when the rate is anomalous against the baseline, as for a Detector,
+// and twice as many cycles, up to s.adaptive, after each cycle no more than
+// a standard deviation above it. Anomalous rates are kept out of the
+// baseline.
+func (s *subscription) adjust(cycle Cycle) {
+	last := s.observed
+	s.observed = cycle.Time
+	if last.IsZero() || !cycle.Time.After(last) {
+		return
+	}
+	rate := float64(cycle.Bytes) / cycle.Time.Sub(last).Seconds()
+
+	b := &s.rates
+	if b.n >= adaptiveWarmup {
+		if rate > b.mean+defaultAnomalySensitivity*b.stdDev() {
+			s.stride = 1
+			return
+		}
+		if rate <= b.mean+b.stdDev() {
+			if s.stride *= 2; s.stride > s.adaptive {
+				s.stride = s.adaptive
+			}
+		}
+	}
+	b.add(defaultAnomalyAlpha, rate)
+}
+
+// meanStride returns the mean number of GC cycles between the reads of the
+// memory profile observed by an adaptive subscription, or zero if it is not
+// adaptive or observed no cycles.
+func (s *subscription) meanStride() float64 {
+	if s.adaptive <= 1 || len(s.cycles) == 0 {
+		return 0
+	}
+	gcs := s.cycles[len(s.cycles)-1].NumGC - s.numGC
+	return float64(gcs) / float64(len(s.cycles))
+}
+
+// strideMarker returns the comment recording the stride of the profile.
+func (p *Profile) strideMarker() string {
+	return strideComment + strconv.FormatFloat(p.Stride, 'f', 2, 64)
+}
+
+// parseStride parses the stride from a comment, if it is a stride marker.
+func parseStride(comment string) (float64, bool) {
+	if !strings.HasPrefix(comment, strideComment) {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.TrimPrefix(comment, strideComment), 64)
+	return v, err == nil
+}
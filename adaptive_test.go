@@ -0,0 +1,67 @@
+package garbage
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionAdjust(t *testing.T) {
+	s := &subscription{adaptive: 8, stride: 1}
+	now := time.Unix(0, 0)
+	observe := func(bytes int64) {
+		now = now.Add(time.Second)
+		s.adjust(Cycle{Time: now, Bytes: bytes})
+	}
+
+	// A quiet rate widens the stride, up to its limit.
+	for i := 0; i < 20; i++ {
+		observe(int64(1e6 + (i%3)*1e4))
+	}
+	if s.stride != 8 {
+		t.Fatalf("quiet rate: want stride 8, got %d", s.stride)
+	}
+
+	// An anomalous rate reads every cycle again, and is not learned.
+	mean := s.rates.mean
+	observe(10e6)
+	if s.stride != 1 {
+		t.Errorf("anomalous rate: want stride 1, got %d", s.stride)
+	}
+	if s.rates.mean != mean {
+		t.Errorf("baseline learned the anomaly: %v, was %v", s.rates.mean, mean)
+	}
+
+	observe(1e6)
+	if s.stride != 2 {
+		t.Errorf("quiet again: want stride 2, got %d", s.stride)
+	}
+}
+
+func TestStrideMarker(t *testing.T) {
+	orig := testProfile()
+	orig.Stride = 2.5
+
+	data, err := orig.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Stride != 2.5 {
+		t.Errorf("proto: want stride 2.5, got %v", p.Stride)
+	}
+
+	text, err := orig.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err = Parse(bytes.NewReader(text)); err != nil {
+		t.Fatal(err)
+	}
+	if p.Stride != 2.5 {
+		t.Errorf("text: want stride 2.5, got %v", p.Stride)
+	}
+}
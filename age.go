@@ -0,0 +1,139 @@
+package garbage
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// Ages is a coarse histogram of the ages, in GC cycles, of objects when they
+// were freed.
+//
+// Like Survival, the ages are estimated by assuming the young die first:
+// the frees observed for a stack in a cycle are attributed to its most recent
+// allocations. Objects allocated before collection began are counted as
+// Longer.
+type Ages struct {
+	SameCycle int64 // freed by the first GC after allocation
+	OneCycle  int64 // survived one GC
+	FewCycles int64 // survived two to five GCs
+	Longer    int64 // survived more than five GCs
+}
+
+func (a *Ages) add(b Ages) {
+	a.SameCycle += b.SameCycle
+	a.OneCycle += b.OneCycle
+	a.FewCycles += b.FewCycles
+	a.Longer += b.Longer
+}
+
+// maxAge is the oldest age, in GC cycles, tracked individually. Older objects
+// are tracked together.
+const maxAge = 5
+
+// cohorts holds the number of objects from a single stack still live at each
+// age, youngest first. The last element holds the objects older than maxAge.
+type cohorts [maxAge + 2]int64
+
+// age moves each cohort to the next age, leaving the youngest empty.
+func (c *cohorts) age() {
+	c[maxAge+1] += c[maxAge]
+	copy(c[1:maxAge+1], c[:maxAge])
+	c[0] = 0
+}
+
+// ageTracker tracks the live cohorts of each stack across reads of the memory
+// profile, one GC cycle apart.
+type ageTracker map[[32]uintptr]*cohorts
+
+// update ages the cohorts of each stack by a cycle, adds the objects allocated
+// between prev and curr as the youngest cohort, and returns the ages of the
+// objects freed between prev and curr. The throttle, if any, paces the
+// comparison.
+func (t ageTracker) update(prev, curr []runtime.MemProfileRecord, th *throttle) map[[32]uintptr]Ages {
+	t.next()
+
+	ages := make(map[[32]uintptr]Ages)
+	prevs := byStack(prev)
+	for _, cr := range curr {
+		th.tick()
+		pr := prevs[cr.Stack0]
+		allocs := cr.AllocObjects - pr.AllocObjects
+		frees := cr.FreeObjects - pr.FreeObjects
+		if allocs == 0 && frees == 0 {
+			continue
+		}
+		ages[cr.Stack0] = t.observe(cr.Stack0, allocs, frees)
+	}
+	return ages
+}
+
+// next ages the cohorts of each stack by a cycle.
+func (t ageTracker) next() {
+	for _, c := range t {
+		c.age()
+	}
+}
+
+// observe adds the objects a stack allocated in the current cycle to its
+// youngest cohort and returns the ages of the objects it freed.
+func (t ageTracker) observe(stk [32]uintptr, allocs, frees int64) Ages {
+	c := t[stk]
+	if c == nil {
+		c = new(cohorts)
+		t[stk] = c
+	}
+	c[0] += allocs
+
+	var a Ages
+	for age := range c {
+		n := c[age]
+		if n > frees {
+			n = frees
+		}
+		c[age] -= n
+		frees -= n
+
+		switch {
+		case age == 0:
+			a.SameCycle += n
+		case age == 1:
+			a.OneCycle += n
+		case age <= maxAge:
+			a.FewCycles += n
+		default:
+			a.Longer += n
+		}
+	}
+	a.Longer += frees // allocated before tracking began
+
+	if *c == (cohorts{}) {
+		delete(t, stk)
+	}
+	return a
+}
+
+// topAges is the number of garbage stacks whose ages and sizes are printed in
+// the legacy text format.
+const topAges = 10
+
+// printAges prints the ages of the garbage from the stacks producing the most
+// garbage, by the default sample, as a comment section of the legacy text
+// format.
+func (p *Profile) printAges(w io.Writer) {
+	top := p.ranked()
+	if len(top) > topAges {
+		top = top[:topAges]
+	}
+
+	fmt.Fprintf(w, "\n# garbage ages: same cycle: 1 cycle: 2-5 cycles: longer\n")
+	for _, r := range top {
+		a := r.Ages
+		fmt.Fprintf(w, "# %d: %d: %d: %d @", a.SameCycle, a.OneCycle, a.FewCycles, a.Longer)
+		for _, pc := range r.Stack() {
+			fmt.Fprintf(w, " %#x", pc)
+		}
+		fmt.Fprintf(w, "\n")
+		p.printStack(w, r.Stack())
+	}
+}
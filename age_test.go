@@ -0,0 +1,54 @@
+package garbage
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestAges(t *testing.T) {
+	rec := func(allocs, frees int64) []runtime.MemProfileRecord {
+		r := runtime.MemProfileRecord{AllocObjects: allocs, FreeObjects: frees}
+		r.Stack0[0] = 1
+		return []runtime.MemProfileRecord{r}
+	}
+
+	// Cumulative allocs and frees of a stack at each read, one cycle apart.
+	reads := []struct{ allocs, frees int64 }{
+		{100, 80},  // 80 objects from before tracking began
+		{200, 130}, // 100 allocated: 50 die young
+		{300, 250}, // 100 allocated: 100 die young, 20 at one cycle
+		{300, 260}, // none allocated: 10 die at two cycles
+		{300, 260},
+		{300, 260},
+		{300, 260},
+		{300, 260},
+		{300, 300}, // 20 die at more than five cycles, 20 predate tracking
+	}
+
+	tr := make(ageTracker)
+	var got Ages
+	prev := rec(reads[0].allocs, reads[0].frees)
+	for _, r := range reads[1:] {
+		curr := rec(r.allocs, r.frees)
+		got.add(tr.update(prev, curr, nil)[prev[0].Stack0])
+		prev = curr
+	}
+
+	if want := (Ages{SameCycle: 150, OneCycle: 20, FewCycles: 10, Longer: 40}); got != want {
+		t.Errorf("want ages %+v, got %+v", want, got)
+	}
+	if len(tr) != 0 {
+		t.Errorf("want empty tracker once every object is freed, got %d stacks", len(tr))
+	}
+
+	p := testProfile()
+	p.Records[0].Ages = got
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "\n# 150: 20: 10: 40 @") {
+		t.Errorf("missing garbage ages in %q", text)
+	}
+}
@@ -0,0 +1,90 @@
+package garbage
+
+import (
+	"runtime"
+	"time"
+)
+
+// defaultAggregationChunk is the number of stacks aggregated between yields
+// if the budget sets no Chunk.
+const defaultAggregationChunk = 4096
+
+// An AggregationBudget limits the CPU the collector spends attributing the
+// garbage of each GC cycle to its stacks, so a collection on a giant heap of
+// very many stacks does not monopolize a core. The collector compares the
+// stacks of its reads of the memory profile in chunks and yields the
+// processor between them, at the cost of observing each cycle later.
+type AggregationBudget struct {
+	// Chunk is the number of stacks compared between yields. Zero means
+	// 4096.
+	Chunk int
+
+	// Share, if between zero and one, is the largest share of a core the
+	// aggregation may use, such as 0.25: after each chunk, the collector
+	// sleeps long enough to keep within it. Otherwise it only yields.
+	Share float64
+}
+
+// limitAggregation limits the CPU of the aggregation of each cycle to b while
+// s is subscribed.
+func (c *collector) limitAggregation(s *subscription, b AggregationBudget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.budget = &b
+}
+
+// A throttle paces the aggregation of a cycle within an AggregationBudget.
+// A nil throttle does not pace.
+type throttle struct {
+	chunk int
+	share float64
+	n     int       // stacks compared
+	start time.Time // of the chunk
+}
+
+// throttle returns a throttle of the strictest aggregation budget of the
+// subscriptions, the smallest chunk and share of each, or nil if none has a
+// budget.
+func (c *collector) throttle() *throttle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var t *throttle
+	for s := range c.subs {
+		b := s.budget
+		if b == nil {
+			continue
+		}
+		if t == nil {
+			t = &throttle{start: time.Now()}
+		}
+		if b.Chunk > 0 && (t.chunk == 0 || b.Chunk < t.chunk) {
+			t.chunk = b.Chunk
+		}
+		if b.Share > 0 && b.Share < 1 && (t.share == 0 || b.Share < t.share) {
+			t.share = b.Share
+		}
+	}
+	if t != nil && t.chunk == 0 {
+		t.chunk = defaultAggregationChunk
+	}
+	return t
+}
+
+// tick counts a stack compared, yielding at the end of each chunk.
+func (t *throttle) tick() {
+	if t == nil {
+		return
+	}
+	if t.n++; t.n%t.chunk != 0 {
+		return
+	}
+	if t.share > 0 && t.share < 1 {
+		busy := time.Since(t.start)
+		time.Sleep(time.Duration(float64(busy) * (1 - t.share) / t.share))
+	} else {
+		runtime.Gosched()
+	}
+	t.start = time.Now()
+}
@@ -0,0 +1,146 @@
+package garbage
+
+import (
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// benchStacks is the number of stacks of the synthetic profiles of the
+// benchmarks, as on a giant heap.
+const benchStacks = 100000
+
+// benchMemProfile returns a synthetic read of the memory profile of n stacks,
+// each with freed objects proportional to i.
+func benchMemProfile(n, i int) []runtime.MemProfileRecord {
+	recs := make([]runtime.MemProfileRecord, n)
+	for j := range recs {
+		r := &recs[j]
+		r.Stack0[0] = uintptr(0x1000 + 16*j)
+		r.Stack0[1] = uintptr(0x800000 + j%64)
+		r.AllocObjects = int64(2 * (i + 1) * (j%7 + 1))
+		r.FreeObjects = int64(i * (j%7 + 1))
+		r.AllocBytes = 32 * r.AllocObjects
+		r.FreeBytes = 32 * r.FreeObjects
+	}
+	return recs
+}
+
+// benchRecords returns the synthetic garbage of n stacks.
+func benchRecords(n int) []Record {
+	return diff(benchMemProfile(n, 0), benchMemProfile(n, 1), nil)
+}
+
+func BenchmarkDiff(b *testing.B) {
+	prev, curr := benchMemProfile(benchStacks, 1), benchMemProfile(benchStacks, 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		diff(prev, curr, nil)
+	}
+}
+
+func BenchmarkObserve(b *testing.B) {
+	const stacks = 20000
+	reads := make([][]runtime.MemProfileRecord, 8)
+	for i := range reads {
+		reads[i] = benchMemProfile(stacks, i)
+	}
+	c := &collector{subs: make(map[*subscription]struct{}), ages: make(ageTracker)}
+	c.subs[new(subscription)] = struct{}{}
+	c.subs[&subscription{depth: 8}] = struct{}{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := i % (len(reads) - 1)
+		c.observe(reads[n], reads[n+1], Cycle{NumGC: uint32(i + 1), Time: time.Now()})
+	}
+}
+
+func BenchmarkMergeAll(b *testing.B) {
+	recs, add := benchRecords(benchStacks), benchRecords(benchStacks)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mergeAll(append([]Record(nil), recs...), add)
+	}
+}
+
+func BenchmarkMerge(b *testing.B) {
+	profiles := []*Profile{
+		{Start: time.Unix(1700000000, 0), Duration: time.Minute, Rate: 1, Records: benchRecords(benchStacks)},
+		{Start: time.Unix(1700000000, 0), Duration: time.Minute, Rate: 1, Records: benchRecords(benchStacks)},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Merge(MergeOptions{}, profiles...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteTo(b *testing.B) {
+	p := &Profile{Start: time.Unix(1700000000, 0), Duration: time.Minute, Rate: 1, Records: benchRecords(benchStacks)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.WriteTo(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMergeAll(t *testing.T) {
+	recs := []Record{testRecord(1, 1, 16), testRecord(2, 2, 32)}
+	add := []Record{testRecord(2, 4, 64), testRecord(3, 1, 16), testRecord(3, 1, 16)}
+
+	var want []Record
+	for _, r := range append(append([]Record(nil), recs...), add...) {
+		want = merge(want, r)
+	}
+	got := mergeAll(recs, add)
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDiffThrottle(t *testing.T) {
+	prev, curr := benchMemProfile(1000, 1), benchMemProfile(1000, 2)
+	want := diff(prev, curr, nil)
+
+	th := &throttle{chunk: 100, share: 0.5, start: time.Now()}
+	got := diff(prev, curr, th)
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d", len(got), len(want))
+	}
+	if th.n != len(curr) {
+		t.Errorf("throttle counted %d stacks, want %d", th.n, len(curr))
+	}
+}
+
+func TestAggregationBudget(t *testing.T) {
+	c := &collector{subs: make(map[*subscription]struct{})}
+	a, b := new(subscription), new(subscription)
+	c.subs[a], c.subs[b] = struct{}{}, struct{}{}
+	if th := c.throttle(); th != nil {
+		t.Fatalf("throttle without a budget: %+v", th)
+	}
+
+	c.limitAggregation(a, AggregationBudget{Share: 0.5})
+	th := c.throttle()
+	if th == nil || th.chunk != defaultAggregationChunk || th.share != 0.5 {
+		t.Fatalf("throttle of one budget: %+v", th)
+	}
+
+	c.limitAggregation(b, AggregationBudget{Chunk: 100, Share: 0.25})
+	if th := c.throttle(); th.chunk != 100 || th.share != 0.25 {
+		t.Fatalf("throttle of the strictest budget: %+v", th)
+	}
+}
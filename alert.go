@@ -0,0 +1,276 @@
+package garbage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// alertStacks is the number of top offending stacks in an alert.
+	alertStacks = 5
+
+	pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+)
+
+// human formats the sizes of alerts.
+var human = units{human: true}
+
+// An Alert is a notification of excess garbage for humans, such as an
+// anomaly of a Detector or a capture of a Trigger, with the stacks that
+// produced the most garbage.
+type Alert struct {
+	Time    time.Time
+	Summary string // one line describing the alert
+
+	// Stacks are the allocation sites of the alert's profile with the most
+	// garbage, the most first, estimated for all allocations.
+	Stacks []AlertStack
+
+	// Profile is the profile captured for the alert, if any.
+	Profile *Profile
+
+	// Owner is the owner of the garbage of the alert, if it was routed by
+	// an OwnerNotifier.
+	Owner string
+}
+
+// An AlertStack is the garbage of an allocation site.
+type AlertStack struct {
+	Frame          // the first frame of the stack outside the runtime
+	Bytes, Objects int64
+}
+
+// NewAlert returns an alert with the summary and the top stacks of p, which
+// may be nil.
+func NewAlert(summary string, p *Profile) Alert {
+	a := Alert{Time: time.Now(), Summary: summary, Profile: p}
+	if p == nil {
+		return a
+	}
+	if !p.Start.IsZero() {
+		a.Time = p.Start
+	}
+
+	bySite := make(map[Frame]*AlertStack)
+	for _, r := range p.Records {
+		fr := p.siteFrame(r.Stack())
+		s := bySite[fr]
+		if s == nil {
+			s = &AlertStack{Frame: fr}
+			bySite[fr] = s
+		}
+		objects, bytes := r.Objects, r.Bytes
+		if !p.scaled {
+			objects, bytes = scaleHeapSample(r.Objects, r.Bytes, int64(p.Rate))
+		}
+		s.Objects += objects
+		s.Bytes += bytes
+	}
+	for _, s := range bySite {
+		a.Stacks = append(a.Stacks, *s)
+	}
+	sort.Slice(a.Stacks, func(i, j int) bool { return a.Stacks[i].Bytes > a.Stacks[j].Bytes })
+	if len(a.Stacks) > alertStacks {
+		a.Stacks = a.Stacks[:alertStacks]
+	}
+	return a
+}
+
+// Alert returns the alert of the anomaly.
+func (a Anomaly) Alert() Alert {
+	summary := fmt.Sprintf("garbage rate of %s/s against a baseline of %s/s",
+		human.bytes(int64(a.Rate)), human.bytes(int64(a.Baseline)))
+	alert := NewAlert(summary, a.Profile)
+	alert.Time = a.Time
+	return alert
+}
+
+// AlertFuncs are the functions of alert templates: bytes formats a count of
+// bytes with a binary prefix.
+var AlertFuncs = template.FuncMap{"bytes": human.bytes}
+
+// A Notifier sends alerts, such as to a chat or paging service.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+var defaultSlackTemplate = template.Must(template.New("slack").Funcs(AlertFuncs).Parse(
+	`:wastebasket: *{{.Summary}}* at {{.Time.Format "2006-01-02 15:04:05 MST"}}
+{{range .Stacks}}• ` + "`{{.Function}}`" + ` {{.File}}:{{.Line}}: {{bytes .Bytes}}
+{{end}}`))
+
+// A SlackNotifier posts alerts to a Slack incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string
+
+	// Template, if set, renders the message text from the Alert. It may
+	// use AlertFuncs.
+	Template *template.Template
+
+	// Client is the HTTP client used. Nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// Notify posts the alert to the webhook.
+func (n *SlackNotifier) Notify(ctx context.Context, a Alert) error {
+	text, err := renderAlert(n.Template, defaultSlackTemplate, a)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.Client, n.WebhookURL, map[string]string{"text": text})
+}
+
+var defaultPagerDutyTemplate = template.Must(template.New("pagerduty").Parse(`{{.Summary}}`))
+
+// A PagerDutyNotifier triggers PagerDuty incidents for alerts through the
+// Events API v2.
+type PagerDutyNotifier struct {
+	RoutingKey string // integration key of the service
+
+	// Source is the affected system, such as the host name or service.
+	Source string
+
+	// Severity is "critical", "error", "warning" or "info". Empty means
+	// "warning".
+	Severity string
+
+	// Template, if set, renders the summary of the incident from the Alert,
+	// as for a SlackNotifier. The top stacks are in its custom details.
+	Template *template.Template
+
+	// URL is the events endpoint. Empty means PagerDuty's.
+	URL string
+
+	// Client is the HTTP client used. Nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// Notify triggers an incident for the alert.
+func (n *PagerDutyNotifier) Notify(ctx context.Context, a Alert) error {
+	summary, err := renderAlert(n.Template, defaultPagerDutyTemplate, a)
+	if err != nil {
+		return err
+	}
+	if len(summary) > 1024 {
+		summary = summary[:1024]
+	}
+
+	severity := n.Severity
+	if severity == "" {
+		severity = "warning"
+	}
+	var stacks []string
+	for _, s := range a.Stacks {
+		stacks = append(stacks, fmt.Sprintf("%s %s:%d: %s", s.Function, s.File, s.Line, human.bytes(s.Bytes)))
+	}
+
+	event := map[string]interface{}{
+		"routing_key":  n.RoutingKey,
+		"event_action": "trigger",
+		"payload": map[string]interface{}{
+			"summary":   strings.TrimSpace(summary),
+			"source":    n.Source,
+			"severity":  severity,
+			"timestamp": a.Time.Format(time.RFC3339),
+			"custom_details": map[string]interface{}{
+				"top_stacks": stacks,
+			},
+		},
+	}
+	url := n.URL
+	if url == "" {
+		url = pagerDutyURL
+	}
+	return postJSON(ctx, n.Client, url, event)
+}
+
+// An OwnerNotifier routes each alert to the notifier of the owner of its
+// garbage, such as the webhook of the owning team: the owner of the most
+// garbage of the alert's profile, or of its top stack if it has no profile
+// (see Profile.Ownership). The owner is set in the alert routed.
+type OwnerNotifier struct {
+	// Owners map allocation sites to their owners, such as the rules of an
+	// ownership file (see LoadOwners).
+	Owners []OwnerRule
+
+	// Notifiers are the notifiers of the owners, by owner.
+	Notifiers map[string]Notifier
+
+	// Default, if set, is notified of the alerts of unowned garbage and of
+	// owners without a notifier. Otherwise those alerts are dropped.
+	Default Notifier
+}
+
+// Notify routes the alert to the notifier of its owner.
+func (n *OwnerNotifier) Notify(ctx context.Context, a Alert) error {
+	a.Owner = n.owner(a)
+	if notifier, ok := n.Notifiers[a.Owner]; ok {
+		return notifier.Notify(ctx, a)
+	}
+	if n.Default != nil {
+		return n.Default.Notify(ctx, a)
+	}
+	return nil
+}
+
+// owner returns the owner of the garbage of a.
+func (n *OwnerNotifier) owner(a Alert) string {
+	if a.Profile != nil && len(a.Profile.Records) > 0 {
+		return a.Profile.Ownership(n.Owners)[0].Owner
+	}
+	if len(a.Stacks) > 0 {
+		if owner, ok := frameOwner(a.Stacks[0].Frame, n.Owners); ok {
+			return owner
+		}
+	}
+	return Unowned
+}
+
+// renderAlert executes tmpl, or def if tmpl is nil, with a.
+func renderAlert(tmpl, def *template.Template, a Alert) (string, error) {
+	if tmpl == nil {
+		tmpl = def
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, a); err != nil {
+		return "", fmt.Errorf("garbage: alert template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// postJSON posts v as JSON to url.
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("garbage: alert to %s: %s: %s", req.URL.Host, res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package garbage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestAlertNotifiers(t *testing.T) {
+	var got []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error(err)
+		}
+		got = append(got, v)
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			http.Error(w, "invalid_token", http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	a := Anomaly{Rate: 8 << 20, Baseline: 1 << 20, Profile: testProfile()}.Alert()
+	if len(a.Stacks) != 1 || !strings.HasSuffix(a.Stacks[0].Function, ".testProfile") || a.Stacks[0].Bytes < 3<<20 {
+		t.Fatalf("want testProfile as the top stack, got %+v", a.Stacks)
+	}
+
+	ctx := context.Background()
+	if err := (&SlackNotifier{WebhookURL: srv.URL}).Notify(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	text, _ := got[0]["text"].(string)
+	if !strings.Contains(text, "8.0 MiB/s") || !strings.Contains(text, "testProfile") {
+		t.Errorf("bad Slack message %q", text)
+	}
+
+	pd := &PagerDutyNotifier{RoutingKey: "key", Source: "api-1", URL: srv.URL}
+	if err := pd.Notify(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := got[1]["payload"].(map[string]interface{})
+	if got[1]["routing_key"] != "key" || got[1]["event_action"] != "trigger" || payload["severity"] != "warning" || payload["source"] != "api-1" {
+		t.Errorf("bad PagerDuty event %v", got[1])
+	}
+	if details, _ := payload["custom_details"].(map[string]interface{}); len(details["top_stacks"].([]interface{})) != 1 {
+		t.Errorf("want the top stack in the details, got %v", payload["custom_details"])
+	}
+
+	tmpl := template.Must(template.New("").Funcs(AlertFuncs).Parse(`{{(index .Stacks 0).Bytes | bytes}} churned`))
+	if err := (&SlackNotifier{WebhookURL: srv.URL, Template: tmpl}).Notify(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if text := got[2]["text"].(string); !strings.HasSuffix(text, "MiB churned") {
+		t.Errorf("bad templated message %q", text)
+	}
+
+	if err := (&SlackNotifier{WebhookURL: srv.URL + "/fail"}).Notify(ctx, a); err == nil || !strings.Contains(err.Error(), "invalid_token") {
+		t.Errorf("want the failure reported, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package garbage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// GarbageFromAllocFreeTrace computes an exact garbage profile from the output
+// of a program run with GODEBUG=allocfreetrace=1: every allocation that the
+// trace shows freed is garbage, attributed to the stack that allocated it.
+// Unlike a collected profile, it is not subject to the sampling error of
+// runtime.MemProfileRate, so its Rate is 1.
+//
+// The allocfreetrace setting was removed in Go 1.22; this reads the traces
+// of earlier versions. Lines that are not part of a trace, such as the
+// program's own output, are ignored.
+func GarbageFromAllocFreeTrace(r io.Reader) (*Profile, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+
+	t := &traceParser{
+		live:   make(map[uint64]traceAlloc),
+		pcs:    make(map[Frame]uintptr),
+		frames: make(map[uintptr][]Frame),
+	}
+	for lineno := 1; sc.Scan(); lineno++ {
+		if err := t.line(sc.Text()); err != nil {
+			return nil, fmt.Errorf("garbage: line %d: %v", lineno, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	t.end()
+
+	if t.events == 0 {
+		return nil, errors.New("garbage: no allocfreetrace events")
+	}
+	return &Profile{
+		Rate:    1,
+		Records: t.garbage,
+		frames:  t.frames,
+	}, nil
+}
+
+// traceAlloc is a live allocation in an allocfreetrace.
+type traceAlloc struct {
+	size  int64
+	stack [32]uintptr
+}
+
+// traceParser accumulates the garbage in an allocfreetrace. Frames are
+// identified by made-up addresses, since the trace does not print them
+// reliably.
+type traceParser struct {
+	events  int
+	live    map[uint64]traceAlloc // by address
+	garbage []Record
+
+	pcs    map[Frame]uintptr
+	frames map[uintptr][]Frame
+
+	// The event being read.
+	kind  string // "tracealloc", "tracefree", "tracegc" or empty
+	addr  uint64
+	size  int64
+	stack []uintptr
+	fn    string // function of the frame whose file is on the next line
+}
+
+func (t *traceParser) line(line string) error {
+	switch {
+	case t.kind == "tracegc":
+		// The stacks of every goroutine; not an event of its own.
+		if line == "end tracegc" {
+			t.kind = ""
+		}
+		return nil
+
+	case strings.HasPrefix(line, "tracealloc("), strings.HasPrefix(line, "tracefree("):
+		t.end()
+		args := strings.Split(strings.TrimSuffix(line[strings.Index(line, "(")+1:], ")"), ", ")
+		if len(args) < 2 {
+			return fmt.Errorf("bad event %q", line)
+		}
+		addr, err := strconv.ParseUint(args[0], 0, 64)
+		if err != nil {
+			return fmt.Errorf("bad address in %q", line)
+		}
+		size, err := strconv.ParseInt(args[1], 0, 64)
+		if err != nil {
+			return fmt.Errorf("bad size in %q", line)
+		}
+		t.kind, t.addr, t.size = line[:strings.Index(line, "(")], addr, size
+		t.events++
+
+	case line == "tracegc()":
+		t.end()
+		t.kind = "tracegc"
+
+	case t.kind == "":
+		// Not part of a trace.
+
+	case line == "":
+		t.end()
+
+	case strings.HasPrefix(line, "goroutine "):
+		// The goroutine header.
+
+	case strings.HasPrefix(line, "\t"):
+		if t.fn == "" {
+			return nil
+		}
+		fr := Frame{Function: t.fn}
+		fr.File = strings.Fields(line)[0]
+		if i := strings.LastIndex(fr.File, ":"); i >= 0 {
+			fr.Line, _ = strconv.Atoi(fr.File[i+1:])
+			fr.File = fr.File[:i]
+		}
+		t.fn = ""
+
+		if len(t.stack) == 0 && strings.HasPrefix(fr.Function, "runtime.") {
+			// Hide the allocator, as the legacy text format does.
+			return nil
+		}
+		t.stack = append(t.stack, t.pc(fr))
+
+	default:
+		fn := strings.TrimPrefix(line, "created by ")
+		if i := strings.Index(fn, " in goroutine "); i >= 0 {
+			fn = fn[:i]
+		}
+		if i := strings.LastIndex(fn, "("); i > 0 && strings.HasSuffix(fn, ")") {
+			fn = fn[:i]
+		}
+		t.fn = fn
+	}
+	return nil
+}
+
+// end completes the event being read.
+func (t *traceParser) end() {
+	switch t.kind {
+	case "tracealloc":
+		a := traceAlloc{size: t.size}
+		copy(a.stack[:], t.stack)
+		t.live[t.addr] = a
+	case "tracefree":
+		if a, ok := t.live[t.addr]; ok {
+			delete(t.live, t.addr)
+			t.garbage = merge(t.garbage, Record{Objects: 1, Bytes: a.size, Stack0: a.stack})
+		}
+	}
+	t.kind, t.stack, t.fn = "", t.stack[:0], ""
+}
+
+// pc returns the made-up address of fr.
+func (t *traceParser) pc(fr Frame) uintptr {
+	pc, ok := t.pcs[fr]
+	if !ok {
+		pc = uintptr(len(t.pcs) + 1)
+		t.pcs[fr] = pc
+		t.frames[pc] = []Frame{fr}
+	}
+	return pc
+}
@@ -0,0 +1,81 @@
+package garbage
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testAllocFreeTrace = `tracealloc(0xc000010000, 0x10, main.T)
+goroutine 1 [running]:
+runtime.mallocgc(0x10, 0x4a1f20, 0x1)
+	/usr/local/go/src/runtime/malloc.go:1171 +0x6b9 fp=0xc000046e70 sp=0xc000046dc0 pc=0x40b559
+runtime.newobject(0x4a1f20)
+	/usr/local/go/src/runtime/malloc.go:1254 +0x25 fp=0xc000046e90 sp=0xc000046e70 pc=0x40b925
+main.alloc(...)
+	/home/gopher/main.go:12
+main.main()
+	/home/gopher/main.go:20 +0x25 fp=0xc000046f80 sp=0xc000046e90 pc=0x48c4a5
+
+hello, world
+tracealloc(0xc000010010, 0x20, main.U)
+goroutine 1 [running]:
+runtime.mallocgc(0x20, 0x4a1f20, 0x1)
+	/usr/local/go/src/runtime/malloc.go:1171 +0x6b9
+main.(*U).grow(0xc000010000)
+	/home/gopher/u.go:7 +0x40
+main.main()
+	/home/gopher/main.go:21 +0x30
+
+tracegc()
+goroutine 5 [runnable]:
+main.worker()
+	/home/gopher/main.go:40 +0x20
+end tracegc
+
+tracefree(0xc000010000, 0x10)
+goroutine 2 [running]:
+runtime.sweepone()
+	/usr/local/go/src/runtime/mgcsweep.go:350 +0x20
+
+tracefree(0xc0000aa000, 0x10)
+goroutine 2 [running]:
+runtime.sweepone()
+	/usr/local/go/src/runtime/mgcsweep.go:350 +0x20
+`
+
+func TestGarbageFromAllocFreeTrace(t *testing.T) {
+	p, err := GarbageFromAllocFreeTrace(strings.NewReader(testAllocFreeTrace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Rate != 1 {
+		t.Errorf("want rate 1, got %d", p.Rate)
+	}
+	if len(p.Records) != 1 {
+		t.Fatalf("want 1 record, got %+v", p.Records)
+	}
+
+	r := p.Records[0]
+	if r.Objects != 1 || r.Bytes != 0x10 {
+		t.Errorf("want 1: 16 of garbage, got %d: %d", r.Objects, r.Bytes)
+	}
+
+	var got []string
+	for _, pc := range r.Stack() {
+		fr := p.frames[pc][0]
+		got = append(got, fr.Function+" "+fr.File+":"+strconv.Itoa(fr.Line))
+	}
+	want := []string{
+		"main.alloc /home/gopher/main.go:12",
+		"main.main /home/gopher/main.go:20",
+	}
+	if !equalStrings(got, want) {
+		t.Errorf("want stack %q, got %q", want, got)
+	}
+
+	if _, err := GarbageFromAllocFreeTrace(strings.NewReader("hello, world\n")); err == nil {
+		t.Error("want error for input without events")
+	}
+}
@@ -0,0 +1,207 @@
+package garbage
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAnomalyAlpha       = 0.1
+	defaultAnomalySensitivity = 3
+	defaultAnomalyWarmup      = 30
+	defaultAnomalyDuration    = 30 * time.Second
+	defaultAnomalyCooldown    = 10 * time.Minute
+)
+
+// An Anomaly is a GC cycle whose garbage rate exceeded the baseline of a
+// Detector.
+type Anomaly struct {
+	Time     time.Time // time the cycle was observed
+	Rate     float64   // estimated garbage bytes per second of the cycle
+	Baseline float64   // moving average of the rate before the cycle
+	StdDev   float64   // moving standard deviation of the rate
+
+	// Profile is the profile captured after the anomaly was detected.
+	Profile *Profile
+}
+
+// A Detector watches the garbage rate of each GC cycle for anomalies against
+// a baseline, an exponentially weighted moving average of the rate and its
+// variance. When the rate of a cycle exceeds the baseline by Sensitivity
+// standard deviations, the detector captures a profile and calls OnAnomaly,
+// so churn regressions are caught without anyone watching dashboards.
+//
+// The rates are estimated, like those of a Monitor, for all allocations
+// rather than those sampled.
+type Detector struct {
+	// Alpha is the weight of each cycle in the baseline, between 0 and 1.
+	// Zero means 0.1.
+	Alpha float64
+
+	// Sensitivity is the number of standard deviations above the baseline
+	// at which a rate is anomalous. Zero means 3.
+	Sensitivity float64
+
+	// Warmup is the number of cycles observed before the baseline is
+	// trusted. Zero means 30.
+	Warmup int
+
+	// Duration is the collection window of the profile captured on an
+	// anomaly. Zero means 30 seconds.
+	Duration time.Duration
+
+	// Cooldown is the minimum time between captures. Anomalies within the
+	// cooldown of a capture are not reported. Zero means ten minutes.
+	Cooldown time.Duration
+
+	// OnAnomaly is called with each anomaly once its profile is captured,
+	// on a goroutine of its own. A Notifier can send its Alert to Slack or
+	// PagerDuty.
+	OnAnomaly func(Anomaly)
+
+	// Interval is how often to check for a completed GC cycle, as for a
+	// Monitor. Zero means one second.
+	Interval time.Duration
+
+	rec    Recorder
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	last     time.Time // time of the previous cycle
+	base     baseline
+	captured time.Time // start of the last capture
+}
+
+// A baseline is an exponentially weighted moving average of a rate and its
+// variance.
+type baseline struct {
+	n        int // rates added
+	mean     float64
+	variance float64
+}
+
+// add adds rate to the baseline with weight alpha.
+func (b *baseline) add(alpha, rate float64) {
+	if b.n == 0 {
+		b.mean = rate
+	} else {
+		diff := rate - b.mean
+		b.mean += alpha * diff
+		b.variance = (1 - alpha) * (b.variance + alpha*diff*diff)
+	}
+	b.n++
+}
+
+// stdDev returns the moving standard deviation of the rate.
+func (b *baseline) stdDev() float64 {
+	return math.Sqrt(b.variance)
+}
+
+// Start starts the detector if it is not already running. The baseline of
+// any previous run is discarded.
+func (d *Detector) Start() {
+	if !enabled {
+		return
+	}
+
+	d.mu.Lock()
+	if d.cancel != nil {
+		d.mu.Unlock()
+		return
+	}
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	d.last, d.base = time.Time{}, baseline{}
+	d.mu.Unlock()
+
+	d.rec.Interval = d.Interval
+	d.rec.Start(func(c *CycleDelta) {
+		rate := int64(runtime.MemProfileRate)
+		var bytes int64
+		for _, r := range c.Garbage {
+			_, b := scaleHeapSample(r.Objects, r.Bytes, rate)
+			bytes += b
+		}
+		if a, ok := d.observe(c.Time, bytes); ok {
+			go d.capture(ctx, a)
+		}
+	})
+}
+
+// Stop stops the detector, cancelling any capture in progress.
+func (d *Detector) Stop() {
+	d.rec.Stop()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+}
+
+// observe adds the garbage bytes of a cycle observed at t to the baseline and
+// reports whether its rate is an anomaly that should be captured.
+func (d *Detector) observe(t time.Time, bytes int64) (Anomaly, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	last := d.last
+	d.last = t
+	if last.IsZero() || !t.After(last) {
+		return Anomaly{}, false
+	}
+	rate := float64(bytes) / t.Sub(last).Seconds()
+
+	a := Anomaly{Time: t, Rate: rate, Baseline: d.base.mean, StdDev: d.base.stdDev()}
+
+	warmup := d.Warmup
+	if warmup <= 0 {
+		warmup = defaultAnomalyWarmup
+	}
+	sensitivity := d.Sensitivity
+	if sensitivity <= 0 {
+		sensitivity = defaultAnomalySensitivity
+	}
+	if d.base.n >= warmup && rate > a.Baseline+sensitivity*a.StdDev {
+		// Keep the anomaly out of the baseline, so a sustained storm is
+		// not learned as normal.
+		cooldown := d.Cooldown
+		if cooldown <= 0 {
+			cooldown = defaultAnomalyCooldown
+		}
+		if !d.captured.IsZero() && t.Sub(d.captured) < cooldown {
+			return a, false
+		}
+		d.captured = t
+		return a, true
+	}
+
+	alpha := d.Alpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = defaultAnomalyAlpha
+	}
+	d.base.add(alpha, rate)
+	return a, false
+}
+
+// capture collects a profile of the anomaly and reports it.
+func (d *Detector) capture(ctx context.Context, a Anomaly) {
+	duration := d.Duration
+	if duration <= 0 {
+		duration = defaultAnomalyDuration
+	}
+
+	p, err := NewCollector(Options{Duration: duration}).Collect(ctx)
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	a.Profile = p
+	if d.OnAnomaly != nil {
+		d.OnAnomaly(a)
+	}
+}
@@ -0,0 +1,44 @@
+package garbage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectorObserve(t *testing.T) {
+	d := &Detector{Warmup: 10, Cooldown: time.Minute}
+	start := time.Unix(0, 0)
+
+	// A steady rate of about 1 MB/s, one cycle a second.
+	now := start
+	for i := 0; i < 20; i++ {
+		now = now.Add(time.Second)
+		if a, ok := d.observe(now, int64(1e6+(i%3)*1e4)); ok {
+			t.Fatalf("cycle %d: unexpected anomaly at rate %v", i, a.Rate)
+		}
+	}
+
+	now = now.Add(time.Second)
+	a, ok := d.observe(now, 5e6)
+	if !ok {
+		t.Fatalf("burst: want anomaly, got none (baseline %v, stddev %v)", a.Baseline, a.StdDev)
+	}
+	if a.Rate != 5e6 || a.Baseline < 0.99e6 || a.Baseline > 1.03e6 {
+		t.Errorf("burst: want rate 5e6 over a baseline near 1e6, got %v over %v", a.Rate, a.Baseline)
+	}
+
+	// A second burst within the cooldown is not captured, and the
+	// bursts are not learned.
+	now = now.Add(time.Second)
+	if _, ok := d.observe(now, 5e6); ok {
+		t.Error("burst within cooldown: want no capture")
+	}
+	if d.base.mean > 1.03e6 {
+		t.Errorf("baseline learned the bursts: %v", d.base.mean)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := d.observe(now, 5e6*60); !ok {
+		t.Error("burst after cooldown: want capture")
+	}
+}
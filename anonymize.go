@@ -0,0 +1,111 @@
+package garbage
+
+import (
+	"path"
+	"strings"
+)
+
+// Anonymize strips the layout of the machine that collected the profile from
+// it, so it can be shared outside the organization: the file of each frame
+// is replaced by its package path and base name, as if the binary were built
+// with -trimpath, and the path of the executable and the host name are
+// omitted from the encodings. Function names and line numbers are kept.
+//
+// The stacks of a collected profile are symbolized by Anonymize, so the
+// profile no longer depends on the running binary.
+func (p *Profile) Anonymize() {
+	p.mapFrames(func(fr Frame) Frame {
+		fr.File = trimFile(fr.Function, fr.File)
+		return fr
+	})
+	p.anonymized = true
+}
+
+// mapFrames replaces each frame of the profile's stacks with f of the frame,
+// symbolizing the stacks of a collected profile.
+func (p *Profile) mapFrames(f func(Frame) Frame) {
+	p.frames = p.symbols(f)
+}
+
+// symbols returns the frames at each address of the profile's stacks, each
+// replaced with f of the frame.
+func (p *Profile) symbols(f func(Frame) Frame) map[uintptr][]Frame {
+	frames := make(map[uintptr][]Frame)
+	add := func(stk []uintptr) {
+		for _, pc := range stk {
+			if _, ok := frames[pc]; ok {
+				continue
+			}
+			var frs []Frame
+			for _, fr := range p.Frames(pc) {
+				frs = append(frs, f(fr))
+			}
+			frames[pc] = frs
+		}
+	}
+
+	for i := range p.Records {
+		add(p.Records[i].Stack())
+	}
+	for i := range p.Suspects {
+		add(p.Suspects[i].Stack())
+	}
+	for i := range p.Survival {
+		add(p.Survival[i].Stack())
+	}
+	for _, b := range p.Bursts {
+		for i := range b.Stacks {
+			add(b.Stacks[i].Stack())
+		}
+	}
+	return frames
+}
+
+// trimFile returns file relative to the import path of the package of
+// function, the form of source paths in binaries built with -trimpath.
+func trimFile(function, file string) string {
+	if file == "" {
+		return ""
+	}
+	base := path.Base(strings.Replace(file, `\`, "/", -1))
+
+	pkg := funcPackage(function)
+	if pkg == "" {
+		return base
+	}
+	return pkg + "/" + base
+}
+
+// funcPackage returns the import path of the package of a fully qualified
+// function name, such as "net/http.(*conn).serve". The linker escapes the
+// dots in the last element of the path, as in "gopkg.in/yaml%2ev3.Unmarshal".
+func funcPackage(function string) string {
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+	return strings.Replace(function[:slash+1+dot], "%2e", ".", -1)
+}
+
+// Anonymize strips the layout of the machine that collected the recording
+// from its symbols, as Profile.Anonymize does, including from the profiles
+// replayed from it.
+func (rec *Recording) Anonymize() {
+	rec.mapFrames(func(fr Frame) Frame {
+		fr.File = trimFile(fr.Function, fr.File)
+		return fr
+	})
+}
+
+// mapFrames replaces each frame of the recording's symbols with f of the
+// frame.
+func (rec *Recording) mapFrames(f func(Frame) Frame) {
+	for pc, frs := range rec.frames {
+		mapped := make([]Frame, len(frs))
+		for i, fr := range frs {
+			mapped[i] = f(fr)
+		}
+		rec.frames[pc] = mapped
+	}
+}
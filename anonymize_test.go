@@ -0,0 +1,53 @@
+package garbage
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestTrimFile(t *testing.T) {
+	tests := []struct {
+		function, file, want string
+	}{
+		{"runtime.mallocgc", "/usr/local/go/src/runtime/malloc.go", "runtime/malloc.go"},
+		{"net/http.(*conn).serve", "/usr/local/go/src/net/http/server.go", "net/http/server.go"},
+		{"github.com/a/b.(*T).m.func1", "/home/alice/src/b/b.go", "github.com/a/b/b.go"},
+		{"gopkg.in/yaml%2ev3.Unmarshal", "/root/go/pkg/mod/gopkg.in/yaml.v3@v3.0.1/yaml.go", "gopkg.in/yaml.v3/yaml.go"},
+		{"main.main", `C:\Users\alice\app\main.go`, "main/main.go"},
+		{"", "/tmp/x.go", "x.go"},
+		{"main.main", "", ""},
+	}
+	for _, test := range tests {
+		if got := trimFile(test.function, test.file); got != test.want {
+			t.Errorf("trimFile(%q, %q): want %q, got %q", test.function, test.file, test.want, got)
+		}
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	var r Record
+	runtime.Callers(1, r.Stack0[:])
+	p := &Profile{Rate: 1, Records: []Record{{Objects: 1, Bytes: 8, Stack0: r.Stack0}}}
+	p.Anonymize()
+
+	var buf bytes.Buffer
+	if err := p.writeText(&buf, textOptions{debug: 1}); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	if !strings.Contains(text, "github.com/benburkert/pprof-garbage/anonymize_test.go:") {
+		t.Errorf("text profile missing trimmed test file:\n%s", text)
+	}
+	wd, _ := os.Getwd()
+	if strings.Contains(text, wd) {
+		t.Errorf("text profile contains working directory %q:\n%s", wd, text)
+	}
+
+	exe, _ := os.Executable()
+	if bytes.Contains(p.encode(), []byte(exe)) {
+		t.Errorf("proto profile contains executable path %q", exe)
+	}
+}
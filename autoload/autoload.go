@@ -0,0 +1,119 @@
+// Package autoload profiles the garbage of a program for its whole lifetime
+// when the program is run by pprof-garbage run. A program opts in by
+// importing the package for its side effect:
+//
+//	import _ "github.com/benburkert/pprof-garbage/autoload"
+//
+// Unless the PPROF_GARBAGE environment variable is set, importing the package
+// does nothing. The variable holds comma-separated settings, as GODEBUG does:
+//
+//	PPROF_GARBAGE=dir=/tmp/garbage,window=10s
+//
+// If dir is set, the program collects garbage profiles back to back, each
+// over the window (30s if unset), and writes each as a gzip-compressed
+// protocol buffer to a file in dir named for the time its window opened. The
+// profile of the window open when the program exits is lost, so shorter
+// windows lose less of a short-lived program.
+package autoload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// EnvVar is the environment variable holding the settings of the profiling.
+const EnvVar = "PPROF_GARBAGE"
+
+// defaultWindow is the collection window of each profile if none is set.
+const defaultWindow = 30 * time.Second
+
+// config are the settings of the profiling.
+type config struct {
+	dir    string
+	window time.Duration
+}
+
+func init() {
+	v := os.Getenv(EnvVar)
+	if v == "" {
+		return
+	}
+	cfg, err := parseConfig(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pprof-garbage/autoload: %v\n", err)
+		return
+	}
+	if cfg.dir == "" {
+		return
+	}
+	go cfg.run()
+}
+
+// parseConfig parses the settings of the profiling from the value of
+// EnvVar. Unknown settings are ignored, as GODEBUG ignores them.
+func parseConfig(v string) (config, error) {
+	cfg := config{window: defaultWindow}
+	for _, kv := range strings.Split(v, ",") {
+		f := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(f) != 2 {
+			continue
+		}
+		switch f[0] {
+		case "dir":
+			cfg.dir = f[1]
+		case "window":
+			d, err := time.ParseDuration(f[1])
+			if err != nil || d <= 0 {
+				return cfg, fmt.Errorf("invalid %s window %q", EnvVar, f[1])
+			}
+			cfg.window = d
+		}
+	}
+	return cfg, nil
+}
+
+// run collects profiles back to back, writing each to the directory, for
+// the life of the process.
+func (cfg config) run() {
+	if err := os.MkdirAll(cfg.dir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "pprof-garbage/autoload: %v\n", err)
+		return
+	}
+	c := garbage.NewCollector(garbage.Options{Duration: cfg.window})
+	for {
+		p, err := c.Collect(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pprof-garbage/autoload: %v\n", err)
+			return
+		}
+		if err := cfg.write(p); err != nil {
+			fmt.Fprintf(os.Stderr, "pprof-garbage/autoload: %v\n", err)
+		}
+	}
+}
+
+// write writes p to a file of the directory named for the time its window
+// opened, atomically, so readers never see a partial profile.
+func (cfg config) write(p *garbage.Profile) error {
+	name := fmt.Sprintf("garbage-%d.pb.gz", p.Start.UnixNano())
+	f, err := os.CreateTemp(cfg.dir, "."+name)
+	if err != nil {
+		return err
+	}
+	if _, err := p.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(cfg.dir, name))
+}
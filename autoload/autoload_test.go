@@ -0,0 +1,32 @@
+package autoload
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		v    string
+		want config
+		err  bool
+	}{
+		{"dir=/tmp/g", config{dir: "/tmp/g", window: defaultWindow}, false},
+		{"dir=/tmp/g,window=5s", config{dir: "/tmp/g", window: 5 * time.Second}, false},
+		{"window=5s, dir=/tmp/g,debug=1", config{dir: "/tmp/g", window: 5 * time.Second}, false},
+		{"dir=/tmp/g,window=soon", config{}, true},
+		{"dir=/tmp/g,window=-1s", config{}, true},
+	}
+	for _, test := range tests {
+		cfg, err := parseConfig(test.v)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: want error", test.v)
+			}
+			continue
+		}
+		if err != nil || cfg != test.want {
+			t.Errorf("%q: want %+v, got %+v, %v", test.v, test.want, cfg, err)
+		}
+	}
+}
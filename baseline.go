@@ -0,0 +1,168 @@
+package garbage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// baselineComment marks a profile from which the garbage of a baseline was
+// subtracted.
+const baselineComment = "baseline: steady-state garbage subtracted"
+
+// Subtract returns a copy of p without the steady-state garbage of base, such
+// as a profile of the service at rest: the garbage rate of each stack of base
+// over its window is subtracted from the same stack of p over p's window, so
+// that only the garbage beyond the baseline remains. Stacks are matched by
+// their symbolized frames, so base may come from an earlier run of the
+// binary. Stacks left with no garbage are dropped. The values of the copy are
+// estimates of all allocations.
+func (p *Profile) Subtract(base *Profile) *Profile {
+	// The garbage of each stack of base over p's window.
+	f := 1.0
+	if !base.perSecond && base.Duration > 0 {
+		f /= base.Duration.Seconds()
+	}
+	if !p.perSecond && (base.perSecond || base.Duration > 0) {
+		f *= p.Duration.Seconds()
+	}
+	steady := make(map[string]Record)
+	for _, r := range base.Records {
+		r = base.weigh(r, f)
+		k := base.stackKey(r.Stack())
+		s := steady[k]
+		s.Objects += r.Objects
+		s.Bytes += r.Bytes
+		steady[k] = s
+	}
+
+	q := *p
+	q.Records = nil
+	q.scaled, q.baselined = true, true
+	for _, r := range p.Records {
+		r = p.weigh(r, 1)
+		s := steady[p.stackKey(r.Stack())]
+		objects, bytes := r.Objects-s.Objects, r.Bytes-s.Bytes
+		if objects <= 0 || bytes <= 0 {
+			continue
+		}
+		// Scale the ages and sizes with the objects left.
+		r = q.weigh(r, float64(objects)/float64(r.Objects))
+		r.Objects, r.Bytes = objects, bytes
+		q.Records = append(q.Records, r)
+	}
+	return &q
+}
+
+// stackKey identifies stk in p by its symbolized frames, or by the address
+// of each frame that is not symbolized.
+func (p *Profile) stackKey(stk []uintptr) string {
+	var b strings.Builder
+	for _, pc := range stk {
+		frames := p.Frames(pc)
+		if len(frames) == 0 {
+			fmt.Fprintf(&b, "%#x\n", pc)
+		}
+		for _, fr := range frames {
+			fmt.Fprintf(&b, "%s %s:%d\n", fr.Function, fr.File, fr.Line)
+		}
+	}
+	return b.String()
+}
+
+// baselineTimeout bounds the fetch of a baseline by URL.
+const baselineTimeout = 30 * time.Second
+
+// baselineClient fetches baselines by URL.
+var baselineClient = &http.Client{Timeout: baselineTimeout}
+
+// readBaseline reads the profile at src, a file name or an http or https URL
+// fetched within ctx.
+func readBaseline(ctx context.Context, src string) (*Profile, error) {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		req, err := http.NewRequestWithContext(ctx, "GET", src, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := baselineClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: %s", src, resp.Status)
+		}
+		return Parse(resp.Body)
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// A baselineEntry is a baseline profile read, or being read.
+type baselineEntry struct {
+	done chan struct{} // closed once read
+	p    *Profile
+	err  error
+}
+
+// baselines caches the baseline profiles of handlers by file name or URL, so
+// each is read once, by the first request for it; the others wait for it.
+var baselines struct {
+	sync.Mutex
+	m map[string]*baselineEntry
+}
+
+// baseline returns the baseline profile of the handler, reading it within
+// ctx on first use. A baseline that fails to read is read again by the next
+// request. Without a Baseline, it is the DeployBaseline, once captured.
+func (h *Handler) baseline(ctx context.Context) (*Profile, error) {
+	if h.Baseline == "" {
+		if h.DeployBaseline != nil {
+			if p := h.DeployBaseline.Profile(); p != nil {
+				return p, nil
+			}
+		}
+		return nil, errors.New("garbage: baseline not yet captured")
+	}
+
+	baselines.Lock()
+	e, ok := baselines.m[h.Baseline]
+	if !ok {
+		e = &baselineEntry{done: make(chan struct{})}
+		if baselines.m == nil {
+			baselines.m = make(map[string]*baselineEntry)
+		}
+		baselines.m[h.Baseline] = e
+	}
+	baselines.Unlock()
+
+	if !ok {
+		e.p, e.err = readBaseline(ctx, h.Baseline)
+		if e.err != nil {
+			baselines.Lock()
+			delete(baselines.m, h.Baseline)
+			baselines.Unlock()
+		}
+		close(e.done)
+	}
+
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("garbage: baseline: %v", ctx.Err())
+	}
+	if e.err != nil {
+		return nil, fmt.Errorf("garbage: baseline: %v", e.err)
+	}
+	return e.p, nil
+}
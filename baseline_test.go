@@ -0,0 +1,153 @@
+package garbage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubtract(t *testing.T) {
+	stack := func(pcs ...uintptr) (stk [32]uintptr) {
+		copy(stk[:], pcs)
+		return stk
+	}
+	frames := func(base uintptr) map[uintptr][]Frame {
+		return map[uintptr][]Frame{
+			base + 0x10: {{Function: "main.decode", File: "/src/main.go", Line: 12}},
+			base + 0x20: {{Function: "main.pad", File: "/src/main.go", Line: 18}},
+			base + 0x30: {{Function: "main.main", File: "/src/main.go", Line: 30}},
+		}
+	}
+
+	p := &Profile{
+		Duration: 10 * time.Second,
+		Records: []Record{
+			{Objects: 300, Bytes: 300 << 10, Cycles: 3, Ages: Ages{SameCycle: 300}, Stack0: stack(0x10, 0x30)},
+			{Objects: 10, Bytes: 10 << 10, Cycles: 1, Stack0: stack(0x20, 0x30)},
+		},
+		frames: frames(0),
+		scaled: true,
+	}
+	// The baseline is of another run of the binary, at other addresses,
+	// over a window twice as long.
+	base := &Profile{
+		Duration: 20 * time.Second,
+		Records: []Record{
+			{Objects: 200, Bytes: 200 << 10, Stack0: stack(0x1010, 0x1030)},
+			{Objects: 40, Bytes: 40 << 10, Stack0: stack(0x1020, 0x1030)},
+		},
+		frames: frames(0x1000),
+		scaled: true,
+	}
+
+	q := p.Subtract(base)
+	if len(q.Records) != 1 {
+		t.Fatalf("want 1 record, got %+v", q.Records)
+	}
+	r := q.Records[0]
+	if r.Objects != 200 || r.Bytes != 200<<10 || r.Ages.SameCycle != 200 {
+		t.Errorf("want 200 objects of 200KiB left, got %+v", r)
+	}
+	if len(p.Records) != 2 {
+		t.Error("Subtract modified the profile")
+	}
+
+	text, err := q.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "# "+baselineComment+"\n") {
+		t.Errorf("missing baseline marker:\n%s", text)
+	}
+	if r, err := Parse(bytes.NewReader(q.encode())); err != nil || !r.baselined {
+		t.Errorf("baseline marker not parsed back: %v", err)
+	}
+}
+
+func TestHandlerBaseline(t *testing.T) {
+	requireEnabled(t)
+
+	name := filepath.Join(t.TempDir(), "base.pb.gz")
+	if err := os.WriteFile(name, goldenProfile().encode(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Handler{Baseline: name}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/debug/pprof/garbage?seconds=0.1&debug=1&baseline=1", nil))
+	if !strings.Contains(w.Body.String(), "# "+baselineComment+"\n") {
+		t.Errorf("missing baseline marker:\n%s", w.Body)
+	}
+
+	h = &Handler{Baseline: filepath.Join(t.TempDir(), "missing.pb.gz")}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/debug/pprof/garbage?seconds=0.1&baseline=1", nil))
+	if w.Code != 500 {
+		t.Errorf("want status 500 for a missing baseline, got %d", w.Code)
+	}
+}
+
+func TestBaselineFetch(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Write(goldenProfile().encode())
+	}))
+	defer srv.Close()
+
+	// A request gives up on a slow baseline with its context, and a
+	// baseline of another handler is read meanwhile.
+	slow := &Handler{Baseline: srv.URL + "/slow"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := slow.baseline(ctx)
+		done <- err
+	}()
+
+	name := filepath.Join(t.TempDir(), "base.pb.gz")
+	if err := os.WriteFile(name, goldenProfile().encode(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Handler{Baseline: name}).baseline(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err == nil {
+		t.Fatal("want an error for a baseline fetch past the request's deadline")
+	}
+
+	// Concurrent requests for a baseline fetch it once.
+	h := &Handler{Baseline: srv.URL + "/shared"}
+	atomic.StoreInt32(&fetches, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := h.baseline(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("want 1 fetch of a shared baseline, got %d", n)
+	}
+}
@@ -0,0 +1,154 @@
+package garbage
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// A bundle is a one-shot incident artifact: a zip of the profile, the
+// profiles of its sub-intervals if any, the heap profiles at the start and end
+// of its window, a goroutine dump and the metadata of the collection.
+type bundle struct {
+	startHeap []byte // heap profile when the window opened
+}
+
+// bundleMetadata is the metadata.json file of a bundle.
+type bundleMetadata struct {
+	Kind      string    `json:"kind"`
+	Start     time.Time `json:"start"`
+	Duration  int64     `json:"duration_ns"`
+	Rate      int       `json:"rate"`
+	Truncated bool      `json:"truncated"`
+	Degraded  bool      `json:"degraded,omitempty"`
+	PerSecond bool      `json:"per_second,omitempty"`
+	Stride    float64   `json:"stride,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	Cycles    int       `json:"cycles"`
+	Hostname  string    `json:"hostname,omitempty"`
+	GoVersion string    `json:"go_version"`
+	GOOS      string    `json:"goos"`
+	GOARCH    string    `json:"goarch"`
+	NumCPU    int       `json:"num_cpu"`
+	Files     []string  `json:"files"`
+
+	Intervals []bundleInterval `json:"intervals,omitempty"`
+}
+
+// bundleInterval is the metadata of the profile of a sub-interval of the
+// window.
+type bundleInterval struct {
+	File     string    `json:"file"`
+	Start    time.Time `json:"start"`
+	Duration int64     `json:"duration_ns"`
+	Cycles   int       `json:"cycles"`
+	Burst    bool      `json:"burst,omitempty"`
+	Phase    string    `json:"phase,omitempty"`
+}
+
+// A bundleFile is a file of a bundle and the function writing it.
+type bundleFile struct {
+	name  string
+	write func(io.Writer) error
+}
+
+// open captures the heap profile at the start of the window.
+func (b *bundle) open() {
+	var buf bytes.Buffer
+	pprof.Lookup("heap").WriteTo(&buf, 0)
+	b.startHeap = buf.Bytes()
+}
+
+// WriteBundle writes p to w as a bundle: a zip of the profile, the profiles
+// of its Intervals, such as the phases of a ManualCollector, the heap profile
+// and a goroutine dump at the time of the call, and a metadata.json file, as
+// a single artifact of the collection.
+func (p *Profile) WriteBundle(w io.Writer) error {
+	var b bundle
+	return b.write(w, p)
+}
+
+// write writes the bundle of p to w, capturing the end heap profile and the
+// goroutine dump.
+func (b *bundle) write(w io.Writer, p *Profile) error {
+	kind := p.kind()
+	files := []bundleFile{
+		{kind + ".pb.gz", func(w io.Writer) error { _, err := p.WriteTo(w); return err }},
+		{"heap-start.pb.gz", func(w io.Writer) error { _, err := w.Write(b.startHeap); return err }},
+		{"heap-end.pb.gz", func(w io.Writer) error { return pprof.Lookup("heap").WriteTo(w, 0) }},
+		{"goroutines.txt", func(w io.Writer) error { return pprof.Lookup("goroutine").WriteTo(w, 2) }},
+	}
+	switch {
+	case p.anonymized || p.redacted:
+		// The runtime's profiles and dumps hold every path and name.
+		files = files[:1]
+	case b.startHeap == nil:
+		// The collection was cancelled before its window opened.
+		files = append(files[:1], files[2:]...)
+	}
+
+	var intervals []bundleInterval
+	for i, part := range p.Intervals {
+		part := part
+		name := fmt.Sprintf("%s-%02d.pb.gz", kind, i+1)
+		files = append(files, bundleFile{name, func(w io.Writer) error { _, err := part.WriteTo(w); return err }})
+		intervals = append(intervals, bundleInterval{
+			File:     name,
+			Start:    part.Start,
+			Duration: int64(part.Duration),
+			Cycles:   len(part.Cycles),
+			Burst:    part.isolatedBurst,
+			Phase:    part.Labels[PhaseLabel],
+		})
+	}
+
+	meta := bundleMetadata{
+		Kind:      kind,
+		Start:     p.Start,
+		Duration:  int64(p.Duration),
+		Rate:      p.Rate,
+		Truncated: p.Truncated,
+		Degraded:  p.Degraded,
+		PerSecond: p.perSecond,
+		Stride:    p.Stride,
+		TraceID:   p.TraceID,
+		Cycles:    len(p.Cycles),
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		NumCPU:    runtime.NumCPU(),
+		Intervals: intervals,
+	}
+	if !p.anonymized {
+		meta.Hostname, _ = os.Hostname()
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if err := f.write(fw); err != nil {
+			return err
+		}
+		meta.Files = append(meta.Files, f.name)
+	}
+
+	fw, err := zw.Create("metadata.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(meta); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,100 @@
+package garbage
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerBundle(t *testing.T) {
+	requireEnabled(t)
+
+	rec := httptest.NewRecorder()
+	new(Handler).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/garbage/bundle?seconds=0.2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want code %d, got %d", http.StatusOK, rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("want Content-Type application/zip, got %q", ct)
+	}
+
+	body := rec.Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	for _, name := range []string{"garbage.pb.gz", "heap-start.pb.gz", "heap-end.pb.gz", "goroutines.txt", "metadata.json"} {
+		if files[name] == nil {
+			t.Errorf("bundle is missing %s", name)
+		}
+	}
+
+	rc, err := files["metadata.json"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var meta bundleMetadata
+	if err := json.NewDecoder(rc).Decode(&meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Kind != garbageKind || len(meta.Files) != 4 || meta.GoVersion == "" {
+		t.Errorf("bad metadata: %+v", meta)
+	}
+}
+
+func TestHandlerBundleIntervals(t *testing.T) {
+	requireEnabled(t)
+
+	rec := httptest.NewRecorder()
+	new(Handler).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/garbage?seconds=0.3&intervals=3", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Fatalf("want Content-Type application/zip, got %q", ct)
+	}
+
+	body := rec.Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var meta bundleMetadata
+	for _, f := range zr.File {
+		if f.Name != "metadata.json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(rc).Decode(&meta)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(meta.Intervals) != 3 {
+		t.Fatalf("want 3 intervals, got %+v", meta.Intervals)
+	}
+	for i, iv := range meta.Intervals {
+		if i > 0 && iv.Start.Before(meta.Intervals[i-1].Start) {
+			t.Errorf("interval %d starts before the one before it", i)
+		}
+		if iv.File != fmt.Sprintf("garbage-%02d.pb.gz", i+1) || iv.Duration <= 0 {
+			t.Errorf("bad interval %d: %+v", i, iv)
+		}
+	}
+	if len(meta.Files) != 7 {
+		t.Errorf("want 7 files, got %v", meta.Files)
+	}
+}
@@ -0,0 +1,178 @@
+package garbage
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// burstFactor is how many times the median per-cycle garbage rate of
+	// the window a cycle's rate must reach to be part of a burst.
+	burstFactor = 2
+
+	// burstMinCycles is the fewest cycles in a window for a median rate.
+	burstMinCycles = 4
+
+	// burstTopStacks is the number of stacks kept per cycle, and reported
+	// per burst.
+	burstTopStacks = 10
+	burstStacks    = 3
+)
+
+// A Burst is an interval of a collection window in which the garbage rate of
+// consecutive GC cycles reached twice the median rate of the window's cycles.
+type Burst struct {
+	Start, End time.Time // from the cycle before the burst to its last cycle
+	Cycles     int       // GC cycles in the burst
+	Rate       float64   // garbage bytes per second in the burst, as sampled
+	Median     float64   // median per-cycle rate of the window
+
+	// Stacks are the allocation stacks responsible for the increase: those
+	// with the most garbage in the burst beyond their share of the window,
+	// the most first. Their values are their garbage in the burst.
+	Stacks []Record
+}
+
+// topRecords returns the n records of recs with the most bytes, the most
+// first.
+func topRecords(recs []Record, n int) []Record {
+	top := append([]Record(nil), recs...)
+	sort.Slice(top, func(i, j int) bool { return top[i].Bytes > top[j].Bytes })
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// findBursts finds the bursts of a collected profile's cycles, once its
+// window is set.
+func (p *Profile) findBursts() []Burst {
+	cycles, tops := p.Cycles, p.tops
+	if p.kind() != garbageKind || len(cycles) < burstMinCycles || len(tops) != len(cycles) {
+		return nil
+	}
+
+	// The rate of a cycle is over the time since the cycle before it, or
+	// since the window opened.
+	rates := make([]float64, len(cycles))
+	since := p.Start
+	for i, c := range cycles {
+		if d := c.Time.Sub(since); d > 0 {
+			rates[i] = float64(c.Bytes) / d.Seconds()
+		}
+		since = c.Time
+	}
+
+	sorted := append([]float64(nil), rates...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+	if median <= 0 {
+		return nil
+	}
+
+	var bursts []Burst
+	for i := 0; i < len(cycles); {
+		if rates[i] < burstFactor*median {
+			i++
+			continue
+		}
+		j := i
+		for j < len(cycles) && rates[j] >= burstFactor*median {
+			j++
+		}
+		bursts = append(bursts, p.burst(cycles, tops, i, j, median))
+		i = j
+	}
+	return bursts
+}
+
+// burst returns the burst of cycles[i:j].
+func (p *Profile) burst(cycles []Cycle, tops [][]Record, i, j int, median float64) Burst {
+	b := Burst{End: cycles[j-1].Time, Cycles: j - i, Median: median, Start: p.Start}
+	if i > 0 {
+		b.Start = cycles[i-1].Time
+	}
+
+	var bytes int64
+	var inBurst []Record
+	for k := i; k < j; k++ {
+		bytes += cycles[k].Bytes
+		for _, r := range tops[k] {
+			inBurst = merge(inBurst, r)
+		}
+	}
+	if d := b.End.Sub(b.Start); d > 0 {
+		b.Rate = float64(bytes) / d.Seconds()
+	}
+
+	// The share of a stack is its garbage over the window spread evenly
+	// over the cycles.
+	share := make(map[[32]uintptr]float64)
+	for _, r := range p.Records {
+		share[r.Stack0] = float64(r.Bytes) * float64(b.Cycles) / float64(len(cycles))
+	}
+	excess := func(r Record) float64 { return float64(r.Bytes) - share[r.Stack0] }
+	sort.Slice(inBurst, func(x, y int) bool { return excess(inBurst[x]) > excess(inBurst[y]) })
+	for _, r := range inBurst {
+		if len(b.Stacks) == burstStacks || excess(r) <= 0 {
+			break
+		}
+		b.Stacks = append(b.Stacks, r)
+	}
+	return b
+}
+
+// burstComment is the profile.proto comment annotating b.
+func (p *Profile) burstComment(b Burst) string {
+	var fns []string
+	for i := range b.Stacks {
+		fns = append(fns, p.site(b.Stacks[i].Stack()))
+	}
+	return fmt.Sprintf("burst: +%v to +%v, %d cycles at %.1fx the median garbage rate: %s",
+		b.Start.Sub(p.Start).Round(time.Millisecond), b.End.Sub(p.Start).Round(time.Millisecond),
+		b.Cycles, b.Rate/b.Median, strings.Join(fns, ", "))
+}
+
+// site returns the function of the first frame of stk outside the runtime,
+// symbolized as the profile's stacks are.
+func (p *Profile) site(stk []uintptr) string {
+	return p.siteFrame(stk).Function
+}
+
+// siteFrame returns the first frame of stk outside the runtime, symbolized as
+// the profile's stacks are.
+func (p *Profile) siteFrame(stk []uintptr) Frame {
+	for _, pc := range stk {
+		for _, fr := range p.Frames(pc) {
+			if !strings.HasPrefix(fr.Function, "runtime.") {
+				return fr
+			}
+		}
+	}
+	return Frame{Function: siteFunction(stk)}
+}
+
+// printBursts prints the bursts and the stacks responsible.
+func (p *Profile) printBursts(w io.Writer) {
+	fmt.Fprintf(w, "\n# bursts: cycles at %dx the median garbage rate or more\n", burstFactor)
+	for _, b := range p.Bursts {
+		fmt.Fprintf(w, "# +%v to +%v: %d cycles at %.1fx the median rate\n",
+			b.Start.Sub(p.Start).Round(time.Millisecond), b.End.Sub(p.Start).Round(time.Millisecond),
+			b.Cycles, b.Rate/b.Median)
+		for i := range b.Stacks {
+			r := &b.Stacks[i]
+			fmt.Fprintf(w, "# %d: %d [%d: %d] @", r.Objects, r.Bytes, r.Objects, r.Bytes)
+			for _, pc := range r.Stack() {
+				fmt.Fprintf(w, " %#x", pc)
+			}
+			fmt.Fprintf(w, "\n")
+			p.printStack(w, r.Stack())
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package garbage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindBursts(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	p := &Profile{Start: start, Duration: 8 * time.Second}
+	for i := 0; i < 8; i++ {
+		steady := testRecord(1, 62, 1000)
+		top := []Record{steady}
+		if i == 4 || i == 5 {
+			top = append(top, testRecord(2, 250, 4000)) // the burst
+		}
+		var c Cycle
+		c.Time = start.Add(time.Duration(i+1) * time.Second)
+		for _, r := range top {
+			c.Bytes += r.Bytes
+			p.Records = merge(p.Records, r)
+		}
+		p.Cycles = append(p.Cycles, c)
+		p.tops = append(p.tops, top)
+	}
+
+	bursts := p.findBursts()
+	if len(bursts) != 1 {
+		t.Fatalf("want 1 burst, got %+v", bursts)
+	}
+	b := bursts[0]
+	if b.Cycles != 2 || !b.Start.Equal(start.Add(4*time.Second)) || !b.End.Equal(start.Add(6*time.Second)) {
+		t.Errorf("want cycles 5 and 6, got %d cycles from %v to %v", b.Cycles, b.Start, b.End)
+	}
+	if b.Median != 1000 || b.Rate != 5000 {
+		t.Errorf("want rate 5000 over median 1000, got %v over %v", b.Rate, b.Median)
+	}
+	if len(b.Stacks) != 1 || b.Stacks[0].Stack0[0] != 2 || b.Stacks[0].Bytes != 8000 {
+		t.Errorf("want stack 2 responsible, got %+v", b.Stacks)
+	}
+
+	p.Bursts = bursts
+	var buf bytes.Buffer
+	if err := p.writeText(&buf, textOptions{debug: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "# +4s to +6s: 2 cycles at 5.0x the median rate") {
+		t.Errorf("burst missing from text:\n%s", buf.String())
+	}
+	if c := p.burstComment(b); !strings.HasPrefix(c, "burst: +4s to +6s, 2 cycles at 5.0x the median garbage rate: ") {
+		t.Errorf("bad comment %q", c)
+	}
+
+	// A steady rate has no bursts.
+	p.tops[4], p.tops[5] = p.tops[0], p.tops[0]
+	p.Cycles[4].Bytes, p.Cycles[5].Bytes = 1000, 1000
+	if bursts := p.findBursts(); len(bursts) != 0 {
+		t.Errorf("want no bursts at a steady rate, got %+v", bursts)
+	}
+}
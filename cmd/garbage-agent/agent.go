@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// reloadPoll is how often the agent checks its configuration file for
+// changes.
+const reloadPoll = 5 * time.Second
+
+// An agent profiles its targets on their schedules and writes the profiles
+// to its sinks.
+type agent struct {
+	file string // configuration file
+
+	mu      sync.Mutex
+	cfg     *config
+	ready   bool                     // whether the targets are running
+	history map[string][]scrape      // recent scrapes of each target, oldest first
+	counts  map[string]*scrapeCounts // scrapes of each target
+	reloads scrapeCounts             // configuration reloads
+}
+
+// scrapeCounts count successes and failures.
+type scrapeCounts struct {
+	successes, failures uint64
+}
+
+func (c *scrapeCounts) add(err error) {
+	if err != nil {
+		c.failures++
+	} else {
+		c.successes++
+	}
+}
+
+// A scrape is the result of profiling a target once.
+type scrape struct {
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration_ns"`
+	Bytes    int           `json:"bytes"`
+	Error    string        `json:"error,omitempty"`
+}
+
+func newAgent(file string, cfg *config) *agent {
+	return &agent{
+		file:    file,
+		cfg:     cfg,
+		history: make(map[string][]scrape),
+		counts:  make(map[string]*scrapeCounts),
+	}
+}
+
+// target is a target with the global settings applied.
+type target struct {
+	name   string
+	url    string // empty for the agent's own process
+	window time.Duration
+	every  time.Duration
+	labels map[string]string
+	sinks  []sink
+
+	// sinkConfigs are the configurations of the sinks, so that a reload
+	// can tell whether the target changed.
+	sinkConfigs []sinkConfig
+}
+
+// same reports whether t and u profile the same target the same way.
+func (t *target) same(u *target) bool {
+	return t.name == u.name && t.url == u.url && t.window == u.window && t.every == u.every &&
+		reflect.DeepEqual(t.labels, u.labels) && reflect.DeepEqual(t.sinkConfigs, u.sinkConfigs)
+}
+
+// targets returns the targets of a configuration.
+func targets(cfg *config) ([]*target, error) {
+	tcs := cfg.Targets
+	if cfg.Self {
+		tcs = append([]targetConfig{{Name: "self"}}, tcs...)
+	}
+
+	var ts []*target
+	for _, tc := range tcs {
+		t := &target{
+			name:   tc.Name,
+			url:    tc.URL,
+			window: time.Duration(cfg.Window),
+			every:  time.Duration(cfg.Every),
+			labels: make(map[string]string),
+		}
+		if tc.Window > 0 {
+			t.window = time.Duration(tc.Window)
+		}
+		if tc.Every > 0 {
+			t.every = time.Duration(tc.Every)
+		}
+		for k, v := range cfg.Labels {
+			t.labels[k] = v
+		}
+		for k, v := range tc.Labels {
+			t.labels[k] = v
+		}
+
+		for _, sc := range cfg.Sinks {
+			s, err := newSink(sc, t)
+			if err != nil {
+				return nil, err
+			}
+			t.sinks = append(t.sinks, s)
+		}
+		t.sinkConfigs = cfg.Sinks
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// A running target is a target being profiled by its own goroutine.
+type running struct {
+	*target
+	cancel func()
+	done   chan struct{}
+}
+
+// run profiles the targets until ctx is done, reloading the configuration
+// when reload receives or the file changes.
+func (a *agent) run(ctx context.Context, reload <-chan os.Signal) error {
+	ts, err := targets(a.cfg)
+	if err != nil {
+		return err
+	}
+
+	live := make(map[string]*running)
+	defer func() {
+		for _, r := range live {
+			r.cancel()
+			<-r.done
+		}
+	}()
+	a.apply(ctx, live, ts)
+
+	a.mu.Lock()
+	a.ready = true
+	a.mu.Unlock()
+
+	sdNotify("READY=1\nSTATUS=profiling " + strconv.Itoa(len(ts)) + " targets")
+	defer sdNotify("STOPPING=1")
+	if interval := sdWatchdog(); interval > 0 {
+		go pingWatchdog(ctx, interval)
+	}
+
+	modTime := a.modTime()
+	ticker := time.NewTicker(reloadPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-reload:
+		case <-ticker.C:
+			if mt := a.modTime(); mt.Equal(modTime) {
+				continue
+			}
+		}
+		modTime = a.modTime()
+
+		cfg, err := loadConfig(a.file)
+		if err == nil {
+			ts, err = targets(cfg)
+		}
+		a.mu.Lock()
+		a.reloads.add(err)
+		a.mu.Unlock()
+		if err != nil {
+			log.Printf("reload: %v; keeping the running configuration", err)
+			continue
+		}
+
+		a.mu.Lock()
+		a.cfg = cfg
+		a.mu.Unlock()
+		a.apply(ctx, live, ts)
+		log.Printf("reloaded %s", a.file)
+		sdNotify("STATUS=profiling " + strconv.Itoa(len(ts)) + " targets")
+	}
+}
+
+// apply profiles the targets ts, stopping the running targets that are
+// gone or changed and starting the new or changed ones. Unchanged targets
+// keep running undisturbed, and the history of every target is kept.
+func (a *agent) apply(ctx context.Context, live map[string]*running, ts []*target) {
+	next := make(map[string]*target)
+	for _, t := range ts {
+		next[t.name] = t
+	}
+
+	for name, r := range live {
+		if t, ok := next[name]; !ok || !r.same(t) {
+			r.cancel()
+			<-r.done
+			delete(live, name)
+		}
+	}
+
+	for _, t := range ts {
+		if _, ok := live[t.name]; ok {
+			continue
+		}
+		tctx, cancel := context.WithCancel(ctx)
+		r := &running{target: t, cancel: cancel, done: make(chan struct{})}
+		live[t.name] = r
+		go func() {
+			defer close(r.done)
+			a.loop(tctx, r.target)
+		}()
+	}
+}
+
+// modTime returns the modification time of the configuration file.
+func (a *agent) modTime() time.Time {
+	fi, err := os.Stat(a.file)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// loop profiles t every t.every, or back to back, until ctx is done.
+func (a *agent) loop(ctx context.Context, t *target) {
+	for {
+		start := time.Now()
+		body, err := t.profile(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			for _, s := range t.sinks {
+				if serr := s.write(ctx, start, body); serr != nil {
+					err = serr
+				}
+			}
+		}
+		a.record(t.name, start, len(body), err)
+
+		wait := t.every
+		if err != nil && wait < t.window {
+			// Do not retry an unreachable target back to back.
+			wait = t.window
+		}
+		timer := time.NewTimer(time.Until(start.Add(wait)))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// record adds a scrape of the named target to its history.
+func (a *agent) record(name string, start time.Time, n int, err error) {
+	s := scrape{Time: start, Duration: time.Since(start), Bytes: n}
+	if err != nil {
+		s.Error = err.Error()
+		log.Printf("%s: %v", name, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c, ok := a.counts[name]
+	if !ok {
+		c = new(scrapeCounts)
+		a.counts[name] = c
+	}
+	c.add(err)
+
+	h := append(a.history[name], s)
+	if n := a.cfg.History; len(h) > n {
+		h = h[len(h)-n:]
+	}
+	a.history[name] = h
+}
+
+// profile collects a profile of the target, encoded as a gzip-compressed
+// protocol buffer, with the labels of the target added to it.
+func (t *target) profile(ctx context.Context) ([]byte, error) {
+	if t.url == "" {
+		p, err := garbage.NewCollector(garbage.Options{Duration: t.window, Labels: t.labels}).Collect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		_, err = p.WriteTo(&buf)
+		return buf.Bytes(), err
+	}
+
+	u, err := url.Parse(t.url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("seconds", strconv.FormatFloat(t.window.Seconds(), 'f', -1, 64))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", t.url, res.Status)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil || len(t.labels) == 0 {
+		return body, err
+	}
+	return relabel(body, t.labels)
+}
+
+// relabel adds labels to the encoded profile body, replacing those of the
+// same keys.
+func relabel(body []byte, labels map[string]string) ([]byte, error) {
+	p, err := garbage.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]string, len(p.Labels)+len(labels))
+	for k, v := range p.Labels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	p.Labels = merged
+
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// A sink is a destination for the profiles of a target.
+type sink interface {
+	write(ctx context.Context, start time.Time, body []byte) error
+}
+
+func newSink(sc sinkConfig, t *target) (sink, error) {
+	switch sc.Type {
+	case "dir":
+		return &dirSink{dir: sc.Path, target: t.name}, nil
+	case "http":
+		return newHTTPSink(sc, t)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", sc.Type)
+}
+
+// A dirSink writes each profile to a file of the directory named for the
+// target and the start of the collection.
+type dirSink struct {
+	dir    string
+	target string
+}
+
+func (s *dirSink) write(ctx context.Context, start time.Time, body []byte) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.pb.gz", fileSafe(s.target), start.UTC().Format("20060102T150405.000Z"))
+	tmp := filepath.Join(s.dir, "."+name)
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, name))
+}
+
+// fileSafe replaces the characters of name that are unsafe in file names.
+func fileSafe(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// An httpSink POSTs each profile to an endpoint, with the target and its
+// labels as query parameters.
+type httpSink struct {
+	pusher *garbage.Pusher
+}
+
+func newHTTPSink(sc sinkConfig, t *target) (*httpSink, error) {
+	u, err := url.Parse(sc.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("target", t.name)
+	keys := make([]string, 0, len(t.labels))
+	for k := range t.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		q.Set(k, t.labels[k])
+	}
+	u.RawQuery = q.Encode()
+
+	p := &garbage.Pusher{URL: u.String()}
+	if sc.Cert != "" || sc.Key != "" {
+		cert, err := tls.LoadX509KeyPair(sc.Cert, sc.Key)
+		if err != nil {
+			return nil, err
+		}
+		p.Certificates = []tls.Certificate{cert}
+	}
+	if sc.CA != "" {
+		pem, err := os.ReadFile(sc.CA)
+		if err != nil {
+			return nil, err
+		}
+		p.RootCAs = x509.NewCertPool()
+		if !p.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no CA certificates", sc.CA)
+		}
+	}
+	return &httpSink{pusher: p}, nil
+}
+
+func (s *httpSink) write(ctx context.Context, start time.Time, body []byte) error {
+	return s.pusher.PushEncoded(ctx, body)
+}
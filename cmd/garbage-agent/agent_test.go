@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+func TestApply(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("profile"))
+	}))
+	defer srv.Close()
+
+	cfg := &config{
+		Window:  duration(time.Second),
+		Every:   duration(time.Hour),
+		History: defaultHistory,
+		Targets: []targetConfig{{Name: "a", URL: srv.URL}, {Name: "b", URL: srv.URL}, {Name: "c", URL: srv.URL}},
+	}
+	a := newAgent("", cfg)
+	ts, err := targets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	live := make(map[string]*running)
+	a.apply(ctx, live, ts)
+	ra, rb := live["a"], live["b"]
+
+	// Reload a configuration that changes b, drops c and adds d.
+	cfg.Targets = []targetConfig{
+		{Name: "a", URL: srv.URL},
+		{Name: "b", URL: srv.URL, Every: duration(time.Minute)},
+		{Name: "d", URL: srv.URL},
+	}
+	if ts, err = targets(cfg); err != nil {
+		t.Fatal(err)
+	}
+	a.apply(ctx, live, ts)
+
+	if live["a"] != ra {
+		t.Error("unchanged target a was restarted")
+	}
+	if live["b"] == rb || live["b"].every != time.Minute {
+		t.Error("changed target b was not restarted with its new settings")
+	}
+	select {
+	case <-rb.done:
+	default:
+		t.Error("the old target b is still running")
+	}
+	if _, ok := live["c"]; ok {
+		t.Error("dropped target c is still running")
+	}
+	if _, ok := live["d"]; !ok {
+		t.Error("new target d is not running")
+	}
+
+	cancel()
+	for _, r := range live {
+		<-r.done
+	}
+}
+
+func TestTargetLabels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := &garbage.Profile{
+			Rate:    1,
+			Labels:  map[string]string{"env": "dev", "host": "a"},
+			Records: []garbage.Record{{Objects: 1, Bytes: 8, Stack0: [32]uintptr{0x1}}},
+		}
+		p.WriteTo(w)
+	}))
+	defer srv.Close()
+
+	cfg := &config{
+		Window:  duration(time.Second),
+		Labels:  map[string]string{"env": "prod"},
+		Targets: []targetConfig{{Name: "api", URL: srv.URL, Labels: map[string]string{"service": "api"}}},
+	}
+	ts, err := targets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ts[0].profile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := garbage.Parse(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"env": "prod", "host": "a", "service": "api"}
+	if !reflect.DeepEqual(p.Labels, want) {
+		t.Errorf("want labels %v, got %v", want, p.Labels)
+	}
+	if len(p.Records) != 1 {
+		t.Errorf("want 1 record, got %d", len(p.Records))
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config is the agent's configuration file.
+type config struct {
+	// Window is the collection window of each profile. Zero means 30s.
+	Window duration `json:"window"`
+
+	// Every is how often each target is profiled. Zero profiles each target
+	// back to back.
+	Every duration `json:"every"`
+
+	// Self profiles the agent's own process as a target named "self", for
+	// agents built into a program with the garbage package.
+	Self bool `json:"self"`
+
+	// History is the number of recent scrapes of each target kept in
+	// memory. Zero means 16.
+	History int `json:"history"`
+
+	// Listen is the address of the agent's HTTP server, which serves
+	// /healthz, /readyz, /metrics and /history. Empty means no server.
+	Listen string `json:"listen"`
+
+	// Labels are added to every profile collected, as the labels of its
+	// samples, whatever the sink.
+	Labels map[string]string `json:"labels"`
+
+	Targets []targetConfig `json:"target"`
+	Sinks   []sinkConfig   `json:"sink"`
+}
+
+// targetConfig is a process to profile through its garbage endpoint.
+type targetConfig struct {
+	Name   string            `json:"name"`
+	URL    string            `json:"url"`    // the /debug/pprof/garbage endpoint
+	Window duration          `json:"window"` // overrides config.Window
+	Every  duration          `json:"every"`  // overrides config.Every
+	Labels map[string]string `json:"labels"` // added to config.Labels
+}
+
+// sinkConfig is a destination for the profiles.
+type sinkConfig struct {
+	// Type is "dir", to write each profile to a file in Path, or "http", to
+	// POST each profile to URL.
+	Type string `json:"type"`
+	Path string `json:"path"`
+	URL  string `json:"url"`
+
+	// Cert and Key are the files of the client certificate for mutual TLS,
+	// and CA the file of the CA certificates the endpoint is verified
+	// against.
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+	CA   string `json:"ca"`
+}
+
+const (
+	defaultWindow  = 30 * time.Second
+	defaultHistory = 16
+)
+
+// A duration is a time.Duration written as a string such as "90s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration %s is not a string", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// loadConfig reads the configuration file name, in TOML or, if its extension
+// is .json, JSON.
+func loadConfig(name string) (*config, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if filepath.Ext(name) != ".json" {
+		v, err := parseTOML(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%v", name, err)
+		}
+		if b, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	c := new(config)
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if err := c.check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return c, nil
+}
+
+// check validates the configuration and fills in its defaults.
+func (c *config) check() error {
+	if c.Window <= 0 {
+		c.Window = duration(defaultWindow)
+	}
+	if c.History <= 0 {
+		c.History = defaultHistory
+	}
+	if len(c.Targets) == 0 && !c.Self {
+		return fmt.Errorf("no targets")
+	}
+
+	names := make(map[string]bool)
+	for i := range c.Targets {
+		t := &c.Targets[i]
+		if t.URL == "" {
+			return fmt.Errorf("target %d has no url", i+1)
+		}
+		if t.Name == "" {
+			t.Name = t.URL
+		}
+		if names[t.Name] || t.Name == "self" && c.Self {
+			return fmt.Errorf("duplicate target %q", t.Name)
+		}
+		names[t.Name] = true
+	}
+
+	for i, s := range c.Sinks {
+		switch {
+		case s.Type == "dir" && s.Path != "":
+		case s.Type == "http" && s.URL != "":
+		default:
+			return fmt.Errorf("sink %d: want type dir with a path or type http with a url", i+1)
+		}
+	}
+	return nil
+}
+
+// parseTOML parses the subset of TOML used by the configuration: tables and
+// arrays of tables, dotted as in [target.labels], and keys, dotted or not,
+// whose values are strings, integers, booleans, arrays of them, which may
+// span lines, or inline tables of them, such as
+//
+//	labels = { env = "prod", region = "us-east-1" }
+//
+// Multi-line strings, floats and dates are rejected.
+func parseTOML(b []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	table := root
+	defined := make(map[string]bool) // the tables defined by a header
+
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		switch {
+		case line == "":
+
+		case strings.HasPrefix(line, "[["):
+			if !strings.HasSuffix(line, "]]") {
+				return nil, fmt.Errorf("%d: bad array of tables %q", n, line)
+			}
+			path, err := splitKey(line[2 : len(line)-2])
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", n, err)
+			}
+			parent, _, err := walkTOML(root, path[:len(path)-1])
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", n, err)
+			}
+			key := path[len(path)-1]
+			tables, _ := parent[key].([]interface{})
+			if _, ok := parent[key]; ok && tables == nil {
+				return nil, fmt.Errorf("%d: %s is not an array of tables", n, strings.Join(path, "."))
+			}
+			table = make(map[string]interface{})
+			parent[key] = append(tables, table)
+
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%d: bad table %q", n, line)
+			}
+			path, err := splitKey(line[1 : len(line)-1])
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", n, err)
+			}
+			parent, _, err := walkTOML(root, path[:len(path)-1])
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", n, err)
+			}
+			if _, ok := parent[path[len(path)-1]].([]interface{}); ok {
+				return nil, fmt.Errorf("%d: %s is an array of tables", n, strings.Join(path, "."))
+			}
+			t, id, err := walkTOML(root, path)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", n, err)
+			}
+			if defined[id] {
+				return nil, fmt.Errorf("%d: duplicate table %s", n, strings.Join(path, "."))
+			}
+			defined[id] = true
+			table = t
+
+		default:
+			i := strings.Index(line, "=")
+			if i < 0 {
+				return nil, fmt.Errorf("%d: want key = value, got %q", n, line)
+			}
+			path, err := splitKey(line[:i])
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", n, err)
+			}
+			value, start := strings.TrimSpace(line[i+1:]), n
+			for unclosed(value) {
+				if !sc.Scan() {
+					return nil, fmt.Errorf("%d: %s: unterminated array", start, strings.Join(path, "."))
+				}
+				n++
+				value += " " + strings.TrimSpace(stripComment(sc.Text()))
+			}
+			v, err := parseTOMLValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %s: %v", start, strings.Join(path, "."), err)
+			}
+			t, _, err := walkTOML(table, path[:len(path)-1])
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", start, err)
+			}
+			key := path[len(path)-1]
+			if _, ok := t[key]; ok {
+				return nil, fmt.Errorf("%d: duplicate key %s", start, strings.Join(path, "."))
+			}
+			t[key] = v
+		}
+	}
+	return root, sc.Err()
+}
+
+// walkTOML returns the table at path below t, creating the tables missing on
+// the way and descending into the last table of each array of tables, and an
+// id of the table, unique in the document.
+func walkTOML(t map[string]interface{}, path []string) (map[string]interface{}, string, error) {
+	var id string
+	for i, key := range path {
+		id += "." + key
+		switch v := t[key].(type) {
+		case nil:
+			next := make(map[string]interface{})
+			t[key] = next
+			t = next
+		case map[string]interface{}:
+			t = v
+		case []interface{}:
+			next, ok := v[len(v)-1].(map[string]interface{})
+			if !ok {
+				return nil, "", fmt.Errorf("%s is not a table", strings.Join(path[:i+1], "."))
+			}
+			id += "#" + strconv.Itoa(len(v)-1)
+			t = next
+		default:
+			return nil, "", fmt.Errorf("%s is not a table", strings.Join(path[:i+1], "."))
+		}
+	}
+	return t, id, nil
+}
+
+// splitKey splits a key, bare or quoted, on the dots outside of quotes.
+func splitKey(s string) ([]string, error) {
+	var path []string
+	var quote byte
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		switch {
+		case i < len(s) && quote != 0 && s[i] == quote:
+			quote = 0
+		case i < len(s) && quote != 0:
+		case i < len(s) && (s[i] == '"' || s[i] == '\''):
+			quote = s[i]
+		case i == len(s) || s[i] == '.':
+			key := strings.TrimSpace(s[start:i])
+			if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+				key = key[1 : len(key)-1]
+			} else if key == "" || strings.ContainsAny(key, " \t\"'") {
+				return nil, fmt.Errorf("bad key %q", strings.TrimSpace(s))
+			}
+			path = append(path, key)
+			start = i + 1
+		}
+	}
+	return path, nil
+}
+
+// unclosed reports whether the value s opens more arrays than it closes, as
+// an array spanning lines does.
+func unclosed(s string) bool {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+func parseTOMLValue(s string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''"):
+		return nil, fmt.Errorf("multi-line strings are not supported")
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("bad literal string %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case s == "true" || s == "false":
+		return s == "true", nil
+	case strings.HasPrefix(s, "{"):
+		if !strings.HasSuffix(s, "}") {
+			return nil, fmt.Errorf("bad inline table %s", s)
+		}
+		t := make(map[string]interface{})
+		for _, e := range splitArray(s[1 : len(s)-1]) {
+			if e = strings.TrimSpace(e); e == "" {
+				continue
+			}
+			i := strings.Index(e, "=")
+			if i < 0 {
+				return nil, fmt.Errorf("want key = value, got %q", e)
+			}
+			v, err := parseTOMLValue(strings.TrimSpace(e[i+1:]))
+			if err != nil {
+				return nil, err
+			}
+			t[strings.Trim(strings.TrimSpace(e[:i]), `"`)] = v
+		}
+		return t, nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("bad array %s", s)
+		}
+		var vs []interface{}
+		for _, e := range splitArray(s[1 : len(s)-1]) {
+			if e = strings.TrimSpace(e); e == "" {
+				continue
+			}
+			v, err := parseTOMLValue(e)
+			if err != nil {
+				return nil, err
+			}
+			vs = append(vs, v)
+		}
+		return vs, nil
+	}
+
+	n, err := strconv.ParseInt(strings.Replace(s, "_", "", -1), 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported value %s", s)
+	}
+	return n, nil
+}
+
+// stripComment removes a comment from a line, outside of strings.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitArray splits the elements of an array or inline table on commas
+// outside of strings and of the arrays and inline tables nested in it.
+func splitArray(s string) []string {
+	var elems []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			elems = append(elems, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(elems, s[start:])
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		toml string
+		want map[string]interface{}
+	}{
+		{`window = "30s"`, map[string]interface{}{"window": "30s"}},
+		{`history = 1_000 # scrapes`, map[string]interface{}{"history": int64(1000)}},
+		{`self = true`, map[string]interface{}{"self": true}},
+		{`path = 'C:\dir'`, map[string]interface{}{"path": `C:\dir`}},
+		{`url = "http://h/#frag" # comment`, map[string]interface{}{"url": "http://h/#frag"}},
+		{`name = "a \"b\" # c"`, map[string]interface{}{"name": `a "b" # c`}},
+		{`name = "tab\there"`, map[string]interface{}{"name": "tab\there"}},
+		{`"quoted" = 1`, map[string]interface{}{"quoted": int64(1)}},
+		{
+			`labels = { env = "prod", "region" = "us,east" }`,
+			map[string]interface{}{"labels": map[string]interface{}{"env": "prod", "region": "us,east"}},
+		},
+		{
+			`xs = [1, [2, 3], { a = "x,y" }, "]"]`,
+			map[string]interface{}{"xs": []interface{}{
+				int64(1),
+				[]interface{}{int64(2), int64(3)},
+				map[string]interface{}{"a": "x,y"},
+				"]",
+			}},
+		},
+		{
+			"[labels]\nenv = \"prod\"\n",
+			map[string]interface{}{"labels": map[string]interface{}{"env": "prod"}},
+		},
+		{
+			"[[target]]\nname = \"a\"\n\n[[target]]\nname = \"b\"\n",
+			map[string]interface{}{"target": []interface{}{
+				map[string]interface{}{"name": "a"},
+				map[string]interface{}{"name": "b"},
+			}},
+		},
+		{
+			"[[target]]\nname = \"a\"\n[target.labels]\nenv = \"prod\"\n[[target]]\nname = \"b\"\n[target.labels]\nenv = \"dev\"\n",
+			map[string]interface{}{"target": []interface{}{
+				map[string]interface{}{"name": "a", "labels": map[string]interface{}{"env": "prod"}},
+				map[string]interface{}{"name": "b", "labels": map[string]interface{}{"env": "dev"}},
+			}},
+		},
+		{
+			"[a.\"b.c\"]\nd = 1\n[a]\ne = 2\n",
+			map[string]interface{}{"a": map[string]interface{}{"b.c": map[string]interface{}{"d": int64(1)}, "e": int64(2)}},
+		},
+		{
+			"labels.env = \"prod\"\nlabels.region = \"us\"\n",
+			map[string]interface{}{"labels": map[string]interface{}{"env": "prod", "region": "us"}},
+		},
+		{
+			"xs = [\n  \"a\", # first\n  [1,\n   2],\n]\nself = true\n",
+			map[string]interface{}{"xs": []interface{}{"a", []interface{}{int64(1), int64(2)}}, "self": true},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := parseTOML([]byte(test.toml))
+		if err != nil {
+			t.Errorf("%q: %v", test.toml, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: want %#v, got %#v", test.toml, test.want, got)
+		}
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []string{
+		`window`,
+		`window = 30s`,
+		`window = "30s`,
+		`path = 'dir`,
+		`labels = { env = "prod"`,
+		`labels = { env }`,
+		`xs = [1, 2`,
+		"a = 1\na = 2",
+		"[labels]\n[labels]",
+		"[labels\n",
+		"[[target]\n",
+		"target = 1\n[[target]]",
+		"[[target]]\n[target]",
+		"[target.labels]\n[target.labels]",
+		"a.b = 1\na.b = 2",
+		"a = 1\na.b = 2",
+		"[a..b]",
+		"[a b]",
+		"xs = [\n1,\n2",
+		`s = """multi"""`,
+		`x = 1.5`,
+	}
+
+	for _, test := range tests {
+		if _, err := parseTOML([]byte(test)); err == nil {
+			t.Errorf("%q: want an error", test)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	toml := `
+window = "10s"
+every = "1m"
+listen = ":9090"
+
+[labels]
+env = "prod"
+
+[[target]]
+name = "api"
+url = "http://127.0.0.1:6060/debug/pprof/garbage"
+every = "30s"
+
+[target.labels]
+service = "api"
+
+[[sink]]
+type = "dir"
+path = "/var/lib/garbage-agent"
+`
+	json := `{
+	"window": "10s",
+	"every": "1m",
+	"listen": ":9090",
+	"labels": {"env": "prod"},
+	"target": [{
+		"name": "api",
+		"url": "http://127.0.0.1:6060/debug/pprof/garbage",
+		"every": "30s",
+		"labels": {"service": "api"}
+	}],
+	"sink": [{"type": "dir", "path": "/var/lib/garbage-agent"}]
+}`
+	want := &config{
+		Window:  duration(10 * time.Second),
+		Every:   duration(time.Minute),
+		History: defaultHistory,
+		Listen:  ":9090",
+		Labels:  map[string]string{"env": "prod"},
+		Targets: []targetConfig{{
+			Name:   "api",
+			URL:    "http://127.0.0.1:6060/debug/pprof/garbage",
+			Every:  duration(30 * time.Second),
+			Labels: map[string]string{"service": "api"},
+		}},
+		Sinks: []sinkConfig{{Type: "dir", Path: "/var/lib/garbage-agent"}},
+	}
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{"agent.toml": toml, "agent.json": json} {
+		name = filepath.Join(dir, name)
+		if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		c, err := loadConfig(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("%s: want %+v, got %+v", name, want, c)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"unknown.toml", "self = true\nwindoe = \"1s\"", "unknown field"},
+		{"unknown.json", `{"self": true, "windoe": "1s"}`, "unknown field"},
+		{"nested.toml", "self = true\n[[target]]\nurl = \"u\"\nlabels = { a = { b = \"c\" } }", "cannot unmarshal"},
+		{"duration.toml", "self = true\nwindow = 30", "not a string"},
+		{"badduration.json", `{"self": true, "window": "soon"}`, "invalid duration"},
+		{"empty.toml", "", "no targets"},
+		{"nourl.toml", "[[target]]\nname = \"a\"", "no url"},
+		{"duplicate.json", `{"target": [{"url": "u"}, {"url": "u"}]}`, "duplicate target"},
+		{"self.json", `{"self": true, "target": [{"name": "self", "url": "u"}]}`, "duplicate target"},
+		{"sink.toml", "self = true\n[[sink]]\ntype = \"dir\"", "sink 1"},
+		{"syntax.toml", "self = ", "1: self"},
+	}
+
+	dir := t.TempDir()
+	for _, test := range tests {
+		name := filepath.Join(dir, test.name)
+		if err := os.WriteFile(name, []byte(test.data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(name); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: want error containing %q, got %v", test.name, test.want, err)
+		}
+	}
+}
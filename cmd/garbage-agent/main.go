@@ -0,0 +1,114 @@
+// Command garbage-agent profiles the garbage of other processes, or its own,
+// on a schedule, so garbage profiling can be rolled out as a sidecar or
+// daemon without changing every service.
+//
+// Usage:
+//
+//	garbage-agent -config agent.toml
+//
+// The configuration file is TOML, or JSON if its name ends in .json:
+//
+//	window = "30s"   # collection window of each profile
+//	every = "5m"     # how often to profile each target; back to back if unset
+//	history = 16     # scrapes of each target kept in memory
+//	self = false     # also profile the agent's own process as "self"
+//	listen = ":9090" # serve /healthz, /readyz, /metrics and /history
+//
+//	[labels]         # added to every profile, whatever the sink
+//	env = "prod"
+//
+//	[[target]]
+//	name = "api"
+//	url = "http://127.0.0.1:6060/debug/pprof/garbage"
+//	every = "1m"     # overrides every and window for this target
+//	labels = { service = "api" }
+//
+//	[[sink]]
+//	type = "dir"     # write each profile to a file named for its target
+//	path = "/var/lib/garbage-agent"
+//
+//	[[sink]]
+//	type = "http"    # POST each profile, with its target and labels in the query
+//	url = "https://profiles.example.com/ingest"
+//	cert = "client.crt"
+//	key = "client.key"
+//	ca = "ca.crt"
+//
+// The TOML may also use dotted keys and tables, such as [target.labels], and
+// arrays spanning lines; multi-line strings, floats and dates are rejected.
+// Labels are written into each profile, as the labels of its samples.
+//
+// The agent profiles each target through its garbage endpoint, the
+// protocol buffer served by the garbage package's Handler.
+//
+// The agent reloads the configuration file when it changes or on SIGHUP. The
+// targets whose settings or sinks changed are restarted and the others keep
+// running; the scrape history of every target is kept. A configuration that
+// fails to load is logged and the running one kept. The listen address is
+// read only at startup.
+//
+// If listen is set, the agent serves /healthz, which responds 200 OK while
+// the agent runs, and /readyz, which responds 200 OK once its targets are
+// running, for liveness and readiness probes. /metrics serves the successes
+// and failures of the scrapes of each target and its last scrape in the
+// OpenMetrics text format, and /history the recent scrapes of each target as
+// JSON.
+//
+// Run by systemd, the agent supports Type=notify services: it notifies the
+// service manager once its targets are running and when it stops, and pings
+// the watchdog if WatchdogSec is set.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	configFile := flag.String("config", "garbage-agent.toml", "read the configuration from `file`")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: garbage-agent [-config file]\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+	}
+
+	log.SetPrefix("garbage-agent: ")
+	log.SetFlags(0)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	a := newAgent(*configFile, cfg)
+	if cfg.Listen != "" {
+		ln, err := net.Listen("tcp", cfg.Listen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			log.Fatal(http.Serve(ln, a.handler()))
+		}()
+	}
+
+	if err := a.run(ctx, reload); err != nil && err != context.Canceled {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// handler serves the agent's health, readiness, metrics and scrape history.
+func (a *agent) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", a.serveReady)
+	mux.HandleFunc("/metrics", a.serveMetrics)
+	mux.HandleFunc("/history", a.serveHistory)
+	return mux
+}
+
+// serveReady responds 200 OK once the agent's targets are running, and 503
+// Service Unavailable before.
+func (a *agent) serveReady(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	ready := a.ready
+	a.mu.Unlock()
+
+	if !ready {
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// serveMetrics serves the scrape counts and the last scrape of each target in
+// the OpenMetrics text format.
+func (a *agent) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	names := make([]string, 0, len(a.counts))
+	for name := range a.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type row struct {
+		name   string
+		counts scrapeCounts
+		last   scrape
+	}
+	rows := make([]row, len(names))
+	for i, name := range names {
+		rows[i] = row{name: name, counts: *a.counts[name]}
+		if h := a.history[name]; len(h) > 0 {
+			rows[i].last = h[len(h)-1]
+		}
+	}
+	reloads := a.reloads
+	a.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "# TYPE garbage_agent_scrapes counter\n")
+	fmt.Fprintf(bw, "# HELP garbage_agent_scrapes Profiles collected from each target, by result.\n")
+	for _, r := range rows {
+		fmt.Fprintf(bw, "garbage_agent_scrapes_total{target=\"%s\",result=\"success\"} %d\n", escapeLabel(r.name), r.counts.successes)
+		fmt.Fprintf(bw, "garbage_agent_scrapes_total{target=\"%s\",result=\"failure\"} %d\n", escapeLabel(r.name), r.counts.failures)
+	}
+
+	fmt.Fprintf(bw, "# TYPE garbage_agent_last_scrape_timestamp_seconds gauge\n")
+	fmt.Fprintf(bw, "# HELP garbage_agent_last_scrape_timestamp_seconds Start of the last scrape of each target.\n")
+	for _, r := range rows {
+		fmt.Fprintf(bw, "garbage_agent_last_scrape_timestamp_seconds{target=\"%s\"} %.3f\n",
+			escapeLabel(r.name), float64(r.last.Time.UnixNano())/1e9)
+	}
+
+	fmt.Fprintf(bw, "# TYPE garbage_agent_last_scrape_duration_seconds gauge\n")
+	fmt.Fprintf(bw, "# HELP garbage_agent_last_scrape_duration_seconds Duration of the last scrape of each target.\n")
+	for _, r := range rows {
+		fmt.Fprintf(bw, "garbage_agent_last_scrape_duration_seconds{target=\"%s\"} %.3f\n",
+			escapeLabel(r.name), r.last.Duration.Seconds())
+	}
+
+	fmt.Fprintf(bw, "# TYPE garbage_agent_last_scrape_bytes gauge\n")
+	fmt.Fprintf(bw, "# HELP garbage_agent_last_scrape_bytes Size of the profile of the last scrape of each target.\n")
+	for _, r := range rows {
+		fmt.Fprintf(bw, "garbage_agent_last_scrape_bytes{target=\"%s\"} %d\n", escapeLabel(r.name), r.last.Bytes)
+	}
+
+	fmt.Fprintf(bw, "# TYPE garbage_agent_config_reloads counter\n")
+	fmt.Fprintf(bw, "# HELP garbage_agent_config_reloads Configuration reloads, by result.\n")
+	fmt.Fprintf(bw, "garbage_agent_config_reloads_total{result=\"success\"} %d\n", reloads.successes)
+	fmt.Fprintf(bw, "garbage_agent_config_reloads_total{result=\"failure\"} %d\n", reloads.failures)
+
+	fmt.Fprintf(bw, "# EOF\n")
+	bw.Flush()
+}
+
+// serveHistory serves the recent scrapes of each target as JSON.
+func (a *agent) serveHistory(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	history := make(map[string][]scrape, len(a.history))
+	for name, h := range a.history {
+		history[name] = append([]scrape(nil), h...)
+	}
+	a.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// escapeLabel escapes a label value of the OpenMetrics text format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends a state change to the service manager with the
+// sd_notify protocol, if the agent is run by systemd as a Type=notify
+// service. It reports whether the state was sent.
+func sdNotify(state string) bool {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return false
+	}
+
+	// A leading @ names an abstract socket, as the net package expects.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err == nil
+}
+
+// sdWatchdog returns the interval at which the service manager expects
+// watchdog pings, or 0 if the watchdog is not enabled for the agent.
+func sdWatchdog() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// pingWatchdog pings the service manager's watchdog at half the interval it
+// expects, until ctx is done.
+func pingWatchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sdNotify("WATCHDOG=1")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
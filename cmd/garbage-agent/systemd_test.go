@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSDNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sdNotify("READY=1") {
+		t.Error("notified without a socket")
+	}
+
+	name := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", name)
+	if !sdNotify("READY=1") {
+		t.Fatal("failed to notify")
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "READY=1" {
+		t.Errorf("want READY=1, got %q", got)
+	}
+}
+
+func TestSDWatchdog(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"", "", 0},
+		{"bad", "", 0},
+		{"0", "", 0},
+		{"2000000", "", 2 * time.Second},
+		{"2000000", pid, 2 * time.Second},
+		{"2000000", "1", 0},
+	}
+
+	for _, test := range tests {
+		t.Setenv("WATCHDOG_USEC", test.usec)
+		t.Setenv("WATCHDOG_PID", test.pid)
+		if got := sdWatchdog(); got != test.want {
+			t.Errorf("WATCHDOG_USEC=%q WATCHDOG_PID=%q: want %v, got %v", test.usec, test.pid, test.want, got)
+		}
+	}
+}
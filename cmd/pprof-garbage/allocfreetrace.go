@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// allocfreetrace computes an exact garbage profile from an allocfreetrace log.
+func allocfreetrace(args []string) error {
+	fs := flag.NewFlagSet("allocfreetrace", flag.ExitOnError)
+	out := fs.String("o", "", "write the garbage profile to `file`")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p, err := garbage.GarbageFromAllocFreeTrace(f)
+	if err != nil {
+		return err
+	}
+
+	return writeProfile(*out, p)
+}
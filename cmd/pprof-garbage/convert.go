@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// convert converts a legacy text profile to the protocol buffer format.
+func convert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	out := fs.String("o", "", "write the converted profile to `file`")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p, err := garbage.ParseText(f)
+	if err != nil {
+		return err
+	}
+
+	return writeProfile(*out, p)
+}
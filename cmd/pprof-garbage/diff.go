@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// diff computes a garbage profile from two heap profiles.
+func diff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	out := fs.String("o", "", "write the garbage profile to `file`")
+	if err := parseFlags(fs, args, 2); err != nil {
+		return err
+	}
+
+	start, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer start.Close()
+
+	end, err := os.Open(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer end.Close()
+
+	p, err := garbage.GarbageFromHeap(start, end)
+	if err != nil {
+		return err
+	}
+
+	return writeProfile(*out, p)
+}
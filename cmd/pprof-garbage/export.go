@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// export writes the garbage of each allocation site of a profile as flat
+// rows, for spreadsheets and BI tools.
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("o", "", "write the rows to `file`")
+	format := fs.String("format", "csv", "write the rows as csv or tsv")
+	seconds := fs.Duration("seconds", 0, "collection window of a profile fetched from an endpoint")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	var comma rune
+	switch *format {
+	case "csv":
+		comma = ','
+	case "tsv":
+		comma = '\t'
+	default:
+		return fmt.Errorf("unknown format %q: want csv or tsv", *format)
+	}
+
+	p, err := readProfile(fs.Arg(0), *seconds)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return writeSites(os.Stdout, comma, p)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := writeSites(f, comma, p); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeSites writes a header and a row per allocation site of p to w, the
+// most garbage first, with fields separated by comma.
+func writeSites(w io.Writer, comma rune, p *garbage.Profile) error {
+	rows, total := sites(p)
+
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	cw.Write([]string{"function", "file", "line", "garbage_bytes", "garbage_objects", "percent"})
+	for _, s := range rows {
+		var pct float64
+		if total > 0 {
+			pct = 100 * float64(s.bytes) / float64(total)
+		}
+		cw.Write([]string{
+			s.Function,
+			s.File,
+			strconv.Itoa(s.Line),
+			strconv.FormatInt(s.bytes, 10),
+			strconv.FormatInt(s.objects, 10),
+			strconv.FormatFloat(pct, 'f', 2, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// A site is the garbage allocated at a line.
+type site struct {
+	garbage.Frame
+	bytes, objects int64
+}
+
+// sites returns the garbage of each allocation site of p, the most garbage
+// first, and the total garbage bytes.
+func sites(p *garbage.Profile) ([]*site, int64) {
+	byFrame := make(map[garbage.Frame]*site)
+	var total int64
+	for _, r := range p.Records {
+		fr := siteFrame(p, r)
+		s := byFrame[fr]
+		if s == nil {
+			s = &site{Frame: fr}
+			byFrame[fr] = s
+		}
+		s.bytes += r.Bytes
+		s.objects += r.Objects
+		total += r.Bytes
+	}
+
+	rows := make([]*site, 0, len(byFrame))
+	for _, s := range byFrame {
+		rows = append(rows, s)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].bytes != rows[j].bytes {
+			return rows[i].bytes > rows[j].bytes
+		}
+		return rows[i].Function < rows[j].Function
+	})
+	return rows, total
+}
+
+// siteFrame returns the frame of r that allocated its garbage: the first
+// outside the runtime, or the first if all are in the runtime.
+func siteFrame(p *garbage.Profile, r garbage.Record) garbage.Frame {
+	var first *garbage.Frame
+	for _, pc := range r.Stack() {
+		for _, fr := range p.Frames(pc) {
+			if !strings.HasPrefix(fr.Function, "runtime.") {
+				return fr
+			}
+			if first == nil {
+				fr := fr
+				first = &fr
+			}
+		}
+	}
+	if first != nil {
+		return *first
+	}
+	if stk := r.Stack(); len(stk) > 0 {
+		return garbage.Frame{Function: fmt.Sprintf("%#x", stk[0])}
+	}
+	return garbage.Frame{Function: "unknown"}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// list prints the source of the functions matching a regexp, annotated with
+// the garbage allocated at each line.
+func list(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	seconds := fs.Duration("seconds", 0, "collection window of a profile fetched from an endpoint")
+	objects := fs.Bool("objects", false, "annotate with objects rather than bytes")
+	if err := parseFlags(fs, args, 2); err != nil {
+		return err
+	}
+
+	re, err := regexp.Compile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	p, err := readProfile(fs.Arg(1), *seconds)
+	if err != nil {
+		return err
+	}
+
+	value := func(r garbage.Record) int64 { return r.Bytes }
+	format := formatBytes
+	if *objects {
+		value = func(r garbage.Record) int64 { return r.Objects }
+		format = formatCount
+	}
+
+	type key struct{ function, file string }
+	type line struct{ flat, cum int64 }
+	routines := make(map[key]map[int]*line)
+	cums := make(map[key]int64)
+
+	var total int64
+	for _, r := range p.Records {
+		v := value(r)
+		total += v
+
+		// The garbage is allocated at the first frame outside the runtime.
+		site := true
+		seen := make(map[key]map[int]bool)
+		for _, pc := range r.Stack() {
+			for _, fr := range p.Frames(pc) {
+				leaf := site && !strings.HasPrefix(fr.Function, "runtime.")
+				if leaf {
+					site = false
+				}
+				if !re.MatchString(fr.Function) {
+					continue
+				}
+				k := key{fr.Function, fr.File}
+				if routines[k] == nil {
+					routines[k] = make(map[int]*line)
+				}
+				ln := routines[k][fr.Line]
+				if ln == nil {
+					ln = new(line)
+					routines[k][fr.Line] = ln
+				}
+				if leaf {
+					ln.flat += v
+				}
+				if seen[k] == nil {
+					seen[k] = make(map[int]bool)
+					cums[k] += v
+				}
+				if !seen[k][fr.Line] {
+					seen[k][fr.Line] = true
+					ln.cum += v
+				}
+			}
+		}
+	}
+	if len(routines) == 0 {
+		return fmt.Errorf("no garbage in functions matching %q", fs.Arg(0))
+	}
+
+	keys := make([]key, 0, len(routines))
+	for k := range routines {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].function != keys[j].function {
+			return keys[i].function < keys[j].function
+		}
+		return keys[i].file < keys[j].file
+	})
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "Total: %s\n", format(total))
+	for _, k := range keys {
+		lines := routines[k]
+		nums := make([]int, 0, len(lines))
+		var flat int64
+		for n, ln := range lines {
+			nums = append(nums, n)
+			flat += ln.flat
+		}
+		sort.Ints(nums)
+
+		fmt.Fprintf(w, "ROUTINE ======================== %s in %s\n", k.function, k.file)
+		fmt.Fprintf(w, "%10s %10s (flat, cum) %s of Total\n", format(flat), format(cums[k]), percent(cums[k], total))
+
+		src, err := readLines(k.file)
+		if err != nil {
+			// Annotate the lines alone.
+			for _, n := range nums {
+				fmt.Fprintf(w, "%10s %10s %6d: ?\n", format(lines[n].flat), format(lines[n].cum), n)
+			}
+			continue
+		}
+
+		const context = 3
+		from, to := nums[0]-context, nums[len(nums)-1]+context
+		if from < 1 {
+			from = 1
+		}
+		if to > len(src) {
+			to = len(src)
+		}
+		for n := from; n <= to; n++ {
+			flat, cum := ".", "."
+			if ln := lines[n]; ln != nil {
+				flat, cum = format(ln.flat), format(ln.cum)
+			}
+			fmt.Fprintf(w, "%10s %10s %6d:%s\n", flat, cum, n, src[n-1])
+		}
+	}
+	return nil
+}
+
+// readLines reads the lines of the file named by name.
+func readLines(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines, sc.Err()
+}
+
+// formatBytes formats n bytes with a binary unit, as pprof does.
+func formatBytes(n int64) string {
+	if n == 0 {
+		return "0"
+	}
+	const units = "kMGTPE"
+	v, u := float64(n), ""
+	for i := 0; i < len(units) && (v >= 1024 || v <= -1024); i++ {
+		v /= 1024
+		u = units[i:i+1] + "B"
+	}
+	if u == "" {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.2f%s", v, u)
+}
+
+// formatCount formats a count of objects.
+func formatCount(n int64) string {
+	return fmt.Sprint(n)
+}
+
+// percent formats v as a percentage of total.
+func percent(v, total int64) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.2f%%", 100*float64(v)/float64(total))
+}
@@ -0,0 +1,167 @@
+// Command pprof-garbage works with garbage profiles offline.
+//
+// Usage:
+//
+//	pprof-garbage convert [-o new.pb.gz] old.txt
+//	pprof-garbage diff [-o garbage.pb.gz] start.pb.gz end.pb.gz
+//	pprof-garbage allocfreetrace [-o garbage.pb.gz] trace.log
+//	pprof-garbage replay [-o garbage.pb.gz] [-focus re] [-ignore re] [-depth n] [-raw] garbage.rec
+//	pprof-garbage web [-http host:port] [-seconds d] [-no_browser] garbage.pb.gz|url
+//	pprof-garbage list [-seconds d] [-objects] regexp garbage.pb.gz|url
+//	pprof-garbage export [-o rows.csv] [-format csv|tsv] [-seconds d] garbage.pb.gz|url
+//	pprof-garbage owners [-seconds d] OWNERS garbage.pb.gz|url
+//	pprof-garbage top [-n 20] [-sort key] [-base base.pb.gz] [-rate] [-watch d] [-color mode] garbage.pb.gz|url
+//	pprof-garbage run [-dir dir] [-window d] [-o garbage.pb.gz] -- command [args]
+//
+// The convert command converts a profile in the legacy text format, as served
+// with debug=1 or debug=2, to the gzip-compressed protocol buffer format
+// expected by the pprof tool.
+//
+// The diff command computes a garbage profile from two heap profiles of the
+// same process, taken at the start and end of a window, for when only heap
+// snapshots were captured.
+//
+// The allocfreetrace command computes an exact garbage profile from the
+// output of a program run with GODEBUG=allocfreetrace=1, which is supported
+// by Go 1.21 and earlier.
+//
+// The replay command aggregates a recording, served with record=1, into a
+// garbage profile. The -focus and -ignore flags select stacks by function
+// name, -depth truncates stacks, and -raw reports the sampled values without
+// scaling them.
+//
+// The web command opens a profile in the pprof web UI, running go tool pprof
+// -http on it. The profile is read from a file, in either format, or fetched
+// from the garbage endpoint at a URL, over the window set by -seconds.
+//
+// The list command prints the source of each function matching the regexp,
+// annotated with the garbage allocated at each line: flat, by the line
+// itself, and cumulative, by the calls made from it. The profile is read as
+// for web; the source files must be present at the paths in the profile.
+//
+// The export command writes a row per allocation site of a profile, read as
+// for web, with the function, file, line, garbage bytes and objects, and
+// percentage of the garbage bytes, as CSV or, with -format tsv, tab-separated
+// values, for spreadsheets and BI tools. The values are estimates of all
+// allocations.
+//
+// The owners command prints the garbage of a profile, read as for web, rolled
+// up by the owners of its allocation sites as assigned by an ownership file in
+// the style of CODEOWNERS (see garbage.ParseOwners), the most garbage first.
+//
+// The top command prints the allocation sites of a profile, read as for web,
+// with the most garbage, sorted by -sort: bytes, objects, delta or name. With
+// -base, it prints the change of each site against a baseline profile, red
+// for growth and green for shrinkage on a terminal; -rate compares the
+// garbage per second of each window, for profiles of different windows. With
+// -watch, it reads the profile again at each interval, and reads a new sort
+// order, or q to quit, from each line of standard input.
+//
+// The run command runs a Go program that imports the autoload package,
+// configuring it through the PPROF_GARBAGE environment variable to collect
+// profiles back to back over windows of -window, and archives them in -dir
+// for the program's lifetime. With -o, it also merges them into one profile.
+// A program that does not import the package is run unprofiled.
+//
+// Each command other than web, list, owners, top and run writes to standard
+// output unless -o is set.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+var commands = map[string]func(args []string) error{
+	"allocfreetrace": allocfreetrace,
+	"convert":        convert,
+	"diff":           diff,
+	"export":         export,
+	"list":           list,
+	"owners":         owners,
+	"replay":         replay,
+	"run":            run,
+	"top":            top,
+	"web":            web,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: pprof-garbage convert [-o output] input\n")
+	fmt.Fprintf(os.Stderr, "       pprof-garbage diff [-o output] start end\n")
+	fmt.Fprintf(os.Stderr, "       pprof-garbage allocfreetrace [-o output] trace\n")
+	fmt.Fprintf(os.Stderr, "       pprof-garbage replay [-o output] [flags] recording\n")
+	fmt.Fprintf(os.Stderr, "       pprof-garbage web [flags] profile|url\n")
+	fmt.Fprintf(os.Stderr, "       pprof-garbage list [flags] regexp profile|url\n")
+	fmt.Fprintf(os.Stderr, "       pprof-garbage export [-o output] [flags] profile|url\n")
+	fmt.Fprintf(os.Stderr, "       pprof-garbage owners [flags] owners profile|url\n")
+	fmt.Fprintf(os.Stderr, "       pprof-garbage top [flags] profile|url\n")
+	fmt.Fprintf(os.Stderr, "       pprof-garbage run [flags] -- command [args]\n")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "pprof-garbage %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// writeProfile writes p in the protocol buffer format to the file named by
+// name, or to standard output if name is empty.
+func writeProfile(name string, p *garbage.Profile) error {
+	if name == "" {
+		_, err := p.WriteTo(os.Stdout)
+		return err
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := p.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseFlags parses args with fs, requiring exactly n positional arguments.
+// Flags may follow the positional arguments, as in "convert old.txt -o
+// new.pb.gz", up to a "--" argument.
+func parseFlags(fs *flag.FlagSet, args []string, n int) error {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if i := len(args) - len(rest) - 1; i >= 0 && args[i] == "--" {
+			pos = append(pos, rest...)
+			break
+		}
+		pos, args = append(pos, rest[0]), rest[1:]
+	}
+	// Leave the positional arguments as fs.Args.
+	if err := fs.Parse(append([]string{"--"}, pos...)); err != nil {
+		return err
+	}
+	if fs.NArg() != n {
+		fs.Usage()
+		return fmt.Errorf("want %d arguments, got %d", n, fs.NArg())
+	}
+	return nil
+}
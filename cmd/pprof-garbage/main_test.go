@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		n    int
+		out  string
+		pos  []string
+	}{
+		{[]string{"old.txt"}, 1, "", []string{"old.txt"}},
+		{[]string{"-o", "new.pb.gz", "old.txt"}, 1, "new.pb.gz", []string{"old.txt"}},
+		{[]string{"old.txt", "-o", "new.pb.gz"}, 1, "new.pb.gz", []string{"old.txt"}},
+		{[]string{"start.pb.gz", "-o", "out.pb.gz", "end.pb.gz"}, 2, "out.pb.gz", []string{"start.pb.gz", "end.pb.gz"}},
+		{[]string{"-o", "out.pb.gz", "--", "-start.pb.gz", "-o"}, 2, "out.pb.gz", []string{"-start.pb.gz", "-o"}},
+		{[]string{"start.pb.gz", "--", "-end.pb.gz"}, 2, "", []string{"start.pb.gz", "-end.pb.gz"}},
+	}
+
+	for _, test := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		out := fs.String("o", "", "")
+		if err := parseFlags(fs, test.args, test.n); err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		if *out != test.out || !reflect.DeepEqual(fs.Args(), test.pos) {
+			t.Errorf("%q: want -o %q and %q, got -o %q and %q", test.args, test.out, test.pos, *out, fs.Args())
+		}
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.String("o", "", "")
+	if err := parseFlags(fs, []string{"a", "-o", "x", "b"}, 1); err == nil {
+		t.Error("want an error for too many arguments")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	old, out := filepath.Join(dir, "old.txt"), filepath.Join(dir, "new.pb.gz")
+	text := "heap profile: 2: 2048 [2: 2048] @ heap/1048576\n2: 2048 [2: 2048] @ 0x1\n"
+	if err := os.WriteFile(old, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := convert([]string{old, "-o", out}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := garbage.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Records) != 1 {
+		t.Errorf("want 1 record, got %d", len(p.Records))
+	}
+}
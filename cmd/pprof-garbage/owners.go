@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// owners prints the garbage of a profile rolled up by the owners of its
+// allocation sites, as assigned by an ownership file.
+func owners(args []string) error {
+	fs := flag.NewFlagSet("owners", flag.ExitOnError)
+	seconds := fs.Duration("seconds", 0, "collection window of a profile fetched from an endpoint")
+	if err := parseFlags(fs, args, 2); err != nil {
+		return err
+	}
+
+	rules, err := garbage.LoadOwners(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	p, err := readProfile(fs.Arg(1), *seconds)
+	if err != nil {
+		return err
+	}
+	return printOwnership(os.Stdout, p.Ownership(rules))
+}
+
+// printOwnership prints a row per owner, the most garbage first.
+func printOwnership(w io.Writer, owned []garbage.Ownership) error {
+	var total int64
+	for _, o := range owned {
+		total += o.Bytes
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "bytes\tobjects\tstacks\tpercent\t\n")
+	for _, o := range owned {
+		var pct float64
+		if total > 0 {
+			pct = 100 * float64(o.Bytes) / float64(total)
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%.2f%%\t %s\n", o.Bytes, o.Objects, o.Stacks, pct, o.Owner)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"regexp"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// replay aggregates a recording into a garbage profile.
+func replay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	out := fs.String("o", "", "write the garbage profile to `file`")
+	focus := fs.String("focus", "", "keep only stacks with a function matching `regexp`")
+	ignore := fs.String("ignore", "", "drop stacks with a function matching `regexp`")
+	depth := fs.Int("depth", 0, "truncate stacks to their innermost `n` addresses")
+	raw := fs.Bool("raw", false, "report sampled values without scaling")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	opts := garbage.ReplayOptions{Depth: *depth, Unscaled: *raw}
+	var err error
+	if *focus != "" {
+		if opts.Focus, err = regexp.Compile(*focus); err != nil {
+			return err
+		}
+	}
+	if *ignore != "" {
+		if opts.Ignore, err = regexp.Compile(*ignore); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rec, err := garbage.ReadRecording(f)
+	if err != nil {
+		return err
+	}
+	return writeProfile(*out, rec.Replay(opts))
+}
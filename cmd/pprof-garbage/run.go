@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	garbage "github.com/benburkert/pprof-garbage"
+	"github.com/benburkert/pprof-garbage/autoload"
+)
+
+// run runs a command that imports the autoload package, archiving the garbage
+// profiles it collects over its lifetime.
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	dir := fs.String("dir", "", "archive the profiles of the command in `directory`; a temporary directory if unset")
+	window := fs.Duration("window", 10*time.Second, "collect each profile over `duration`")
+	out := fs.String("o", "", "also merge the profiles into `file`")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: pprof-garbage run [flags] -- command [args]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no command to run")
+	}
+
+	if *dir == "" {
+		d, err := os.MkdirTemp("", "pprof-garbage-run-")
+		if err != nil {
+			return err
+		}
+		*dir = d
+	}
+	abs, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(fs.Arg(0), fs.Args()[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=dir=%s,window=%s", autoload.EnvVar, abs, *window))
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Let the command decide when to exit: an interrupt from the terminal
+	// reaches it directly, and a termination is passed on.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		for sig := range sigs {
+			if sig == syscall.SIGTERM {
+				cmd.Process.Signal(sig)
+			}
+		}
+	}()
+	runErr := cmd.Wait()
+
+	names, err := filepath.Glob(filepath.Join(abs, "garbage-*.pb.gz"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Fprintf(os.Stderr, "pprof-garbage run: no profiles in %s; does the command import %s and run for a full window?\n",
+			abs, "github.com/benburkert/pprof-garbage/autoload")
+	} else {
+		fmt.Fprintf(os.Stderr, "pprof-garbage run: %d profiles in %s\n", len(names), abs)
+	}
+
+	if *out != "" && len(names) > 0 {
+		if err := mergeFiles(*out, names); err != nil {
+			return err
+		}
+	}
+	return runErr
+}
+
+// mergeFiles merges the profiles in the named files into the file out.
+func mergeFiles(out string, names []string) error {
+	var profiles []*garbage.Profile
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		p, err := garbage.Parse(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		profiles = append(profiles, p)
+	}
+
+	m, err := garbage.Merge(garbage.MergeOptions{}, profiles...)
+	if err != nil {
+		return err
+	}
+	return writeProfile(out, m)
+}
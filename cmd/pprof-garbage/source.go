@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// readProfile reads the garbage profile in the file named by src, in either
+// format, or fetches it from the garbage endpoint at src if it is a URL,
+// over the window seconds if set.
+func readProfile(src string, seconds time.Duration) (*garbage.Profile, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return garbage.Parse(f)
+	}
+
+	u, err := url.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if seconds > 0 {
+		q := u.Query()
+		q.Set("seconds", strconv.FormatFloat(seconds.Seconds(), 'f', -1, 64))
+		u.RawQuery = q.Encode()
+	}
+
+	fmt.Fprintf(os.Stderr, "fetching profile from %s\n", u.Redacted())
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: %s: %s", u.Redacted(), resp.Status, strings.TrimSpace(string(body)))
+	}
+	return garbage.Parse(resp.Body)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// ANSI escapes for top's output to a terminal.
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiBold  = "\x1b[1m"
+	ansiReset = "\x1b[0m"
+	ansiClear = "\x1b[H\x1b[2J"
+)
+
+// top prints the allocation sites of a profile with the most garbage,
+// optionally against a baseline and refreshed periodically.
+func top(args []string) error {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	n := fs.Int("n", 20, "print the top `n` allocation sites")
+	sortBy := fs.String("sort", "bytes", "sort by bytes, objects, delta or name")
+	basePath := fs.String("base", "", "compare against the baseline profile in `file`")
+	rate := fs.Bool("rate", false, "compare garbage per second of each window")
+	watch := fs.Duration("watch", 0, "refresh every `interval`, reading sort keys from standard input")
+	color := fs.String("color", "auto", "color the deltas: auto, always or never")
+	seconds := fs.Duration("seconds", 0, "collection window of a profile fetched from an endpoint")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	if _, ok := siteOrders[*sortBy]; !ok {
+		return fmt.Errorf("unknown sort order %q", *sortBy)
+	}
+
+	t := &topView{n: *n, order: *sortBy}
+	switch *color {
+	case "auto":
+		t.color = isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+	case "always":
+		t.color = true
+	case "never":
+	default:
+		return fmt.Errorf("unknown color mode %q", *color)
+	}
+
+	load := func(src string) (*garbage.Profile, error) {
+		p, err := readProfile(src, *seconds)
+		if err == nil && *rate {
+			p = p.PerSecond()
+		}
+		return p, err
+	}
+	if *basePath != "" {
+		base, err := load(*basePath)
+		if err != nil {
+			return err
+		}
+		t.base = make(map[garbage.Frame]*site)
+		rows, _ := sites(base)
+		for _, s := range rows {
+			t.base[s.Frame] = s
+		}
+	}
+
+	p, err := load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *watch <= 0 {
+		t.print(os.Stdout, p)
+		return nil
+	}
+
+	// Read sort keys, one per line, while refreshing.
+	keys := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			keys <- strings.TrimSpace(sc.Text())
+		}
+		close(keys)
+	}()
+
+	tick := time.NewTicker(*watch)
+	defer tick.Stop()
+	for {
+		if t.color {
+			fmt.Print(ansiClear)
+		}
+		t.print(os.Stdout, p)
+		fmt.Printf("\nsort: [b]ytes [o]bjects [d]elta [n]ame, [q]uit (then enter); refreshing every %v\n", *watch)
+
+		select {
+		case key, ok := <-keys:
+			if !ok || key == "q" {
+				return nil
+			}
+			for order := range siteOrders {
+				if key != "" && strings.HasPrefix(order, key) {
+					t.order = order
+				}
+			}
+		case <-tick.C:
+			next, err := load(fs.Arg(0))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "pprof-garbage top: %v\n", err)
+				continue
+			}
+			p = next
+		}
+	}
+}
+
+// A topView prints the top allocation sites of profiles.
+type topView struct {
+	n     int
+	order string // a key of siteOrders
+	color bool
+	base  map[garbage.Frame]*site // nil without a baseline
+}
+
+// siteOrders are the orders top sorts sites by, each given the deltas of the
+// sites' bytes against the baseline.
+var siteOrders = map[string]func(a, b *site, delta map[*site]int64) bool{
+	"bytes":   func(a, b *site, _ map[*site]int64) bool { return a.bytes > b.bytes },
+	"objects": func(a, b *site, _ map[*site]int64) bool { return a.objects > b.objects },
+	"delta":   func(a, b *site, delta map[*site]int64) bool { return abs(delta[a]) > abs(delta[b]) },
+	"name":    func(a, b *site, _ map[*site]int64) bool { return a.Function < b.Function },
+}
+
+func (t *topView) print(w io.Writer, p *garbage.Profile) {
+	rows, total := sites(p)
+
+	delta := make(map[*site]int64)
+	var baseTotal int64
+	for _, b := range t.base {
+		baseTotal += b.bytes
+	}
+	for _, s := range rows {
+		delta[s] = s.bytes
+		if b := t.base[s.Frame]; b != nil {
+			delta[s] -= b.bytes
+		}
+	}
+	less := siteOrders[t.order]
+	sort.SliceStable(rows, func(i, j int) bool { return less(rows[i], rows[j], delta) })
+	if len(rows) > t.n {
+		rows = rows[:t.n]
+	}
+
+	fmt.Fprintf(w, "Total: %s garbage", formatBytes(total))
+	if t.base != nil {
+		fmt.Fprintf(w, ", %s against the baseline", t.paint(total-baseTotal, formatDelta(total-baseTotal)))
+	}
+	fmt.Fprintf(w, "\n")
+
+	header := fmt.Sprintf("%10s %7s %10s", "flat", "flat%", "objects")
+	if t.base != nil {
+		header += fmt.Sprintf(" %10s", "delta")
+	}
+	header += "  site"
+	if t.color {
+		header = ansiBold + header + ansiReset
+	}
+	fmt.Fprintln(w, header)
+
+	for _, s := range rows {
+		fmt.Fprintf(w, "%10s %7s %10d", formatBytes(s.bytes), percent(s.bytes, total), s.objects)
+		if t.base != nil {
+			fmt.Fprintf(w, " %s", t.paint(delta[s], fmt.Sprintf("%10s", formatDelta(delta[s]))))
+		}
+		fmt.Fprintf(w, "  %s", s.Function)
+		if s.File != "" {
+			fmt.Fprintf(w, " (%s:%d)", s.File, s.Line)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// paint colors text red for a growth of d, and green for a shrinkage.
+func (t *topView) paint(d int64, text string) string {
+	switch {
+	case !t.color || d == 0:
+		return text
+	case d > 0:
+		return ansiRed + text + ansiReset
+	default:
+		return ansiGreen + text + ansiReset
+	}
+}
+
+// formatDelta formats a change of d bytes with its sign.
+func formatDelta(d int64) string {
+	if d > 0 {
+		return "+" + formatBytes(d)
+	}
+	if d < 0 {
+		return "-" + formatBytes(-d)
+	}
+	return "0"
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// web opens a garbage profile, from a file or fetched from an endpoint, in
+// the pprof web UI.
+func web(args []string) error {
+	fs := flag.NewFlagSet("web", flag.ExitOnError)
+	addr := fs.String("http", "localhost:0", "serve the web UI at `host:port`")
+	seconds := fs.Duration("seconds", 0, "collection window of a profile fetched from an endpoint")
+	noBrowser := fs.Bool("no_browser", false, "do not open a browser")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	p, err := readProfile(fs.Arg(0), *seconds)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "pprof-garbage-*.pb.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = p.WriteTo(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	pprof := []string{"tool", "pprof", "-http=" + *addr}
+	if *noBrowser {
+		pprof = append(pprof, "-no_browser")
+	}
+	cmd := exec.Command("go", append(pprof, f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// pprof serves until interrupted: hand it the signal, and outlive it to
+	// remove the profile.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		for s := range sig {
+			cmd.Process.Signal(s)
+		}
+	}()
+	return cmd.Wait()
+}
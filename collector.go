@@ -0,0 +1,432 @@
+package garbage
+
+import (
+	"context"
+	"runtime"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+// shared is the collector used by every garbage profile in the process.
+var shared = new(collector)
+
+// collector observes GC cycles on behalf of all in-flight profiles. A single
+// goroutine forces the initial GC, reads the memory profile once per cycle and
+// hands the per-cycle garbage to each subscriber, so overlapping profiles
+// neither interleave forced GCs nor count the same frees twice.
+type collector struct {
+	mu      sync.Mutex
+	subs    map[*subscription]struct{}
+	running bool
+	last    []runtime.MemProfileRecord // most recent read of the memory profile
+	numGC   uint32                     // runtime.MemStats.NumGC at last
+	ages    ageTracker                 // live cohorts since the collector started
+
+	// degraded is set while the process is under memory pressure, or the
+	// collector's overhead is over a subscription's limit: the collector
+	// polls less often and attributes garbage to the leaf of each stack
+	// only. It is used only by the collector's goroutine.
+	degraded bool
+
+	usage usage // since the collector started
+
+	// paused is set by Pause. wake interrupts the wait for a GC cycle, for
+	// Resume, Flush and unsubscribe, and flushes are closed once the
+	// memory profile has been read for Flush.
+	paused   bool
+	wake     chan struct{}
+	flushes  []chan struct{}
+	lastRead time.Time
+}
+
+// subscription accumulates the garbage observed by the collector between
+// subscribe and unsubscribe.
+type subscription struct {
+	period   time.Duration
+	cycles   []Cycle
+	garbage  []Record
+	survival []Survival
+	tops     [][]Record // largest garbage stacks of each cycle, for bursts
+
+	// degraded is set if any cycle was observed under memory pressure.
+	degraded bool
+
+	// stride, if greater than one, lets the collector read the memory
+	// profile only every stride GC cycles while no other subscription
+	// needs every cycle.
+	stride int
+
+	// adaptive, if greater than one, is the largest stride the
+	// subscription adapts to the garbage rate of its cycles, against the
+	// baseline of the rates. observed is the time of its last cycle.
+	adaptive int
+	rates    baseline
+	observed time.Time
+
+	// numGC is runtime.MemStats.NumGC at first.
+	numGC uint32
+
+	// depth, if positive, trims each stack to its innermost depth frames
+	// as the garbage is aggregated.
+	depth int
+
+	// spill, if set, bounds the stacks of garbage held in memory.
+	spill *spill
+
+	// isolate, if set, cuts the garbage into segments at the edges of
+	// bursts.
+	isolate *isolation
+
+	// maxOverhead, if positive, limits the collector's share of the
+	// process's CPU time and allocations since base. Over it, abort is
+	// called, or if abort is nil, overloaded is set to degrade the
+	// collector.
+	maxOverhead float64
+	abort       func(error)
+	base        usage
+	overloaded  bool
+
+	// budget, if set, limits the CPU the collector spends aggregating each
+	// cycle.
+	budget *AggregationBudget
+
+	// record is set if the raw deltas of each cycle are kept in recorded.
+	record   bool
+	recorded []RecordedCycle
+
+	// first and last are the reads of the memory profile that open and close
+	// the window.
+	first, last []runtime.MemProfileRecord
+
+	// notify, if set, is handed each cycle in place of accumulating its
+	// garbage, for subscriptions with no end. It is called on the
+	// collector's goroutine, after the collector is unlocked.
+	notify func(*CycleDelta)
+
+	// reset, if set, discards what a subscription with no end has kept,
+	// for Reset.
+	reset func()
+}
+
+// subscribe registers a new subscription that polls for GC cycles at least
+// once every period, starting the collector if it is not already running. If
+// record is set, the subscription also keeps the raw deltas of each cycle.
+func (c *collector) subscribe(period time.Duration, record bool) *subscription {
+	return c.add(&subscription{period: period, record: record})
+}
+
+// watch registers a subscription that hands each cycle to notify, polling as
+// for subscribe. If stride is greater than one, the cycles handed to notify
+// may each span up to stride GC cycles.
+func (c *collector) watch(period time.Duration, stride int, notify func(*CycleDelta)) *subscription {
+	return c.add(&subscription{period: period, stride: stride, notify: notify})
+}
+
+func (c *collector) add(s *subscription) *subscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.subs == nil {
+		c.subs = make(map[*subscription]struct{})
+	}
+	c.subs[s] = struct{}{}
+
+	if !c.running {
+		c.running = true
+		c.wake = make(chan struct{}, 1)
+
+		ready := make(chan struct{})
+		go c.run(ready)
+
+		// wait for the baseline to be read before the window opens.
+		c.mu.Unlock()
+		<-ready
+		c.mu.Lock()
+	}
+	s.first, s.numGC = c.last, c.numGC
+	return s
+}
+
+// unsubscribe removes s from the collector, closing its window. The
+// collector stops once it has no subscribers.
+func (c *collector) unsubscribe(s *subscription) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.subs, s)
+	s.last = c.last
+	if len(c.subs) == 0 {
+		c.poke()
+	}
+}
+
+// stats returns the number of GC cycles s has observed and the number of
+// stacks it has attributed garbage to, counting spilled stacks once per run.
+func (c *collector) stats(s *subscription) (cycles, stacks int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stacks = len(s.garbage)
+	if s.spill != nil {
+		stacks += s.spill.stacks
+	}
+	return len(s.cycles), stacks
+}
+
+// recording reports whether any subscription keeps the raw deltas of each
+// cycle.
+func (c *collector) recording() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for s := range c.subs {
+		if s.record {
+			return true
+		}
+	}
+	return false
+}
+
+// interval returns the polling interval and the GC cycles between reads of
+// the memory profile for the current subscribers, or false if there are none.
+// The collector wakes on the GC sentinel and polls only in case its finalizer
+// is delayed.
+func (c *collector) interval() (time.Duration, int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.subs) == 0 {
+		c.running = false
+		for _, done := range c.flushes {
+			close(done)
+		}
+		c.flushes = nil
+		return 0, 0, false
+	}
+
+	var period time.Duration
+	stride := 0
+	for s := range c.subs {
+		if period == 0 || s.period < period {
+			period = s.period
+		}
+		n := s.stride
+		if n < 1 {
+			n = 1
+		}
+		if stride == 0 || n < stride {
+			stride = n
+		}
+	}
+	return period / 10, stride, true
+}
+
+func (c *collector) run(ready chan<- struct{}) {
+	runtime.GC()
+
+	memstats := new(runtime.MemStats)
+	runtime.ReadMemStats(memstats)
+	numGC := memstats.NumGC
+	gc := readGCMetrics()
+
+	prev := read()
+
+	c.mu.Lock()
+	c.last, c.numGC, c.lastRead = prev, numGC, time.Now()
+	c.ages = make(ageTracker)
+	c.usage = usage{}
+	c.usage.cpu, c.usage.allocs = readProcUsage()
+	c.mu.Unlock()
+	close(ready)
+
+	for {
+		interval, stride, ok := c.interval()
+		if !ok {
+			return
+		}
+		if c.degraded = underPressure() || c.overloaded(); c.degraded {
+			interval *= pressureSlowdown
+		}
+		flushes := c.takeFlushes()
+		if flushes == nil {
+			c.wait(interval)
+			flushes = c.takeFlushes()
+		}
+
+		// The memory profile is cumulative, so the garbage of the cycles
+		// skipped by a stride or a pause is attributed at the next read.
+		if flushes == nil && (c.isPaused() || gcCycles() < uint64(numGC)+uint64(stride)) {
+			continue
+		}
+		if gcCycles() == uint64(numGC) {
+			release(flushes)
+			continue
+		}
+		work := startWork()
+		runtime.ReadMemStats(memstats)
+		numGC = memstats.NumGC
+
+		curr := read()
+
+		prevGC := gc
+		gc = readGCMetrics()
+
+		cycle := Cycle{
+			NumGC:    numGC,
+			Time:     time.Now(),
+			Pause:    time.Duration(memstats.PauseNs[(memstats.NumGC+255)%256]),
+			MarkCPU:  gc.markCPU - prevGC.markCPU,
+			HeapLive: gc.heapLive,
+			HeapGoal: gc.heapGoal,
+		}
+		// Mark each cycle observed in the execution trace, if one is running.
+		trace.WithRegion(context.Background(), "garbage.cycle", func() {
+			trace.Logf(context.Background(), "garbage", "GC %d", numGC)
+			c.observe(prev, curr, cycle)
+		})
+		c.endWork(work)
+		release(flushes)
+
+		prev = curr
+	}
+}
+
+// observe attributes the garbage between two reads of the memory profile, a
+// GC cycle apart, to the subscribers. The garbage totals of cycle are filled
+// in.
+func (c *collector) observe(prev, curr []runtime.MemProfileRecord, cycle Cycle) {
+	t := c.throttle()
+	garbage := diff(prev, curr, t)
+	freed := c.ages.update(prev, curr, t)
+	for i := range garbage {
+		garbage[i].Ages = freed[garbage[i].Stack0]
+		garbage[i].Sizes = sizesOf(garbage[i].Objects, garbage[i].Bytes)
+	}
+	if c.degraded {
+		garbage = collapse(garbage, leafStack)
+	}
+	survivors := survival(prev, curr, t)
+	top := topRecords(garbage, burstTopStacks)
+
+	for _, r := range garbage {
+		cycle.Objects += r.Objects
+		cycle.Bytes += r.Bytes
+	}
+
+	var deltas []Delta
+	if c.recording() {
+		deltas = windowDeltas(prev, curr)
+	}
+
+	var notify []func(*CycleDelta)
+	defer func() {
+		d := &CycleDelta{Cycle: cycle, Prev: prev, Curr: curr, Garbage: garbage}
+		for _, fn := range notify {
+			fn(d)
+		}
+	}()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last, c.numGC, c.lastRead = curr, cycle.NumGC, cycle.Time
+	for s := range c.subs {
+		if s.notify != nil {
+			notify = append(notify, s.notify)
+			continue
+		}
+		g, t := garbage, top
+		if s.depth > 0 {
+			g = collapse(garbage, s.trim)
+			t = topRecords(g, burstTopStacks)
+		}
+		if s.isolate != nil {
+			s.isolateBurst(cycle, prev)
+		}
+		s.cycles = append(s.cycles, cycle)
+		s.tops = append(s.tops, t)
+		s.degraded = s.degraded || c.degraded
+		s.garbage = mergeAll(s.garbage, g)
+		if s.spill != nil {
+			s.garbage = s.spill.add(s.garbage)
+		}
+		s.survival = mergeSurvivals(s.survival, survivors, s.trim)
+		if s.record {
+			s.recorded = append(s.recorded, RecordedCycle{Cycle: cycle, Deltas: deltas})
+		}
+		if s.adaptive > 1 {
+			s.adjust(cycle)
+		}
+	}
+}
+
+// cut returns the profile of the kind accumulated by s since it subscribed or
+// was last cut, and starts accumulating afresh.
+func (c *collector) cut(s *subscription, kind string) *Profile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.last = c.last
+	p := s.profile(kind)
+	s.cycles, s.tops, s.garbage, s.survival, s.degraded = nil, nil, nil, nil, false
+	s.first, s.numGC = s.last, c.numGC
+	return p
+}
+
+// waitCycle waits up to timeout for s to observe a GC cycle, if it has not
+// yet. It reports whether the wait ended before cancel was closed.
+func (c *collector) waitCycle(s *subscription, timeout time.Duration, cancel <-chan struct{}) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		c.mu.Lock()
+		n := len(s.cycles)
+		c.mu.Unlock()
+
+		d := time.Until(deadline)
+		if n > 0 || d <= 0 {
+			return true
+		}
+		if d > gcPollInterval {
+			d = gcPollInterval
+		}
+		if !sleep(d, cancel) {
+			return false
+		}
+	}
+}
+
+// profile returns the profile of the kind accumulated by s, without the
+// collection window and runtime statistics.
+func (s *subscription) profile(kind string) *Profile {
+	deltas := windowDeltas(s.first, s.last)
+	if s.depth > 0 {
+		var trimmed []Delta
+		index := make(map[[32]uintptr]int)
+		for _, d := range deltas {
+			d.Stack0 = s.trim(d.Stack0)
+			trimmed = mergeDelta(trimmed, index, d)
+		}
+		deltas = trimmed
+	}
+	sortSurvival(s.survival)
+	garbage := s.garbage
+	if s.spill != nil {
+		garbage = s.spill.merge(garbage)
+	}
+
+	p := &Profile{
+		Kind:     kind,
+		Records:  garbage,
+		Cycles:   s.cycles,
+		Suspects: suspects(deltas),
+		Survival: s.survival,
+		Degraded: s.degraded,
+		Stride:   s.meanStride(),
+		tops:     s.tops,
+	}
+	if kind == growthKind {
+		p.Records = growth(deltas)
+	}
+	return p
+}
@@ -0,0 +1,194 @@
+package garbage
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Pause pauses the collector shared by every profile, Monitor, Recorder and
+// Detector in the process, so the profiler can be quiesced during
+// latency-critical events without restarting the process: until Resume, it
+// neither polls for GC cycles nor reads the memory profile. The memory
+// profile is cumulative, so the garbage of the cycles completed while paused
+// is attributed at the first read after Resume, as a single cycle.
+// Collections in flight keep running but observe no cycles while paused.
+func Pause() {
+	shared.pause(true)
+}
+
+// Resume resumes the collector after Pause.
+func Resume() {
+	shared.pause(false)
+}
+
+// Flush reads the memory profile now, paused or not, attributing the garbage
+// of the GC cycles completed since the last read to the subscribers, and
+// returns once it has. It does nothing if no cycle completed since the last
+// read or the collector is not running.
+func Flush() {
+	shared.flush()
+}
+
+// Reset discards the cycles kept by every running Monitor, starting their
+// windows afresh. Collections in flight are not affected.
+func Reset() {
+	shared.resetAll()
+}
+
+// CollectorStatus is the state of the collector shared by every profile in the
+// process.
+type CollectorStatus struct {
+	Running     bool      `json:"running"`     // whether any subscriber is observing GC cycles
+	Paused      bool      `json:"paused"`      // whether Pause is in effect
+	Subscribers int       `json:"subscribers"` // collections, monitors and recorders observing
+	NumGC       uint32    `json:"num_gc"`      // runtime.MemStats.NumGC at the last read
+	LastRead    time.Time `json:"last_read"`   // time of the last read of the memory profile
+}
+
+// Status returns the state of the collector.
+func Status() CollectorStatus {
+	return shared.status()
+}
+
+func (c *collector) pause(paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = paused
+	c.poke()
+}
+
+func (c *collector) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.paused
+}
+
+func (c *collector) flush() {
+	c.mu.Lock()
+	if !c.running {
+		c.mu.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	c.flushes = append(c.flushes, done)
+	c.poke()
+	c.mu.Unlock()
+
+	<-done
+}
+
+// takeFlushes returns the pending Flush requests, to be released once the
+// memory profile has been read.
+func (c *collector) takeFlushes() []chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flushes := c.flushes
+	c.flushes = nil
+	return flushes
+}
+
+// release returns the Flush requests waiting on a read.
+func release(flushes []chan struct{}) {
+	for _, done := range flushes {
+		close(done)
+	}
+}
+
+// poke interrupts the collector's wait for a GC cycle. c.mu must be held.
+func (c *collector) poke() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// wait returns once a GC cycle completes, after timeout or when poked. While
+// paused, it returns only when poked.
+func (c *collector) wait(timeout time.Duration) {
+	c.mu.Lock()
+	paused, wake := c.paused, c.wake
+	c.mu.Unlock()
+
+	if paused {
+		<-wake
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-gcDoneChan():
+	case <-timer.C:
+	case <-wake:
+	}
+}
+
+// onReset registers fn to discard what s has kept, for Reset.
+func (c *collector) onReset(s *subscription, fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.reset = fn
+}
+
+func (c *collector) resetAll() {
+	var resets []func()
+	c.mu.Lock()
+	for s := range c.subs {
+		if s.reset != nil {
+			resets = append(resets, s.reset)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, fn := range resets {
+		fn()
+	}
+}
+
+func (c *collector) status() CollectorStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CollectorStatus{
+		Running:     c.running,
+		Paused:      c.paused,
+		Subscribers: len(c.subs),
+		NumGC:       c.numGC,
+		LastRead:    c.lastRead,
+	}
+}
+
+// serveCollector responds with the Status of the collector as JSON. POST
+// requests first apply the action parameter: pause, resume, flush or reset.
+func serveCollector(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "POST":
+		switch action := r.FormValue("action"); action {
+		case "pause":
+			Pause()
+		case "resume":
+			Resume()
+		case "flush":
+			Flush()
+		case "reset":
+			Reset()
+		default:
+			http.Error(w, "garbage: action must be pause, resume, flush or reset", http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "garbage: collector requires GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Status())
+}
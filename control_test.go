@@ -0,0 +1,97 @@
+package garbage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPauseFlush(t *testing.T) {
+	requireEnabled(t)
+
+	deltas := make(chan *CycleDelta, 16)
+
+	r := &Recorder{Interval: 10 * time.Millisecond}
+	r.Start(func(d *CycleDelta) {
+		select {
+		case deltas <- d:
+		default:
+		}
+	})
+	defer r.Stop()
+
+	Pause()
+	defer Resume()
+	if !Status().Paused {
+		t.Fatal("status not paused after Pause")
+	}
+
+	// Drain a cycle observed before the pause took effect.
+	time.Sleep(50 * time.Millisecond)
+	for len(deltas) > 0 {
+		<-deltas
+	}
+
+	runtime.GC()
+	select {
+	case d := <-deltas:
+		t.Fatalf("observed GC %d while paused", d.NumGC)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	Flush()
+	select {
+	case d := <-deltas:
+		if d.NumGC == 0 {
+			t.Error("flushed cycle has no NumGC")
+		}
+	default:
+		t.Fatal("Flush returned before the cycle was observed")
+	}
+
+	Resume()
+	if Status().Paused {
+		t.Error("status paused after Resume")
+	}
+}
+
+func TestHandlerCollector(t *testing.T) {
+	requireEnabled(t)
+
+	h := new(Handler)
+	defer Resume()
+
+	for _, action := range []string{"pause", "resume", "flush", "reset"} {
+		req := httptest.NewRequest("POST", "/debug/pprof/garbage/collector?action="+action, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: want status %d, got %d: %s", action, http.StatusOK, w.Code, w.Body)
+		}
+		var st CollectorStatus
+		if err := json.NewDecoder(w.Body).Decode(&st); err != nil {
+			t.Fatalf("%s: %v", action, err)
+		}
+		if st.Paused != (action == "pause") {
+			t.Errorf("%s: want paused %v, got %v", action, action == "pause", st.Paused)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/debug/pprof/garbage/collector?action=stop", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "pause") {
+		t.Errorf("bad action: want status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body)
+	}
+
+	req = httptest.NewRequest("DELETE", "/debug/pprof/garbage/collector", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE: want status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
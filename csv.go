@@ -0,0 +1,31 @@
+package garbage
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvHeader names the columns of the CSV form of a profile's cycle timeline.
+var csvHeader = []string{"timestamp", "cycle", "garbage_bytes", "garbage_objects", "heap_goal", "pause_ns"}
+
+// writeCSV writes the GC cycles observed by the profile as CSV, one row per
+// cycle after a header row, for spreadsheets and data frames. Like the cycle
+// table of the text format, the garbage is the sampled, unscaled counts.
+func (p *Profile) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, c := range p.Cycles {
+		cw.Write([]string{
+			c.Time.UTC().Format(time.RFC3339Nano),
+			strconv.FormatUint(uint64(c.NumGC), 10),
+			strconv.FormatInt(c.Bytes, 10),
+			strconv.FormatInt(c.Objects, 10),
+			strconv.FormatUint(c.HeapGoal, 10),
+			strconv.FormatInt(int64(c.Pause), 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
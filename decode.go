@@ -0,0 +1,299 @@
+package garbage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// protoProfile is a profile.proto message decoded by decodeProto, with its
+// stacks symbolized by address.
+type protoProfile struct {
+	types       []string // of the sample values
+	defaultType string   // sample type pprof opens on, if set
+	samples     []protoSample
+	labels      map[string]string // labels of every sample
+	frames      map[uintptr][]Frame
+	comments    []string
+	period      int64
+	time        time.Time // zero if unset
+	duration    time.Duration
+}
+
+type protoSample struct {
+	stack  [32]uintptr
+	values []int64
+}
+
+// decodeProto decodes a profile in the profile.proto format.
+func decodeProto(data []byte) (*protoProfile, error) {
+	type location struct {
+		address uint64
+		lines   [][2]uint64 // function ID and line
+	}
+	type function struct {
+		name, file int64
+	}
+	type sample struct {
+		locs   []uint64
+		values []int64
+		labels [][2]int64 // string indexes of the key and value
+	}
+
+	var (
+		strs      []string
+		types     []int64 // string index of each sample type
+		samples   []sample
+		comments  []int64
+		locs      = make(map[uint64]location)
+		funcs     = make(map[uint64]function)
+		period    int64
+		timeNanos int64
+		duration  int64
+		defType   int64
+	)
+
+	err := decodeMessage(data, func(tag int, v uint64, b []byte) error {
+		switch tag {
+		case tagProfile_SampleType:
+			return decodeMessage(b, func(tag int, v uint64, b []byte) error {
+				if tag == tagValueType_Type {
+					types = append(types, int64(v))
+				}
+				return nil
+			})
+		case tagProfile_Sample:
+			var s sample
+			err := decodeMessage(b, func(tag int, v uint64, b []byte) error {
+				switch tag {
+				case tagSample_Location:
+					return decodeRepeated(v, b, func(u uint64) { s.locs = append(s.locs, u) })
+				case tagSample_Value:
+					return decodeRepeated(v, b, func(u uint64) { s.values = append(s.values, int64(u)) })
+				case tagSample_Label:
+					var l [2]int64
+					err := decodeMessage(b, func(tag int, v uint64, b []byte) error {
+						switch tag {
+						case tagLabel_Key:
+							l[0] = int64(v)
+						case tagLabel_Str:
+							l[1] = int64(v)
+						}
+						return nil
+					})
+					s.labels = append(s.labels, l)
+					return err
+				}
+				return nil
+			})
+			samples = append(samples, s)
+			return err
+		case tagProfile_Location:
+			var id uint64
+			var loc location
+			err := decodeMessage(b, func(tag int, v uint64, b []byte) error {
+				switch tag {
+				case tagLocation_ID:
+					id = v
+				case tagLocation_Address:
+					loc.address = v
+				case tagLocation_Line:
+					var ln [2]uint64
+					err := decodeMessage(b, func(tag int, v uint64, b []byte) error {
+						switch tag {
+						case tagLine_FunctionID:
+							ln[0] = v
+						case tagLine_Line:
+							ln[1] = v
+						}
+						return nil
+					})
+					loc.lines = append(loc.lines, ln)
+					return err
+				}
+				return nil
+			})
+			locs[id] = loc
+			return err
+		case tagProfile_Function:
+			var id uint64
+			var fn function
+			err := decodeMessage(b, func(tag int, v uint64, b []byte) error {
+				switch tag {
+				case tagFunction_ID:
+					id = v
+				case tagFunction_Name:
+					fn.name = int64(v)
+				case tagFunction_Filename:
+					fn.file = int64(v)
+				}
+				return nil
+			})
+			funcs[id] = fn
+			return err
+		case tagProfile_StringTable:
+			strs = append(strs, string(b))
+		case tagProfile_Comment:
+			return decodeRepeated(v, b, func(u uint64) { comments = append(comments, int64(u)) })
+		case tagProfile_Period:
+			period = int64(v)
+		case tagProfile_TimeNanos:
+			timeNanos = int64(v)
+		case tagProfile_DurationNanos:
+			duration = int64(v)
+		case tagProfile_DefaultSampleType:
+			defType = int64(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	str := func(i int64) string {
+		if i < 0 || i >= int64(len(strs)) {
+			return ""
+		}
+		return strs[i]
+	}
+
+	pp := &protoProfile{
+		period:   period,
+		duration: time.Duration(duration),
+		frames:   make(map[uintptr][]Frame),
+	}
+	if timeNanos != 0 {
+		pp.time = time.Unix(0, timeNanos)
+	}
+	for _, t := range types {
+		pp.types = append(pp.types, str(t))
+	}
+	pp.defaultType = str(defType)
+	for _, c := range comments {
+		pp.comments = append(pp.comments, str(c))
+	}
+
+	for _, loc := range locs {
+		pc := uintptr(loc.address)
+		if _, ok := pp.frames[pc]; ok {
+			continue
+		}
+		for _, ln := range loc.lines {
+			fn := funcs[ln[0]]
+			pp.frames[pc] = append(pp.frames[pc], Frame{
+				Function: str(fn.name),
+				File:     str(fn.file),
+				Line:     int(ln[1]),
+			})
+		}
+	}
+
+	for i, s := range samples {
+		if len(s.values) != len(types) {
+			return nil, errors.New("sample values do not match sample types")
+		}
+		pp.labels = commonLabels(pp.labels, sampleLabels(s.labels, str), i == 0)
+		ps := protoSample{values: s.values}
+		for i, id := range s.locs {
+			if i == len(ps.stack) {
+				break
+			}
+			ps.stack[i] = uintptr(locs[id].address)
+		}
+		pp.samples = append(pp.samples, ps)
+	}
+	return pp, nil
+}
+
+// Parse parses a garbage or growth profile in the protocol buffer format,
+// compressed or not, as written by WriteTo, or in the legacy text format
+// (see ParseText). The values of the profile are estimates of all
+// allocations, as in the protocol buffer format, and its stacks are
+// symbolized by its own symbols.
+//
+// The markers of the profile's comments are kept, but its GC cycles and
+// other sections are not encoded in the protocol buffer format.
+func Parse(r io.Reader) (*Profile, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(zr)
+	}
+
+	if head, _ := br.Peek(len("heap profile:")); string(head) == "heap profile:" {
+		p, err := ParseText(br)
+		if err != nil {
+			return nil, err
+		}
+		if !p.scaled {
+			for i := range p.Records {
+				p.Records[i] = p.weigh(p.Records[i], 1)
+			}
+			p.scaled = true
+		}
+		return p, nil
+	}
+
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	pp, err := decodeProto(data)
+	if err != nil {
+		return nil, fmt.Errorf("garbage: bad profile: %v", err)
+	}
+
+	if len(pp.types) != 2 || !strings.HasSuffix(pp.types[0], "_objects") || !strings.HasSuffix(pp.types[1], "_bytes") {
+		return nil, fmt.Errorf("garbage: not a garbage profile: sample types %q", pp.types)
+	}
+	p := &Profile{
+		Kind:     strings.TrimSuffix(pp.types[0], "_objects"),
+		Start:    pp.time,
+		Duration: pp.duration,
+		Rate:     int(pp.period),
+		frames:   pp.frames,
+		scaled:   true,
+	}
+	if len(pp.labels) > 0 {
+		p.Labels = pp.labels
+	}
+	switch pp.defaultType {
+	case pp.types[0]:
+		p.DefaultSample = sampleObjects
+	case pp.types[1]:
+		p.DefaultSample = sampleBytes
+	}
+	for _, s := range pp.samples {
+		p.Records = append(p.Records, Record{Objects: s.values[0], Bytes: s.values[1], Stack0: s.stack})
+	}
+	for _, c := range pp.comments {
+		switch {
+		case c == truncatedComment:
+			p.Truncated = true
+		case c == degradedComment:
+			p.Degraded = true
+		case c == perSecondComment:
+			p.perSecond = true
+		case c == baselineComment:
+			p.baselined = true
+		case strings.HasPrefix(c, traceComment):
+			p.TraceID = strings.TrimPrefix(c, traceComment)
+		case strings.HasPrefix(c, buildComment):
+			p.Build = strings.TrimPrefix(c, buildComment)
+		case strings.HasPrefix(c, strideComment):
+			p.Stride, _ = parseStride(c)
+		case strings.HasPrefix(c, mergedComment):
+			if w, ok := parseMerged(c); ok {
+				p.Windows = append(p.Windows, w)
+			}
+		}
+	}
+	return p, nil
+}
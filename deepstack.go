@@ -0,0 +1,40 @@
+package garbage
+
+// The memory profile records at most 32 frames of each allocation stack, so
+// the stacks of deep call chains are truncated: their outermost frames are
+// lost, and stacks that differ only in those frames are merged into one
+// record. Truncated stacks end in a synthetic "(truncated)" root frame in the
+// text and protocol buffer forms, whose samples are also labeled
+// stack=truncated, and the profile counts them.
+
+// truncatedFrame is the function of the synthetic root frame of a truncated
+// stack.
+const truncatedFrame = "(truncated)"
+
+// truncatedStacksComment prefixes the number of records with truncated
+// stacks.
+const truncatedStacksComment = "truncated_stacks: "
+
+// stackTruncated reports whether stk fills the stack of a memory profile
+// record, and so may have been truncated.
+func stackTruncated(stk []uintptr) bool {
+	return len(stk) == len(Record{}.Stack0)
+}
+
+// StackTruncated reports whether the record's stack reached the depth of the
+// memory profile, so its outermost frames may have been lost.
+func (r *Record) StackTruncated() bool {
+	return stackTruncated(r.Stack())
+}
+
+// TruncatedStacks returns the number of records of the profile whose stacks
+// were truncated at the depth of the memory profile, and their garbage bytes.
+func (p *Profile) TruncatedStacks() (records int, bytes int64) {
+	for i := range p.Records {
+		if p.Records[i].StackTruncated() {
+			records++
+			bytes += p.Records[i].Bytes
+		}
+	}
+	return records, bytes
+}
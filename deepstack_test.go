@@ -0,0 +1,52 @@
+package garbage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTruncatedStacks(t *testing.T) {
+	p := goldenProfile()
+	deep := Record{Objects: 1, Bytes: 64, Cycles: 1}
+	for i := range deep.Stack0 {
+		deep.Stack0[i] = 0x1010
+	}
+	p.Records = append(p.Records, deep)
+
+	if n, bytes := p.TruncatedStacks(); n != 1 || bytes != 64 {
+		t.Errorf("want 1 truncated stack of 64 bytes, got %d of %d", n, bytes)
+	}
+
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "main.decode\t/src/main.go:12\n#\t"+truncatedFrame+"\n\n") {
+		t.Errorf("missing truncated root frame:\n%s", text)
+	}
+	if !strings.Contains(string(text), "# truncated_stacks: 1\n") {
+		t.Errorf("missing truncated stack count:\n%s", text)
+	}
+
+	data := p.encode()
+	for _, s := range []string{truncatedFrame, "stack", "truncated_stacks: 1"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("protocol buffer missing %q", s)
+		}
+	}
+
+	// The synthetic root is dropped when the profile is read back, and the
+	// stack is still recognized as truncated.
+	gz, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := Parse(bytes.NewReader(gz))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := q.TruncatedStacks(); n != 1 {
+		t.Errorf("want 1 truncated stack parsed back, got %d", n)
+	}
+}
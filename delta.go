@@ -0,0 +1,117 @@
+package garbage
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+)
+
+// A Delta describes the allocations and frees of a single allocation stack
+// over a collection window.
+type Delta struct {
+	AllocObjects int64       // number of objects allocated
+	AllocBytes   int64       // number of bytes allocated
+	FreeObjects  int64       // number of objects freed
+	FreeBytes    int64       // number of bytes freed
+	Stack0       [32]uintptr // stack trace for this delta; ends at first 0 entry
+}
+
+// InUseBytes returns the growth in bytes in use (AllocBytes - FreeBytes).
+func (d *Delta) InUseBytes() int64 { return d.AllocBytes - d.FreeBytes }
+
+// InUseObjects returns the growth in objects in use (AllocObjects -
+// FreeObjects).
+func (d *Delta) InUseObjects() int64 {
+	return d.AllocObjects - d.FreeObjects
+}
+
+// Stack returns the stack trace associated with the delta,
+// a prefix of d.Stack0.
+func (d *Delta) Stack() []uintptr {
+	for i, v := range d.Stack0 {
+		if v == 0 {
+			return d.Stack0[0:i]
+		}
+	}
+	return d.Stack0[0:]
+}
+
+// windowDeltas returns the allocations and frees of each stack between two
+// reads of the memory profile. Stacks with no activity are omitted.
+func windowDeltas(first, last []runtime.MemProfileRecord) []Delta {
+	var deltas []Delta
+	firsts := byStack(first)
+	for _, lr := range last {
+		fr := firsts[lr.Stack0]
+
+		d := Delta{
+			AllocObjects: lr.AllocObjects - fr.AllocObjects,
+			AllocBytes:   lr.AllocBytes - fr.AllocBytes,
+			FreeObjects:  lr.FreeObjects - fr.FreeObjects,
+			FreeBytes:    lr.FreeBytes - fr.FreeBytes,
+			Stack0:       lr.Stack0,
+		}
+		if d.AllocObjects != 0 || d.FreeObjects != 0 {
+			deltas = append(deltas, d)
+		}
+	}
+	return deltas
+}
+
+// growth returns the net growth in memory in use by each stack in deltas.
+// Stacks whose use did not change are omitted.
+func growth(deltas []Delta) []Record {
+	var recs []Record
+	for i := range deltas {
+		d := &deltas[i]
+		if d.InUseObjects() == 0 && d.InUseBytes() == 0 {
+			continue
+		}
+		recs = append(recs, Record{
+			Objects: d.InUseObjects(),
+			Bytes:   d.InUseBytes(),
+			Stack0:  d.Stack0,
+		})
+	}
+	return recs
+}
+
+// suspectRatio is how many times its frees a stack must allocate during the
+// window to be a retention suspect.
+const suspectRatio = 4
+
+// suspects returns the deltas that are retention suspects, largest growth
+// first.
+func suspects(deltas []Delta) []Delta {
+	var sus []Delta
+	for _, d := range deltas {
+		if d.InUseBytes() > 0 && d.AllocBytes >= suspectRatio*d.FreeBytes {
+			sus = append(sus, d)
+		}
+	}
+
+	sort.Slice(sus, func(i, j int) bool {
+		return sus[i].InUseBytes() > sus[j].InUseBytes()
+	})
+	return sus
+}
+
+// printSuspects prints the retention suspects as a comment section of the
+// legacy text format, in the heap profile form of growth [allocated] with
+// frees omitted.
+func (p *Profile) printSuspects(w io.Writer) {
+	sus := p.Suspects
+	fmt.Fprintf(w, "\n# retention suspects: allocations far exceeding frees\n")
+	for i := range sus {
+		d := &sus[i]
+		fmt.Fprintf(w, "# %d: %d [%d: %d] @",
+			d.InUseObjects(), d.InUseBytes(),
+			d.AllocObjects, d.AllocBytes)
+		for _, pc := range d.Stack() {
+			fmt.Fprintf(w, " %#x", pc)
+		}
+		fmt.Fprintf(w, "\n")
+		p.printStack(w, d.Stack())
+	}
+}
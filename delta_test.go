@@ -0,0 +1,86 @@
+package garbage
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSuspects(t *testing.T) {
+	rec := func(pc uintptr, allocBytes, freeBytes int64) runtime.MemProfileRecord {
+		r := runtime.MemProfileRecord{
+			AllocBytes:   allocBytes,
+			AllocObjects: allocBytes / 1024,
+			FreeBytes:    freeBytes,
+			FreeObjects:  freeBytes / 1024,
+		}
+		r.Stack0[0] = pc
+		return r
+	}
+
+	first := []runtime.MemProfileRecord{
+		rec(1, 1<<20, 1<<20),
+		rec(2, 1<<20, 1<<20),
+		rec(3, 1<<20, 0),
+	}
+	last := []runtime.MemProfileRecord{
+		rec(1, 2<<20, 2<<20), // churn: allocated and freed alike
+		rec(2, 9<<20, 2<<20), // leak: 8 MiB allocated, 1 MiB freed
+		rec(3, 1<<20, 0),     // idle
+		rec(4, 5<<20, 0),     // new stack, never freed
+		rec(5, 4<<20, 2<<20), // growing, but freeing too much to suspect
+	}
+
+	sus := suspects(windowDeltas(first, last))
+	if len(sus) != 2 {
+		t.Fatalf("want 2 suspects, got %+v", sus)
+	}
+	if pc := sus[0].Stack()[0]; pc != 2 {
+		t.Errorf("want largest growth at stack 2 first, got %#x", pc)
+	}
+	if got := sus[0].InUseBytes(); got != 7<<20 {
+		t.Errorf("want growth of %d bytes, got %d", 7<<20, got)
+	}
+	if pc := sus[1].Stack()[0]; pc != 4 {
+		t.Errorf("want stack 4 second, got %#x", pc)
+	}
+
+	p := testProfile()
+	p.Suspects = sus
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "# retention suspects") {
+		t.Errorf("missing retention suspects in %q", text)
+	}
+	if want := "# 7168: 7340032 [8192: 8388608] @ 0x2\n"; !strings.Contains(string(text), want) {
+		t.Errorf("want suspect line %q in %q", want, text)
+	}
+}
+
+func TestGrowth(t *testing.T) {
+	deltas := []Delta{
+		{AllocObjects: 4, AllocBytes: 4096, FreeObjects: 4, FreeBytes: 4096},
+		{AllocObjects: 8, AllocBytes: 8192, FreeObjects: 2, FreeBytes: 2048},
+		{AllocObjects: 1, AllocBytes: 1024, FreeObjects: 3, FreeBytes: 3072},
+	}
+
+	recs := growth(deltas)
+	if len(recs) != 2 {
+		t.Fatalf("want 2 records, got %+v", recs)
+	}
+	if recs[0].Objects != 6 || recs[0].Bytes != 6144 {
+		t.Errorf("want growth of 6: 6144, got %d: %d", recs[0].Objects, recs[0].Bytes)
+	}
+	if recs[1].Objects != -2 || recs[1].Bytes != -2048 {
+		t.Errorf("want shrinkage of -2: -2048, got %d: %d", recs[1].Objects, recs[1].Bytes)
+	}
+
+	p := testProfile()
+	p.Kind = growthKind
+	if data := p.encode(); !bytes.Contains(data, []byte("growth_bytes")) {
+		t.Errorf("growth profile missing growth_bytes sample type")
+	}
+}
@@ -0,0 +1,276 @@
+package garbage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBaselineDelay    = time.Minute
+	defaultBaselineDuration = 30 * time.Second
+)
+
+// buildComment prefixes the build of the binary a profile was collected
+// from, if recorded.
+const buildComment = "build: "
+
+// A DeployBaseline captures a baseline garbage profile once, shortly after
+// the process starts, tagged with the build of the binary (see
+// Profile.Build). Serving it at a stable path, such as below the endpoint
+// of a Handler, lets the garbage of each deploy be compared with that of the
+// last, or subtracted from later profiles of the same deploy.
+type DeployBaseline struct {
+	// Delay is how long after Start the capture opens, to let the
+	// process warm up. Zero means one minute.
+	Delay time.Duration
+
+	// Duration is the collection window of the baseline. Zero means 30
+	// seconds.
+	Duration time.Duration
+
+	// Build, if set, identifies the build of the binary, such as a release
+	// tag or image digest, in place of its build info. Binaries built
+	// without a VCS revision are otherwise identified by a hash of the
+	// executable.
+	Build string
+
+	// Dir, if set, is the directory the baseline is written to, named for
+	// the build. A baseline already written there for the build is loaded
+	// by Start instead of capturing a new one, so restarts of the same
+	// deploy keep their baseline. A baseline is neither loaded nor written
+	// if the build cannot be identified.
+	Dir string
+
+	// OnCapture, if set, is called with the baseline once captured.
+	OnCapture func(*Profile)
+
+	// OnError, if set, is called with the error of a capture or of writing
+	// the baseline to Dir.
+	OnError func(error)
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	profile *Profile
+}
+
+// Start schedules the capture of the baseline, if it is not already
+// captured or scheduled.
+func (d *DeployBaseline) Start() {
+	if !enabled {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil || d.profile != nil {
+		return
+	}
+
+	build, known := d.build()
+	if d.Dir != "" && known {
+		if p, err := readBaseline(context.Background(), filepath.Join(d.Dir, baselineName(build))); err == nil {
+			d.profile = p
+			return
+		}
+	}
+
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	go d.capture(ctx, build, known)
+}
+
+// Stop cancels the capture of the baseline if it has not completed.
+func (d *DeployBaseline) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+}
+
+// Profile returns the baseline, or nil if it is not yet captured.
+func (d *DeployBaseline) Profile() *Profile {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.profile
+}
+
+// capture waits out the delay, then collects the baseline and stores it if
+// its build is known.
+func (d *DeployBaseline) capture(ctx context.Context, build string, known bool) {
+	delay := d.Delay
+	if delay <= 0 {
+		delay = defaultBaselineDelay
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return
+	}
+
+	duration := d.Duration
+	if duration <= 0 {
+		duration = defaultBaselineDuration
+	}
+	p, err := NewCollector(Options{Duration: duration}).Collect(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.fail(err)
+		}
+		return
+	}
+	p.Build = build
+
+	d.mu.Lock()
+	d.profile, d.cancel = p, nil
+	d.mu.Unlock()
+
+	if d.Dir != "" {
+		if !known {
+			d.fail(errors.New("garbage: baseline not stored: the build of the binary is unknown"))
+		} else if err := d.store(p); err != nil {
+			d.fail(err)
+		}
+	}
+	if d.OnCapture != nil {
+		d.OnCapture(p)
+	}
+}
+
+// fail reports err to OnError.
+func (d *DeployBaseline) fail(err error) {
+	if d.OnError != nil {
+		d.OnError(err)
+	}
+}
+
+// store writes p to a file in Dir named for its build.
+func (d *DeployBaseline) store(p *Profile) error {
+	if err := os.MkdirAll(d.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := baselineName(p.Build)
+	tmp := filepath.Join(d.Dir, "."+name)
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := p.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(d.Dir, name))
+}
+
+// ServeHTTP serves the baseline in the protocol buffer format, or 404 Not
+// Found until it is captured.
+func (d *DeployBaseline) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := d.Profile()
+	if p == nil {
+		http.Error(w, "garbage: baseline not yet captured", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", baselineName(p.Build)))
+	p.WriteTo(w)
+}
+
+// build returns the build of the binary the baseline is tagged with, and
+// whether it identifies the binary, so that the baselines of different
+// binaries are not stored under the same name.
+func (d *DeployBaseline) build() (string, bool) {
+	if d.Build != "" {
+		return d.Build, true
+	}
+	build, ok := buildInfo()
+	if ok {
+		return build, true
+	}
+	sum, err := executableSum()
+	if err != nil {
+		return build, false
+	}
+	return strings.TrimSpace(build + " sha256:" + sum), true
+}
+
+// buildInfo describes the build of the running binary: the path and version
+// of its main module and the VCS revision it was built from, if known. It
+// reports whether the revision is known.
+func buildInfo() (string, bool) {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", false
+	}
+	build := bi.Main.Path
+	if bi.Main.Version != "" {
+		build += "@" + bi.Main.Version
+	}
+	var rev, modified string
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				modified = "+dirty"
+			}
+		}
+	}
+	if rev != "" {
+		build += " " + rev + modified
+	}
+	return strings.TrimSpace(build), rev != "" && modified == ""
+}
+
+// executableSum returns a prefix of the SHA-256 hash of the running binary.
+func executableSum() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// baselineName returns the name of the file of the baseline of build.
+func baselineName(build string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, build)
+	if name == "" {
+		name = "unknown"
+	}
+	return "baseline-" + name + spoolExt
+}
@@ -0,0 +1,124 @@
+package garbage
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeployBaseline(t *testing.T) {
+	requireEnabled(t)
+
+	if testing.Short() {
+		t.Skip("collects a profile")
+	}
+
+	dir := t.TempDir()
+	captured := make(chan *Profile, 1)
+	d := &DeployBaseline{
+		Delay:     time.Millisecond,
+		Duration:  100 * time.Millisecond,
+		Dir:       dir,
+		OnCapture: func(p *Profile) { captured <- p },
+	}
+	h := &Handler{DeployBaseline: d}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/debug/pprof/garbage/baseline", nil))
+	if w.Code != 404 {
+		t.Errorf("want 404 before the capture, got %d", w.Code)
+	}
+
+	d.Start()
+	defer d.Stop()
+	var p *Profile
+	select {
+	case p = <-captured:
+	case <-time.After(10 * time.Second):
+		t.Fatal("baseline not captured")
+	}
+	if build, _ := d.build(); p.Build != build {
+		t.Errorf("want build %q, got %q", build, p.Build)
+	}
+	if _, err := os.Stat(filepath.Join(dir, baselineName(p.Build))); err != nil {
+		t.Error(err)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/debug/pprof/garbage/baseline", nil))
+	q, err := Parse(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Build != p.Build {
+		t.Errorf("want build %q served, got %q", p.Build, q.Build)
+	}
+
+	// A restart of the same build loads the stored baseline.
+	e := &DeployBaseline{Dir: dir}
+	e.Start()
+	if e.Profile() == nil {
+		t.Error("stored baseline not loaded")
+	}
+}
+
+func TestDeployBaselineStoreError(t *testing.T) {
+	requireEnabled(t)
+
+	if testing.Short() {
+		t.Skip("collects a profile")
+	}
+
+	// Dir is a file, so the baseline cannot be written to it.
+	dir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(dir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	d := &DeployBaseline{
+		Delay:    time.Millisecond,
+		Duration: 100 * time.Millisecond,
+		Dir:      dir,
+		OnError:  func(err error) { errs <- err },
+	}
+	d.Start()
+	defer d.Stop()
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("want an error writing the baseline")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("error writing the baseline not reported")
+	}
+}
+
+func TestDeployBaselineBuild(t *testing.T) {
+	if build, ok := (&DeployBaseline{Build: "v1.2.3"}).build(); build != "v1.2.3" || !ok {
+		t.Errorf("want the explicit build, got %q", build)
+	}
+
+	// Test binaries are built without a VCS revision, so they are
+	// identified by the hash of the executable.
+	build, ok := new(DeployBaseline).build()
+	if !ok || !strings.Contains(build, "sha256:") {
+		t.Errorf("want the build identified by the executable, got %q", build)
+	}
+	if again, _ := new(DeployBaseline).build(); again != build {
+		t.Errorf("want a stable build, got %q and %q", build, again)
+	}
+}
+
+func TestBaselineName(t *testing.T) {
+	if got, want := baselineName("example.com/svc@v1.2.3 abc123+dirty"), "baseline-example.com_svc_v1.2.3_abc123_dirty.pb.gz"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if got, want := baselineName(""), "baseline-unknown.pb.gz"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
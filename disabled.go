@@ -0,0 +1,10 @@
+//go:build nogarbageprofile
+
+package garbage
+
+// enabled is false when built with the nogarbageprofile tag: the handler is
+// not registered, Garbage responds 404, Collect returns an empty profile
+// without running the collector, NotifyGC sends no events, and
+// EstimateGCInterval observes no cycles, so the linker drops the collection
+// machinery from the binary.
+const enabled = false
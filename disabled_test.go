@@ -0,0 +1,43 @@
+//go:build nogarbageprofile
+
+package garbage
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestDisabled(t *testing.T) {
+	ch := make(chan GCEvent, 1)
+	NotifyGC(ch)
+	defer StopGC(ch)
+
+	runtime.GC()
+	if d, err := EstimateGCInterval(10 * time.Millisecond); d != 10*time.Millisecond || !errors.Is(err, ErrNoGC) {
+		t.Errorf("EstimateGCInterval: want 10ms and ErrNoGC, got %v and %v", d, err)
+	}
+	if _, cycles, ok := gcInterval(10*time.Millisecond, nil); cycles != 0 || !ok {
+		t.Errorf("gcInterval: want no cycles, got %d", cycles)
+	}
+
+	select {
+	case ev := <-ch:
+		t.Errorf("NotifyGC: want no events, got %+v", ev)
+	case <-time.After(2 * gcPollInterval):
+	}
+	if gcNotifier.running {
+		t.Error("NotifyGC: want no poller running")
+	}
+	rec := httptest.NewRecorder()
+	new(Handler).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/garbage", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Handler: want code %d, got %d", http.StatusNotFound, rec.Code)
+	}
+	if prof := Collect(10 * time.Millisecond); len(prof.Records) > 0 {
+		t.Errorf("Collect: want an empty profile, got %d records", len(prof.Records))
+	}
+}
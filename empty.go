@@ -0,0 +1,42 @@
+package garbage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// emptyComment prefixes the explanation of an empty garbage profile, written
+// in the footer of the text format and the comments of the protocol buffer.
+const emptyComment = "empty: "
+
+// emptyNote explains why the garbage profile is empty, with the likely
+// causes, or returns "" if it is not: either it observed no GC cycles, or
+// none of the cycles it observed freed a sampled object.
+func (p *Profile) emptyNote() string {
+	if p.kind() != garbageKind || len(p.Records) > 0 {
+		return ""
+	}
+
+	var reason string
+	var causes []string
+	if len(p.Cycles) == 0 {
+		reason = fmt.Sprintf("no GC cycles observed in the %v window", p.Duration.Round(time.Millisecond))
+		causes = []string{
+			"the GC is off (GOGC=off)",
+			"the process is idle",
+			"the window is shorter than the GC period; retry with a longer window or waitgc=1",
+		}
+	} else {
+		reason = fmt.Sprintf("no garbage attributed in %d GC cycles", len(p.Cycles))
+		causes = []string{
+			"the process is idle",
+			fmt.Sprintf("too little garbage to sample at 1 in %d bytes", p.Rate),
+			"the process keeps all it allocates live",
+		}
+	}
+	if p.Truncated {
+		causes = append(causes, "the collection was cancelled")
+	}
+	return fmt.Sprintf("%s%s; likely causes: %s", emptyComment, reason, strings.Join(causes, ", "))
+}
@@ -0,0 +1,55 @@
+package garbage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmptyNote(t *testing.T) {
+	p := &Profile{Duration: 2 * time.Second, Rate: 512 * 1024}
+	note := p.emptyNote()
+	if !strings.HasPrefix(note, "empty: no GC cycles observed in the 2s window; likely causes: the GC is off (GOGC=off),") {
+		t.Errorf("bad note without cycles: %q", note)
+	}
+
+	var buf bytes.Buffer
+	if err := p.writeText(&buf, textOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "# "+note+"\n") {
+		t.Errorf("note missing from text:\n%s", buf.String())
+	}
+
+	data, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(raw, []byte(note)) {
+		t.Errorf("note missing from the protocol buffer comments")
+	}
+
+	p.Cycles = []Cycle{{NumGC: 1}, {NumGC: 2}}
+	if note := p.emptyNote(); !strings.HasPrefix(note, "empty: no garbage attributed in 2 GC cycles; likely causes: the process is idle, too little garbage to sample at 1 in 524288 bytes") {
+		t.Errorf("bad note without garbage: %q", note)
+	}
+
+	p.Records = []Record{{Objects: 1, Bytes: 16, Stack0: [32]uintptr{1}}}
+	if note := p.emptyNote(); note != "" {
+		t.Errorf("want no note on a profile with garbage, got %q", note)
+	}
+	if note := (&Profile{Kind: growthKind}).emptyNote(); note != "" {
+		t.Errorf("want no note on a growth profile, got %q", note)
+	}
+}
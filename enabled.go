@@ -0,0 +1,7 @@
+//go:build !nogarbageprofile
+
+package garbage
+
+// enabled reports whether the garbage profiler is compiled in. Build with the
+// nogarbageprofile tag to compile it out.
+const enabled = true
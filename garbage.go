@@ -2,178 +2,203 @@
 // by the pprof visualization tool. The profile shows estimates for garbage
 // allocations over a given time duration:
 //
-//     go tool pprof http://127.0.0.1:6000/debug/pprof/garbage?debug=1
+//     go tool pprof http://127.0.0.1:6000/debug/pprof/garbage
+//
+// Like the heap endpoint of net/http/pprof, the debug parameter selects the
+// format: 0 (the default) for the protocol buffer, 1 for the legacy text
+// format with symbolized stacks, and 2 to add the GC cycles observed and the
+// runtime.MemStats.
 //
 // See https://github.com/golang/go/issues/16629 for more details.
+//
+// The /debug/pprof/growth endpoint profiles the net growth in memory in use
+// over the same kind of window, so churn and leaks can be compared directly.
+//
+// A Monitor collects continuously, keeping the most recent GC cycles for
+// rolling metrics; the /debug/pprof/garbage/metrics endpoint serves those of
+// DefaultMonitor in the OpenMetrics text format.
+//
+// Programs can collect a Profile directly with a Collector, and read its
+// records and their symbolized Frames rather than an encoded profile.
+//
+// A Pusher collects profiles continuously and pushes them to an HTTP endpoint,
+// over mutual TLS if need be.
+//
+// NotifyGC delivers an event on a channel as GC cycles complete, for tooling
+// that reacts to the garbage collector without a polling loop of its own.
+//
+// Wrap the net/http/pprof index with Index to list the garbage profile on the
+// /debug/pprof/ page.
+//
+// Building with the nogarbageprofile tag compiles the profiler out: the
+// endpoint is not registered and collection functions are no-ops.
+//
+// The package imports only the standard library, the protocol buffer encoding
+// included, so registering the handler adds little to a binary. Integrations
+// that need other modules or assets are in subpackages that programs import
+// only if they use them: proto converts profiles for the pprof libraries,
+// sinks/s3 stores pushed profiles in S3, and ui serves a page viewing the
+// profile.
 package garbage
 
 import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"runtime"
-	"strconv"
 	"strings"
-	"text/tabwriter"
 	"time"
 )
 
 func init() {
-	http.Handle("/debug/pprof/garbage", http.HandlerFunc(Garbage))
+	if !enabled {
+		return
+	}
+	// Since Go 1.22, net/http/pprof registers "GET /debug/pprof/", which
+	// conflicts with patterns below it that have no method.
+	methods := []string{""}
+	if methodPatterns() {
+		methods = []string{"GET ", "POST "}
+	}
+	garbage, growth := new(Handler), &Handler{Growth: true}
+	for _, m := range methods {
+		http.Handle(m+"/debug/pprof/garbage", garbage)
+		http.Handle(m+"/debug/pprof/garbage/", garbage)
+		http.Handle(m+"/debug/pprof/growth", growth)
+		http.Handle(m+"/debug/pprof/growth/", growth)
+	}
+}
+
+// methodPatterns reports whether the patterns of http.ServeMux may begin with
+// a method, as since Go 1.22 unless GODEBUG sets httpmuxgo121=1.
+func methodPatterns() bool {
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.NotFoundHandler())
+	_, pattern := mux.Handler(&http.Request{Method: "GET", URL: &url.URL{Path: "/"}})
+	return pattern != ""
 }
 
 // Garbage returns an HTTP handler that serves the garbage profile.
 func Garbage(w http.ResponseWriter, r *http.Request) {
-	sec, _ := strconv.Atoi(r.FormValue("seconds"))
-	if sec == 0 {
-		sec = 30
-	}
-
-	debug, _ := strconv.Atoi(r.FormValue("debug"))
-
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.(http.Flusher).Flush()
-
-	WriteGarbageProfile(w, time.Duration(sec)*time.Second, debug != 0)
+	new(Handler).ServeHTTP(w, r)
 }
 
 // WriteGarbageProfile writes a pprof-formatted snapshot of the garbage profile
 // to w. The profile runs twice as long as duration: the first half is
 // calculating the GC period for the duration. The debug parameter enables
-// additional output.
+// additional output. It is safe to call WriteGarbageProfile concurrently:
+// overlapping profiles share a single collector. The output keeps the CompatV1
+// layout.
 func WriteGarbageProfile(w io.Writer, duration time.Duration, debug bool) {
-	var garbage, prev []runtime.MemProfileRecord
-
+	opts := textOptions{format: CompatV1}
 	if debug {
-		w = tabwriter.NewWriter(w, 1, 8, 1, '\t', 0)
-	}
-
-	runtime.GC()
-
-	periodGC, numGC := calcPeriod(duration)
-	ticker := time.NewTicker(periodGC / 10)
-	defer ticker.Stop()
-
-	periodc := ticker.C
-	finc := time.After(duration)
-	for {
-		var fin bool
-		if numGC, fin = waitGC(numGC, periodc, finc); fin {
-			break
-		}
-
-		curr := read()
-		if prev != nil {
-			for _, cr := range curr {
-				if pr, ok := find(prev, cr); ok {
-					garbage = update(garbage, pr, cr)
-				}
-			}
-		}
-		prev = curr
-	}
-
-	var total runtime.MemProfileRecord
-	for _, r := range garbage {
-		total.AllocBytes += r.AllocBytes
-		total.AllocObjects += r.AllocObjects
-	}
-
-	fmt.Fprintf(w, "heap profile: %d: %d [%d: %d] @ heap/%d\n",
-		total.InUseObjects(), total.InUseBytes(),
-		total.AllocObjects, total.AllocBytes,
-		2*runtime.MemProfileRate)
-
-	for i := range garbage {
-		r := &garbage[i]
-		fmt.Fprintf(w, "%d: %d [%d: %d] @",
-			r.InUseObjects(), r.InUseBytes(),
-			r.AllocObjects, r.AllocBytes)
-		for _, pc := range r.Stack() {
-			fmt.Fprintf(w, " %#x", pc)
-		}
-		fmt.Fprintf(w, "\n")
-		if debug {
-			printStackRecord(w, r.Stack(), false)
-		}
+		opts.debug = 1
 	}
+	Collect(duration).writeText(w, opts)
 }
 
-func calcPeriod(duration time.Duration) (time.Duration, uint32) {
-	memstats := new(runtime.MemStats)
-	runtime.ReadMemStats(memstats)
-	startGC := memstats.NumGC
-
-	time.Sleep(duration)
+// sleep pauses for duration, returning false if cancel is closed first.
+func sleep(duration time.Duration, cancel <-chan struct{}) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
 
-	runtime.ReadMemStats(memstats)
-	return duration / time.Duration(memstats.NumGC-startGC), memstats.NumGC
+	select {
+	case <-timer.C:
+		return true
+	case <-cancel:
+		return false
+	}
 }
 
-func waitGC(numGC uint32, periodc, finc <-chan time.Time) (uint32, bool) {
-	memstats := new(runtime.MemStats)
-
-	i := 0
-	for {
-		i++
-		select {
-		case <-finc:
-			return numGC, true
-		case <-periodc:
-			runtime.ReadMemStats(memstats)
-			if memstats.NumGC != numGC {
-				return memstats.NumGC, false
-			}
+// diff returns the garbage attributed to each stack between two reads of the
+// memory profile: the objects freed since prev. The throttle, if any, paces
+// the comparison.
+func diff(prev, curr []runtime.MemProfileRecord, t *throttle) []Record {
+	var recs []Record
+	index := make(map[[32]uintptr]int)
+	prevs := byStack(prev)
+	for _, cr := range curr {
+		t.tick()
+		if pr, ok := prevs[cr.Stack0]; ok {
+			recs = update(recs, index, pr, cr)
 		}
 	}
+	return recs
 }
 
-func update(recs []runtime.MemProfileRecord, prev, curr runtime.MemProfileRecord) []runtime.MemProfileRecord {
-	garbage := runtime.MemProfileRecord{
-		AllocBytes:   min(curr.FreeBytes, prev.AllocBytes),
-		AllocObjects: min(curr.FreeObjects, prev.AllocObjects),
-		Stack0:       curr.Stack0,
+// update adds the garbage for the stack of curr, the objects freed since prev,
+// to recs, whose stacks are indexed by index.
+func update(recs []Record, index map[[32]uintptr]int, prev, curr runtime.MemProfileRecord) []Record {
+	garbage := Record{
+		Bytes:   curr.FreeBytes - prev.FreeBytes,
+		Objects: curr.FreeObjects - prev.FreeObjects,
+		Cycles:  1,
+		Stack0:  curr.Stack0,
+	}
+	if garbage.Objects == 0 {
+		return recs
 	}
 
-	for i, rec := range recs {
-		if sameStack(rec, curr) {
-			recs[i].AllocBytes += garbage.AllocBytes
-			recs[i].AllocObjects += garbage.AllocObjects
+	return mergeIndexed(recs, index, garbage)
+}
 
+// merge adds the garbage of r to the record for the same stack in recs.
+func merge(recs []Record, r Record) []Record {
+	for i, rec := range recs {
+		if rec.Stack0 == r.Stack0 {
+			recs[i].add(r)
 			return recs
 		}
 	}
 
-	return append(recs, garbage)
+	return append(recs, r)
 }
 
-func find(recs []runtime.MemProfileRecord, want runtime.MemProfileRecord) (runtime.MemProfileRecord, bool) {
-	for _, rec := range recs {
-		if sameStack(rec, want) {
-			return rec, true
-		}
+// mergeAll merges each of add into recs, as merge does, in time linear in
+// the records of both.
+func mergeAll(recs, add []Record) []Record {
+	if len(add) == 0 {
+		return recs
+	}
+	index := make(map[[32]uintptr]int, len(recs)+len(add))
+	for i := range recs {
+		index[recs[i].Stack0] = i
+	}
+	for _, r := range add {
+		recs = mergeIndexed(recs, index, r)
 	}
-	return runtime.MemProfileRecord{}, false
+	return recs
 }
 
-func sameStack(r1, r2 runtime.MemProfileRecord) bool {
-	if len(r1.Stack0) != len(r2.Stack0) {
-		return false
-	}
-	for i := range r1.Stack0 {
-		if r1.Stack0[i] != r2.Stack0[i] {
-			return false
-		}
+// mergeIndexed merges r into recs, as merge does, with index the position of
+// each stack of recs, which it keeps up to date.
+func mergeIndexed(recs []Record, index map[[32]uintptr]int, r Record) []Record {
+	if i, ok := index[r.Stack0]; ok {
+		recs[i].add(r)
+		return recs
 	}
-	return true
+	index[r.Stack0] = len(recs)
+	return append(recs, r)
 }
 
-func min(a, b int64) int64 {
-	if a > b {
-		return b
+// add adds the garbage of r, of the same stack, to the record.
+func (rec *Record) add(r Record) {
+	rec.Bytes += r.Bytes
+	rec.Objects += r.Objects
+	rec.Cycles += r.Cycles
+	rec.Ages.add(r.Ages)
+	rec.Sizes.add(r.Sizes)
+}
+
+// byStack indexes recs by stack, so that reads of the memory profile can be
+// compared in linear time.
+func byStack(recs []runtime.MemProfileRecord) map[[32]uintptr]runtime.MemProfileRecord {
+	m := make(map[[32]uintptr]runtime.MemProfileRecord, len(recs))
+	for _, rec := range recs {
+		m[rec.Stack0] = rec
 	}
-	return a
+	return m
 }
 
 func read() []runtime.MemProfileRecord {
@@ -1,7 +1,10 @@
 package garbage
 
 import (
+	"bytes"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -14,8 +17,12 @@ func TestGarbage(t *testing.T) {
 	WriteGarbageProfile(os.Stdout, 10*time.Second, true)
 }
 
+// garbageWindow bounds the generators of TestGarbage to its profile, so they
+// do not run on into the tests after it.
+const garbageWindow = 10 * time.Second
+
 func genGarbage() {
-	for {
+	for start := time.Now(); time.Since(start) < garbageWindow; {
 		bytes := make([]byte, 10<<20)
 		for i := range bytes {
 			bytes[i] = byte(i)
@@ -25,7 +32,7 @@ func genGarbage() {
 }
 
 func lessGarbage() {
-	for {
+	for start := time.Now(); time.Since(start) < garbageWindow; {
 		bytes := make([]byte, 1<<20)
 		for i := range bytes {
 			bytes[i] = byte(i)
@@ -37,7 +44,7 @@ func lessGarbage() {
 var hold = make([][]byte, 0, 1<<20)
 
 func notGarbage() {
-	for {
+	for start := time.Now(); time.Since(start) < garbageWindow; {
 		bytes := make([]byte, 1<<20)
 		for i := range bytes {
 			bytes[i] = byte(i)
@@ -46,4 +53,88 @@ func notGarbage() {
 
 		time.Sleep(1 * time.Millisecond)
 	}
+	hold = nil
+}
+
+func TestGarbageAttribution(t *testing.T) {
+	requireEnabled(t)
+	if testing.Short() {
+		t.Skip("collects for 2s of wall-clock time")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go churn(done)
+
+	var buf bytes.Buffer
+	WriteGarbageProfile(&buf, 2*time.Second, true)
+	if !strings.Contains(buf.String(), "garbage.churn") {
+		t.Errorf("profile does not attribute garbage to churn:\n%s", buf.String())
+	}
+}
+
+// churn allocates garbage until done is closed.
+func churn(done <-chan struct{}) {
+	for !stopped(done) {
+		bytes := make([]byte, 1<<20)
+		for i := range bytes {
+			bytes[i] = byte(i)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func stopped(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestGarbageConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	bufs := make([]bytes.Buffer, 4)
+	for i := range bufs {
+		wg.Add(1)
+		go func(buf *bytes.Buffer) {
+			defer wg.Done()
+			WriteGarbageProfile(buf, time.Second, false)
+		}(&bufs[i])
+	}
+	wg.Wait()
+
+	for i := range bufs {
+		if !strings.HasPrefix(bufs[i].String(), "heap profile: ") {
+			t.Errorf("profile %d: missing header: %q", i, bufs[i].String())
+		}
+	}
+
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		shared.mu.Lock()
+		running := shared.running
+		shared.mu.Unlock()
+
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("collector still running after all profiles finished")
+		}
+	}
+}
+
+// requireEnabled skips a test that needs a running collector when the
+// profiler is compiled out by the nogarbageprofile tag.
+func requireEnabled(tb testing.TB) {
+	tb.Helper()
+	if !enabled {
+		tb.Skip("the profiler is compiled out")
+	}
+}
+
+// testRecord returns a record of the garbage of one GC cycle at pc.
+func testRecord(pc uintptr, objects, bytes int64) Record {
+	return Record{Objects: objects, Bytes: bytes, Cycles: 1, Stack0: [32]uintptr{pc}}
 }
@@ -0,0 +1,28 @@
+// Package garbagechi mounts the garbage profile on a chi router, behind the
+// router's middleware chain:
+//
+//	r := chi.NewRouter()
+//	r.Use(middleware.Logger)
+//	garbagechi.Mount(r, "/debug/pprof/garbage", nil, auth)
+//	garbagechi.Mount(r, "/debug/pprof/growth", &garbage.Handler{Growth: true}, auth)
+package garbagechi
+
+import (
+	"net/http"
+
+	garbage "github.com/benburkert/pprof-garbage"
+	"github.com/go-chi/chi/v5"
+)
+
+// Mount serves h on r at path, such as "/debug/pprof/garbage", and on the
+// subtree below it, which serves the progress, cancel and collector endpoints
+// of h, behind the middleware of r and then middleware. A nil h serves the
+// garbage profile as garbage.Garbage does.
+func Mount(r chi.Router, path string, h *garbage.Handler, middleware ...func(http.Handler) http.Handler) {
+	if h == nil {
+		h = new(garbage.Handler)
+	}
+	r = r.With(middleware...)
+	r.Handle(path, h)
+	r.Handle(path+"/*", h)
+}
@@ -0,0 +1,57 @@
+package garbagechi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMount(t *testing.T) {
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Auth") != "ok" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	h := chi.NewRouter()
+	Mount(h, "/debug/pprof/garbage", nil, auth)
+	h.Get("/other", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		method, path, auth string
+		want               int
+	}{
+		{"HEAD", "/debug/pprof/garbage", "", http.StatusUnauthorized},
+		{"HEAD", "/debug/pprof/garbage", "ok", http.StatusOK},
+		{"GET", "/debug/pprof/garbage/collector", "ok", http.StatusOK},
+		{"POST", "/debug/pprof/garbage/cancel", "ok", http.StatusNotFound},
+		{"GET", "/debug/pprof/garbage/collector", "", http.StatusUnauthorized},
+		{"GET", "/other", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.auth != "" {
+			r.Header.Set("X-Auth", test.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.want {
+			t.Errorf("%s %s: want status %d, got %d: %s", test.method, test.path, test.want, w.Code, w.Body)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/debug/pprof/garbage/collector", nil)
+	r.Header.Set("X-Auth", "ok")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if !strings.Contains(w.Body.String(), "\"subscribers\"") {
+		t.Errorf("want the collector status, got %s", w.Body)
+	}
+}
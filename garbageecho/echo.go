@@ -0,0 +1,31 @@
+// Package garbageecho mounts the garbage profile on an echo router, behind
+// the router's middleware chain:
+//
+//	e := echo.New()
+//	e.Use(middleware.Logger())
+//	garbageecho.Mount(e, "/debug/pprof/garbage", nil, auth)
+//	garbageecho.Mount(e, "/debug/pprof/growth", &garbage.Handler{Growth: true}, auth)
+package garbageecho
+
+import (
+	garbage "github.com/benburkert/pprof-garbage"
+	"github.com/labstack/echo/v4"
+)
+
+// A Router is an *echo.Echo or an *echo.Group.
+type Router interface {
+	Any(path string, h echo.HandlerFunc, middleware ...echo.MiddlewareFunc) []*echo.Route
+}
+
+// Mount serves h on r at path, such as "/debug/pprof/garbage", and on the
+// subtree below it, which serves the progress, cancel and collector endpoints
+// of h, behind the middleware of r and then middleware. A nil h serves the
+// garbage profile as garbage.Garbage does.
+func Mount(r Router, path string, h *garbage.Handler, middleware ...echo.MiddlewareFunc) {
+	if h == nil {
+		h = new(garbage.Handler)
+	}
+	eh := echo.WrapHandler(h)
+	r.Any(path, eh, middleware...)
+	r.Any(path+"/*", eh, middleware...)
+}
@@ -0,0 +1,27 @@
+// Package garbagegin mounts the garbage profile on a gin router, behind the
+// router's middleware chain:
+//
+//	r := gin.New()
+//	r.Use(gin.Logger())
+//	garbagegin.Mount(r, "/debug/pprof/garbage", nil, auth)
+//	garbagegin.Mount(r, "/debug/pprof/growth", &garbage.Handler{Growth: true}, auth)
+package garbagegin
+
+import (
+	garbage "github.com/benburkert/pprof-garbage"
+	"github.com/gin-gonic/gin"
+)
+
+// Mount serves h on r, an *gin.Engine or *gin.RouterGroup, at path, such as
+// "/debug/pprof/garbage", and on the subtree below it, which serves the
+// progress, cancel and collector endpoints of h, behind the middleware of r
+// and then middleware. A nil h serves the garbage profile as garbage.Garbage
+// does.
+func Mount(r gin.IRoutes, path string, h *garbage.Handler, middleware ...gin.HandlerFunc) {
+	if h == nil {
+		h = new(garbage.Handler)
+	}
+	handlers := append(middleware[:len(middleware):len(middleware)], gin.WrapH(h))
+	r.Any(path, handlers...)
+	r.Any(path+"/*endpoint", handlers...)
+}
@@ -0,0 +1,27 @@
+// Package garbagemux mounts the garbage profile on a gorilla/mux router,
+// behind the router's middleware chain:
+//
+//	r := mux.NewRouter()
+//	r.Use(logging)
+//	garbagemux.Mount(r, "/debug/pprof/garbage", nil, auth)
+//	garbagemux.Mount(r, "/debug/pprof/growth", &garbage.Handler{Growth: true}, auth)
+package garbagemux
+
+import (
+	garbage "github.com/benburkert/pprof-garbage"
+	"github.com/gorilla/mux"
+)
+
+// Mount serves h on r at path, such as "/debug/pprof/garbage", and on the
+// subtree below it, which serves the progress, cancel and collector endpoints
+// of h, behind the middleware of r and then middleware, which applies to h
+// alone. A nil h serves the garbage profile as garbage.Garbage does.
+func Mount(r *mux.Router, path string, h *garbage.Handler, middleware ...mux.MiddlewareFunc) {
+	if h == nil {
+		h = new(garbage.Handler)
+	}
+	sub := r.PathPrefix(path).Subrouter()
+	sub.Use(middleware...)
+	sub.Handle("", h)
+	sub.PathPrefix("/").Handler(h)
+}
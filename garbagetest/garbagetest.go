@@ -0,0 +1,219 @@
+// Package garbagetest provides synthetic workloads for validating the
+// accuracy of garbage profiles, and a handler for testing the wiring of the
+// endpoint (see ServeProfile).
+//
+// A Generator allocates objects of a given size at a given rate and drops
+// each after a given lifetime. Each running generator allocates from its own
+// stack, so the garbage attributed to it can be compared with the garbage it
+// actually produced:
+//
+//	g := &garbagetest.Generator{Size: 1 << 20, Interval: time.Millisecond}
+//	g.Start()
+//	defer g.Stop()
+//
+//	p := garbage.Collect(10 * time.Second)
+//	garbagetest.CheckAccuracy(t, p, 0.25, g)
+package garbagetest
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// maxGenerators is the number of generators that may run at once. Generators
+// are told apart by the depth of their stacks, which the memory profile
+// truncates at 32 frames.
+const maxGenerators = 24
+
+var ids struct {
+	sync.Mutex
+	used [maxGenerators + 1]bool
+}
+
+// A Generator is a synthetic workload that allocates an object of Size bytes
+// every Interval, which must be positive, and drops it after Lifetime. A zero
+// Lifetime drops each object immediately; a negative Lifetime never drops
+// them.
+type Generator struct {
+	Size     int
+	Interval time.Duration
+	Lifetime time.Duration
+
+	id      int
+	start   time.Time
+	stop    chan struct{}
+	done    chan struct{}
+	dropped int64 // objects dropped, updated atomically
+
+	sink []byte
+	live []object
+}
+
+type object struct {
+	buf     []byte
+	expires time.Time
+}
+
+// Start starts the generator. It panics if too many generators are running.
+func (g *Generator) Start() {
+	ids.Lock()
+	for id := 1; id <= maxGenerators; id++ {
+		if !ids.used[id] {
+			ids.used[id], g.id = true, id
+			break
+		}
+	}
+	ids.Unlock()
+	if g.id == 0 {
+		panic("garbagetest: too many generators")
+	}
+
+	g.start = time.Now()
+	g.stop = make(chan struct{})
+	g.done = make(chan struct{})
+	atomic.StoreInt64(&g.dropped, 0)
+	go func() {
+		defer close(g.done)
+		nest(g.id, g.run)
+	}()
+}
+
+// Stop stops the generator and releases the objects it holds.
+func (g *Generator) Stop() {
+	close(g.stop)
+	<-g.done
+	g.sink, g.live = nil, nil
+
+	ids.Lock()
+	ids.used[g.id] = false
+	ids.Unlock()
+}
+
+// nest calls f depth frames deep, giving each generator a stack of its own.
+//
+//go:noinline
+func nest(depth int, f func()) {
+	if depth == 0 {
+		f()
+		return
+	}
+	nest(depth-1, f)
+}
+
+func (g *Generator) run() {
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case now := <-ticker.C:
+			g.alloc(now)
+		}
+	}
+}
+
+//go:noinline
+func (g *Generator) alloc(now time.Time) {
+	buf := make([]byte, g.Size)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+
+	switch {
+	case g.Lifetime == 0:
+		if g.sink != nil {
+			atomic.AddInt64(&g.dropped, 1)
+		}
+		g.sink = buf
+	default:
+		g.live = append(g.live, object{buf: buf, expires: now.Add(g.Lifetime)})
+		if g.Lifetime < 0 {
+			return
+		}
+		var n int
+		for n < len(g.live) && !g.live[n].expires.After(now) {
+			n++
+		}
+		if n > 0 {
+			atomic.AddInt64(&g.dropped, int64(n))
+			g.live = append(g.live[:0], g.live[n:]...)
+		}
+	}
+}
+
+// Match reports whether r is attributed to the generator.
+func (g *Generator) Match(r *garbage.Record) bool {
+	depth := 0
+	frames := runtime.CallersFrames(r.Stack())
+	for {
+		f, more := frames.Next()
+		if f.Function == "github.com/benburkert/pprof-garbage/garbagetest.nest" {
+			depth++
+		}
+		if !more {
+			break
+		}
+	}
+	// nest is called once more than the generator's depth.
+	return depth == g.id+1
+}
+
+// Expected returns the garbage bytes the generator is expected to produce
+// over the window of p, from the rate at which it has dropped objects since it
+// started.
+func (g *Generator) Expected(p *garbage.Profile) int64 {
+	elapsed := time.Since(g.start)
+	if elapsed <= 0 {
+		return 0
+	}
+	rate := float64(atomic.LoadInt64(&g.dropped)) / elapsed.Seconds()
+	return int64(rate * p.Duration.Seconds() * float64(g.Size))
+}
+
+// Measured returns the garbage bytes that p attributes to the generator,
+// scaled to estimate all allocations.
+func (g *Generator) Measured(p *garbage.Profile) int64 {
+	var objects, bytes int64
+	for i := range p.Records {
+		if r := &p.Records[i]; g.Match(r) {
+			objects += r.Objects
+			bytes += r.Bytes
+		}
+	}
+	if objects == 0 || p.Rate <= 1 {
+		return bytes
+	}
+
+	avgSize := float64(bytes) / float64(objects)
+	return int64(float64(bytes) / (1 - math.Exp(-avgSize/float64(p.Rate))))
+}
+
+// CheckAccuracy reports an error if the garbage that p attributes to any of
+// the generators is not within tolerance, a fraction, of the garbage it was
+// expected to produce.
+func CheckAccuracy(tb testing.TB, p *garbage.Profile, tolerance float64, gens ...*Generator) {
+	tb.Helper()
+
+	for _, g := range gens {
+		want, got := g.Expected(p), g.Measured(p)
+		if want == 0 {
+			if got != 0 {
+				tb.Errorf("generator %d (%d bytes every %v, lifetime %v): want no garbage, got %d bytes",
+					g.id, g.Size, g.Interval, g.Lifetime, got)
+			}
+			continue
+		}
+		if err := math.Abs(float64(got-want)) / float64(want); err > tolerance {
+			tb.Errorf("generator %d (%d bytes every %v, lifetime %v): want %d bytes of garbage, got %d (%.0f%% off)",
+				g.id, g.Size, g.Interval, g.Lifetime, want, got, 100*err)
+		}
+	}
+}
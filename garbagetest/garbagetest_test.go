@@ -0,0 +1,77 @@
+//go:build !nogarbageprofile
+
+package garbagetest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+func TestAccuracy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("collects for 6s of wall-clock time")
+	}
+
+	gens := []*Generator{
+		{Size: 1 << 20, Interval: 5 * time.Millisecond},
+		{Size: 256 << 10, Interval: 2 * time.Millisecond, Lifetime: 100 * time.Millisecond},
+		{Size: 64 << 10, Interval: 10 * time.Millisecond, Lifetime: -1},
+	}
+	for _, g := range gens {
+		g.Start()
+		defer g.Stop()
+	}
+
+	p := garbage.Collect(3 * time.Second)
+	CheckAccuracy(t, p, 0.25, gens...)
+}
+
+func TestServeProfile(t *testing.T) {
+	srv := ServeProfile(t, ServeOptions{
+		Handler: &garbage.Handler{Token: "secret"},
+		Wrap:    func(h http.Handler) http.Handler { return http.StripPrefix("/debug/garbage", h) },
+	})
+
+	get := func(token string) *http.Response {
+		req, err := http.NewRequest("GET", srv.URL+"/debug/garbage?debug=1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := get(""); resp.StatusCode == http.StatusOK {
+		t.Errorf("want unauthorized without the token, got %s", resp.Status)
+	}
+
+	start := time.Now()
+	resp := get("secret")
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200 OK, got %s: %s", resp.Status, body)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("want the replay served at once, took %v", d)
+	}
+	for _, want := range []string{"heap profile: 800:", "garbagetest.decode", "garbagetest.encode", "# cycles: 4"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("%q missing from profile:\n%s", want, body)
+		}
+	}
+}
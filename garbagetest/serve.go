@@ -0,0 +1,112 @@
+package garbagetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	garbage "github.com/benburkert/pprof-garbage"
+	"github.com/benburkert/pprof-garbage/internal/replay"
+)
+
+// ServeOptions configure the handler served by ServeProfile.
+type ServeOptions struct {
+	// Handler is the handler to serve, configured as the program configures
+	// its own. Nil means a zero Handler. It is copied, not modified.
+	Handler *garbage.Handler
+
+	// Recording is replayed in place of the GC for every request. Nil means
+	// a synthetic recording of a few GC cycles of garbage from the stacks of
+	// this package.
+	Recording *garbage.Recording
+
+	// Wrap, if set, wraps the handler as the program mounts it, such as in
+	// its router or behind its middleware.
+	Wrap func(http.Handler) http.Handler
+}
+
+// ServeProfile serves the garbage profile handler on an httptest.Server that
+// is closed when the test ends. The handler replays a recording instead of
+// observing the GC, so each request is served in milliseconds rather than
+// twice its window, to test a program's wiring of the handler, such as its
+// authorization, routing and formats:
+//
+//	srv := garbagetest.ServeProfile(t, garbagetest.ServeOptions{
+//		Handler: &garbage.Handler{Token: "secret"},
+//	})
+//	resp, err := http.Get(srv.URL + "?debug=1")
+func ServeProfile(tb testing.TB, opts ServeOptions) *httptest.Server {
+	tb.Helper()
+
+	var h garbage.Handler
+	if opts.Handler != nil {
+		h = *opts.Handler
+	}
+	rec := opts.Recording
+	if rec == nil {
+		rec = synthetic(time.Now())
+	}
+	replay.SetHandler(&h, rec)
+
+	var handler http.Handler = &h
+	if opts.Wrap != nil {
+		handler = opts.Wrap(handler)
+	}
+	srv := httptest.NewServer(handler)
+	tb.Cleanup(srv.Close)
+	return srv
+}
+
+// syntheticCycles is the number of GC cycles of the synthetic recording, one
+// a second.
+const syntheticCycles = 4
+
+// synthetic returns a recording of syntheticCycles GC cycles up to now, in
+// which the stacks of decode and encode each allocate garbage.
+func synthetic(now time.Time) *garbage.Recording {
+	stacks := [][32]uintptr{decode(), encode()}
+	start := now.Add(-syntheticCycles * time.Second)
+	rec := &garbage.Recording{
+		Start:    start,
+		Duration: syntheticCycles * time.Second,
+		Rate:     1,
+	}
+	for i := 0; i < syntheticCycles; i++ {
+		rc := garbage.RecordedCycle{
+			Cycle: garbage.Cycle{
+				NumGC:    uint32(i + 1),
+				Time:     start.Add(time.Duration(i+1) * time.Second),
+				Pause:    100 * time.Microsecond,
+				HeapLive: 4 << 20,
+				HeapGoal: 8 << 20,
+			},
+		}
+		for j, stk := range stacks {
+			size := int64(64) << (4 * j)
+			rc.Deltas = append(rc.Deltas, garbage.Delta{
+				AllocObjects: 100,
+				AllocBytes:   100 * size,
+				FreeObjects:  100,
+				FreeBytes:    100 * size,
+				Stack0:       stk,
+			})
+		}
+		rec.Cycles = append(rec.Cycles, rc)
+	}
+	return rec
+}
+
+//go:noinline
+func decode() [32]uintptr { return callers() }
+
+//go:noinline
+func encode() [32]uintptr { return callers() }
+
+// callers returns the stack of its caller.
+func callers() [32]uintptr {
+	var stk [32]uintptr
+	runtime.Callers(2, stk[:])
+	return stk
+}
@@ -0,0 +1,77 @@
+package garbage
+
+import (
+	"errors"
+	"runtime"
+	"runtime/metrics"
+	"time"
+)
+
+// ErrNoGC is returned by EstimateGCInterval if no GC cycle completed in the
+// window.
+var ErrNoGC = errors.New("garbage: no GC cycle completed in the window")
+
+// EstimateGCInterval measures the average time between GC cycles over window,
+// blocking until the window closes. How often a program collects under load
+// is useful on its own for tuning GOGC and GOMEMLIMIT, and for alerting. If no
+// cycle completes in the window, the interval is at least the window, which
+// is returned with ErrNoGC.
+func EstimateGCInterval(window time.Duration) (time.Duration, error) {
+	if window <= 0 {
+		return 0, errors.New("garbage: window must be positive")
+	}
+	if !enabled {
+		time.Sleep(window)
+		return window, ErrNoGC
+	}
+
+	interval, cycles, _ := gcInterval(window, nil)
+	if cycles == 0 {
+		return window, ErrNoGC
+	}
+	return interval, nil
+}
+
+// calcPeriod measures the average GC period over duration, or returns
+// duration if no GC completes. It returns false if cancel is closed first.
+func calcPeriod(duration time.Duration, cancel <-chan struct{}) (time.Duration, bool) {
+	interval, cycles, ok := gcInterval(duration, cancel)
+	if cycles == 0 {
+		return duration, ok
+	}
+	return interval, ok
+}
+
+// gcInterval measures the average time between GC cycles over window, and the
+// number of cycles it is averaged over. It returns false if cancel is closed
+// before the window closes.
+func gcInterval(window time.Duration, cancel <-chan struct{}) (time.Duration, uint64, bool) {
+	if !enabled {
+		return 0, 0, sleep(window, cancel)
+	}
+
+	start := gcCycles()
+	if !sleep(window, cancel) {
+		return 0, 0, false
+	}
+
+	cycles := gcCycles() - start
+	if cycles == 0 {
+		return 0, 0, true
+	}
+	return window / time.Duration(cycles), cycles, true
+}
+
+// gcCycles returns the number of GC cycles completed by the process.
+func gcCycles() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/cycles/total:gc-cycles"}}
+	metrics.Read(sample)
+	if v := sample[0].Value; v.Kind() == metrics.KindUint64 {
+		return v.Uint64()
+	}
+
+	// Fall back to the stop-the-world MemStats if the metric is unsupported.
+	memstats := new(runtime.MemStats)
+	runtime.ReadMemStats(memstats)
+	return uint64(memstats.NumGC)
+}
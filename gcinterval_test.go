@@ -0,0 +1,32 @@
+package garbage
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestEstimateGCInterval(t *testing.T) {
+	requireEnabled(t)
+
+	if _, err := EstimateGCInterval(0); err == nil {
+		t.Error("want error for a zero window")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for !stopped(done) {
+			runtime.GC()
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	interval, err := EstimateGCInterval(200 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interval <= 0 || interval > 100*time.Millisecond {
+		t.Errorf("want an interval of about 10ms, got %v", interval)
+	}
+}
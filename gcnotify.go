@@ -0,0 +1,170 @@
+package garbage
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// gcPollInterval is how often NotifyGC checks for completed GC cycles if
+// the sentinel's finalizer is delayed.
+const gcPollInterval = 100 * time.Millisecond
+
+// A GCEvent reports the completion of one or more GC cycles.
+type GCEvent struct {
+	NumGC    uint64    // GC cycles completed by the process
+	Cycles   int       // cycles completed since the previous event
+	Time     time.Time // time the cycles were observed
+	HeapLive uint64    // heap bytes marked live by the latest cycle
+	HeapGoal uint64    // heap size goal for the next cycle
+}
+
+// gcNotifier polls for GC cycles on behalf of the channels registered with
+// NotifyGC.
+var gcNotifier struct {
+	sync.Mutex
+	chans   map[chan<- GCEvent]struct{}
+	running bool
+}
+
+// NotifyGC causes GC events to be sent to ch, so that tooling in a program
+// can react to GC cycles without a polling loop of its own. Like
+// signal.Notify, NotifyGC does not block sending to ch: the caller must
+// ensure that ch has sufficient buffer space to keep up, and the Cycles of
+// an event count any cycles whose events were dropped.
+func NotifyGC(ch chan<- GCEvent) {
+	if ch == nil {
+		panic("garbage: NotifyGC using nil channel")
+	}
+	if !enabled {
+		return
+	}
+
+	gcNotifier.Lock()
+	defer gcNotifier.Unlock()
+
+	if gcNotifier.chans == nil {
+		gcNotifier.chans = make(map[chan<- GCEvent]struct{})
+	}
+	gcNotifier.chans[ch] = struct{}{}
+
+	if !gcNotifier.running {
+		gcNotifier.running = true
+		go pollGC(gcCycles())
+	}
+}
+
+// StopGC causes GC events to no longer be sent to ch. When StopGC returns,
+// no more events will be sent to ch.
+func StopGC(ch chan<- GCEvent) {
+	gcNotifier.Lock()
+	defer gcNotifier.Unlock()
+
+	delete(gcNotifier.chans, ch)
+}
+
+// pollGC sends an event to the registered channels whenever a GC cycle
+// completes, until there are none.
+func pollGC(numGC uint64) {
+	if !enabled {
+		return
+	}
+
+	// last is the NumGC of the last event sent to each channel.
+	last := make(map[chan<- GCEvent]uint64)
+
+	for {
+		waitGC(gcPollInterval)
+
+		n := gcCycles()
+		if n == numGC {
+			gcNotifier.Lock()
+			stop := len(gcNotifier.chans) == 0
+			if stop {
+				gcNotifier.running = false
+			}
+			gcNotifier.Unlock()
+			if stop {
+				return
+			}
+			continue
+		}
+		numGC = n
+
+		m := readGCMetrics()
+		ev := GCEvent{NumGC: n, Time: time.Now(), HeapLive: m.heapLive, HeapGoal: m.heapGoal}
+
+		gcNotifier.Lock()
+		if len(gcNotifier.chans) == 0 {
+			gcNotifier.running = false
+			gcNotifier.Unlock()
+			return
+		}
+		for ch := range gcNotifier.chans {
+			prev, ok := last[ch]
+			if !ok {
+				prev = n - 1
+			}
+			ev.Cycles = int(n - prev)
+			select {
+			case ch <- ev:
+				last[ch] = n
+			default:
+				last[ch] = prev
+			}
+		}
+		for ch := range last {
+			if _, ok := gcNotifier.chans[ch]; !ok {
+				delete(last, ch)
+			}
+		}
+		gcNotifier.Unlock()
+	}
+}
+
+// gcSentinel is an otherwise unreachable object whose finalizer signals the
+// completion of the GC cycle that collected it. It holds a pointer so that it
+// is never placed in a tiny allocation block, whose finalizers may be delayed
+// indefinitely by the other objects in the block.
+type gcSentinel struct {
+	_ *gcSentinel
+}
+
+// gcDone is closed by the finalizer of the armed sentinel.
+var gcDone struct {
+	sync.Mutex
+	ch chan struct{}
+}
+
+// gcDoneChan returns a channel that is closed once a GC cycle completes,
+// arming a new sentinel if there is none. The sentinel is re-armed on demand
+// each cycle, so nothing is allocated while no one is waiting.
+func gcDoneChan() <-chan struct{} {
+	gcDone.Lock()
+	defer gcDone.Unlock()
+
+	if gcDone.ch == nil {
+		gcDone.ch = make(chan struct{})
+		runtime.SetFinalizer(new(gcSentinel), func(*gcSentinel) {
+			gcDone.Lock()
+			defer gcDone.Unlock()
+
+			close(gcDone.ch)
+			gcDone.ch = nil
+		})
+	}
+	return gcDone.ch
+}
+
+// waitGC returns once a GC cycle completes, or after timeout if the sentinel's
+// finalizer has not run by then, as when another finalizer blocks the
+// finalizer goroutine. Callers confirm that a cycle completed with gcCycles.
+func waitGC(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-gcDoneChan():
+	case <-timer.C:
+	}
+}
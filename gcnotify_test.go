@@ -0,0 +1,57 @@
+package garbage
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestNotifyGC(t *testing.T) {
+	requireEnabled(t)
+
+	ch := make(chan GCEvent, 1)
+	NotifyGC(ch)
+	defer StopGC(ch)
+
+	start := gcCycles()
+	runtime.GC()
+
+	select {
+	case ev := <-ch:
+		if ev.NumGC <= start {
+			t.Errorf("NumGC = %d, want > %d", ev.NumGC, start)
+		}
+		if ev.Cycles < 1 {
+			t.Errorf("Cycles = %d, want >= 1", ev.Cycles)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no GC event")
+	}
+
+	StopGC(ch)
+	for len(ch) > 0 {
+		<-ch
+	}
+	runtime.GC()
+	time.Sleep(5 * gcPollInterval)
+	if len(ch) > 0 {
+		t.Error("GC event sent after StopGC")
+	}
+}
+
+func TestWaitGC(t *testing.T) {
+	done := gcDoneChan()
+	runtime.GC()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sentinel finalizer did not run")
+	}
+
+	start := time.Now()
+	waitGC(10 * time.Millisecond)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("waitGC blocked for %v past its timeout", d)
+	}
+}
@@ -0,0 +1,155 @@
+package garbage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// gobVersion is the version of the binary form of a Profile written by
+// GobEncode, its first byte.
+const gobVersion = 1
+
+// gobProfile is the binary form of a Profile: its exported fields, the
+// symbols of its stacks and the state of its values.
+type gobProfile struct {
+	Start     time.Time
+	Duration  time.Duration
+	Rate      int
+	Kind      string
+	Truncated bool
+	Degraded  bool
+	Stride    float64
+	Windows   []Window
+	Sample    string
+	TraceID   string
+	Build     string
+	Labels    map[string]string
+	Owners    []OwnerRule
+	Records   []Record
+	Cycles    []Cycle
+	Suspects  []Delta
+	Survival  []Survival
+	Bursts    []Burst
+	Quantiles []StackQuantiles
+	Overshoot []Overshoot
+	Intervals []*Profile
+	MemStats  *runtime.MemStats
+
+	StartStats, EndStats *RuntimeStats
+
+	Frames                                             map[uintptr][]Frame
+	Anonymized, Redacted, Scaled, PerSecond, Baselined bool
+}
+
+// GobEncode encodes the profile in a compact binary form, a versioned,
+// gzip-compressed gob, so a Profile can be sent between processes with
+// encoding/gob or an RPC system built on it, such as net/rpc, without the
+// protocol buffer format. Unlike MarshalBinary, the form keeps every field of
+// the profile. The stacks are symbolized when encoded, since their addresses
+// only make sense to the binary that collected them.
+func (p *Profile) GobEncode() ([]byte, error) {
+	gp := gobProfile{
+		Start:      p.Start,
+		Duration:   p.Duration,
+		Rate:       p.Rate,
+		Kind:       p.Kind,
+		Truncated:  p.Truncated,
+		Degraded:   p.Degraded,
+		Stride:     p.Stride,
+		Windows:    p.Windows,
+		Sample:     p.DefaultSample,
+		TraceID:    p.TraceID,
+		Build:      p.Build,
+		Labels:     p.Labels,
+		Owners:     p.Owners,
+		Records:    p.Records,
+		Cycles:     p.Cycles,
+		Suspects:   p.Suspects,
+		Survival:   p.Survival,
+		Bursts:     p.Bursts,
+		Quantiles:  p.StackQuantiles,
+		Overshoot:  p.Overshoots,
+		Intervals:  p.Intervals,
+		MemStats:   p.MemStats,
+		StartStats: p.StartStats,
+		EndStats:   p.EndStats,
+		Frames:     p.symbols(func(fr Frame) Frame { return fr }),
+		Anonymized: p.anonymized,
+		Redacted:   p.redacted,
+		Scaled:     p.scaled,
+		PerSecond:  p.perSecond,
+		Baselined:  p.baselined,
+	}
+
+	buf := bytes.NewBuffer([]byte{gobVersion})
+	zw := gzip.NewWriter(buf)
+	if err := gob.NewEncoder(zw).Encode(&gp); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode decodes a profile encoded by GobEncode, replacing p. The decoded
+// profile is symbolized by the encoded symbols, like a profile read by
+// ParseText.
+func (p *Profile) GobDecode(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("garbage: empty gob profile")
+	}
+	if data[0] != gobVersion {
+		return fmt.Errorf("garbage: unsupported gob profile version %d", data[0])
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+	if err != nil {
+		return fmt.Errorf("garbage: bad gob profile: %v", err)
+	}
+	var gp gobProfile
+	if err := gob.NewDecoder(zr).Decode(&gp); err != nil {
+		return fmt.Errorf("garbage: bad gob profile: %v", err)
+	}
+
+	*p = Profile{
+		Start:          gp.Start,
+		Duration:       gp.Duration,
+		Rate:           gp.Rate,
+		Kind:           gp.Kind,
+		Truncated:      gp.Truncated,
+		Degraded:       gp.Degraded,
+		Stride:         gp.Stride,
+		Windows:        gp.Windows,
+		DefaultSample:  gp.Sample,
+		TraceID:        gp.TraceID,
+		Build:          gp.Build,
+		Labels:         gp.Labels,
+		Owners:         gp.Owners,
+		Records:        gp.Records,
+		Cycles:         gp.Cycles,
+		Suspects:       gp.Suspects,
+		Survival:       gp.Survival,
+		Bursts:         gp.Bursts,
+		StackQuantiles: gp.Quantiles,
+		Overshoots:     gp.Overshoot,
+		Intervals:      gp.Intervals,
+		MemStats:       gp.MemStats,
+		StartStats:     gp.StartStats,
+		EndStats:       gp.EndStats,
+		frames:         gp.Frames,
+		anonymized:     gp.Anonymized,
+		redacted:       gp.Redacted,
+		scaled:         gp.Scaled,
+		perSecond:      gp.PerSecond,
+		baselined:      gp.Baselined,
+	}
+	if p.frames == nil {
+		p.frames = make(map[uintptr][]Frame)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package garbage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"testing"
+)
+
+func TestProfileGob(t *testing.T) {
+	orig := testProfile()
+	orig.TraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	orig.Intervals = []*Profile{testProfile()}
+	orig = orig.PerSecond()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(orig); err != nil {
+		t.Fatal(err)
+	}
+	var p *Profile
+	if err := gob.NewDecoder(&buf).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.Start.Equal(orig.Start) || p.TraceID != orig.TraceID || !p.perSecond || !p.scaled {
+		t.Errorf("bad profile: start %v trace %s per second %v", p.Start, p.TraceID, p.perSecond)
+	}
+	if !reflect.DeepEqual(p.Records, orig.Records) {
+		t.Errorf("want records %+v, got %+v", orig.Records, p.Records)
+	}
+	if len(p.Intervals) != 1 || len(p.Intervals[0].Records) != 1 {
+		t.Errorf("want one interval with one record, got %+v", p.Intervals)
+	}
+
+	// The decoded profile is symbolized by the encoding, not this binary.
+	pc := p.Records[0].Stack()[0]
+	if got, want := p.frames[pc], symbolize(pc); !reflect.DeepEqual(got, want) {
+		t.Errorf("want frames %+v, got %+v", want, got)
+	}
+
+	if err := new(Profile).GobDecode([]byte{9}); err == nil {
+		t.Error("want an error for an unknown version")
+	}
+}
@@ -0,0 +1,104 @@
+package garbage
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenProfile returns a profile with its own symbols, so that its text form
+// does not depend on the test binary.
+func goldenProfile() *Profile {
+	start := time.Unix(1470000000, 0)
+	stack := func(pcs ...uintptr) (stk [32]uintptr) {
+		copy(stk[:], pcs)
+		return stk
+	}
+
+	return &Profile{
+		Start:    start,
+		Duration: 10 * time.Second,
+		Rate:     512 * 1024,
+		Records: []Record{
+			{Objects: 3, Bytes: 3 << 20, Cycles: 2, Ages: Ages{SameCycle: 2, OneCycle: 1}, Sizes: Sizes{Huge: 3}, Stack0: stack(0x1010, 0x2020)},
+			{Objects: 1, Bytes: 4096, Cycles: 1, Ages: Ages{Longer: 1}, Sizes: Sizes{Medium: 1}, Stack0: stack(0x3030, 0x2020)},
+		},
+		Cycles: []Cycle{
+			{NumGC: 7, Time: start.Add(4 * time.Second), Pause: time.Millisecond, MarkCPU: 2 * time.Millisecond,
+				HeapLive: 4 << 20, HeapGoal: 8 << 20, Objects: 2, Bytes: 2 << 20},
+			{NumGC: 8, Time: start.Add(9 * time.Second), Pause: 500 * time.Microsecond, MarkCPU: 3 * time.Millisecond,
+				HeapLive: 5 << 20, HeapGoal: 10 << 20, Objects: 2, Bytes: 1<<20 + 4096},
+		},
+		Suspects: []Delta{
+			{AllocObjects: 8, AllocBytes: 8 << 20, FreeObjects: 1, FreeBytes: 1 << 20, Stack0: stack(0x4040, 0x2020)},
+		},
+		Survival: []Survival{
+			{Allocated: 8, Survived: 7, Stack0: stack(0x4040, 0x2020)},
+			{Allocated: 4, Survived: 1, Stack0: stack(0x1010, 0x2020)},
+		},
+		frames: map[uintptr][]Frame{
+			0x1010: {{"main.decode", "/src/main.go", 12}},
+			0x2020: {{"main.main", "/src/main.go", 30}},
+			0x3030: {{"strings.Repeat", "/go/src/strings/strings.go", 541}, {"main.pad", "/src/main.go", 18}},
+			0x4040: {{"main.(*cache).put", "/src/cache.go", 22}},
+		},
+	}
+}
+
+func TestGoldenText(t *testing.T) {
+	tests := []struct {
+		name string
+		opts textOptions
+	}{
+		{"v1-debug0", textOptions{format: CompatV1}},
+		{"v1-debug1", textOptions{debug: 1, format: CompatV1}},
+		{"v1-debug2", textOptions{debug: 2, format: CompatV1}},
+		{"debug0", textOptions{}},
+		{"debug1", textOptions{debug: 1}},
+		{"debug2", textOptions{debug: 2}},
+		{"debug2-human", textOptions{debug: 2, human: true}},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := goldenProfile().writeText(&buf, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, test.name, buf.Bytes())
+	}
+}
+
+func TestGoldenCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := goldenProfile().writeCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "cycles.csv", buf.Bytes())
+}
+
+// checkGolden compares got with the named golden file in testdata, or
+// replaces the file with the -update flag.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: layout changed; got:\n%s\nwant:\n%s", name, got, want)
+	}
+}
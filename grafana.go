@@ -0,0 +1,235 @@
+package garbage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// grafanaTopSites is the number of allocation sites in the top_sites target.
+const grafanaTopSites = 10
+
+// The time series targets of the Grafana datasource, each computed from a
+// GC cycle kept by the monitor and the cycle before it.
+var grafanaSeries = map[string]func(c monitorCycle, seconds float64) float64{
+	"garbage_bytes_per_second":   func(c monitorCycle, s float64) float64 { return float64(c.Bytes) / s },
+	"garbage_objects_per_second": func(c monitorCycle, s float64) float64 { return float64(c.Objects) / s },
+	"gc_pause_seconds":           func(c monitorCycle, s float64) float64 { return c.Pause.Seconds() },
+	"heap_live_bytes":            func(c monitorCycle, s float64) float64 { return float64(c.HeapLive) },
+	"heap_goal_bytes":            func(c monitorCycle, s float64) float64 { return float64(c.HeapGoal) },
+}
+
+// grafanaTargets lists the targets in the order returned by /search.
+var grafanaTargets = []string{
+	"garbage_bytes_per_second",
+	"garbage_objects_per_second",
+	"gc_pause_seconds",
+	"heap_live_bytes",
+	"heap_goal_bytes",
+	"top_sites",
+}
+
+type (
+	grafanaRange struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	}
+
+	grafanaQuery struct {
+		Range   grafanaRange `json:"range"`
+		Targets []struct {
+			Target string `json:"target"`
+			Type   string `json:"type"` // "timeserie" or "table"
+		} `json:"targets"`
+	}
+
+	grafanaTimeSeries struct {
+		Target     string       `json:"target"`
+		Datapoints [][2]float64 `json:"datapoints"` // value, Unix milliseconds
+	}
+
+	grafanaTable struct {
+		Type    string          `json:"type"`
+		Columns []grafanaColumn `json:"columns"`
+		Rows    [][]interface{} `json:"rows"`
+	}
+
+	grafanaColumn struct {
+		Text string `json:"text"`
+		Type string `json:"type"`
+	}
+
+	grafanaAnnotationQuery struct {
+		Range      grafanaRange    `json:"range"`
+		Annotation json.RawMessage `json:"annotation"`
+	}
+
+	grafanaAnnotation struct {
+		Annotation json.RawMessage `json:"annotation"`
+		Time       int64           `json:"time"` // Unix milliseconds
+		Title      string          `json:"title"`
+		Text       string          `json:"text"`
+		Tags       []string        `json:"tags"`
+	}
+)
+
+// ServeGrafana serves the monitor's GC cycles as a Grafana simple JSON
+// datasource, so garbage rates and top allocation sites can be graphed without
+// an intermediate database. Mount it at a path and the subtree below it:
+//
+//	mux.HandleFunc("/grafana/", m.ServeGrafana)
+//
+// Requests for a path ending in /search list the targets, /query responds
+// with their values over the requested range and /annotations marks the GC
+// cycles in the range for an annotation whose query is "gc". Any other path
+// responds 200 OK, for the datasource's connection test. The top_sites target
+// is a time series per top allocation site or, queried as a table, the
+// sites' garbage over the range. Serving the datasource starts the monitor if
+// it is not running.
+func (m *Monitor) ServeGrafana(w http.ResponseWriter, r *http.Request) {
+	if !enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	m.Start()
+
+	var v interface{}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/search"):
+		v = grafanaTargets
+
+	case strings.HasSuffix(r.URL.Path, "/query"):
+		var q grafanaQuery
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			http.Error(w, fmt.Sprintf("garbage: bad query: %v", err), http.StatusBadRequest)
+			return
+		}
+		v = m.grafanaQuery(q)
+
+	case strings.HasSuffix(r.URL.Path, "/annotations"):
+		var q grafanaAnnotationQuery
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			http.Error(w, fmt.Sprintf("garbage: bad annotation query: %v", err), http.StatusBadRequest)
+			return
+		}
+		v = m.grafanaAnnotations(q)
+
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// grafanaQuery answers a query for the values of targets over a range.
+func (m *Monitor) grafanaQuery(q grafanaQuery) []interface{} {
+	since, cycles := m.snapshot()
+
+	// The rates of a cycle are over the time since the cycle before it.
+	seconds := make([]float64, len(cycles))
+	for i, c := range cycles {
+		seconds[i] = c.Time.Sub(since).Seconds()
+		since = c.Time
+	}
+
+	var inRange []monitorCycle
+	var inSeconds []float64
+	for i, c := range cycles {
+		if !c.Time.Before(q.Range.From) && !c.Time.After(q.Range.To) && seconds[i] > 0 {
+			inRange = append(inRange, c)
+			inSeconds = append(inSeconds, seconds[i])
+		}
+	}
+
+	results := []interface{}{}
+	for _, t := range q.Targets {
+		if t.Target == "top_sites" {
+			results = append(results, grafanaSites(inRange, inSeconds, t.Type == "table")...)
+			continue
+		}
+
+		f, ok := grafanaSeries[t.Target]
+		if !ok {
+			continue
+		}
+		ts := grafanaTimeSeries{Target: t.Target, Datapoints: [][2]float64{}}
+		for i, c := range inRange {
+			ts.Datapoints = append(ts.Datapoints, [2]float64{f(c, inSeconds[i]), unixMillis(c.Time)})
+		}
+		results = append(results, ts)
+	}
+	return results
+}
+
+// grafanaSites returns the garbage of the top allocation sites over cycles,
+// as a table or a time series of the garbage rate of each site.
+func grafanaSites(cycles []monitorCycle, seconds []float64, table bool) []interface{} {
+	sites := topSites(cycles, grafanaTopSites)
+
+	if table {
+		t := grafanaTable{
+			Type:    "table",
+			Columns: []grafanaColumn{{"function", "string"}, {"bytes", "number"}},
+			Rows:    [][]interface{}{},
+		}
+		for _, s := range sites {
+			t.Rows = append(t.Rows, []interface{}{s.function, s.bytes})
+		}
+		return []interface{}{t}
+	}
+
+	functions := make(map[[32]uintptr]string)
+	bytes := make([]map[string]int64, len(cycles))
+	for i, c := range cycles {
+		bytes[i] = c.sites(functions)
+	}
+
+	var results []interface{}
+	for _, s := range sites {
+		ts := grafanaTimeSeries{Target: s.function, Datapoints: [][2]float64{}}
+		for i, c := range cycles {
+			bytes := bytes[i][s.function]
+			ts.Datapoints = append(ts.Datapoints, [2]float64{float64(bytes) / seconds[i], unixMillis(c.Time)})
+		}
+		results = append(results, ts)
+	}
+	return results
+}
+
+// grafanaAnnotations marks the GC cycles in the range of an annotation whose
+// query is "gc".
+func (m *Monitor) grafanaAnnotations(q grafanaAnnotationQuery) []grafanaAnnotation {
+	var a struct {
+		Query string `json:"query"`
+	}
+	json.Unmarshal(q.Annotation, &a)
+
+	annotations := []grafanaAnnotation{}
+	if strings.TrimSpace(a.Query) != "gc" {
+		return annotations
+	}
+
+	_, cycles := m.snapshot()
+	for _, c := range cycles {
+		if c.Time.Before(q.Range.From) || c.Time.After(q.Range.To) {
+			continue
+		}
+		annotations = append(annotations, grafanaAnnotation{
+			Annotation: q.Annotation,
+			Time:       int64(unixMillis(c.Time)),
+			Title:      fmt.Sprintf("GC %d", c.NumGC),
+			Text:       fmt.Sprintf("pause %v, heap live %d of goal %d bytes", c.Pause, c.HeapLive, c.HeapGoal),
+			Tags:       []string{"gc"},
+		})
+	}
+	return annotations
+}
+
+func unixMillis(t time.Time) float64 {
+	return float64(t.UnixNano() / int64(time.Millisecond))
+}
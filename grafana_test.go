@@ -0,0 +1,60 @@
+package garbage
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGrafanaQuery(t *testing.T) {
+	start := time.Unix(1470000000, 0)
+	m := &Monitor{since: start}
+
+	var stk [32]uintptr
+	runtime.Callers(1, stk[:])
+	for i := 1; i <= 2; i++ {
+		m.observe(Cycle{NumGC: uint32(i), Time: start.Add(time.Duration(2*i) * time.Second)},
+			[]Record{{Objects: 1, Bytes: 1 << 30, Cycles: 1, Stack0: stk}})
+	}
+
+	var q grafanaQuery
+	if err := json.Unmarshal([]byte(`{
+		"range": {"from": "2016-07-31T21:20:03Z", "to": "2016-07-31T21:21:00Z"},
+		"targets": [
+			{"target": "garbage_bytes_per_second", "type": "timeserie"},
+			{"target": "top_sites", "type": "table"},
+			{"target": "top_sites", "type": "timeserie"}
+		]
+	}`), &q); err != nil {
+		t.Fatal(err)
+	}
+	results := m.grafanaQuery(q)
+	if len(results) != 3 {
+		t.Fatalf("want 3 results, got %d: %+v", len(results), results)
+	}
+
+	// Only the second cycle is in range; its rate is over the 2s since the first.
+	ts := results[0].(grafanaTimeSeries)
+	if want := [2]float64{1 << 29, 1470000004000}; len(ts.Datapoints) != 1 || ts.Datapoints[0] != want {
+		t.Errorf("want datapoints [%v], got %v", want, ts.Datapoints)
+	}
+
+	table := results[1].(grafanaTable)
+	fn := "github.com/benburkert/pprof-garbage.TestGrafanaQuery"
+	if len(table.Rows) != 1 || table.Rows[0][0] != fn || table.Rows[0][1] != int64(1<<30) {
+		t.Errorf("want 1 row for %s, got %v", fn, table.Rows)
+	}
+
+	if site := results[2].(grafanaTimeSeries); site.Target != fn || len(site.Datapoints) != 1 {
+		t.Errorf("want a time series for %s, got %+v", fn, site)
+	}
+
+	annotations := m.grafanaAnnotations(grafanaAnnotationQuery{
+		Range:      grafanaRange{From: start, To: start.Add(time.Minute)},
+		Annotation: json.RawMessage(`{"name": "gc", "query": "gc"}`),
+	})
+	if len(annotations) != 2 || annotations[1].Title != "GC 2" {
+		t.Errorf("want an annotation per GC cycle, got %+v", annotations)
+	}
+}
@@ -0,0 +1,656 @@
+package garbage
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"runtime"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benburkert/pprof-garbage/internal/replay"
+)
+
+// A Handler serves the garbage profile. The zero value serves the same
+// profile as Garbage. Mount a Handler at both the profile path and the
+// subtree below it to serve the progress and cancel endpoints.
+//
+// A Handler does not depend on the path it is mounted at, so it can be
+// registered with any router that accepts an http.Handler, behind that
+// router's middleware. The garbagechi, garbagemux, garbagegin and
+// garbageecho packages mount it, and the subtree below it, on chi,
+// gorilla/mux, gin and echo routers:
+//
+//	garbagechi.Mount(r, "/debug/pprof/garbage", nil, auth)
+//
+// The profile reveals the structure of the program and each request imposes
+// load, so production handlers should restrict access with the LocalOnly,
+// AllowedNets, Token or Authorize fields. A request must pass every check
+// that is set.
+type Handler struct {
+	// LocalOnly restricts access to clients connecting from a loopback
+	// address.
+	LocalOnly bool
+
+	// AllowedNets restricts access to clients connecting from one of the
+	// networks. Clients are identified by the request's RemoteAddr, so
+	// handlers behind a proxy should use Authorize instead.
+	AllowedNets []*net.IPNet
+
+	// Token is a shared secret that clients must present as a bearer token
+	// in the Authorization header.
+	Token string
+
+	// Authorize is called for each request that passes the other checks. A
+	// non-nil error rejects the request with 403 Forbidden.
+	Authorize func(*http.Request) error
+
+	// RateLimit, if set, limits how often each client may start a
+	// collection. Rejected requests receive 429 Too Many Requests.
+	RateLimit *RateLimiter
+
+	// Strict rejects requests with invalid or out of range parameters with
+	// 400 Bad Request and a JSON error body. Otherwise invalid parameters are
+	// replaced by defaults and durations are clamped to range.
+	Strict bool
+
+	// TextFormat is the layout of text responses. The compat=v1 parameter
+	// selects CompatV1 for a single request.
+	TextFormat TextFormat
+
+	// DefaultSample is the sample type, "objects" or "bytes", that pprof
+	// opens every profile served on (see Profile.DefaultSample). The
+	// sample parameter selects it for a single request.
+	DefaultSample string
+
+	// Growth serves the growth profile (see CollectGrowth) instead of the
+	// garbage profile.
+	Growth bool
+
+	// Durations bounds the collection window a request may ask for with
+	// the seconds parameter, a possibly fractional number of seconds, or
+	// the d parameter, a duration string such as "90s", and sets the
+	// window of requests that ask for none.
+	Durations DurationPolicy
+
+	// MinDuration and MaxDuration bound the collection window as the Min
+	// and Max of Durations do, if those are zero.
+	//
+	// Deprecated: Use Durations.
+	MinDuration time.Duration
+	MaxDuration time.Duration
+
+	// Anonymize strips the file paths and host name from every profile
+	// served (see Profile.Anonymize). The anonymize=1 parameter strips them
+	// from a single response.
+	Anonymize bool
+
+	// Redact lists patterns of the function names and files of the frames
+	// to replace with a placeholder in every profile served (see
+	// Profile.Redact).
+	Redact []*regexp.Regexp
+
+	// SigningKey, if set, signs every profile served: the X-Profile-Signature
+	// trailer of the response holds the HMAC-SHA256 of the body under the
+	// key (see Sign and Verify).
+	SigningKey []byte
+
+	// MaxOverhead and DegradeOnOverhead limit the overhead of the
+	// collector during each collection, as for Options. A collection over
+	// the limit responds with its truncated profile.
+	MaxOverhead       float64
+	DegradeOnOverhead bool
+
+	// AggregationBudget limits the CPU the collector spends aggregating
+	// each GC cycle during each collection, as for Options.
+	AggregationBudget AggregationBudget
+
+	// StackDepth, if positive, trims the allocation stacks of every profile
+	// served to their innermost StackDepth frames, as for Options.
+	StackDepth int
+
+	// Labels are the static labels of every profile served (see
+	// Profile.Labels).
+	Labels map[string]string
+
+	// Owners map the allocation sites of every profile served to their
+	// owners, for the ownership rollup of the text and JSON formats (see
+	// Profile.Ownership).
+	Owners []OwnerRule
+
+	// MaxGCWait is the longest a request with the waitgc=1 parameter
+	// extends its window for a GC cycle, as for Options.WaitGC. Zero means
+	// one minute.
+	MaxGCWait time.Duration
+
+	// MaxStacks and SpillDir bound the stacks of garbage each collection
+	// holds in memory, spilling the rest to disk, as for Options.
+	MaxStacks int
+	SpillDir  string
+
+	// Monitor is the continuous collector whose metrics and Grafana
+	// datasource are served below the profile path at /metrics and /grafana.
+	// Nil means DefaultMonitor.
+	Monitor *Monitor
+
+	// Baseline is the file name or http or https URL of a profile of the
+	// steady-state garbage, such as a capture of the service at rest. The
+	// baseline=1 parameter subtracts it from the profile served (see
+	// Profile.Subtract), so only the garbage beyond it shows. It is read
+	// on first use, within the request; a URL is fetched for up to 30
+	// seconds.
+	Baseline string
+
+	// DeployBaseline, if set, is served below the profile path at
+	// /baseline, and subtracted by the baseline=1 parameter once captured
+	// if Baseline is not set.
+	DeployBaseline *DeployBaseline
+
+	// replay, if set, stands in for the GC: every request is served the
+	// garbage profile replayed from the recording, at once, instead of
+	// collecting one. The parameters of a request are validated as usual.
+	// It is set by garbagetest.ServeProfile.
+	replay *Recording
+}
+
+func init() {
+	replay.SetHandler = func(h, rec interface{}) {
+		h.(*Handler).replay = rec.(*Recording)
+	}
+}
+
+// ServeHTTP serves the garbage profile. The X-Profile-Job response header
+// identifies the collection.
+//
+// The debug parameter selects the format as for the heap endpoint of
+// net/http/pprof: 0 (the default) for the protocol buffer, 1 for the legacy
+// text format with symbolized stacks, the retention suspects, the survival,
+// age and size estimates, the GC cycles whose heap overshot its goal and the
+// stacks responsible, the quantiles of the garbage per GC cycle, the churn of
+// the sync.Pools allocating garbage and the garbage by owner, if the handler
+// has Owners, and 2 to add the GC cycles observed and the runtime.MemStats;
+// the human=1 parameter prints the sizes and counts in those sections in
+// human-readable form. The debug=json parameter selects newline-delimited
+// JSON: a "profile" line with the collection totals, then a "cycle" line per
+// GC cycle observed, a "record" line with the symbolized stack and garbage
+// ages and sizes of each allocation site, a "suspect" line per retention
+// suspect, a "survival" line per allocating stack, an "overshoot" line per GC
+// cycle whose heap overshot its goal, a "quantiles" line with the quantiles of
+// the garbage per GC cycle of each stack with the most garbage, a "pool" line
+// per call site of a sync.Pool allocating garbage and an "owner" line per
+// owner. The format=csv parameter selects the timeline of GC cycles as CSV,
+// with the timestamp, cycle, garbage_bytes, garbage_objects, heap_goal and
+// pause_ns columns. The format=multipart parameter responds with both the text
+// format, at debug level 1 unless the debug parameter is set, and the protocol
+// buffer of the same collection, as the parts of a multipart/mixed body, for
+// humans and tools alike. The record=1 parameter responds with a Recording of
+// the collection instead, for replay offline. The stream parameter, a duration
+// such as "10s", responds with a sequence of profiles, one per interval of the
+// window, each a gzip-compressed protocol buffer preceded by its length as a
+// varint (see ReadDelimited) and written as its interval closes.
+//
+// The normalize=rate parameter divides the garbage of the profile by the
+// seconds of its window (see Profile.PerSecond), so profiles of different
+// windows compare directly.
+//
+// The waitgc=1 parameter extends a window that observed no GC cycle until the
+// first, up to MaxGCWait, so a process that collects rarely still responds
+// with a profile with garbage.
+//
+// The baseline=1 parameter subtracts the Baseline profile of the handler from
+// the response, leaving only the garbage beyond the steady state.
+//
+// The sample parameter, objects or bytes, selects the sample type pprof opens
+// the profile on, and orders the records of the text format by it.
+//
+// The anonymize=1 parameter strips the file paths and host name from the
+// response (see Profile.Anonymize); an anonymized or redacted bundle holds only
+// the profile and its metadata.
+//
+// The trace ID of the request's W3C traceparent header, or of the trace_id
+// parameter, is recorded in the profile to link it to the request's trace (see
+// Profile.TraceID).
+//
+// Each collection is a "garbage.collect" task of the execution trace, if one
+// is being captured, with regions for its calibration and window, a
+// "garbage.cycle" region for each GC cycle observed and a "garbage.emit"
+// region for writing the response.
+//
+// HEAD requests are answered immediately with the X-Profile-Window-Seconds,
+// X-Profile-Expected-Seconds, X-Profile-Format and X-Profile-Sample-Rate
+// headers describing the collection a GET would run, so clients can set their
+// timeouts before issuing it. Responses other than streams end with the
+// X-Profile-Cycles, X-Profile-Garbage-Bytes, X-Profile-Garbage-Objects,
+// X-Profile-Duration-Seconds and X-Profile-Truncated trailers describing the
+// profile collected, so tools can record it without parsing the body.
+//
+// Requests for a path ending in /progress respond with the progress of the
+// in-flight collections as JSON (see Jobs). POST requests for a path ending in
+// /cancel cancel the collection named by the id parameter and respond with its
+// truncated profile (see Cancel). Requests for a path ending in /collector
+// respond with the Status of the collector shared by every profile as JSON;
+// POST requests first apply the action parameter, one of pause, resume, flush
+// or reset (see Pause, Resume, Flush and Reset), so operators can quiesce the
+// profiler without restarting the process. Requests for a path ending in
+// /baseline respond with the DeployBaseline of the handler. Requests for a
+// path ending in /metrics respond with the metrics of the Monitor in the
+// OpenMetrics text format (see Monitor.ServeMetrics), and requests below
+// /grafana serve the Monitor as a Grafana simple JSON datasource (see
+// Monitor.ServeGrafana). Requests for a path ending in /bundle run the
+// collection and respond with a zip of the profile, the heap profiles at the
+// start and end of the window, a goroutine dump and a metadata.json file, as a
+// one-shot incident artifact. The intervals parameter, a number of
+// sub-intervals such as 6, partitions the window and adds the profile of each
+// sub-interval to the bundle, to show how the garbage shifted over the window;
+// it selects the bundle for any path. The isolate_bursts=1 parameter cuts the
+// sub-intervals, or the window alone, at the start and end of each burst of
+// garbage, so a burst's stacks are isolated in a profile of their own (see
+// Options.IsolateBursts); it too selects the bundle.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	if code, err := h.authorize(r); err != nil {
+		if code == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="garbage"`)
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/progress") {
+		serveProgress(w, r)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/cancel") {
+		serveCancel(w, r)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/collector") {
+		serveCollector(w, r)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/baseline") {
+		if h.DeployBaseline == nil {
+			http.NotFound(w, r)
+			return
+		}
+		h.DeployBaseline.ServeHTTP(w, r)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/metrics") {
+		h.monitor().ServeMetrics(w, r)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/grafana") || strings.Contains(r.URL.Path, "/grafana/") {
+		h.monitor().ServeGrafana(w, r)
+		return
+	}
+
+	p, err := h.params(r)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/bundle") {
+		p.format = "bundle"
+	}
+
+	w.Header().Set("X-Profile-Window-Seconds", formatSeconds(p.duration))
+	expected := 2 * p.duration
+	if p.format == "stream" {
+		// The GC period is measured over one interval of the stream.
+		expected = p.stream + p.duration
+	}
+	w.Header().Set("X-Profile-Expected-Seconds", formatSeconds(expected))
+	w.Header().Set("X-Profile-Format", p.format)
+	w.Header().Set("X-Profile-Sample-Rate", strconv.Itoa(runtime.MemProfileRate))
+	var boundary string // of a multipart response
+	switch p.format {
+	case "proto":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", h.kind()))
+	case "json":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", h.kind()+".csv"))
+	case "recording":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", h.kind()+".rec"))
+	case "stream":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", h.kind()+".stream"))
+	case "bundle":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", h.kind()+"-bundle.zip"))
+	case "multipart":
+		boundary = multipart.NewWriter(nil).Boundary()
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+boundary)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	if r.Method == "HEAD" {
+		// Describe the collection a GET would run, without running it.
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if h.RateLimit != nil {
+		if ok, wait := h.RateLimit.Allow(r); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "garbage: rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	var base *Profile
+	if p.baseline {
+		if base, err = h.baseline(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	j := startJob(p.duration)
+	j.kind = h.kind()
+	j.record = p.format == "recording"
+	j.traceID = p.traceID
+	j.maxOverhead, j.degrade = h.MaxOverhead, h.DegradeOnOverhead
+	j.budget = h.AggregationBudget
+	j.depth = h.StackDepth
+	j.maxStacks, j.spillDir = h.MaxStacks, h.SpillDir
+	j.replay = h.replay
+	if p.waitGC {
+		j.waitGC = h.maxGCWait()
+	}
+	if p.format == "bundle" {
+		j.intervals, j.isolate = p.intervals, p.isolate
+	}
+	var b bundle
+	if p.format == "bundle" {
+		j.opened = b.open
+	}
+	w.Header().Set("X-Profile-Job", j.id)
+	if p.format != "stream" {
+		for _, k := range metadataTrailers {
+			w.Header().Add("Trailer", k)
+		}
+	}
+	if h.SigningKey != nil {
+		w.Header().Add("Trailer", signatureHeader)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	flush := func() {}
+	if f, ok := w.(http.Flusher); ok {
+		// Middleware wrappers from other routers may not implement Flusher.
+		flush = f.Flush
+	}
+	flush()
+
+	if h.SigningKey != nil {
+		sw := newSigningWriter(w, h.SigningKey)
+		defer sw.sign()
+		w = sw
+	}
+
+	if p.format == "stream" {
+		serveStream(w, r, j, p, h, base, flush)
+		return
+	}
+
+	prof := j.collect()
+	j.scrub(h.Redact, p.anon)
+	setMetadataTrailers(w.Header(), prof)
+	if base != nil {
+		prof = prof.Subtract(base)
+	}
+	if p.rate {
+		prof = prof.PerSecond()
+	}
+	prof.DefaultSample = p.sample
+	prof.setLabels(h.Labels)
+	prof.Owners = h.Owners
+
+	defer trace.StartRegion(r.Context(), "garbage.emit").End()
+	switch p.format {
+	case "proto":
+		prof.WriteTo(w)
+	case "json":
+		prof.writeJSON(w)
+	case "csv":
+		prof.writeCSV(w)
+	case "recording":
+		j.recording.WriteTo(w)
+	case "bundle":
+		b.write(w, prof)
+	case "multipart":
+		writeMultipart(w, boundary, prof, h.kind(), textOptions{debug: p.debug, human: p.human, format: p.compat})
+	default:
+		prof.writeText(w, textOptions{debug: p.debug, human: p.human, format: p.compat})
+	}
+}
+
+func (h *Handler) monitor() *Monitor {
+	if h.Monitor != nil {
+		return h.Monitor
+	}
+	return DefaultMonitor
+}
+
+func (h *Handler) kind() string {
+	if h.Growth {
+		return growthKind
+	}
+	return garbageKind
+}
+
+// writeMultipart writes prof as a multipart body delimited by boundary: a
+// part in the text format, at debug level 1 unless opts set one, then a part
+// in the protocol buffer format, both named for kind.
+func writeMultipart(w io.Writer, boundary string, prof *Profile, kind string, opts textOptions) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+	if opts.debug == 0 {
+		opts.debug = 1
+	}
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":        {"text/plain; charset=utf-8"},
+		"Content-Disposition": {fmt.Sprintf("attachment; filename=%q", kind+".txt")},
+	})
+	if err != nil {
+		return err
+	}
+	if err := prof.writeText(part, opts); err != nil {
+		return err
+	}
+
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":        {"application/octet-stream"},
+		"Content-Disposition": {fmt.Sprintf("attachment; filename=%q", kind)},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := prof.WriteTo(part); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// serveStream runs the collection of j as a stream of profiles over the
+// intervals of the request's parameters, writing each as it closes. The
+// stream stops when the client goes away.
+func serveStream(w http.ResponseWriter, r *http.Request, j *job, p params, h *Handler, base *Profile, flush func()) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-r.Context().Done():
+			j.stop()
+		case <-stop:
+		}
+	}()
+
+	j.stream(p.stream, func(prof *Profile) error {
+		defer trace.StartRegion(r.Context(), "garbage.emit").End()
+		scrubProfile(prof, h.Redact, p.anon)
+		if base != nil {
+			prof = prof.Subtract(base)
+		}
+		if p.rate {
+			prof = prof.PerSecond()
+		}
+		prof.DefaultSample = p.sample
+		prof.setLabels(h.Labels)
+		if err := writeDelimited(w, prof); err != nil {
+			return err
+		}
+		flush()
+		return nil
+	})
+}
+
+// serveCancel cancels the collection named by the id parameter and responds
+// with its truncated profile. Only POST requests are accepted.
+func serveCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "garbage: cancel requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, ok := Cancel(r.FormValue("id"))
+	if !ok {
+		http.Error(w, "garbage: no such job", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	p.writeText(w, textOptions{debug: 1})
+}
+
+// serveProgress responds with the progress of the in-flight collections as
+// JSON, or of the single collection named by the id parameter.
+func serveProgress(w http.ResponseWriter, r *http.Request) {
+	var v interface{} = Jobs()
+	if id := r.FormValue("id"); id != "" {
+		p, ok := JobProgress(id)
+		if !ok {
+			http.Error(w, "garbage: no such job", http.StatusNotFound)
+			return
+		}
+		v = p
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// authorize checks r against the access controls of h, returning the status
+// code to reject it with if it fails.
+func (h *Handler) authorize(r *http.Request) (int, error) {
+	if h.LocalOnly || len(h.AllowedNets) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return http.StatusForbidden, errors.New("garbage: unknown client address")
+		}
+
+		if h.LocalOnly && !ip.IsLoopback() {
+			return http.StatusForbidden, errors.New("garbage: client is not local")
+		}
+		if len(h.AllowedNets) > 0 && !containsIP(h.AllowedNets, ip) {
+			return http.StatusForbidden, errors.New("garbage: client address not allowed")
+		}
+	}
+
+	if h.Token != "" {
+		token, ok := bearerToken(r)
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) != 1 {
+			return http.StatusUnauthorized, errors.New("garbage: invalid bearer token")
+		}
+	}
+
+	if h.Authorize != nil {
+		if err := h.Authorize(r); err != nil {
+			return http.StatusForbidden, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// bearerToken returns the token of the Bearer credentials of the request's
+// Authorization header. The scheme is case-insensitive, as in RFC 7235.
+func bearerToken(r *http.Request) (string, bool) {
+	const scheme = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(scheme) || !strings.EqualFold(auth[:len(scheme)], scheme) {
+		return "", false
+	}
+	return auth[len(scheme):], true
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataTrailers are the response trailers describing the profile
+// collected, set by setMetadataTrailers.
+var metadataTrailers = []string{
+	"X-Profile-Cycles",
+	"X-Profile-Garbage-Bytes",
+	"X-Profile-Garbage-Objects",
+	"X-Profile-Duration-Seconds",
+	"X-Profile-Truncated",
+}
+
+// setMetadataTrailers sets the metadata trailers of a response from its
+// profile. The garbage is estimated for all allocations.
+func setMetadataTrailers(h http.Header, p *Profile) {
+	var objects, bytes int64
+	for _, r := range p.Records {
+		r = p.weigh(r, 1)
+		objects += r.Objects
+		bytes += r.Bytes
+	}
+	h.Set("X-Profile-Cycles", strconv.Itoa(len(p.Cycles)))
+	h.Set("X-Profile-Garbage-Bytes", strconv.FormatInt(bytes, 10))
+	h.Set("X-Profile-Garbage-Objects", strconv.FormatInt(objects, 10))
+	h.Set("X-Profile-Duration-Seconds", formatSeconds(p.Duration))
+	h.Set("X-Profile-Truncated", strconv.FormatBool(p.Truncated))
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
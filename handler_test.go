@@ -0,0 +1,201 @@
+package garbage
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// noFlusher hides the http.Flusher of the wrapped ResponseWriter, like the
+// response wrappers of many router middleware.
+type noFlusher struct {
+	http.ResponseWriter
+}
+
+func TestHandlerMounted(t *testing.T) {
+	requireEnabled(t)
+
+	h := new(Handler)
+
+	mux := http.NewServeMux()
+	mux.Handle("/admin/garbage", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(noFlusher{w}, r)
+	}))
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/admin/garbage?seconds=1&debug=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	if !strings.HasPrefix(string(body), "heap profile: ") {
+		t.Errorf("missing profile header: %q", body)
+	}
+}
+
+func TestHandlerAuthorize(t *testing.T) {
+	requireEnabled(t)
+
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+
+	tests := []struct {
+		handler    Handler
+		remoteAddr string
+		header     string
+		code       int
+	}{
+		{Handler{}, "192.0.2.1:1234", "", http.StatusOK},
+		{Handler{LocalOnly: true}, "127.0.0.1:1234", "", http.StatusOK},
+		{Handler{LocalOnly: true}, "[::1]:1234", "", http.StatusOK},
+		{Handler{LocalOnly: true}, "192.0.2.1:1234", "", http.StatusForbidden},
+		{Handler{AllowedNets: []*net.IPNet{private}}, "10.1.2.3:1234", "", http.StatusOK},
+		{Handler{AllowedNets: []*net.IPNet{private}}, "192.0.2.1:1234", "", http.StatusForbidden},
+		{Handler{Token: "s3cret"}, "192.0.2.1:1234", "Bearer s3cret", http.StatusOK},
+		{Handler{Token: "s3cret"}, "192.0.2.1:1234", "bearer s3cret", http.StatusOK},
+		{Handler{Token: "s3cret"}, "192.0.2.1:1234", "Bearer guess", http.StatusUnauthorized},
+		{Handler{Token: "s3cret"}, "192.0.2.1:1234", "s3cret", http.StatusUnauthorized},
+		{Handler{Token: "s3cret"}, "192.0.2.1:1234", "Basic s3cret", http.StatusUnauthorized},
+		{Handler{Token: "s3cret"}, "192.0.2.1:1234", "", http.StatusUnauthorized},
+		{Handler{LocalOnly: true, Token: "s3cret"}, "192.0.2.1:1234", "Bearer s3cret", http.StatusForbidden},
+		{Handler{Authorize: func(*http.Request) error { return nil }}, "192.0.2.1:1234", "", http.StatusOK},
+		{Handler{Authorize: func(*http.Request) error { return errors.New("nope") }}, "192.0.2.1:1234", "", http.StatusForbidden},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest("GET", "/debug/pprof/garbage", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+
+		if code, _ := test.handler.authorize(req); code != test.code {
+			t.Errorf("%d: want code %d, got %d", i, test.code, code)
+		}
+
+		if test.code == http.StatusOK {
+			continue
+		}
+
+		rec := httptest.NewRecorder()
+		test.handler.ServeHTTP(rec, req)
+		if rec.Code != test.code {
+			t.Errorf("%d: want response code %d, got %d", i, test.code, rec.Code)
+		}
+	}
+}
+
+func TestHandlerTrailers(t *testing.T) {
+	requireEnabled(t)
+
+	srv := httptest.NewServer(new(Handler))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/debug/pprof/garbage?seconds=0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if _, err := io.ReadAll(res.Body); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range metadataTrailers {
+		if res.Trailer.Get(k) == "" {
+			t.Errorf("missing %s trailer", k)
+		}
+	}
+	if got := res.Trailer.Get("X-Profile-Truncated"); got != "false" {
+		t.Errorf("X-Profile-Truncated: want %q, got %q", "false", got)
+	}
+	if _, err := strconv.ParseInt(res.Trailer.Get("X-Profile-Garbage-Bytes"), 10, 64); err != nil {
+		t.Errorf("X-Profile-Garbage-Bytes: %v", err)
+	}
+}
+
+func TestHandlerHead(t *testing.T) {
+	requireEnabled(t)
+
+	rec := httptest.NewRecorder()
+	new(Handler).ServeHTTP(rec, httptest.NewRequest("HEAD", "/debug/pprof/garbage?seconds=2.5", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("want code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	headers := map[string]string{
+		"X-Profile-Window-Seconds":   "2.5",
+		"X-Profile-Expected-Seconds": "5",
+		"X-Profile-Format":           "proto",
+		"X-Profile-Sample-Rate":      strconv.Itoa(runtime.MemProfileRate),
+		"Content-Type":               "application/octet-stream",
+	}
+	for k, want := range headers {
+		if got := rec.Header().Get(k); got != want {
+			t.Errorf("%s: want %q, got %q", k, want, got)
+		}
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("want empty body, got %q", rec.Body)
+	}
+}
+
+func TestHandlerMultipart(t *testing.T) {
+	requireEnabled(t)
+
+	srv := httptest.NewServer(new(Handler))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/debug/pprof/garbage?seconds=0.1&format=multipart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("want multipart/mixed, got %q (%v)", res.Header.Get("Content-Type"), err)
+	}
+
+	mr := multipart.NewReader(res.Body, params["boundary"])
+	part, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := io.ReadAll(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(text), "heap profile: ") {
+		t.Errorf("want text part, got %q", text)
+	}
+
+	if part, err = mr.NextPart(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Parse(part)
+	if err != nil {
+		t.Fatalf("want proto part: %v", err)
+	}
+	if p.Rate != runtime.MemProfileRate {
+		t.Errorf("want rate %d, got %d", runtime.MemProfileRate, p.Rate)
+	}
+}
@@ -0,0 +1,220 @@
+package garbage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// GarbageFromHeap computes a garbage profile from two heap profiles of the
+// same process, taken at the start and end of a window: the garbage of each
+// allocation stack is the objects it freed between them. Each heap profile may
+// be in the protocol buffer format, compressed or not, or in the legacy text
+// format written with debug=1, but both must be in the same format.
+//
+// Unlike a collected profile, the garbage is not broken down by GC cycle. The
+// values of a protocol buffer heap profile are already scaled to estimate all
+// allocations, and are kept as they are.
+func GarbageFromHeap(start, end io.Reader) (*Profile, error) {
+	s, err := readHeap(start)
+	if err != nil {
+		return nil, err
+	}
+	e, err := readHeap(end)
+	if err != nil {
+		return nil, err
+	}
+	if s.scaled != e.scaled {
+		return nil, errors.New("garbage: heap profiles are in different formats")
+	}
+
+	p := &Profile{
+		Start:  s.time,
+		Rate:   e.rate,
+		frames: s.frames,
+		scaled: e.scaled,
+	}
+	if !s.time.IsZero() && !e.time.IsZero() {
+		p.Duration = e.time.Sub(s.time)
+	}
+	for pc, frames := range e.frames {
+		p.frames[pc] = frames
+	}
+
+	starts := make(map[[32]uintptr]legacyRecord, len(s.records))
+	for _, r := range s.records {
+		starts[r.stack] = r
+	}
+	for _, er := range e.records {
+		sr := starts[er.stack]
+		r := Record{
+			Objects: (er.allocObjects - er.inuseObjects) - (sr.allocObjects - sr.inuseObjects),
+			Bytes:   (er.allocBytes - er.inuseBytes) - (sr.allocBytes - sr.inuseBytes),
+			Stack0:  er.stack,
+		}
+		if r.Objects > 0 {
+			p.Records = append(p.Records, r)
+		}
+	}
+	return p, nil
+}
+
+// heapSnapshot is a heap profile read by readHeap.
+type heapSnapshot struct {
+	time    time.Time // zero for the legacy text format
+	rate    int       // runtime.MemProfileRate
+	scaled  bool      // whether the values estimate all allocations
+	records []legacyRecord
+	frames  map[uintptr][]Frame
+}
+
+// readHeap reads a heap profile in the protocol buffer or legacy text format.
+func readHeap(r io.Reader) (*heapSnapshot, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(zr)
+	}
+
+	if head, _ := br.Peek(len("heap profile:")); string(head) == "heap profile:" {
+		lp, err := parseLegacy(br)
+		if err != nil {
+			return nil, err
+		}
+		return &heapSnapshot{
+			rate:    int(lp.rate / 2),
+			records: lp.records,
+			frames:  lp.frames,
+		}, nil
+	}
+
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	return decodeHeap(data)
+}
+
+// decodeHeap decodes a heap profile in the profile.proto format, as written
+// by runtime/pprof.
+func decodeHeap(data []byte) (*heapSnapshot, error) {
+	pp, err := decodeProto(data)
+	if err != nil {
+		return nil, fmt.Errorf("garbage: bad heap profile: %v", err)
+	}
+
+	index := map[string]int{"alloc_objects": -1, "alloc_space": -1, "inuse_objects": -1, "inuse_space": -1}
+	for i, t := range pp.types {
+		if _, ok := index[t]; ok {
+			index[t] = i
+		}
+	}
+	for name, i := range index {
+		if i < 0 {
+			return nil, fmt.Errorf("garbage: not a heap profile: no %s samples", name)
+		}
+	}
+
+	h := &heapSnapshot{
+		time:   pp.time,
+		rate:   int(pp.period),
+		scaled: true,
+		frames: pp.frames,
+	}
+	for _, s := range pp.samples {
+		h.records = append(h.records, legacyRecord{
+			inuseObjects: s.values[index["inuse_objects"]],
+			inuseBytes:   s.values[index["inuse_space"]],
+			allocObjects: s.values[index["alloc_objects"]],
+			allocBytes:   s.values[index["alloc_space"]],
+			stack:        s.stack,
+		})
+	}
+	return h, nil
+}
+
+// decodeMessage calls fn with each field of the protocol buffer message in
+// data: the value of varint fields, or the contents of length-delimited ones.
+func decodeMessage(data []byte, fn func(tag int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := decodeVarint(data)
+		if n == 0 {
+			return errors.New("truncated field key")
+		}
+		data = data[n:]
+
+		tag, wire := int(key>>3), key&7
+		switch wire {
+		case 0:
+			v, n := decodeVarint(data)
+			if n == 0 {
+				return errors.New("truncated varint")
+			}
+			data = data[n:]
+			if err := fn(tag, v, nil); err != nil {
+				return err
+			}
+		case 1:
+			if len(data) < 8 {
+				return errors.New("truncated fixed64")
+			}
+			data = data[8:]
+		case 2:
+			l, n := decodeVarint(data)
+			if n == 0 || uint64(len(data)-n) < l {
+				return errors.New("truncated length-delimited field")
+			}
+			b := data[n : n+int(l)]
+			data = data[n+int(l):]
+			if err := fn(tag, 0, b); err != nil {
+				return err
+			}
+		case 5:
+			if len(data) < 4 {
+				return errors.New("truncated fixed32")
+			}
+			data = data[4:]
+		default:
+			return fmt.Errorf("unknown wire type %d", wire)
+		}
+	}
+	return nil
+}
+
+// decodeRepeated calls fn with the value of a repeated varint field, v if it
+// was not packed or each varint in b if it was.
+func decodeRepeated(v uint64, b []byte, fn func(uint64)) error {
+	if b == nil {
+		fn(v)
+		return nil
+	}
+	for len(b) > 0 {
+		u, n := decodeVarint(b)
+		if n == 0 {
+			return errors.New("truncated packed varint")
+		}
+		fn(u)
+		b = b[n:]
+	}
+	return nil
+}
+
+// decodeVarint decodes the varint at the start of data, returning it and its
+// length, or a length of zero if data does not hold a whole varint.
+func decodeVarint(data []byte) (uint64, int) {
+	var x uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		b := data[i]
+		x |= uint64(b&0x7f) << (7 * uint(i))
+		if b < 0x80 {
+			return x, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,71 @@
+package garbage
+
+import (
+	"bytes"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"testing"
+)
+
+var heapSink []byte
+
+//go:noinline
+func heapGarbage() {
+	for i := 0; i < 64; i++ {
+		heapSink = make([]byte, 1<<20)
+	}
+	heapSink = nil
+}
+
+func TestGarbageFromHeap(t *testing.T) {
+	for _, debug := range []int{0, 1} {
+		var start, end bytes.Buffer
+
+		runtime.GC()
+		if err := pprof.Lookup("heap").WriteTo(&start, debug); err != nil {
+			t.Fatal(err)
+		}
+		heapGarbage()
+		runtime.GC()
+		runtime.GC()
+		if err := pprof.Lookup("heap").WriteTo(&end, debug); err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := GarbageFromHeap(&start, &end)
+		if err != nil {
+			t.Fatalf("debug=%d: %v", debug, err)
+		}
+		if p.scaled != (debug == 0) {
+			t.Errorf("debug=%d: want scaled %v", debug, debug == 0)
+		}
+
+		var found bool
+		for _, r := range p.Records {
+			for _, pc := range r.Stack() {
+				for _, fr := range p.frames[pc] {
+					if strings.HasSuffix(fr.Function, ".heapGarbage") {
+						found = true
+						if r.Bytes < 32<<20 {
+							t.Errorf("debug=%d: want at least 32 MiB of garbage from heapGarbage, got %d", debug, r.Bytes)
+						}
+					}
+				}
+			}
+		}
+		if !found {
+			t.Errorf("debug=%d: no garbage attributed to heapGarbage", debug)
+		}
+	}
+}
+
+func TestGarbageFromHeapMixed(t *testing.T) {
+	var proto, text bytes.Buffer
+	pprof.Lookup("heap").WriteTo(&proto, 0)
+	pprof.Lookup("heap").WriteTo(&text, 1)
+
+	if _, err := GarbageFromHeap(&proto, &text); err == nil {
+		t.Error("want error mixing formats")
+	}
+}
@@ -0,0 +1,35 @@
+package garbage
+
+import (
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestImports checks that the package imports only the standard library and
+// its internal packages, so importing the handler never pulls in other
+// modules.
+func TestImports(t *testing.T) {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), ".", nil, parser.ImportsOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range pkgs {
+		for name, f := range pkg.Files {
+			if strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			for _, imp := range f.Imports {
+				path, _ := strconv.Unquote(imp.Path.Value)
+				if strings.HasPrefix(path, "github.com/benburkert/pprof-garbage/internal/") {
+					continue
+				}
+				if elem := strings.SplitN(path, "/", 2)[0]; strings.Contains(elem, ".") {
+					t.Errorf("%s imports %s, outside the standard library", name, path)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package garbage
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const indexDescription = "Estimates of the allocations that became garbage during " +
+	"the window set by the seconds GET parameter (default 30s). The request " +
+	"takes twice as long as the window."
+
+const growthDescription = "Net growth in memory in use over the window set by the " +
+	"seconds GET parameter (default 30s). The request takes twice as long as the window."
+
+// Index wraps the net/http/pprof index handler so the /debug/pprof/ page also
+// lists the garbage and growth profiles:
+//
+//	mux.Handle("/debug/pprof/", garbage.Index(http.HandlerFunc(pprof.Index)))
+//
+// Requests for individual profiles pass through to index unchanged.
+func Index(index http.Handler) http.Handler {
+	if !enabled {
+		return index
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iw := &indexWriter{ResponseWriter: w}
+		index.ServeHTTP(iw, r)
+		if iw.page == nil {
+			return
+		}
+
+		page := iw.page.Bytes()
+		page = insertBefore(page, "</table>", "<tr><td></td><td><a href='garbage?debug=1'>garbage</a></td></tr>\n"+
+			"<tr><td></td><td><a href='growth?debug=1'>growth</a></td></tr>\n")
+		page = insertBefore(page, "</ul>", fmt.Sprintf("<li><div class=profile-name>garbage: </div> %s</li>\n", indexDescription)+
+			fmt.Sprintf("<li><div class=profile-name>growth: </div> %s</li>\n", growthDescription))
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(page)
+	})
+}
+
+// indexWriter buffers a successful HTML response so the profile listing can
+// be amended, and passes any other response through.
+type indexWriter struct {
+	http.ResponseWriter
+
+	page        *bytes.Buffer
+	wroteHeader bool
+}
+
+func (w *indexWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if code == http.StatusOK && strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		w.page = new(bytes.Buffer)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *indexWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.page != nil {
+		return w.page.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func insertBefore(page []byte, marker, text string) []byte {
+	i := bytes.Index(page, []byte(marker))
+	if i < 0 {
+		return page
+	}
+
+	out := make([]byte, 0, len(page)+len(text))
+	out = append(out, page[:i]...)
+	out = append(out, text...)
+	return append(out, page[i:]...)
+}
@@ -0,0 +1,75 @@
+package garbage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/pprof"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	requireEnabled(t)
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/pprof/", Index(http.HandlerFunc(pprof.Index)))
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/debug/pprof/", "<a href='garbage?debug=1'>garbage</a>"},
+		{"/debug/pprof/", "garbage: </div> " + indexDescription},
+		{"/debug/pprof/", "<a href='growth?debug=1'>growth</a>"},
+		{"/debug/pprof/goroutine?debug=1", "goroutine profile: total"},
+	}
+
+	for _, test := range tests {
+		res, err := http.Get(srv.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s: want status %d, got %d", test.path, http.StatusOK, res.StatusCode)
+		}
+		if !strings.Contains(string(body), test.want) {
+			t.Errorf("%s: want %q in body:\n%s", test.path, test.want, body)
+		}
+	}
+}
+
+// TestDefaultServeMux checks the handlers registered alongside those of
+// net/http/pprof, imported above, whose "GET /debug/pprof/" conflicts with
+// patterns without a method since Go 1.22.
+func TestDefaultServeMux(t *testing.T) {
+	requireEnabled(t)
+
+	tests := []struct {
+		method, path string
+	}{
+		{"GET", "/debug/pprof/garbage"},
+		{"HEAD", "/debug/pprof/garbage"},
+		{"GET", "/debug/pprof/growth"},
+		{"POST", "/debug/pprof/garbage/cancel"},
+		{"POST", "/debug/pprof/garbage/collector"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if h, _ := http.DefaultServeMux.Handler(r); h == nil {
+			t.Errorf("%s %s: no handler", test.method, test.path)
+		} else if _, ok := h.(*Handler); !ok {
+			t.Errorf("%s %s: want *Handler, got %T", test.method, test.path, h)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+// Package replay lets garbagetest set the recording a garbage.Handler
+// replays in place of the GC, without exporting it from package garbage.
+package replay
+
+// SetHandler sets the *garbage.Recording the *garbage.Handler h replays. It is
+// installed by package garbage when it is initialized.
+var SetHandler func(h, rec interface{})
@@ -0,0 +1,82 @@
+package garbage
+
+import (
+	"runtime"
+	"time"
+)
+
+// An isolation cuts the garbage a subscription aggregates into segments at
+// the start and end of each burst of garbage, so the stacks of a burst are
+// isolated in a profile of their own rather than diluted across the window.
+type isolation struct {
+	rates    baseline  // garbage rates of the cycles outside bursts
+	observed time.Time // time of the last cycle
+	burst    bool      // whether the cycles are in a burst
+	segments []*Profile
+}
+
+// isolateBursts lets s cut its garbage into segments at the edges of bursts.
+func (c *collector) isolateBursts(s *subscription) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.isolate = new(isolation)
+}
+
+// isolateBurst cuts s before cycle if the cycle starts or ends a burst: a
+// cycle whose garbage rate is anomalous against the baseline of the rates,
+// as for a Detector. Like an adaptive subscription, s learns the baseline
+// over its first cycles before judging any. prev is the read of the memory
+// profile before the cycle.
+func (s *subscription) isolateBurst(cycle Cycle, prev []runtime.MemProfileRecord) {
+	is := s.isolate
+	last := is.observed
+	is.observed = cycle.Time
+	if last.IsZero() || !cycle.Time.After(last) {
+		return
+	}
+	rate := float64(cycle.Bytes) / cycle.Time.Sub(last).Seconds()
+
+	b := &is.rates
+	burst := b.n >= adaptiveWarmup && rate > b.mean+defaultAnomalySensitivity*b.stdDev()
+	if !burst {
+		b.add(defaultAnomalyAlpha, rate)
+	}
+	if burst == is.burst {
+		return
+	}
+	is.burst = burst
+	if len(s.cycles) == 0 {
+		return
+	}
+
+	s.last = prev
+	p := s.profile(garbageKind)
+	p.isolatedBurst = !burst
+	is.segments = append(is.segments, p)
+	s.cycles, s.tops, s.garbage, s.survival, s.degraded = nil, nil, nil, nil, false
+	s.first, s.numGC = prev, p.Cycles[len(p.Cycles)-1].NumGC
+}
+
+// isolated returns the profiles of the kind of the segments s was cut into,
+// and of the rest of its window since, in order. The window opened at start
+// and closed at end; each segment closes with its last cycle.
+func (s *subscription) isolated(kind string, start, end time.Time) []*Profile {
+	rest := s.profile(kind)
+	parts := []*Profile{rest}
+	if s.isolate != nil {
+		rest.isolatedBurst = s.isolate.burst
+		parts = append(s.isolate.segments, rest)
+	}
+	for i, p := range parts {
+		p.Kind = kind
+		p.Start = start
+		if i < len(parts)-1 {
+			start = p.Cycles[len(p.Cycles)-1].Time
+		} else {
+			start = end
+		}
+		p.Duration = start.Sub(p.Start)
+	}
+	return parts
+}
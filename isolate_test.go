@@ -0,0 +1,58 @@
+package garbage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsolateBursts(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	s := &subscription{isolate: new(isolation)}
+	for i := 0; i < 12; i++ {
+		garbage := []Record{testRecord(1, 62, 1000)}
+		if i == 7 || i == 8 {
+			garbage = append(garbage, testRecord(2, 3125, 50000)) // the burst
+		}
+		cycle := Cycle{NumGC: uint32(i + 1), Time: start.Add(time.Duration(i+1) * time.Second)}
+		for _, r := range garbage {
+			cycle.Bytes += r.Bytes
+		}
+
+		// As the collector observes the cycle.
+		s.isolateBurst(cycle, nil)
+		s.cycles = append(s.cycles, cycle)
+		s.tops = append(s.tops, topRecords(garbage, burstTopStacks))
+		for _, r := range garbage {
+			s.garbage = merge(s.garbage, r)
+		}
+	}
+
+	end := start.Add(12 * time.Second)
+	parts := s.isolated(garbageKind, start, end)
+	if len(parts) != 3 {
+		t.Fatalf("want 3 intervals, got %d", len(parts))
+	}
+	want := []struct {
+		cycles int
+		burst  bool
+		stacks int
+		start  time.Duration
+	}{
+		{7, false, 1, 0},
+		{2, true, 2, 7 * time.Second},
+		{3, false, 1, 9 * time.Second},
+	}
+	for i, w := range want {
+		p := parts[i]
+		if len(p.Cycles) != w.cycles || p.isolatedBurst != w.burst || len(p.Records) != w.stacks {
+			t.Errorf("interval %d: want %d cycles, burst %v and %d stacks; got %d, %v and %d",
+				i, w.cycles, w.burst, w.stacks, len(p.Cycles), p.isolatedBurst, len(p.Records))
+		}
+		if got := p.Start.Sub(start); got != w.start {
+			t.Errorf("interval %d: want start +%v, got +%v", i, w.start, got)
+		}
+	}
+	if last := parts[2]; !last.Start.Add(last.Duration).Equal(end) {
+		t.Errorf("want the last interval to close with the window, got %v", last.Start.Add(last.Duration))
+	}
+}
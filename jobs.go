@@ -0,0 +1,400 @@
+package garbage
+
+import (
+	"context"
+	"runtime"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// jobs tracks the in-flight collections.
+var jobs = struct {
+	sync.Mutex
+	m    map[string]*job
+	next uint64
+}{m: make(map[string]*job)}
+
+// A job is a single in-flight collection.
+type job struct {
+	id     string
+	kind   string // garbageKind or growthKind
+	record bool   // whether to keep a Recording of the collection
+	start  time.Time
+	window time.Duration
+
+	traceID   string // W3C trace ID of the request that started the job
+	intervals int    // if above one, the sub-intervals of the window profiled
+	isolate   bool   // whether to cut the sub-intervals at the edges of bursts
+	opened    func() // if set, called when the window opens
+
+	// maxOverhead, if positive, limits the collector's overhead; over it,
+	// the collection is degraded if degrade is set, or aborted with err.
+	maxOverhead float64
+	degrade     bool
+
+	// budget limits the CPU of the aggregation of each cycle.
+	budget AggregationBudget
+
+	// adaptive, if above one, is the largest stride of the collection's
+	// reads of the memory profile.
+	adaptive int
+
+	// depth, if positive, trims the stacks of the collection to their
+	// innermost depth frames.
+	depth int
+
+	// waitGC, if positive, is the longest the window is extended for a
+	// GC cycle, if it observed none.
+	waitGC time.Duration
+
+	// replay, if set, is replayed in place of collecting.
+	replay *Recording
+
+	// maxStacks, if positive, is the most stacks of garbage the collection
+	// holds in memory, spilling the rest to runs in spillDir.
+	maxStacks int
+	spillDir  string
+
+	mu  sync.Mutex
+	sub *subscription // nil while calibrating
+	err error         // why the collection was aborted, if it was
+
+	cancel     chan struct{}
+	cancelOnce sync.Once
+	done       chan struct{}
+	profile    *Profile   // set once done is closed
+	recording  *Recording // set once done is closed, if record is set
+}
+
+// startJob registers a collection over window, clamped to the duration
+// policy of the process.
+func startJob(window time.Duration) *job {
+	window = processPolicy().clamp(window)
+
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	jobs.next++
+	j := &job{
+		id:     strconv.FormatUint(jobs.next, 10),
+		kind:   garbageKind,
+		start:  time.Now(),
+		window: window,
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	jobs.m[j.id] = j
+	return j
+}
+
+// collect runs the collection and unregisters the job. If the job is
+// cancelled, the profile holds the garbage collected so far and is marked as
+// truncated.
+//
+// The collection is a "garbage.collect" task of the execution trace, with
+// "calibrate" and "window" regions for its two halves.
+func (j *job) collect() *Profile {
+	ctx, task := trace.NewTask(context.Background(), "garbage.collect")
+	defer func() {
+		task.End()
+
+		jobs.Lock()
+		delete(jobs.m, j.id)
+		jobs.Unlock()
+
+		close(j.done)
+	}()
+	trace.Logf(ctx, "garbage", "job %s: %s profile over %v", j.id, j.kind, j.window)
+
+	if j.replay != nil {
+		return j.replayed()
+	}
+
+	region := trace.StartRegion(ctx, "calibrate")
+	periodGC, ok := calcPeriod(j.window, j.cancel)
+	region.End()
+	if !ok {
+		j.profile = &Profile{
+			Start:     time.Now(),
+			Rate:      runtime.MemProfileRate,
+			Kind:      j.kind,
+			Truncated: true,
+			TraceID:   j.traceID,
+		}
+		if j.record {
+			j.recording = &Recording{
+				Start:     j.profile.Start,
+				Rate:      j.profile.Rate,
+				Truncated: true,
+			}
+		}
+		return j.profile
+	}
+
+	sub := shared.subscribe(periodGC, j.record)
+	j.guard(sub)
+	j.limit(sub)
+	j.adapt(sub)
+	j.trim(sub)
+	j.spill(sub)
+	j.mu.Lock()
+	j.sub = sub
+	j.mu.Unlock()
+
+	trace.Logf(ctx, "garbage", "GC period %v", periodGC)
+
+	if j.opened != nil {
+		j.opened()
+	}
+
+	region = trace.StartRegion(ctx, "window")
+	startStats := readRuntimeStats()
+	start := time.Now()
+	var (
+		parts    []*Profile
+		finished bool
+	)
+	if j.intervals > 1 || j.isolating() {
+		parts, finished = j.partition(periodGC)
+	} else {
+		finished = sleep(j.window, j.cancel)
+	}
+	if finished && j.waitGC > 0 {
+		finished = shared.waitCycle(sub, j.waitGC, j.cancel)
+	}
+	shared.unsubscribe(sub)
+	region.End()
+
+	endStats := readRuntimeStats()
+	memstats := new(runtime.MemStats)
+	runtime.ReadMemStats(memstats)
+
+	j.profile = sub.profile(j.kind)
+	j.profile.Start = start
+	j.profile.Duration = time.Since(start)
+	j.profile.Rate = runtime.MemProfileRate
+	j.profile.Truncated = !finished
+	j.profile.TraceID = j.traceID
+	j.profile.MemStats = memstats
+	j.profile.StartStats, j.profile.EndStats = startStats, endStats
+	j.profile.Bursts = j.profile.findBursts()
+	j.profile.StackQuantiles = j.profile.findStackQuantiles()
+	j.profile.Overshoots = j.profile.findOvershoots()
+	j.profile.Intervals = parts
+	if j.record {
+		j.recording = newRecording(j.profile, sub.recorded)
+	}
+	return j.profile
+}
+
+// replayed sets the profile of the job, and its recording if it keeps one, to
+// those of j.replay. The recording is copied, so scrubbing it leaves j.replay
+// as it was.
+func (j *job) replayed() *Profile {
+	j.profile = j.replay.Replay(ReplayOptions{Depth: j.depth})
+	j.profile.TraceID = j.traceID
+	if j.record {
+		rec := *j.replay
+		rec.frames = make(map[uintptr][]Frame, len(j.replay.frames))
+		for pc, frs := range j.replay.frames {
+			rec.frames[pc] = frs
+		}
+		j.recording = &rec
+	}
+	return j.profile
+}
+
+// partition waits out the window in j.intervals equal sub-intervals, or one
+// if there are none, and returns the profile of each, with a subscription of
+// its own alongside the window's. If the job isolates bursts, each
+// sub-interval is cut at their edges into several profiles. It reports
+// whether the window closed before the job was cancelled.
+func (j *job) partition(periodGC time.Duration) ([]*Profile, bool) {
+	n := j.intervals
+	if n < 1 {
+		n = 1
+	}
+
+	var parts []*Profile
+	end := time.Now().Add(j.window)
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		sub := shared.subscribe(periodGC, false)
+		j.adapt(sub)
+		j.trim(sub)
+		if j.isolating() {
+			shared.isolateBursts(sub)
+		}
+		finished := sleep(end.Sub(start)/time.Duration(n-i), j.cancel)
+		shared.unsubscribe(sub)
+
+		for _, p := range sub.isolated(j.kind, start, time.Now()) {
+			p.Rate = runtime.MemProfileRate
+			p.TraceID = j.traceID
+			p.Bursts = p.findBursts()
+			p.StackQuantiles = p.findStackQuantiles()
+			p.Overshoots = p.findOvershoots()
+			parts = append(parts, p)
+		}
+		if !finished {
+			parts[len(parts)-1].Truncated = true
+			return parts, false
+		}
+	}
+	return parts, true
+}
+
+// isolating reports whether the job isolates bursts into intervals of their
+// own.
+func (j *job) isolating() bool {
+	return j.isolate && j.kind == garbageKind
+}
+
+// Cancel stops the in-flight collection with the given ID and returns the
+// truncated profile of the garbage collected so far. It returns false if there
+// is no such collection.
+func Cancel(id string) (*Profile, bool) {
+	jobs.Lock()
+	j, ok := jobs.m[id]
+	jobs.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	j.stop()
+	<-j.done
+	return j.profile, true
+}
+
+// stop cancels the collection, if it is still running.
+func (j *job) stop() {
+	j.cancelOnce.Do(func() { close(j.cancel) })
+}
+
+// guard applies the job's overhead limit to its subscription.
+func (j *job) guard(sub *subscription) {
+	if j.maxOverhead <= 0 {
+		return
+	}
+	abort := j.abort
+	if j.degrade {
+		abort = nil
+	}
+	shared.guard(sub, j.maxOverhead, abort)
+}
+
+// limit applies the job's aggregation budget to its subscription.
+func (j *job) limit(sub *subscription) {
+	if j.budget != (AggregationBudget{}) {
+		shared.limitAggregation(sub, j.budget)
+	}
+}
+
+// adapt applies the job's adaptive stride to its subscription.
+func (j *job) adapt(sub *subscription) {
+	if j.adaptive > 1 {
+		shared.adapt(sub, j.adaptive)
+	}
+}
+
+// trim applies the job's stack depth to its subscription.
+func (j *job) trim(sub *subscription) {
+	if j.depth > 0 {
+		shared.trimTo(sub, j.depth)
+	}
+}
+
+// spill applies the job's budget of stacks in memory to its subscription.
+func (j *job) spill(sub *subscription) {
+	if j.maxStacks > 0 {
+		shared.spillTo(sub, j.maxStacks, j.spillDir)
+	}
+}
+
+// abort cancels the collection with err.
+func (j *job) abort(err error) {
+	j.mu.Lock()
+	j.err = err
+	j.mu.Unlock()
+	j.stop()
+}
+
+// abortErr returns the error the collection was aborted with, if any.
+func (j *job) abortErr() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// Progress describes an in-flight collection.
+type Progress struct {
+	ID      string        `json:"id"`
+	Phase   string        `json:"phase"` // "calibrating" or "collecting"
+	Start   time.Time     `json:"start"`
+	Window  time.Duration `json:"window_ns"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+	Percent float64       `json:"percent"` // of the expected wall time
+	Cycles  int           `json:"cycles"`  // GC cycles observed
+	Stacks  int           `json:"stacks"`  // allocation stacks with garbage
+}
+
+// Jobs returns the progress of the in-flight collections, oldest first.
+func Jobs() []Progress {
+	jobs.Lock()
+	js := make([]*job, 0, len(jobs.m))
+	for _, j := range jobs.m {
+		js = append(js, j)
+	}
+	jobs.Unlock()
+
+	ps := make([]Progress, 0, len(js))
+	for _, j := range js {
+		ps = append(ps, j.progress())
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].Start.Before(ps[j].Start) })
+	return ps
+}
+
+// JobProgress returns the progress of the in-flight collection with the given
+// ID, or false if there is none.
+func JobProgress(id string) (Progress, bool) {
+	jobs.Lock()
+	j, ok := jobs.m[id]
+	jobs.Unlock()
+
+	if !ok {
+		return Progress{}, false
+	}
+	return j.progress(), true
+}
+
+func (j *job) progress() Progress {
+	p := Progress{
+		ID:      j.id,
+		Phase:   "calibrating",
+		Start:   j.start,
+		Window:  j.window,
+		Elapsed: time.Since(j.start),
+	}
+
+	if total := 2 * j.window; total > 0 {
+		p.Percent = 100 * float64(p.Elapsed) / float64(total)
+		if p.Percent > 100 {
+			p.Percent = 100
+		}
+	}
+
+	j.mu.Lock()
+	sub := j.sub
+	j.mu.Unlock()
+
+	if sub != nil {
+		p.Phase = "collecting"
+		p.Cycles, p.Stacks = shared.stats(sub)
+	}
+	return p
+}
@@ -0,0 +1,174 @@
+package garbage
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"runtime/trace"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobsProgress(t *testing.T) {
+	requireEnabled(t)
+
+	j := startJob(2 * time.Second)
+
+	p, ok := JobProgress(j.id)
+	if !ok {
+		t.Fatalf("job %s not found", j.id)
+	}
+	if p.Phase != "calibrating" || p.Window != 2*time.Second {
+		t.Errorf("want calibrating 2s job, got %+v", p)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		j.collect()
+		close(done)
+	}()
+
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if p, _ = JobProgress(j.id); p.Phase == "collecting" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job never started collecting: %+v", p)
+		}
+	}
+	if p.Percent < 50 || p.Percent > 100 {
+		t.Errorf("want collecting job at least half done, got %.1f%%", p.Percent)
+	}
+
+	rec := httptest.NewRecorder()
+	new(Handler).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/garbage/progress", nil))
+
+	var ps []Progress
+	if err := json.NewDecoder(rec.Body).Decode(&ps); err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 1 || ps[0].ID != j.id {
+		t.Errorf("want progress for job %s, got %+v", j.id, ps)
+	}
+
+	<-done
+
+	if _, ok := JobProgress(j.id); ok {
+		t.Errorf("job %s still in flight after collection", j.id)
+	}
+
+	rec = httptest.NewRecorder()
+	new(Handler).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/garbage/progress?id="+j.id, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("want code %d for finished job, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestJobsCancel(t *testing.T) {
+	requireEnabled(t)
+
+	tests := []struct {
+		phase  string
+		window time.Duration
+	}{
+		{"calibrating", time.Hour},
+		{"collecting", 3 * time.Second},
+	}
+
+	for _, test := range tests {
+		phase := test.phase
+		j := startJob(test.window)
+
+		profc := make(chan *Profile)
+		go func() { profc <- j.collect() }()
+
+		for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			if p, _ := JobProgress(j.id); p.Phase == phase {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: job never reached phase", phase)
+			}
+		}
+
+		rec := httptest.NewRecorder()
+		new(Handler).ServeHTTP(rec, httptest.NewRequest("POST", "/debug/pprof/garbage/cancel?id="+j.id, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: want code %d, got %d", phase, http.StatusOK, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "# "+truncatedComment) {
+			t.Errorf("%s: cancel response not marked truncated: %q", phase, rec.Body)
+		}
+
+		select {
+		case p := <-profc:
+			if !p.Truncated {
+				t.Errorf("%s: collected profile not truncated", phase)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: collection did not stop after cancel", phase)
+		}
+	}
+}
+
+func TestJobsTraced(t *testing.T) {
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("execution trace already running: %v", err)
+	}
+
+	j := startJob(200 * time.Millisecond)
+	go func() {
+		for !stopped(j.done) {
+			runtime.GC()
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	p := j.collect()
+	trace.Stop()
+
+	if len(p.Cycles) == 0 {
+		t.Error("no GC cycles observed while tracing")
+	}
+	for _, name := range []string{"garbage.collect", "garbage.cycle", "calibrate", "window"} {
+		if !bytes.Contains(buf.Bytes(), []byte(name)) {
+			t.Errorf("execution trace is missing %q", name)
+		}
+	}
+}
+
+func TestWaitCycle(t *testing.T) {
+	c := new(collector)
+	s := new(subscription)
+	cancel := make(chan struct{})
+
+	start := time.Now()
+	if !c.waitCycle(s, 10*time.Millisecond, cancel) {
+		t.Errorf("want the wait to time out, not be cancelled")
+	}
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("want a wait of 10ms without cycles, got %v", d)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.mu.Lock()
+		s.cycles = append(s.cycles, Cycle{NumGC: 1})
+		c.mu.Unlock()
+	}()
+	start = time.Now()
+	if !c.waitCycle(s, time.Minute, cancel) {
+		t.Errorf("want the wait to end with a cycle")
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("want the wait to end at the cycle, got %v", d)
+	}
+
+	close(cancel)
+	if c.waitCycle(&subscription{}, time.Minute, cancel) {
+		t.Errorf("want a cancelled wait")
+	}
+}
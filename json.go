@@ -0,0 +1,438 @@
+package garbage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"time"
+)
+
+// The NDJSON form of a profile is a "profile" line with the collection totals,
+// followed by a "cycle" line per GC cycle observed, a "record" line per
+// allocation stack, a "suspect" line per retention suspect, a "survival" line
+// per allocating stack, a "burst" line per burst, an "overshoot" line per GC
+// cycle whose heap overshot its goal, a "quantiles" line per stack with the
+// most garbage, a "pool" line per call site of a sync.Pool allocating garbage
+// and an "owner" line per owner, if the profile has Owners.
+type (
+	jsonProfile struct {
+		Type      string            `json:"type"`
+		Kind      string            `json:"kind"`
+		Start     time.Time         `json:"start"`
+		Duration  int64             `json:"duration_ns"`
+		Rate      int               `json:"rate"`
+		Truncated bool              `json:"truncated"`
+		Degraded  bool              `json:"degraded,omitempty"`
+		PerSecond bool              `json:"per_second,omitempty"`
+		Stride    float64           `json:"stride,omitempty"`
+		Sample    string            `json:"default_sample,omitempty"`
+		TraceID   string            `json:"trace_id,omitempty"`
+		Build     string            `json:"build,omitempty"`
+		Labels    map[string]string `json:"labels,omitempty"`
+		Objects   int64             `json:"objects"`
+		Bytes     int64             `json:"bytes"`
+		Cycles    int               `json:"cycles"`
+
+		// Records whose stacks were truncated at the depth of the
+		// memory profile.
+		TruncatedStacks int `json:"truncated_stacks,omitempty"`
+
+		// Windows of the profiles merged, if any.
+		Windows []jsonWindow `json:"windows,omitempty"`
+
+		// GC CPU usage over the window, if available.
+		GCCPUFraction *float64 `json:"gc_cpu_fraction,omitempty"`
+		AssistCPU     *int64   `json:"assist_cpu_ns,omitempty"`
+
+		// Growth of the memory outside the Go heap over the window, if
+		// available.
+		Native *jsonNative `json:"native,omitempty"`
+
+		// Estimated accuracy of the total garbage, if any.
+		Accuracy *jsonAccuracy `json:"accuracy,omitempty"`
+
+		// Quantiles of the garbage bytes per GC cycle, if any cycles
+		// were observed.
+		CycleQuantiles *jsonQuantiles `json:"cycle_quantiles,omitempty"`
+	}
+
+	jsonQuantiles struct {
+		P50 int64 `json:"p50"`
+		P90 int64 `json:"p90"`
+		P99 int64 `json:"p99"`
+	}
+
+	jsonStackQuantiles struct {
+		Type  string      `json:"type"`
+		P50   int64       `json:"p50"`
+		P90   int64       `json:"p90"`
+		P99   int64       `json:"p99"`
+		Stack []jsonFrame `json:"stack"`
+	}
+
+	jsonAccuracy struct {
+		Samples       float64 `json:"samples"`
+		SamplingError float64 `json:"sampling_error"`
+		CycleError    float64 `json:"cycle_error"`
+		Margin        float64 `json:"margin_95"`
+	}
+
+	jsonNative struct {
+		NonGo    *int64 `json:"non_go_bytes,omitempty"`
+		Runtime  int64  `json:"runtime_bytes"`
+		CgoCalls int64  `json:"cgo_calls"`
+	}
+
+	jsonWindow struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+	}
+
+	jsonCycle struct {
+		Type     string    `json:"type"`
+		NumGC    uint32    `json:"num_gc"`
+		Time     time.Time `json:"time"`
+		Pause    int64     `json:"pause_ns"`
+		MarkCPU  int64     `json:"mark_cpu_ns"`
+		HeapLive uint64    `json:"heap_live"`
+		HeapGoal uint64    `json:"heap_goal"`
+		Objects  int64     `json:"objects"`
+		Bytes    int64     `json:"bytes"`
+	}
+
+	jsonRecord struct {
+		Type    string      `json:"type"`
+		Objects int64       `json:"objects"`
+		Bytes   int64       `json:"bytes"`
+		Cycles  int         `json:"cycles"`
+		Ages    jsonAges    `json:"ages"`
+		Sizes   jsonSizes   `json:"sizes"`
+		Stack   []jsonFrame `json:"stack"`
+
+		StackTruncated bool   `json:"stack_truncated,omitempty"`
+		Reclaim        string `json:"reclaim,omitempty"`
+	}
+
+	jsonAges struct {
+		SameCycle int64 `json:"same_cycle"`
+		OneCycle  int64 `json:"one_cycle"`
+		FewCycles int64 `json:"few_cycles"`
+		Longer    int64 `json:"longer"`
+	}
+
+	jsonSizes struct {
+		Tiny   int64 `json:"tiny"`
+		Small  int64 `json:"small"`
+		Medium int64 `json:"medium"`
+		Large  int64 `json:"large"`
+		Huge   int64 `json:"huge"`
+	}
+
+	jsonSuspect struct {
+		Type         string      `json:"type"`
+		AllocObjects int64       `json:"alloc_objects"`
+		AllocBytes   int64       `json:"alloc_bytes"`
+		FreeObjects  int64       `json:"free_objects"`
+		FreeBytes    int64       `json:"free_bytes"`
+		Stack        []jsonFrame `json:"stack"`
+	}
+
+	jsonSurvival struct {
+		Type      string      `json:"type"`
+		Allocated int64       `json:"allocated"`
+		Survived  int64       `json:"survived"`
+		Fraction  float64     `json:"fraction"`
+		Stack     []jsonFrame `json:"stack"`
+	}
+
+	jsonBurst struct {
+		Type   string            `json:"type"`
+		Start  time.Time         `json:"start"`
+		End    time.Time         `json:"end"`
+		Cycles int               `json:"cycles"`
+		Rate   float64           `json:"rate"`
+		Median float64           `json:"median_rate"`
+		Stacks []jsonBurstRecord `json:"stacks"`
+	}
+
+	jsonBurstRecord struct {
+		Objects int64       `json:"objects"`
+		Bytes   int64       `json:"bytes"`
+		Stack   []jsonFrame `json:"stack"`
+	}
+
+	jsonOvershoot struct {
+		Type   string            `json:"type"`
+		NumGC  uint32            `json:"num_gc"`
+		Time   time.Time         `json:"time"`
+		Pause  int64             `json:"pause_ns"`
+		Goal   uint64            `json:"heap_goal"`
+		Heap   uint64            `json:"heap"`
+		Bytes  uint64            `json:"overshoot_bytes"`
+		Stacks []jsonBurstRecord `json:"stacks"`
+	}
+
+	jsonPool struct {
+		Type    string    `json:"type"`
+		Site    jsonFrame `json:"site"`
+		Misses  int64     `json:"misses"`
+		Objects int64     `json:"objects"`
+		Bytes   int64     `json:"bytes"`
+		Churn   float64   `json:"churn"`
+	}
+
+	jsonOwner struct {
+		Type    string `json:"type"`
+		Owner   string `json:"owner"`
+		Objects int64  `json:"objects"`
+		Bytes   int64  `json:"bytes"`
+		Stacks  int    `json:"stacks"`
+	}
+
+	jsonFrame struct {
+		PC       string `json:"pc"`
+		Function string `json:"function,omitempty"`
+		File     string `json:"file,omitempty"`
+		Line     int    `json:"line,omitempty"`
+	}
+)
+
+// writeJSON writes the profile to w as newline-delimited JSON.
+func (p *Profile) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	head := jsonProfile{
+		Type:      "profile",
+		Kind:      p.kind(),
+		Start:     p.Start,
+		Duration:  int64(p.Duration),
+		Rate:      p.Rate,
+		Truncated: p.Truncated,
+		Degraded:  p.Degraded,
+		PerSecond: p.perSecond,
+		Stride:    p.Stride,
+		Sample:    p.DefaultSample,
+		TraceID:   p.TraceID,
+		Build:     p.Build,
+		Labels:    p.Labels,
+		Cycles:    len(p.Cycles),
+	}
+	head.TruncatedStacks, _ = p.TruncatedStacks()
+	for _, w := range p.Windows {
+		head.Windows = append(head.Windows, jsonWindow(w))
+	}
+	for _, r := range p.Records {
+		head.Objects += r.Objects
+		head.Bytes += r.Bytes
+	}
+	if p.StartStats != nil && p.EndStats != nil {
+		if fraction, assist, ok := gcCPU(p.StartStats, p.EndStats); ok {
+			ns := int64(assist)
+			head.GCCPUFraction, head.AssistCPU = &fraction, &ns
+		}
+	}
+	if g, ok := p.Native(); ok {
+		head.Native = &jsonNative{Runtime: g.Runtime, CgoCalls: g.CgoCalls}
+		if g.RSSKnown {
+			head.Native.NonGo = &g.NonGo
+		}
+	}
+	if a, ok := p.Accuracy(); ok {
+		head.Accuracy = &jsonAccuracy{
+			Samples:       math.Round(a.Samples),
+			SamplingError: a.SamplingError,
+			CycleError:    a.CycleError,
+			Margin:        a.Margin(),
+		}
+	}
+	if q, ok := p.CycleQuantiles(); ok {
+		head.CycleQuantiles = &jsonQuantiles{P50: q.P50, P90: q.P90, P99: q.P99}
+	}
+	if err := enc.Encode(head); err != nil {
+		return err
+	}
+
+	for _, c := range p.Cycles {
+		cycle := jsonCycle{
+			Type:     "cycle",
+			NumGC:    c.NumGC,
+			Time:     c.Time,
+			Pause:    int64(c.Pause),
+			MarkCPU:  int64(c.MarkCPU),
+			HeapLive: c.HeapLive,
+			HeapGoal: c.HeapGoal,
+			Objects:  c.Objects,
+			Bytes:    c.Bytes,
+		}
+		if err := enc.Encode(cycle); err != nil {
+			return err
+		}
+	}
+
+	for i := range p.Records {
+		r := &p.Records[i]
+		rec := jsonRecord{
+			Type:    "record",
+			Objects: r.Objects,
+			Bytes:   r.Bytes,
+			Cycles:  r.Cycles,
+			Ages:    jsonAges(r.Ages),
+			Sizes:   jsonSizes(r.Sizes),
+			Stack:   p.jsonStack(r.Stack()),
+
+			StackTruncated: r.StackTruncated(),
+			Reclaim:        p.Reclaim(r),
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+
+	for i := range p.Suspects {
+		d := &p.Suspects[i]
+		sus := jsonSuspect{
+			Type:         "suspect",
+			AllocObjects: d.AllocObjects,
+			AllocBytes:   d.AllocBytes,
+			FreeObjects:  d.FreeObjects,
+			FreeBytes:    d.FreeBytes,
+			Stack:        p.jsonStack(d.Stack()),
+		}
+		if err := enc.Encode(sus); err != nil {
+			return err
+		}
+	}
+
+	for i := range p.Survival {
+		s := &p.Survival[i]
+		sv := jsonSurvival{
+			Type:      "survival",
+			Allocated: s.Allocated,
+			Survived:  s.Survived,
+			Fraction:  s.Fraction(),
+			Stack:     p.jsonStack(s.Stack()),
+		}
+		if err := enc.Encode(sv); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range p.Bursts {
+		jb := jsonBurst{
+			Type:   "burst",
+			Start:  b.Start,
+			End:    b.End,
+			Cycles: b.Cycles,
+			Rate:   b.Rate,
+			Median: b.Median,
+		}
+		for i := range b.Stacks {
+			r := &b.Stacks[i]
+			jb.Stacks = append(jb.Stacks, jsonBurstRecord{
+				Objects: r.Objects,
+				Bytes:   r.Bytes,
+				Stack:   p.jsonStack(r.Stack()),
+			})
+		}
+		if err := enc.Encode(jb); err != nil {
+			return err
+		}
+	}
+
+	for i := range p.Overshoots {
+		o := &p.Overshoots[i]
+		jo := jsonOvershoot{
+			Type:  "overshoot",
+			NumGC: o.NumGC,
+			Time:  o.Time,
+			Pause: int64(o.Pause),
+			Goal:  o.Goal,
+			Heap:  o.Heap,
+			Bytes: o.Bytes(),
+		}
+		for j := range o.Stacks {
+			r := &o.Stacks[j]
+			jo.Stacks = append(jo.Stacks, jsonBurstRecord{
+				Objects: r.Objects,
+				Bytes:   r.Bytes,
+				Stack:   p.jsonStack(r.Stack()),
+			})
+		}
+		if err := enc.Encode(jo); err != nil {
+			return err
+		}
+	}
+
+	for i := range p.StackQuantiles {
+		q := &p.StackQuantiles[i]
+		jq := jsonStackQuantiles{
+			Type:  "quantiles",
+			P50:   q.P50,
+			P90:   q.P90,
+			P99:   q.P99,
+			Stack: p.jsonStack(q.Stack()),
+		}
+		if err := enc.Encode(jq); err != nil {
+			return err
+		}
+	}
+
+	for _, u := range p.Pools() {
+		jp := jsonPool{
+			Type:    "pool",
+			Site:    jsonFrame{Function: u.Site.Function, File: u.Site.File, Line: u.Site.Line},
+			Misses:  u.Misses,
+			Objects: u.Objects,
+			Bytes:   u.Bytes,
+			Churn:   u.Churn(),
+		}
+		if err := enc.Encode(jp); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Owners) > 0 {
+		for _, o := range p.Ownership(p.Owners) {
+			jo := jsonOwner{Type: "owner", Owner: o.Owner, Objects: o.Objects, Bytes: o.Bytes, Stacks: o.Stacks}
+			if err := enc.Encode(jo); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonStack symbolizes stk, expanding inlined calls into their own frames.
+func (p *Profile) jsonStack(stk []uintptr) []jsonFrame {
+	var frames []jsonFrame
+	for _, pc := range stk {
+		if p.frames != nil {
+			for _, fr := range p.frames[pc] {
+				frames = append(frames, jsonFrame{
+					PC:       fmt.Sprintf("%#x", pc),
+					Function: fr.Function,
+					File:     fr.File,
+					Line:     fr.Line,
+				})
+			}
+			continue
+		}
+
+		fs := runtime.CallersFrames([]uintptr{pc})
+		for {
+			f, more := fs.Next()
+			frames = append(frames, jsonFrame{
+				PC:       fmt.Sprintf("%#x", pc),
+				Function: f.Function,
+				File:     f.File,
+				Line:     f.Line,
+			})
+			if !more {
+				break
+			}
+		}
+	}
+	return frames
+}
@@ -0,0 +1,61 @@
+package garbage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestProfileJSON(t *testing.T) {
+	p := testProfile()
+	p.Cycles = []Cycle{
+		{NumGC: 7, Time: p.Start.Add(time.Second), Objects: 1, Bytes: 1 << 20},
+		{NumGC: 8, Time: p.Start.Add(2 * time.Second), Objects: 2, Bytes: 2 << 20},
+	}
+
+	var buf bytes.Buffer
+	if err := p.writeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", sc.Text(), err)
+		}
+		types = append(types, line["type"].(string))
+
+		switch line["type"] {
+		case "profile":
+			if line["bytes"].(float64) != 3<<20 || line["cycles"].(float64) != 2 {
+				t.Errorf("bad profile line: %s", sc.Text())
+			}
+		case "record":
+			stack := line["stack"].([]interface{})
+			top := stack[0].(map[string]interface{})
+			if top["function"] != "github.com/benburkert/pprof-garbage.testProfile" {
+				t.Errorf("want testProfile at top of stack, got %v", top["function"])
+			}
+		}
+	}
+
+	if want := []string{"profile", "cycle", "cycle", "record"}; !equalStrings(types, want) {
+		t.Errorf("want lines %v, got %v", want, types)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
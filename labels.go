@@ -0,0 +1,67 @@
+package garbage
+
+import "sort"
+
+// reservedLabel reports whether key is the key of a sample label the profile
+// writes itself.
+func reservedLabel(key string) bool {
+	return key == "stack" || key == "reclaim"
+}
+
+// labelKeys returns the keys of the static labels of the profile, sorted, but
+// the reserved keys.
+func (p *Profile) labelKeys() []string {
+	var keys []string
+	for k := range p.Labels {
+		if !reservedLabel(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setLabels sets the static labels of the profile and its intervals, if any
+// are set.
+func (p *Profile) setLabels(labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	p.Labels = labels
+	for _, q := range p.Intervals {
+		q.setLabels(labels)
+	}
+}
+
+// sampleLabels returns the string labels of a sample, but those the profile
+// writes itself.
+func sampleLabels(labels [][2]int64, str func(int64) string) map[string]string {
+	m := make(map[string]string, len(labels))
+	for _, l := range labels {
+		if k := str(l[0]); k != "" && !reservedLabel(k) {
+			m[k] = str(l[1])
+		}
+	}
+	return m
+}
+
+// commonLabels returns the labels of common also in labels, or a copy of
+// labels if first is set.
+func commonLabels(common, labels map[string]string, first bool) map[string]string {
+	if first {
+		if len(labels) == 0 {
+			return nil
+		}
+		common = make(map[string]string, len(labels))
+		for k, v := range labels {
+			common[k] = v
+		}
+		return common
+	}
+	for k, v := range common {
+		if labels[k] != v {
+			delete(common, k)
+		}
+	}
+	return common
+}
@@ -0,0 +1,38 @@
+package garbage
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	p := goldenProfile()
+	p.Labels = map[string]string{"region": "us-east-1", "shard": "7", "reclaim": "weak"}
+
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	q, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"region": "us-east-1", "shard": "7"}
+	if !reflect.DeepEqual(q.Labels, want) {
+		t.Errorf("want labels %v, got %v", want, q.Labels)
+	}
+
+	r := goldenProfile()
+	r.Labels = map[string]string{"region": "us-east-1", "shard": "8"}
+	m, err := Merge(MergeOptions{}, q, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"region": "us-east-1"}; !reflect.DeepEqual(m.Labels, want) {
+		t.Errorf("want merged labels %v, got %v", want, m.Labels)
+	}
+	if len(q.Labels) != 2 {
+		t.Errorf("merge changed the labels of a profile: %v", q.Labels)
+	}
+}
@@ -0,0 +1,60 @@
+package garbage
+
+import (
+	"regexp"
+	"sort"
+)
+
+// A Match is a record of a profile whose stack calls a function matched by
+// Lookup.
+type Match struct {
+	Record
+
+	// Frames is the record's stack, symbolized as the profile's stacks are,
+	// innermost first with inlined calls expanded.
+	Frames []Frame
+
+	// Share is the fraction of the profile's garbage bytes produced by the
+	// record.
+	Share float64
+}
+
+// Lookup returns the records of the profile whose stacks call a function
+// whose name matches re, the most garbage bytes first, so that tools can ask
+// what allocates the garbage of particular code without walking the profile
+// themselves.
+func (p *Profile) Lookup(re *regexp.Regexp) []Match {
+	var total int64
+	for _, r := range p.Records {
+		total += r.Bytes
+	}
+
+	var matches []Match
+	for _, r := range p.Records {
+		var frames []Frame
+		for _, pc := range r.Stack() {
+			frames = append(frames, p.Frames(pc)...)
+		}
+		if !matchFrames(re, frames) {
+			continue
+		}
+		m := Match{Record: r, Frames: frames}
+		if total > 0 {
+			m.Share = float64(r.Bytes) / float64(total)
+		}
+		matches = append(matches, m)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Bytes > matches[j].Bytes })
+	return matches
+}
+
+// matchFrames reports whether the function of any of frames matches re.
+func matchFrames(re *regexp.Regexp, frames []Frame) bool {
+	for _, fr := range frames {
+		if re.MatchString(fr.Function) {
+			return true
+		}
+	}
+	return false
+}
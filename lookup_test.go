@@ -0,0 +1,38 @@
+package garbage
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	p := goldenProfile()
+	p.frames = map[uintptr][]Frame{
+		0x1010: {{Function: "main.decode", File: "/src/main.go", Line: 12}},
+		0x2020: {{Function: "main.main", File: "/src/main.go", Line: 30}},
+		0x3030: {
+			{Function: "strings.Repeat", File: "/go/src/strings/strings.go", Line: 541},
+			{Function: "main.pad", File: "/src/main.go", Line: 18},
+		},
+	}
+
+	matches := p.Lookup(regexp.MustCompile(`^main\.pad$`))
+	if len(matches) != 1 {
+		t.Fatalf("want 1 match, got %+v", matches)
+	}
+	m := matches[0]
+	if m.Bytes != 4096 || len(m.Frames) != 3 || m.Frames[1].Function != "main.pad" {
+		t.Errorf("unexpected match %+v", m)
+	}
+	if want := 4096.0 / (3<<20 + 4096); m.Share != want {
+		t.Errorf("want share %v, got %v", want, m.Share)
+	}
+
+	matches = p.Lookup(regexp.MustCompile(`^main\.main$`))
+	if len(matches) != 2 || matches[0].Bytes < matches[1].Bytes {
+		t.Errorf("want 2 matches, most bytes first, got %+v", matches)
+	}
+	if len(p.Lookup(regexp.MustCompile(`^bytes\.`))) != 0 {
+		t.Error("want no matches")
+	}
+}
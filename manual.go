@@ -0,0 +1,180 @@
+package garbage
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// manualPeriod is the GC period of the subscription of a manual collection,
+// whose window has no length known in advance to measure it over. The
+// collector polls for cycles at a tenth of it.
+const manualPeriod = 10 * time.Second
+
+// PhaseLabel is the label naming the phase of the profile of each phase of a
+// ManualCollector.
+const PhaseLabel = "phase"
+
+// A ManualCollector collects a profile over a window its caller opens with
+// Begin and closes with End, to bound the collection around a phase of the
+// program, such as a stage of a batch job or a cache rebuild, rather than a
+// fixed wall-clock window:
+//
+//	mc := garbage.Begin()
+//	rebuildCache()
+//	prof := mc.End()
+//
+// A pipeline can mark its named phases as the session goes, for a profile of
+// each phase alongside that of the whole session:
+//
+//	mc := garbage.Begin()
+//	mc.Mark("decode")
+//	decode()
+//	mc.Mark("transform")
+//	transform()
+//	prof := mc.End()
+//
+// The window opens at once, with no calibration of the GC period.
+type ManualCollector struct {
+	opts  Options
+	kind  string
+	start time.Time
+	stats *RuntimeStats
+	sub   *subscription // nil if the profiler is not compiled in
+
+	mu         sync.Mutex
+	phase      string
+	phaseStart time.Time
+	phaseSub   *subscription // nil until the first Mark
+	phases     []*Profile
+	profile    *Profile // set once ended
+}
+
+// Begin opens the window of a manual collection of a garbage profile with the
+// default options.
+func Begin() *ManualCollector {
+	return NewCollector(Options{}).Begin()
+}
+
+// Begin opens the window of a manual collection with the collector's options.
+// The Duration and Intervals of the options are ignored, and an invalid Kind
+// collects a garbage profile.
+func (c *Collector) Begin() *ManualCollector {
+	mc := &ManualCollector{opts: c.opts, kind: c.opts.Kind}
+	if mc.kind != growthKind {
+		mc.kind = garbageKind
+	}
+	if !enabled {
+		mc.start = time.Now()
+		return mc
+	}
+
+	mc.sub = mc.subscribe()
+	mc.stats = readRuntimeStats()
+	mc.start = time.Now()
+	return mc
+}
+
+// subscribe subscribes to the collector with the options of the collection.
+func (mc *ManualCollector) subscribe() *subscription {
+	sub := shared.subscribe(manualPeriod, false)
+	if mc.opts.AggregationBudget != (AggregationBudget{}) {
+		shared.limitAggregation(sub, mc.opts.AggregationBudget)
+	}
+	if mc.opts.AdaptiveStride > 1 {
+		shared.adapt(sub, mc.opts.AdaptiveStride)
+	}
+	if mc.opts.StackDepth > 0 {
+		shared.trimTo(sub, mc.opts.StackDepth)
+	}
+	if mc.opts.MaxStacks > 0 {
+		shared.spillTo(sub, mc.opts.MaxStacks, mc.opts.SpillDir)
+	}
+	return sub
+}
+
+// Mark closes the current phase of the window, if any, and opens the phase
+// name. The garbage before the first Mark is in the profile of the whole
+// window only. Mark does nothing once the window is closed.
+func (mc *ManualCollector) Mark(name string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if mc.profile != nil || mc.sub == nil {
+		return
+	}
+	if mc.phaseSub == nil {
+		mc.phaseSub = mc.subscribe()
+	} else {
+		mc.endPhase(shared.cut(mc.phaseSub, mc.kind))
+	}
+	mc.phase, mc.phaseStart = name, time.Now()
+}
+
+// endPhase completes the profile p of the current phase.
+func (mc *ManualCollector) endPhase(p *Profile) {
+	p.Start = mc.phaseStart
+	p.Duration = time.Since(mc.phaseStart)
+	p.Rate = runtime.MemProfileRate
+	p.TraceID = mc.opts.TraceID
+	p.Bursts = p.findBursts()
+	p.StackQuantiles = p.findStackQuantiles()
+	p.Overshoots = p.findOvershoots()
+	p.Owners = mc.opts.Owners
+
+	p.Labels = map[string]string{PhaseLabel: mc.phase}
+	for k, v := range mc.opts.Labels {
+		if k != PhaseLabel {
+			p.Labels[k] = v
+		}
+	}
+	mc.phases = append(mc.phases, p)
+}
+
+// End closes the window and returns the profile of the collection, with the
+// profile of each phase marked in its Intervals, oldest first, labeled with
+// the phase's name under PhaseLabel. If the options set WaitGC and the window
+// observed no GC cycle, End first waits up to WaitGC for one. Later calls
+// return the same profile.
+func (mc *ManualCollector) End() *Profile {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if mc.profile != nil {
+		return mc.profile
+	}
+	if mc.sub == nil {
+		mc.profile = &Profile{Start: mc.start, Rate: runtime.MemProfileRate, Kind: mc.kind, TraceID: mc.opts.TraceID}
+		return mc.profile
+	}
+
+	if mc.opts.WaitGC > 0 {
+		shared.waitCycle(mc.sub, mc.opts.WaitGC, nil)
+	}
+	shared.unsubscribe(mc.sub)
+	if mc.phaseSub != nil {
+		shared.unsubscribe(mc.phaseSub)
+		mc.endPhase(mc.phaseSub.profile(mc.kind))
+	}
+
+	memstats := new(runtime.MemStats)
+	runtime.ReadMemStats(memstats)
+
+	p := mc.sub.profile(mc.kind)
+	p.Start = mc.start
+	p.Duration = time.Since(mc.start)
+	p.Rate = runtime.MemProfileRate
+	p.TraceID = mc.opts.TraceID
+	p.MemStats = memstats
+	p.StartStats, p.EndStats = mc.stats, readRuntimeStats()
+	p.Bursts = p.findBursts()
+	p.StackQuantiles = p.findStackQuantiles()
+	p.Overshoots = p.findOvershoots()
+	p.setLabels(mc.opts.Labels)
+	p.Owners = mc.opts.Owners
+
+	p.Intervals = mc.phases
+	scrubProfile(p, mc.opts.Redact, mc.opts.Anonymize)
+	mc.profile = p
+	return p
+}
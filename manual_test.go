@@ -0,0 +1,108 @@
+package garbage
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var manualSink []byte
+
+func TestManualCollector(t *testing.T) {
+	requireEnabled(t)
+
+	mc := NewCollector(Options{Labels: map[string]string{"phase": "rebuild"}}).Begin()
+	for i := 0; i < 1000; i++ {
+		manualSink = make([]byte, 4096)
+	}
+	runtime.GC()
+	Flush()
+	time.Sleep(time.Millisecond)
+	p := mc.End()
+
+	if p.Kind != garbageKind || len(p.Cycles) == 0 {
+		t.Errorf("want a garbage profile of the cycles in the window, got kind %q and %d cycles", p.Kind, len(p.Cycles))
+	}
+	if p.Duration <= 0 || p.Start.IsZero() {
+		t.Errorf("want the window from Begin to End, got %v at %v", p.Duration, p.Start)
+	}
+	if p.Labels["phase"] != "rebuild" {
+		t.Errorf("want the labels of the options, got %v", p.Labels)
+	}
+	if q := mc.End(); q != p {
+		t.Errorf("want End to return the same profile again")
+	}
+	shared.mu.Lock()
+	_, ok := shared.subs[mc.sub]
+	shared.mu.Unlock()
+	if ok {
+		t.Errorf("subscription still registered after End")
+	}
+}
+
+func TestManualCollectorPhases(t *testing.T) {
+	requireEnabled(t)
+
+	mc := NewCollector(Options{Labels: map[string]string{"job": "etl"}}).Begin()
+	for _, phase := range []string{"decode", "transform"} {
+		mc.Mark(phase)
+		for i := 0; i < 1000; i++ {
+			manualSink = make([]byte, 4096)
+		}
+		runtime.GC()
+		Flush()
+	}
+	p := mc.End()
+	mc.Mark("late")
+
+	if len(p.Intervals) != 2 {
+		t.Fatalf("want a profile per phase, got %d", len(p.Intervals))
+	}
+	var cycles int
+	for i, phase := range []string{"decode", "transform"} {
+		part := p.Intervals[i]
+		if part.Labels[PhaseLabel] != phase || part.Labels["job"] != "etl" {
+			t.Errorf("phase %d: want labels of %s, got %v", i, phase, part.Labels)
+		}
+		if part.Start.Before(p.Start) || part.Start.Add(part.Duration).After(p.Start.Add(p.Duration)) {
+			t.Errorf("phase %s outside the window", phase)
+		}
+		cycles += len(part.Cycles)
+	}
+	if len(p.Cycles) < cycles || cycles == 0 {
+		t.Errorf("want the window to cover the cycles of the phases, got %d of %d", len(p.Cycles), cycles)
+	}
+	if _, ok := p.Labels[PhaseLabel]; ok {
+		t.Errorf("want no phase label on the whole window, got %v", p.Labels)
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteBundle(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta bundleMetadata
+	for _, f := range zr.File {
+		if f.Name != "metadata.json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(rc).Decode(&meta)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(meta.Intervals) != 2 || meta.Intervals[0].Phase != "decode" || meta.Intervals[1].Phase != "transform" {
+		t.Errorf("want the phases in the bundle metadata, got %+v", meta.Intervals)
+	}
+}
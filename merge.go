@@ -0,0 +1,249 @@
+package garbage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MergeOptions configure Merge.
+type MergeOptions struct {
+	// Weights, if set, multiplies the garbage of each profile by its
+	// weight, in the order of the profiles.
+	Weights []float64
+
+	// ByDuration weights each profile by the seconds of its window, so
+	// that each contributes its rate rather than its total: the merged
+	// profile is the mean of the profiles' garbage per second (see
+	// Profile.PerSecond), weighted by Weights if set. Otherwise a 300s
+	// capture outweighs a 30s one tenfold.
+	ByDuration bool
+
+	// Align clips the profiles to their common interval, from the latest
+	// start to the earliest end of their windows, so the merged profile
+	// covers a coherent range of time across instances whose windows were
+	// scraped at different moments. The garbage of each profile is scaled
+	// by the share of its window in the common interval, as if it were
+	// spread evenly over the window, and only the GC cycles within the
+	// interval are kept. Profiles whose windows do not overlap are an
+	// error.
+	Align bool
+}
+
+// A Window is the collection window of one of the profiles merged into a
+// profile.
+type Window struct {
+	Start, End time.Time
+}
+
+// mergedComment prefixes the window of each profile merged, as start/end in
+// RFC 3339 format.
+const mergedComment = "merged: "
+
+// Merge combines profiles of the same kind, such as captures of the replicas
+// of a service, into one. The garbage of each stack is summed across the
+// profiles, scaled to estimate all allocations; the GC cycles are combined,
+// oldest first, and the window spans the profiles'. Only the labels every
+// profile has are kept; pprof's own merge keeps those of each sample, to slice
+// the merged profile by them. The retention suspects, survival estimates,
+// bursts, overshoots and quantiles of stacks are not merged. The window of
+// each profile is recorded in Windows.
+//
+// Stacks are matched by their symbolized frames, as by Subtract, so the
+// profiles of instances of a binary loaded at different addresses line up.
+func Merge(opts MergeOptions, profiles ...*Profile) (*Profile, error) {
+	if len(profiles) == 0 {
+		return nil, errors.New("garbage: no profiles to merge")
+	}
+	if opts.Weights != nil && len(opts.Weights) != len(profiles) {
+		return nil, fmt.Errorf("garbage: %d weights for %d profiles", len(opts.Weights), len(profiles))
+	}
+
+	first := profiles[0]
+	m := &Profile{
+		Kind:   first.Kind,
+		Start:  first.Start,
+		Rate:   first.Rate,
+		scaled: true,
+	}
+	end := first.Start.Add(first.Duration)
+
+	var common Window
+	if opts.Align {
+		var err error
+		if common, err = commonWindow(profiles); err != nil {
+			return nil, err
+		}
+		m.Start, end = common.Start, common.End
+	}
+
+	// The stacks of symbolized profiles are remapped to addresses of the
+	// merged profile, where the same address may be symbolized differently.
+	symbolized := false
+	for _, p := range profiles {
+		symbolized = symbolized || p.frames != nil
+	}
+
+	var total float64
+	index := make(map[[32]uintptr]int)
+	stacks := make(map[string][32]uintptr) // merged stacks by stackKey
+	for i, p := range profiles {
+		if p.kind() != first.kind() {
+			return nil, fmt.Errorf("garbage: cannot merge %s and %s profiles", first.kind(), p.kind())
+		}
+
+		if p.perSecond != first.perSecond && !opts.ByDuration {
+			return nil, errors.New("garbage: cannot merge totals with rates; weigh by duration")
+		}
+
+		w := 1.0
+		if opts.Weights != nil {
+			w = opts.Weights[i]
+		}
+		total += w
+		if opts.ByDuration && !p.perSecond {
+			if p.Duration <= 0 {
+				return nil, fmt.Errorf("garbage: profile %d has no window to weigh", i)
+			}
+			w /= p.Duration.Seconds()
+		}
+
+		if opts.Align && !opts.ByDuration && !p.perSecond {
+			// The share of the profile's garbage in the common interval.
+			w *= float64(common.End.Sub(common.Start)) / float64(p.Duration)
+		}
+
+		m.Windows = append(m.Windows, Window{p.Start, p.Start.Add(p.Duration)})
+		if !opts.Align {
+			if p.Start.Before(m.Start) {
+				m.Start = p.Start
+			}
+			if e := p.Start.Add(p.Duration); e.After(end) {
+				end = e
+			}
+		}
+		m.Truncated = m.Truncated || p.Truncated
+		m.Degraded = m.Degraded || p.Degraded
+		m.Labels = commonLabels(m.Labels, p.Labels, i == 0)
+		m.perSecond = p.perSecond
+
+		for _, r := range p.Records {
+			key := p.stackKey(r.Stack())
+			stk, ok := stacks[key]
+			if !ok {
+				stk = r.Stack0
+				if symbolized {
+					stk = m.remap(p, stk)
+				}
+				stacks[key] = stk
+			}
+			r = p.weigh(r, w)
+			r.Stack0 = stk
+			m.Records = mergeIndexed(m.Records, index, r)
+		}
+		for _, c := range p.Cycles {
+			if !opts.Align || c.Time.After(common.Start) && !c.Time.After(common.End) {
+				m.Cycles = append(m.Cycles, c)
+			}
+		}
+	}
+
+	if opts.ByDuration {
+		// The weighted mean of the rates.
+		if total <= 0 {
+			return nil, errors.New("garbage: weights sum to zero")
+		}
+		for i := range m.Records {
+			m.Records[i] = m.weigh(m.Records[i], 1/total)
+		}
+		m.perSecond = true
+	}
+	m.Duration = end.Sub(m.Start)
+	sort.SliceStable(m.Cycles, func(i, j int) bool { return m.Cycles[i].Time.Before(m.Cycles[j].Time) })
+	return m, nil
+}
+
+// remap returns stk of p with each address symbolized differently by m moved
+// to the next address free in m, or symbolized alike, and adds the frames of
+// the addresses to the symbols of m.
+func (m *Profile) remap(p *Profile, stk [32]uintptr) [32]uintptr {
+	if m.frames == nil {
+		m.frames = make(map[uintptr][]Frame)
+	}
+	for i, pc := range stk {
+		if pc == 0 {
+			break
+		}
+		frames := p.Frames(pc)
+		for {
+			have, ok := m.frames[pc]
+			if !ok {
+				m.frames[pc] = frames
+				break
+			}
+			if sameFrames(have, frames) {
+				break
+			}
+			pc++
+		}
+		stk[i] = pc
+	}
+	return stk
+}
+
+// sameFrames reports whether a and b are the same frames.
+func sameFrames(a, b []Frame) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// commonWindow returns the interval common to the windows of the profiles.
+func commonWindow(profiles []*Profile) (Window, error) {
+	var w Window
+	for i, p := range profiles {
+		if p.Start.IsZero() || p.Duration <= 0 {
+			return Window{}, fmt.Errorf("garbage: profile %d has no window to align", i)
+		}
+		if end := p.Start.Add(p.Duration); i == 0 || end.Before(w.End) {
+			w.End = end
+		}
+		if i == 0 || p.Start.After(w.Start) {
+			w.Start = p.Start
+		}
+	}
+	if !w.End.After(w.Start) {
+		return Window{}, errors.New("garbage: profile windows do not overlap")
+	}
+	return w, nil
+}
+
+// mergedMarker returns the comment recording the window of a merged profile.
+func (w Window) mergedMarker() string {
+	return mergedComment + w.Start.UTC().Format(time.RFC3339Nano) + "/" + w.End.UTC().Format(time.RFC3339Nano)
+}
+
+// parseMerged parses the window from a comment, if it is a merged marker.
+func parseMerged(comment string) (Window, bool) {
+	if !strings.HasPrefix(comment, mergedComment) {
+		return Window{}, false
+	}
+	i := strings.IndexByte(comment, '/')
+	if i < 0 {
+		return Window{}, false
+	}
+	start, err1 := time.Parse(time.RFC3339Nano, comment[len(mergedComment):i])
+	end, err2 := time.Parse(time.RFC3339Nano, comment[i+1:])
+	if err1 != nil || err2 != nil {
+		return Window{}, false
+	}
+	return Window{start, end}, true
+}
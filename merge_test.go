@@ -0,0 +1,116 @@
+package garbage
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	short := &Profile{Start: start, Duration: 30 * time.Second, Rate: 1, Records: []Record{testRecord(1, 300, 30000)}}
+	long := &Profile{Start: start, Duration: 300 * time.Second, Rate: 1, Records: []Record{testRecord(1, 3000, 300000), testRecord(2, 600, 60000)}}
+
+	m, err := Merge(MergeOptions{}, short, long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Records) != 2 || m.Records[0].Objects != 3300 || m.Duration != 300*time.Second {
+		t.Errorf("want the totals summed, got %+v over %v", m.Records, m.Duration)
+	}
+
+	m, err = Merge(MergeOptions{ByDuration: true}, short, long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.perSecond || m.Records[0].Objects != 10 || m.Records[1].Objects != 1 {
+		t.Errorf("want the mean rates, got %+v", m.Records)
+	}
+
+	m, err = Merge(MergeOptions{ByDuration: true, Weights: []float64{3, 1}}, short, long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Records[0].Objects != 10 || m.Records[1].Bytes != 50 {
+		t.Errorf("want the weighted mean rates, got %+v", m.Records)
+	}
+
+	if _, err := Merge(MergeOptions{Weights: []float64{1}}, short, long); err == nil {
+		t.Error("want an error for too few weights")
+	}
+	if _, err := Merge(MergeOptions{}, short, long.PerSecond()); err == nil {
+		t.Error("want an error merging totals with rates")
+	}
+	if _, err := Merge(MergeOptions{}, short, &Profile{Kind: growthKind}); err == nil {
+		t.Error("want an error merging different kinds")
+	}
+}
+
+func TestMergeAlign(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	a := &Profile{Start: start, Duration: 30 * time.Second, Rate: 1, Records: []Record{testRecord(1, 300, 30000)},
+		Cycles: []Cycle{{NumGC: 1, Time: start.Add(5 * time.Second)}, {NumGC: 2, Time: start.Add(25 * time.Second)}}}
+	b := &Profile{Start: start.Add(10 * time.Second), Duration: 30 * time.Second, Rate: 1, Records: []Record{testRecord(1, 600, 60000)},
+		Cycles: []Cycle{{NumGC: 9, Time: start.Add(20 * time.Second)}, {NumGC: 10, Time: start.Add(35 * time.Second)}}}
+
+	m, err := Merge(MergeOptions{Align: true}, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Start.Equal(b.Start) || m.Duration != 20*time.Second {
+		t.Errorf("want the common interval from %v for 20s, got from %v for %v", b.Start, m.Start, m.Duration)
+	}
+	// Two thirds of each window is common.
+	if len(m.Records) != 1 || m.Records[0].Objects != 600 {
+		t.Errorf("want 600 objects in the common interval, got %+v", m.Records)
+	}
+	if len(m.Cycles) != 2 || m.Cycles[0].NumGC != 9 || m.Cycles[1].NumGC != 2 {
+		t.Errorf("want the cycles within the common interval, got %+v", m.Cycles)
+	}
+	if len(m.Windows) != 2 || !m.Windows[1].End.Equal(start.Add(40*time.Second)) {
+		t.Errorf("want the window of each profile, got %+v", m.Windows)
+	}
+
+	// The windows survive the protocol buffer.
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Windows) != 2 || !p.Windows[0].Start.Equal(start) {
+		t.Errorf("want the windows parsed back, got %+v", p.Windows)
+	}
+
+	c := &Profile{Start: start.Add(time.Hour), Duration: time.Minute, Rate: 1}
+	if _, err := Merge(MergeOptions{Align: true}, a, c); err == nil {
+		t.Error("want an error aligning disjoint windows")
+	}
+}
+
+func TestMergeRelocated(t *testing.T) {
+	f := []Frame{{Function: "main.f", File: "main.go", Line: 10}}
+	g := []Frame{{Function: "main.g", File: "main.go", Line: 20}}
+
+	// The instances load the binary at different addresses, so main.f is
+	// at 0x1000 in a and 0x2000 in b, where 0x1000 is main.g.
+	a := &Profile{Rate: 1, Records: []Record{testRecord(0x1000, 1, 100)},
+		frames: map[uintptr][]Frame{0x1000: f}}
+	b := &Profile{Rate: 1, Records: []Record{testRecord(0x2000, 2, 200), testRecord(0x1000, 4, 400)},
+		frames: map[uintptr][]Frame{0x2000: f, 0x1000: g}}
+
+	m, err := Merge(MergeOptions{}, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int64)
+	for _, r := range m.Records {
+		got[m.Frames(r.Stack0[0])[0].Function] += r.Objects
+	}
+	if want := map[string]int64{"main.f": 3, "main.g": 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v objects by function, got %v", want, got)
+	}
+}
@@ -0,0 +1,238 @@
+package garbage
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMonitor is the Monitor served by the /metrics endpoint of a Handler
+// with no Monitor of its own.
+var DefaultMonitor = new(Monitor)
+
+const (
+	defaultMonitorSize     = 120
+	defaultMonitorInterval = time.Second
+)
+
+// A Monitor is a continuous collector: it observes GC cycles for as long as
+// it runs, keeping the garbage of the most recent cycles in a ring buffer for
+// rolling rates and top allocation sites. Unlike a Collector it never
+// produces a profile of its own, so it keeps no more than Size cycles of
+// garbage however long it runs.
+//
+// The garbage a Monitor keeps is scaled to estimate all allocations, rather
+// than those sampled at runtime.MemProfileRate.
+type Monitor struct {
+	// Size is the number of recent GC cycles kept. Zero means 120.
+	Size int
+
+	// Interval is how often to check for a completed GC cycle. Cycles that
+	// complete within one interval are observed as one. Zero means one
+	// second.
+	Interval time.Duration
+
+	// Stride, if greater than one, reads the memory profile only every
+	// Stride GC cycles, for hot services where a read per cycle costs too
+	// much. The memory profile is cumulative, so the garbage of the cycles
+	// between reads is attributed at the next and the totals are exact;
+	// each cycle kept spans Stride GC cycles or more, and ages are counted
+	// in reads rather than cycles. While a profile or other monitor needs
+	// every cycle, the memory profile is read every cycle regardless.
+	Stride int
+
+	ctl sync.Mutex // serializes Start and Stop
+	sub *subscription
+
+	mu      sync.Mutex
+	cycles  []monitorCycle // oldest first
+	since   time.Time      // start of the window the cycles cover
+	sinceGC uint32         // runtime.MemStats.NumGC at since
+
+	now func() time.Time // for testing
+}
+
+// monitorCycle is a GC cycle kept by a Monitor, with the garbage of each
+// allocation stack in the cycle.
+type monitorCycle struct {
+	Cycle
+	garbage []Record
+}
+
+// Start starts the monitor if it is not already running. The garbage of any
+// previous run is discarded.
+func (m *Monitor) Start() {
+	if !enabled {
+		return
+	}
+
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	if m.sub != nil {
+		return
+	}
+
+	memstats := new(runtime.MemStats)
+	runtime.ReadMemStats(memstats)
+
+	m.mu.Lock()
+	m.cycles = nil
+	m.since, m.sinceGC = m.time(), memstats.NumGC
+	m.mu.Unlock()
+
+	interval := m.Interval
+	if interval <= 0 {
+		interval = defaultMonitorInterval
+	}
+	// The collector polls at a tenth of the shortest subscription period.
+	m.sub = shared.watch(10*interval, m.Stride, func(d *CycleDelta) { m.observe(d.Cycle, d.Garbage) })
+	shared.onReset(m.sub, m.Reset)
+}
+
+// Stop stops the monitor. The cycles kept remain available until the next
+// Start.
+func (m *Monitor) Stop() {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	if m.sub == nil {
+		return
+	}
+	shared.unsubscribe(m.sub)
+	m.sub = nil
+}
+
+// Reset discards the cycles kept, starting the monitor's window afresh
+// without stopping it.
+func (m *Monitor) Reset() {
+	memstats := new(runtime.MemStats)
+	runtime.ReadMemStats(memstats)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cycles = nil
+	m.since, m.sinceGC = m.time(), memstats.NumGC
+}
+
+// Running reports whether the monitor is running.
+func (m *Monitor) Running() bool {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	return m.sub != nil
+}
+
+// observe adds the garbage of a GC cycle to the ring buffer, dropping the
+// oldest cycle if it is full.
+func (m *Monitor) observe(cycle Cycle, garbage []Record) {
+	rate := int64(runtime.MemProfileRate)
+
+	mc := monitorCycle{Cycle: cycle, garbage: make([]Record, len(garbage))}
+	for i, r := range garbage {
+		r.Objects, r.Bytes = scaleHeapSample(r.Objects, r.Bytes, rate)
+		mc.garbage[i] = r
+		mc.Objects += r.Objects
+		mc.Bytes += r.Bytes
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	size := m.Size
+	if size <= 0 {
+		size = defaultMonitorSize
+	}
+	m.cycles = append(m.cycles, mc)
+	if n := len(m.cycles) - size; n > 0 {
+		last := m.cycles[n-1]
+		m.since, m.sinceGC = last.Time, last.NumGC
+		m.cycles = append(m.cycles[:0], m.cycles[n:]...)
+	}
+}
+
+// Cycles returns the GC cycles kept, oldest first, with their estimated
+// garbage.
+func (m *Monitor) Cycles() []Cycle {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cycles := make([]Cycle, len(m.cycles))
+	for i, c := range m.cycles {
+		cycles[i] = c.Cycle
+	}
+	return cycles
+}
+
+// Top returns the n allocation stacks with the most estimated garbage bytes
+// over the cycles kept, the most first. If n <= 0, Top returns every stack.
+func (m *Monitor) Top(n int) []Record {
+	m.mu.Lock()
+	var recs []Record
+	index := make(map[[32]uintptr]int)
+	for _, c := range m.cycles {
+		for _, r := range c.garbage {
+			i, ok := index[r.Stack0]
+			if !ok {
+				index[r.Stack0] = len(recs)
+				recs = append(recs, r)
+				continue
+			}
+			recs[i].Objects += r.Objects
+			recs[i].Bytes += r.Bytes
+			recs[i].Cycles += r.Cycles
+			recs[i].Ages.add(r.Ages)
+			recs[i].Sizes.add(r.Sizes)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Bytes > recs[j].Bytes })
+	if n > 0 && len(recs) > n {
+		recs = recs[:n]
+	}
+	return recs
+}
+
+// snapshot returns a copy of the cycles kept and the start of the window
+// they cover.
+func (m *Monitor) snapshot() (time.Time, []monitorCycle) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.since, append([]monitorCycle(nil), m.cycles...)
+}
+
+// A monitorWindow summarizes the cycles kept by a Monitor.
+type monitorWindow struct {
+	since   time.Time // start of the window
+	numGC   uint32    // GCs completed in the window
+	objects int64     // estimated garbage objects
+	bytes   int64     // estimated garbage bytes
+	pause   time.Duration
+}
+
+func (m *Monitor) window() monitorWindow {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w := monitorWindow{since: m.since}
+	for _, c := range m.cycles {
+		w.objects += c.Objects
+		w.bytes += c.Bytes
+		w.pause += c.Pause
+	}
+	if n := len(m.cycles); n > 0 {
+		w.numGC = m.cycles[n-1].NumGC - m.sinceGC
+	}
+	return w
+}
+
+func (m *Monitor) time() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
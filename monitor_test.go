@@ -0,0 +1,75 @@
+package garbage
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitorWindow(t *testing.T) {
+	start := time.Unix(1470000000, 0)
+	now := start.Add(10 * time.Second)
+	m := &Monitor{Size: 2, now: func() time.Time { return now }}
+	m.since = start
+
+	var stk [32]uintptr
+	runtime.Callers(1, stk[:])
+
+	// Objects far larger than the sampling rate are not scaled.
+	for i := 1; i <= 3; i++ {
+		m.observe(Cycle{NumGC: uint32(2 * i), Time: start.Add(time.Duration(2*i) * time.Second)},
+			[]Record{{Objects: 1, Bytes: 1 << 30, Cycles: 1, Stack0: stk}})
+	}
+
+	cycles := m.Cycles()
+	if len(cycles) != 2 || cycles[0].NumGC != 4 || cycles[1].Bytes != 1<<30 {
+		t.Fatalf("want the last 2 cycles, got %+v", cycles)
+	}
+	if top := m.Top(5); len(top) != 1 || top[0].Bytes != 2<<30 || top[0].Cycles != 2 {
+		t.Errorf("want 1 stack with the garbage of 2 cycles, got %+v", top)
+	}
+
+	var buf bytes.Buffer
+	if err := m.writeMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	// The window opens at the dropped cycle, 8 seconds before now.
+	for _, want := range []string{
+		"garbage_window_seconds 8\n",
+		"garbage_bytes_per_second 2.68435456e+08\n",
+		"garbage_objects_per_second 0.25\n",
+		"garbage_gc_cycles_per_second 0.5\n",
+		`garbage_site_bytes_per_second{function="github.com/benburkert/pprof-garbage.TestMonitorWindow"} 2.68435456e+08` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in metrics:\n%s", want, out)
+		}
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("metrics do not end with # EOF:\n%s", out)
+	}
+}
+
+func TestMonitorStartStop(t *testing.T) {
+	requireEnabled(t)
+
+	m := &Monitor{Interval: 10 * time.Millisecond}
+	m.Start()
+	defer m.Stop()
+
+	for deadline := time.Now().Add(5 * time.Second); len(m.Cycles()) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("monitor observed no GC cycles")
+		}
+		runtime.GC()
+	}
+
+	m.Stop()
+	if m.Running() {
+		t.Error("monitor still running after Stop")
+	}
+}
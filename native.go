@@ -0,0 +1,91 @@
+package garbage
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// nativeComment prefixes the note on the memory the process gained outside
+// the Go heap over the window, written in the footer of the text format when
+// there is any, since no garbage profile explains it.
+const nativeComment = "native: "
+
+// NativeGrowth is the growth of the memory of a process outside the Go heap
+// over a collection window. The garbage profile accounts only for the Go
+// heap, so growth in the resident set that is not Go memory, such as C
+// allocations made through cgo, is not garbage the profile can explain.
+type NativeGrowth struct {
+	// NonGo is the growth of the resident set not mapped by the Go runtime,
+	// if the resident set size is known: memory allocated by C code,
+	// mapped files and the like.
+	NonGo int64
+
+	// Runtime is the growth of the memory the Go runtime mapped for other
+	// than the heap: goroutine stacks, its metadata and the like.
+	Runtime int64
+
+	// CgoCalls is the number of calls from Go to C made over the window.
+	CgoCalls int64
+
+	// RSSKnown is set if the resident set size of the process was read.
+	RSSKnown bool
+}
+
+// Native returns the growth of the memory of the process outside the Go heap
+// over the window, or false if the profile has no runtime statistics.
+func (p *Profile) Native() (NativeGrowth, bool) {
+	start, end := p.StartStats, p.EndStats
+	if start == nil || end == nil || end.Sys == 0 {
+		return NativeGrowth{}, false
+	}
+	g := NativeGrowth{
+		Runtime:  int64(end.Sys-end.HeapSys) - int64(start.Sys-start.HeapSys),
+		CgoCalls: int64(end.CgoCalls - start.CgoCalls),
+		RSSKnown: start.RSS > 0 && end.RSS > 0,
+	}
+	if g.RSSKnown {
+		g.NonGo = (int64(end.RSS) - int64(start.RSS)) - (int64(end.Sys) - int64(start.Sys))
+	}
+	return g, true
+}
+
+// nativeNote returns the note on the native growth of the profile, or "" if
+// the process gained no memory outside the Go heap and made no cgo calls.
+func (p *Profile) nativeNote() string {
+	g, ok := p.Native()
+	if !ok || (g.NonGo <= 0 && g.Runtime <= 0 && g.CgoCalls == 0) {
+		return ""
+	}
+	var parts []string
+	if g.RSSKnown {
+		parts = append(parts, fmt.Sprintf("non-Go %+d bytes", g.NonGo))
+	}
+	parts = append(parts,
+		fmt.Sprintf("Go runtime outside the heap %+d bytes", g.Runtime),
+		fmt.Sprintf("%d cgo calls", g.CgoCalls))
+	return nativeComment + strings.Join(parts, ", ")
+}
+
+// residentSize returns the resident set size of the process, or 0 if it is
+// unknown.
+func residentSize() uint64 {
+	if runtime.GOOS != "linux" {
+		return 0
+	}
+	b, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * uint64(os.Getpagesize())
+}
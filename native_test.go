@@ -0,0 +1,45 @@
+package garbage
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNative(t *testing.T) {
+	p := goldenProfile()
+	p.StartStats = &RuntimeStats{Sys: 64 << 20, HeapSys: 48 << 20, RSS: 60 << 20, CgoCalls: 10}
+	p.EndStats = &RuntimeStats{Sys: 66 << 20, HeapSys: 49 << 20, RSS: 100 << 20, CgoCalls: 52}
+
+	g, ok := p.Native()
+	if !ok {
+		t.Fatal("want native growth")
+	}
+	want := NativeGrowth{NonGo: 38 << 20, Runtime: 1 << 20, CgoCalls: 42, RSSKnown: true}
+	if g != want {
+		t.Errorf("want %+v, got %+v", want, g)
+	}
+
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	note := "# native: non-Go +39845888 bytes, Go runtime outside the heap +1048576 bytes, 42 cgo calls\n"
+	if !strings.Contains(string(text), note) {
+		t.Errorf("missing %q:\n%s", note, text)
+	}
+
+	p.EndStats = &RuntimeStats{Sys: 64 << 20, HeapSys: 48 << 20, RSS: 60 << 20, CgoCalls: 10}
+	if note := p.nativeNote(); note != "" {
+		t.Errorf("want no note without growth, got %q", note)
+	}
+}
+
+func TestResidentSize(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resident set size read only on Linux")
+	}
+	if rss := residentSize(); rss == 0 {
+		t.Error("want resident set size, got 0")
+	}
+}
@@ -0,0 +1,66 @@
+package garbage
+
+import "math"
+
+const perSecondComment = "normalized: values are per second of the window"
+
+// PerSecond returns a copy of the profile with the garbage of each stack
+// divided by the seconds of the window, so profiles of different windows,
+// or from fleets of different sizes once merged, compare directly. The values
+// are estimates of all allocations, rather than those sampled, rounded to the
+// nearest whole object and byte; the ages of each stack are divided alike.
+// The GC cycles and the other sections are kept as they are.
+//
+// A profile with no window is returned as it is.
+func (p *Profile) PerSecond() *Profile {
+	if p.Duration <= 0 || p.perSecond {
+		return p
+	}
+	sec := p.Duration.Seconds()
+
+	q := *p
+	q.Records = make([]Record, len(p.Records))
+	for i, r := range p.Records {
+		q.Records[i] = p.weigh(r, 1/sec)
+	}
+	q.Intervals = nil
+	for _, part := range p.Intervals {
+		q.Intervals = append(q.Intervals, part.PerSecond())
+	}
+	q.scaled, q.perSecond = true, true
+	return &q
+}
+
+// weigh returns r of the profile scaled to estimate all allocations, if its
+// values are sampled, and multiplied by w, rounded to whole objects and bytes.
+// Its ages and sizes are scaled alike.
+func (p *Profile) weigh(r Record, w float64) Record {
+	objects, bytes := r.Objects, r.Bytes
+	if !p.scaled {
+		objects, bytes = scaleHeapSample(r.Objects, r.Bytes, int64(p.Rate))
+	}
+	var f float64
+	if r.Objects > 0 {
+		f = float64(objects) / float64(r.Objects) * w
+	}
+	r.Objects = round(float64(objects) * w)
+	r.Bytes = round(float64(bytes) * w)
+	r.Ages = Ages{
+		SameCycle: round(float64(r.Ages.SameCycle) * f),
+		OneCycle:  round(float64(r.Ages.OneCycle) * f),
+		FewCycles: round(float64(r.Ages.FewCycles) * f),
+		Longer:    round(float64(r.Ages.Longer) * f),
+	}
+	r.Sizes = Sizes{
+		Tiny:   round(float64(r.Sizes.Tiny) * f),
+		Small:  round(float64(r.Sizes.Small) * f),
+		Medium: round(float64(r.Sizes.Medium) * f),
+		Large:  round(float64(r.Sizes.Large) * f),
+		Huge:   round(float64(r.Sizes.Huge) * f),
+	}
+	return r
+}
+
+func round(v float64) int64 {
+	return int64(math.Round(v))
+}
@@ -0,0 +1,46 @@
+package garbage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPerSecond(t *testing.T) {
+	r := Record{Objects: 600, Bytes: 60000, Ages: Ages{SameCycle: 300, Longer: 300}}
+	r.Stack0[0] = 1
+	p := &Profile{Duration: 10 * time.Second, Rate: 1, Records: []Record{r}}
+
+	q := p.PerSecond()
+	if p.Records[0].Bytes != 60000 {
+		t.Fatal("PerSecond modified the profile")
+	}
+	got := q.Records[0]
+	if got.Objects != 60 || got.Bytes != 6000 || got.Ages.SameCycle != 30 || got.Ages.Longer != 30 {
+		t.Errorf("want 60 objects and 6000 bytes per second, got %+v", got)
+	}
+	if q.PerSecond() != q {
+		t.Error("PerSecond normalized twice")
+	}
+
+	text, err := q.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), perSecondComment) {
+		t.Errorf("normalization missing from text:\n%s", text)
+	}
+	parsed, err := ParseText(strings.NewReader(string(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.perSecond || !parsed.scaled {
+		t.Error("normalization lost by ParseText")
+	}
+
+	// Sampled values are scaled to estimate all allocations first.
+	p.Rate = 512 * 1024
+	if q := p.PerSecond(); q.Records[0].Bytes <= 6000 {
+		t.Errorf("want sampled bytes scaled up, got %d per second", q.Records[0].Bytes)
+	}
+}
@@ -0,0 +1,139 @@
+package garbage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metricsTopSites is the number of allocation sites exposed by ServeMetrics.
+const metricsTopSites = 10
+
+// ServeMetrics serves the monitor's rolling garbage rate, GC frequency and top
+// allocation sites in the OpenMetrics text format, for scrapers that are not
+// full Prometheus clients. The rates are over the window of cycles kept.
+// Serving the metrics starts the monitor if it is not running.
+func (m *Monitor) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	if !enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	m.Start()
+
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	m.writeMetrics(w)
+}
+
+// writeMetrics writes the metrics served by ServeMetrics.
+func (m *Monitor) writeMetrics(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	win := m.window()
+	seconds := m.time().Sub(win.since).Seconds()
+	perSecond := func(v float64) float64 {
+		if seconds <= 0 {
+			return 0
+		}
+		return v / seconds
+	}
+
+	gauge(bw, "garbage_window_seconds", "Length of the window the rates are over.", seconds)
+	gauge(bw, "garbage_bytes_per_second", "Estimated bytes of garbage per second.", perSecond(float64(win.bytes)))
+	gauge(bw, "garbage_objects_per_second", "Estimated garbage objects per second.", perSecond(float64(win.objects)))
+	gauge(bw, "garbage_gc_cycles_per_second", "GC cycles completed per second.", perSecond(float64(win.numGC)))
+	gauge(bw, "garbage_gc_pause_seconds_per_second", "Stop-the-world GC pause per second.", perSecond(win.pause.Seconds()))
+
+	fmt.Fprintf(bw, "# TYPE garbage_site_bytes_per_second gauge\n")
+	fmt.Fprintf(bw, "# HELP garbage_site_bytes_per_second Estimated bytes of garbage per second by top allocation site.\n")
+	_, cycles := m.snapshot()
+	for _, s := range topSites(cycles, metricsTopSites) {
+		fmt.Fprintf(bw, "garbage_site_bytes_per_second{function=\"%s\"} %s\n",
+			escapeLabel(s.function), formatFloat(perSecond(float64(s.bytes))))
+	}
+
+	fmt.Fprintf(bw, "# EOF\n")
+	return bw.Flush()
+}
+
+// A siteGarbage is the garbage of the allocation stacks sharing a function.
+type siteGarbage struct {
+	function string
+	bytes    int64
+}
+
+// topSites returns the n functions with the most garbage bytes over cycles.
+// The function of a stack is its first frame outside the runtime, so that
+// allocations by make and new are attributed to their callers.
+func topSites(cycles []monitorCycle, n int) []siteGarbage {
+	functions := make(map[[32]uintptr]string)
+	total := make(map[string]int64)
+	for _, c := range cycles {
+		for fn, bytes := range c.sites(functions) {
+			total[fn] += bytes
+		}
+	}
+
+	sites := make([]siteGarbage, 0, len(total))
+	for fn, bytes := range total {
+		sites = append(sites, siteGarbage{function: fn, bytes: bytes})
+	}
+	sort.Slice(sites, func(i, j int) bool {
+		if sites[i].bytes != sites[j].bytes {
+			return sites[i].bytes > sites[j].bytes
+		}
+		return sites[i].function < sites[j].function
+	})
+	if len(sites) > n {
+		sites = sites[:n]
+	}
+	return sites
+}
+
+// sites returns the garbage bytes of each function in c, looking up the
+// function of each stack in functions and adding those not yet there.
+func (c monitorCycle) sites(functions map[[32]uintptr]string) map[string]int64 {
+	bytes := make(map[string]int64)
+	for _, r := range c.garbage {
+		fn, ok := functions[r.Stack0]
+		if !ok {
+			fn = siteFunction(r.Stack())
+			functions[r.Stack0] = fn
+		}
+		bytes[fn] += r.Bytes
+	}
+	return bytes
+}
+
+// siteFunction returns the function of the first frame of stk outside the
+// runtime, or the address of the first frame if it cannot be symbolized.
+func siteFunction(stk []uintptr) string {
+	for _, pc := range stk {
+		for _, fr := range symbolize(pc) {
+			if !strings.HasPrefix(fr.Function, "runtime.") {
+				return fr.Function
+			}
+		}
+	}
+	if len(stk) > 0 {
+		return fmt.Sprintf("%#x", stk[0])
+	}
+	return "unknown"
+}
+
+func gauge(w io.Writer, name, help string, v float64) {
+	fmt.Fprintf(w, "# TYPE %s gauge\n# HELP %s %s\n%s %s\n", name, name, help, name, formatFloat(v))
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value of the OpenMetrics text format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,195 @@
+package garbage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"runtime"
+	"time"
+)
+
+// Options configure a Collector.
+type Options struct {
+	// Duration is the collection window. A collection runs twice as long:
+	// the first half measures the GC period for the window.
+	Duration time.Duration
+
+	// Kind is the kind of profile to collect: "garbage" (or empty) for the
+	// allocations that became garbage, or "growth" for the net growth in
+	// memory in use.
+	Kind string
+
+	// TraceID, if set, is the W3C trace ID recorded in the profile (see
+	// Profile.TraceID).
+	TraceID string
+
+	// Anonymize strips the file paths and host name from the profile (see
+	// Profile.Anonymize) and the recording.
+	Anonymize bool
+
+	// Intervals, if above one, partitions the window into that many equal
+	// sub-intervals and collects a profile of each as well, in
+	// Profile.Intervals, to show how the garbage shifted over the window.
+	Intervals int
+
+	// IsolateBursts cuts the sub-intervals of the window short at the start
+	// and end of each burst of garbage, a GC cycle whose garbage rate is
+	// anomalous as for a Detector, so the stacks of a burst are isolated in
+	// an interval of their own rather than diluted across the capture.
+	// Without Intervals, it cuts the window alone into Profile.Intervals.
+	// It applies only to garbage profiles.
+	IsolateBursts bool
+
+	// MaxOverhead, if positive, is the largest share of the process's CPU
+	// time and allocations the collector may use, such as 0.02. The
+	// collector's use is measured by the wall time and allocations of its
+	// work on each cycle, upper bounds of its own. Over the limit, the
+	// collection is aborted: Collect returns the truncated profile along
+	// with an *OverheadError.
+	MaxOverhead float64
+
+	// DegradeOnOverhead continues a collection over MaxOverhead degraded
+	// instead, as under memory pressure (see Profile.Degraded).
+	DegradeOnOverhead bool
+
+	// AggregationBudget, if set, limits the CPU the collector spends
+	// attributing the garbage of each GC cycle to its stacks, by yielding
+	// between chunks of stacks, so a collection on a giant heap does not
+	// monopolize a core. The strictest budget of the collections running
+	// applies.
+	AggregationBudget AggregationBudget
+
+	// AdaptiveStride, if above one, adapts how often the collection reads
+	// the memory profile to the garbage rate, for continuous collection on
+	// hot services: every GC cycle while the rate is anomalous against its
+	// moving baseline, as for a Detector, and up to every AdaptiveStride
+	// cycles while it is quiet. The garbage of the cycles between reads is
+	// attributed at the next read, but that of the cycles after the last
+	// read of the window is not. The mean stride is recorded in
+	// Profile.Stride.
+	AdaptiveStride int
+
+	// StackDepth, if positive, trims each allocation stack to its
+	// innermost StackDepth frames as the garbage is aggregated, merging the
+	// stacks that become identical. On services with deep middleware
+	// stacks this trades attribution depth for far smaller profiles that
+	// render faster.
+	StackDepth int
+
+	// WaitGC, if positive, extends a window that closes before any GC
+	// cycle was observed by up to WaitGC, until the first cycle, so a
+	// process that collects rarely still yields a profile with garbage.
+	WaitGC time.Duration
+
+	// MaxStacks, if positive, is the most allocation stacks whose garbage
+	// the collection holds in memory. Past it, the garbage aggregated so
+	// far is spilled to a temporary file in SpillDir (os.TempDir if empty)
+	// as a run sorted by stack, and the runs are merged when the profile is
+	// emitted, so long windows on services with huge numbers of stacks stay
+	// within a memory budget. The records of a spilled profile are sorted
+	// by stack.
+	MaxStacks int
+	SpillDir  string
+
+	// Labels are the static labels of the profile (see Profile.Labels).
+	Labels map[string]string
+
+	// Owners map the allocation sites of the profile to their owners
+	// (see Profile.Owners).
+	Owners []OwnerRule
+
+	// Redact lists patterns of the function names and files of the frames
+	// to replace with a placeholder (see Profile.Redact).
+	Redact []*regexp.Regexp
+}
+
+// A Collector collects profiles with fixed options. It is safe for concurrent
+// use, and the collections of every Collector in the process share a single
+// GC observer, as the endpoint's do.
+type Collector struct {
+	opts Options
+}
+
+// NewCollector returns a Collector with the given options.
+func NewCollector(opts Options) *Collector {
+	return &Collector{opts: opts}
+}
+
+// Collect collects a profile over the collection window. If ctx is done
+// before the window closes, Collect returns the truncated profile of the
+// garbage collected so far, along with ctx.Err().
+func (c *Collector) Collect(ctx context.Context) (*Profile, error) {
+	j, err := c.run(ctx, false)
+	if j == nil {
+		return nil, err
+	}
+	return j.profile, err
+}
+
+// Record collects a Recording over the collection window, which can be
+// replayed as a profile of any options later. If ctx is done before the window
+// closes, Record returns the truncated recording, along with ctx.Err().
+func (c *Collector) Record(ctx context.Context) (*Recording, error) {
+	j, err := c.run(ctx, true)
+	if j == nil {
+		return nil, err
+	}
+	return j.recording, err
+}
+
+// run runs a collection, stopping it early if ctx is done. It returns a nil
+// job if the options are invalid.
+func (c *Collector) run(ctx context.Context, record bool) (*job, error) {
+	kind := c.opts.Kind
+	switch kind {
+	case "":
+		kind = garbageKind
+	case garbageKind, growthKind:
+	default:
+		return nil, fmt.Errorf("garbage: unknown profile kind %q", kind)
+	}
+
+	if !enabled {
+		j := &job{
+			profile:   &Profile{Start: time.Now(), Rate: runtime.MemProfileRate, Kind: kind, TraceID: c.opts.TraceID},
+			recording: &Recording{Start: time.Now(), Rate: runtime.MemProfileRate},
+		}
+		return j, nil
+	}
+
+	j := startJob(c.opts.Duration)
+	j.kind, j.record = kind, record
+	j.traceID = c.opts.TraceID
+	j.intervals, j.isolate = c.opts.Intervals, c.opts.IsolateBursts
+	j.maxOverhead, j.degrade = c.opts.MaxOverhead, c.opts.DegradeOnOverhead
+	j.budget = c.opts.AggregationBudget
+	j.adaptive = c.opts.AdaptiveStride
+	j.depth = c.opts.StackDepth
+	j.waitGC = c.opts.WaitGC
+	j.maxStacks, j.spillDir = c.opts.MaxStacks, c.opts.SpillDir
+
+	if done := ctx.Done(); done != nil {
+		finished := make(chan struct{})
+		defer close(finished)
+
+		go func() {
+			select {
+			case <-done:
+				j.stop()
+			case <-finished:
+			}
+		}()
+	}
+
+	j.collect()
+	j.scrub(c.opts.Redact, c.opts.Anonymize)
+	j.profile.setLabels(c.opts.Labels)
+	j.profile.Owners = c.opts.Owners
+	if err := j.abortErr(); err != nil {
+		return j, err
+	}
+	if j.profile.Truncated {
+		return j, ctx.Err()
+	}
+	return j, nil
+}
@@ -0,0 +1,44 @@
+package garbage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCollectorContext(t *testing.T) {
+	requireEnabled(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	p, err := NewCollector(Options{Duration: time.Hour, Kind: growthKind}).Collect(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("collection did not stop with its context: took %v", elapsed)
+	}
+	if p == nil || !p.Truncated || p.Kind != growthKind {
+		t.Errorf("want truncated growth profile, got %+v", p)
+	}
+}
+
+func TestCollectorKind(t *testing.T) {
+	p, err := NewCollector(Options{Kind: "heap"}).Collect(context.Background())
+	if err == nil || p != nil {
+		t.Errorf("want error for unknown kind, got %v, %v", p, err)
+	}
+}
+
+func TestProfileFrames(t *testing.T) {
+	p := goldenProfile()
+	frames := p.Frames(0x3030)
+	if len(frames) != 2 || frames[0].Function != "strings.Repeat" || frames[1].Function != "main.pad" {
+		t.Errorf("want inlined frames of 0x3030, got %+v", frames)
+	}
+	if frames := p.Frames(0x9999); len(frames) != 0 {
+		t.Errorf("want no frames for unknown pc, got %+v", frames)
+	}
+}
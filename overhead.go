@@ -0,0 +1,148 @@
+package garbage
+
+import (
+	"fmt"
+	"runtime/metrics"
+	"time"
+)
+
+const (
+	// overheadMinCPU and overheadMinAllocs are the CPU time and allocations
+	// of the process over which the collector's share of each is measured
+	// before it is trusted.
+	overheadMinCPU    = 100 * time.Millisecond
+	overheadMinAllocs = 16 << 20
+)
+
+// usage is the resources used by the collector and by the process since the
+// collector started. The collector's CPU time is the wall time of its work on
+// each cycle, and its allocations those of the process during that work: both
+// are upper bounds.
+type usage struct {
+	work, cpu          time.Duration
+	workAllocs, allocs uint64
+}
+
+// readProcUsage reads the CPU time used by the process and the bytes it has
+// allocated, as estimated by the runtime.
+func readProcUsage() (time.Duration, uint64) {
+	samples := []metrics.Sample{
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+		{Name: "/gc/heap/allocs:bytes"},
+	}
+	metrics.Read(samples)
+
+	var cpu time.Duration
+	if total, idle := samples[0].Value, samples[1].Value; total.Kind() == metrics.KindFloat64 && idle.Kind() == metrics.KindFloat64 {
+		cpu = secondsDuration(total.Float64() - idle.Float64())
+	}
+	var allocs uint64
+	if v := samples[2].Value; v.Kind() == metrics.KindUint64 {
+		allocs = v.Uint64()
+	}
+	return cpu, allocs
+}
+
+// An OverheadError reports a collection aborted because the collector's share
+// of the process's CPU time or allocations exceeded the limit set by
+// Options.MaxOverhead.
+type OverheadError struct {
+	Resource string  // "CPU time" or "allocations"
+	Fraction float64 // the collector's share of the resource
+	Limit    float64
+}
+
+func (e *OverheadError) Error() string {
+	return fmt.Sprintf("garbage: collection aborted: the collector used %.1f%% of the process's %s, above the limit of %.1f%%",
+		100*e.Fraction, e.Resource, 100*e.Limit)
+}
+
+// exceeds returns the error for the first resource whose share used by the
+// collector since base exceeds limit, or nil.
+func (u usage) exceeds(base usage, limit float64) *OverheadError {
+	if cpu := u.cpu - base.cpu; cpu >= overheadMinCPU {
+		if f := float64(u.work-base.work) / float64(cpu); f > limit {
+			return &OverheadError{"CPU time", f, limit}
+		}
+	}
+	if allocs := u.allocs - base.allocs; allocs >= overheadMinAllocs {
+		if f := float64(u.workAllocs-base.workAllocs) / float64(allocs); f > limit {
+			return &OverheadError{"allocations", f, limit}
+		}
+	}
+	return nil
+}
+
+// A workStart marks the start of the collector's work on a cycle.
+type workStart struct {
+	time   time.Time
+	allocs uint64
+}
+
+func startWork() workStart {
+	_, allocs := readProcUsage()
+	return workStart{time.Now(), allocs}
+}
+
+// endWork accounts the work since w to the collector and checks the overhead
+// limits of the subscriptions. A subscription over its limit is degraded, or
+// aborted once.
+func (c *collector) endWork(w workStart) {
+	work := time.Since(w.time)
+	cpu, allocs := readProcUsage()
+
+	var aborts []func()
+	defer func() {
+		for _, abort := range aborts {
+			abort()
+		}
+	}()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.usage.work += work
+	c.usage.workAllocs += allocs - w.allocs
+	c.usage.cpu, c.usage.allocs = cpu, allocs
+
+	for s := range c.subs {
+		if s.maxOverhead <= 0 || s.overloaded {
+			continue
+		}
+		err := c.usage.exceeds(s.base, s.maxOverhead)
+		switch {
+		case err == nil:
+		case s.abort == nil:
+			s.overloaded = true
+		default:
+			abort := s.abort
+			s.maxOverhead = 0
+			aborts = append(aborts, func() { abort(err) })
+		}
+	}
+}
+
+// guard limits the overhead of the collector while s is subscribed to limit
+// of the process's CPU time and allocations. Over the limit, the collector
+// is degraded if abort is nil, or abort is called.
+func (c *collector) guard(s *subscription, limit float64, abort func(error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.maxOverhead, s.abort, s.base = limit, abort, c.usage
+}
+
+// overloaded reports whether a subscription degraded the collector for its
+// overhead.
+func (c *collector) overloaded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for s := range c.subs {
+		if s.overloaded {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package garbage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOverheadExceeds(t *testing.T) {
+	base := usage{cpu: time.Second, allocs: 1 << 30}
+
+	u := base
+	u.cpu += 50 * time.Millisecond
+	u.work += 50 * time.Millisecond
+	if err := u.exceeds(base, 0.01); err != nil {
+		t.Errorf("want no verdict below %v of CPU, got %v", overheadMinCPU, err)
+	}
+
+	u.cpu += time.Second
+	if err := u.exceeds(base, 0.1); err != nil {
+		t.Errorf("want 5%% of CPU under a 10%% limit, got %v", err)
+	}
+	if err := u.exceeds(base, 0.01); err == nil || err.Resource != "CPU time" {
+		t.Errorf("want 5%% of CPU over a 1%% limit, got %v", err)
+	}
+
+	u = base
+	u.allocs += 100 << 20
+	u.workAllocs += 10 << 20
+	if err := u.exceeds(base, 0.05); err == nil || err.Resource != "allocations" || err.Fraction != 0.1 {
+		t.Errorf("want 10%% of allocations over a 5%% limit, got %v", err)
+	}
+}
+
+func TestCollectOverheadAbort(t *testing.T) {
+	requireEnabled(t)
+
+	if testing.Short() {
+		t.Skip("collects for two seconds")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				heapSink = make([]byte, 4096)
+			}
+		}
+	}()
+
+	p, err := NewCollector(Options{Duration: time.Second, MaxOverhead: 1e-9}).Collect(context.Background())
+	if _, ok := err.(*OverheadError); !ok {
+		t.Fatalf("want an *OverheadError, got %v", err)
+	}
+	if p == nil || !p.Truncated {
+		t.Error("want the truncated profile")
+	}
+}
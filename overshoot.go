@@ -0,0 +1,95 @@
+package garbage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// overshootStacks is the number of stacks reported per overshoot.
+const overshootStacks = 3
+
+// An Overshoot is a GC cycle whose heap grew past the goal set by the cycle
+// before it, leaving the GC to catch up with assists and longer marking. The
+// runtime does not export the peak heap of a cycle, so it is estimated as
+// the heap the cycle marked live plus the garbage it found, scaled by the
+// sampling rate.
+type Overshoot struct {
+	NumGC uint32        // runtime.MemStats.NumGC after the cycle
+	Time  time.Time     // time the cycle was observed
+	Pause time.Duration // stop-the-world pause of the cycle
+	Goal  uint64        // heap size goal of the cycle
+	Heap  uint64        // estimated heap size at the end of the cycle
+
+	// Stacks are the allocation stacks with the most garbage in the cycle,
+	// the most first, those responsible for the growth of the heap. Their
+	// values are their garbage in the cycle, as sampled.
+	Stacks []Record
+}
+
+// Bytes returns the bytes by which the heap overshot its goal.
+func (o *Overshoot) Bytes() uint64 { return o.Heap - o.Goal }
+
+// findOvershoots finds the cycles of a collected profile whose heap overshot
+// its goal. The goal of a cycle is the HeapGoal of the cycle before it, so
+// the first cycle of the window, and those after a cycle without a goal, are
+// not judged.
+func (p *Profile) findOvershoots() []Overshoot {
+	cycles, tops := p.Cycles, p.tops
+	if p.kind() != garbageKind || len(tops) != len(cycles) {
+		return nil
+	}
+
+	var overshoots []Overshoot
+	for i := 1; i < len(cycles); i++ {
+		goal, c := cycles[i-1].HeapGoal, cycles[i]
+		if goal == 0 || c.HeapLive == 0 {
+			continue
+		}
+		bytes := c.Bytes
+		if !p.scaled {
+			_, bytes = scaleHeapSample(c.Objects, c.Bytes, int64(p.Rate))
+		}
+		heap := c.HeapLive + uint64(bytes)
+		if heap <= goal {
+			continue
+		}
+		o := Overshoot{NumGC: c.NumGC, Time: c.Time, Pause: c.Pause, Goal: goal, Heap: heap}
+		o.Stacks = topRecords(tops[i], overshootStacks)
+		overshoots = append(overshoots, o)
+	}
+	return overshoots
+}
+
+// overshootComment is the profile.proto comment annotating o.
+func (p *Profile) overshootComment(o *Overshoot) string {
+	var fns []string
+	for i := range o.Stacks {
+		fns = append(fns, p.site(o.Stacks[i].Stack()))
+	}
+	return fmt.Sprintf("overshoot: GC %d at +%v, heap %d bytes over its goal of %d: %s",
+		o.NumGC, o.Time.Sub(p.Start).Round(time.Millisecond), o.Bytes(), o.Goal,
+		strings.Join(fns, ", "))
+}
+
+// printOvershoots prints the cycles that overshot their heap goal and the
+// stacks with the most garbage in them.
+func (p *Profile) printOvershoots(w io.Writer) {
+	fmt.Fprintf(w, "\n# overshoots: cycles whose heap grew past its goal\n")
+	for i := range p.Overshoots {
+		o := &p.Overshoots[i]
+		fmt.Fprintf(w, "# GC %d at +%v: %d bytes over the goal of %d (%.1f%%), pause %v\n",
+			o.NumGC, o.Time.Sub(p.Start).Round(time.Millisecond), o.Bytes(), o.Goal,
+			100*float64(o.Bytes())/float64(o.Goal), o.Pause)
+		for j := range o.Stacks {
+			r := &o.Stacks[j]
+			fmt.Fprintf(w, "# %d: %d [%d: %d] @", r.Objects, r.Bytes, r.Objects, r.Bytes)
+			for _, pc := range r.Stack() {
+				fmt.Fprintf(w, " %#x", pc)
+			}
+			fmt.Fprintf(w, "\n")
+			p.printStack(w, r.Stack())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package garbage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindOvershoots(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	p := &Profile{Start: start, Duration: 4 * time.Second, Rate: 1}
+	for i := 0; i < 4; i++ {
+		top := []Record{testRecord(1, 62, 1000)}
+		if i == 2 {
+			top = append(top, testRecord(2, 500, 8000)) // the overshoot
+		}
+		c := Cycle{
+			NumGC:    uint32(i + 1),
+			Time:     start.Add(time.Duration(i+1) * time.Second),
+			HeapLive: 4000,
+			HeapGoal: 8000,
+		}
+		for _, r := range top {
+			c.Objects += r.Objects
+			c.Bytes += r.Bytes
+			p.Records = merge(p.Records, r)
+		}
+		p.Cycles = append(p.Cycles, c)
+		p.tops = append(p.tops, top)
+	}
+
+	overshoots := p.findOvershoots()
+	if len(overshoots) != 1 {
+		t.Fatalf("want 1 overshoot, got %+v", overshoots)
+	}
+	o := &overshoots[0]
+	if o.NumGC != 3 || o.Goal != 8000 || o.Heap != 13000 || o.Bytes() != 5000 {
+		t.Errorf("want GC 3 at 13000 bytes over a goal of 8000, got %+v", o)
+	}
+	if len(o.Stacks) != 2 || o.Stacks[0].Stack0[0] != 2 {
+		t.Errorf("want stack 2 responsible, got %+v", o.Stacks)
+	}
+
+	p.Overshoots = overshoots
+	var buf bytes.Buffer
+	if err := p.writeText(&buf, textOptions{debug: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "# GC 3 at +3s: 5000 bytes over the goal of 8000 (62.5%)") {
+		t.Errorf("overshoot missing from text:\n%s", buf.String())
+	}
+	if c := p.overshootComment(o); !strings.HasPrefix(c, "overshoot: GC 3 at +3s, heap 5000 bytes over its goal of 8000: ") {
+		t.Errorf("bad comment %q", c)
+	}
+
+	// The first cycle has no goal to overshoot.
+	p.Cycles[0].HeapLive = 1 << 20
+	p.Cycles[2].HeapLive = 0
+	if overshoots := p.findOvershoots(); len(overshoots) != 0 {
+		t.Errorf("want no overshoots, got %+v", overshoots)
+	}
+}
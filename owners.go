@@ -0,0 +1,179 @@
+package garbage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Unowned is the owner of the garbage of stacks no OwnerRule matches.
+const Unowned = "(unowned)"
+
+// An OwnerRule assigns allocation sites to a logical owner: a team, tenant or
+// subsystem. It matches the sites in the functions whose names begin with
+// Prefix, such as the package path "github.com/acme/billing/" or the method
+// "main.(*Server).handle", or if Glob is set, the sites in the source files
+// matching it, a pattern as in an ownership file (see ParseOwners).
+type OwnerRule struct {
+	Prefix string
+	Glob   string
+	Owner  string
+}
+
+// An Ownership is the garbage of the stacks attributed to an owner.
+type Ownership struct {
+	Owner   string
+	Objects int64 // number of garbage objects
+	Bytes   int64 // number of garbage bytes
+	Stacks  int   // number of allocation stacks
+}
+
+// Ownership rolls the garbage of the profile up by owner, the most garbage
+// bytes first, turning the stack profile into an accountability report. Each
+// stack is attributed to the owner of its innermost frame matched by a rule,
+// or to Unowned. If several rules match a frame, the last with a Glob wins,
+// as in a CODEOWNERS file, and otherwise the one with the longest Prefix.
+func (p *Profile) Ownership(rules []OwnerRule) []Ownership {
+	var owned []Ownership
+	index := make(map[string]int)
+	for _, r := range p.Records {
+		owner := p.owner(r.Stack(), rules)
+		i, ok := index[owner]
+		if !ok {
+			i = len(owned)
+			index[owner] = i
+			owned = append(owned, Ownership{Owner: owner})
+		}
+		owned[i].Objects += r.Objects
+		owned[i].Bytes += r.Bytes
+		owned[i].Stacks++
+	}
+
+	sort.SliceStable(owned, func(i, j int) bool { return owned[i].Bytes > owned[j].Bytes })
+	return owned
+}
+
+// owner returns the owner of stk under rules.
+func (p *Profile) owner(stk []uintptr, rules []OwnerRule) string {
+	for _, pc := range stk {
+		for _, fr := range p.Frames(pc) {
+			if owner, ok := frameOwner(fr, rules); ok {
+				return owner
+			}
+		}
+	}
+	return Unowned
+}
+
+// frameOwner returns the owner of fr under rules, if any rule matches it.
+func frameOwner(fr Frame, rules []OwnerRule) (string, bool) {
+	glob, prefix := -1, -1
+	for i, rule := range rules {
+		switch {
+		case rule.Glob != "":
+			if matchOwnerGlob(rule.Glob, fr.File) {
+				glob = i
+			}
+		case strings.HasPrefix(fr.Function, rule.Prefix):
+			if prefix < 0 || len(rule.Prefix) > len(rules[prefix].Prefix) {
+				prefix = i
+			}
+		}
+	}
+	switch {
+	case glob >= 0:
+		return rules[glob].Owner, true
+	case prefix >= 0:
+		return rules[prefix].Owner, true
+	}
+	return "", false
+}
+
+// ParseOwners parses an ownership file in the style of CODEOWNERS. Each line
+// holds a pattern of source files and the owner of the allocation sites in
+// them, separated by white space; blank lines and those starting with # are
+// ignored. Later lines take precedence over earlier ones. The first owner of
+// a line with several owns its files.
+//
+// A pattern is matched against the trailing elements of a file's path, as
+// by path.Match, so "*" does not cross a slash: "billing/*.go" matches the
+// Go files of any billing directory, and a pattern without a slash, such as
+// "*_gen.go", matches a file name in any directory. A pattern that matches a
+// directory, or ends in a slash, matches every file below it. A leading
+// slash is ignored, since the paths of a profile have no repository root.
+func ParseOwners(r io.Reader) ([]OwnerRule, error) {
+	var rules []OwnerRule
+	sc := bufio.NewScanner(r)
+	for lineno := 1; sc.Scan(); lineno++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("garbage: owners line %d: no owner for %q", lineno, fields[0])
+		}
+		if _, err := path.Match(fields[0], ""); err != nil {
+			return nil, fmt.Errorf("garbage: owners line %d: bad pattern %q", lineno, fields[0])
+		}
+		rules = append(rules, OwnerRule{Glob: fields[0], Owner: fields[1]})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// LoadOwners reads the ownership file name (see ParseOwners).
+func LoadOwners(name string) ([]OwnerRule, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseOwners(f)
+}
+
+// matchOwnerGlob reports whether the file matches the pattern of an ownership
+// file.
+func matchOwnerGlob(pattern, file string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	dir := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+
+	elems := strings.Split(strings.TrimPrefix(filepath.ToSlash(file), "/"), "/")
+	n := strings.Count(pattern, "/") + 1
+	for i := 0; i+n <= len(elems); i++ {
+		if ok, _ := path.Match(pattern, strings.Join(elems[i:i+n], "/")); ok {
+			// The file itself, or a directory above it.
+			return i+n < len(elems) || !dir
+		}
+	}
+	return false
+}
+
+// printOwnership prints the garbage of the profile by owner as a comment
+// section of the legacy text format.
+func (p *Profile) printOwnership(w io.Writer, owned []Ownership) {
+	var total int64
+	for _, o := range owned {
+		total += o.Bytes
+	}
+
+	fmt.Fprintf(w, "\n# owner: garbage objects: garbage bytes\n")
+	for _, o := range owned {
+		fmt.Fprintf(w, "# %d: %d", o.Objects, o.Bytes)
+		if total > 0 {
+			fmt.Fprintf(w, " (%.1f%%)", 100*float64(o.Bytes)/float64(total))
+		}
+		fmt.Fprintf(w, " in %d stacks @ %s\n", o.Stacks, o.Owner)
+	}
+}
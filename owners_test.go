@@ -0,0 +1,97 @@
+package garbage
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOwnership(t *testing.T) {
+	p := goldenProfile()
+	p.Owners = []OwnerRule{
+		{Prefix: "main.", Owner: "app"},
+		{Prefix: "main.decode", Owner: "codec"},
+	}
+
+	want := []Ownership{
+		{Owner: "codec", Objects: 3, Bytes: 3 << 20, Stacks: 1},
+		{Owner: "app", Objects: 1, Bytes: 4096, Stacks: 1},
+	}
+	if got := p.Ownership(p.Owners); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "# 3: 3145728 (99.9%) in 1 stacks @ codec\n") {
+		t.Errorf("missing ownership section:\n%s", text)
+	}
+
+	if got := p.Ownership([]OwnerRule{{Prefix: "net/http.", Owner: "web"}}); len(got) != 1 || got[0].Owner != Unowned {
+		t.Errorf("want all garbage unowned, got %+v", got)
+	}
+}
+
+func TestParseOwners(t *testing.T) {
+	const file = `# garbage owners
+*            @platform
+/src/        @app
+main.go      @entry
+
+*_test.go
+`
+	if _, err := ParseOwners(strings.NewReader(file)); err == nil {
+		t.Error("want error for a pattern without an owner")
+	}
+
+	rules, err := ParseOwners(strings.NewReader(strings.TrimSuffix(file, "*_test.go\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []OwnerRule{{Glob: "*", Owner: "@platform"}, {Glob: "/src/", Owner: "@app"}, {Glob: "main.go", Owner: "@entry"}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Fatalf("want %+v, got %+v", want, rules)
+	}
+
+	tests := []struct {
+		file, owner string
+	}{
+		{"/src/main.go", "@entry"},
+		{"/src/codec.go", "@app"},
+		{"/go/src/strings/strings.go", "@app"},
+		{"/usr/lib/go/strings.go", "@platform"},
+	}
+	for _, test := range tests {
+		if owner, _ := frameOwner(Frame{File: test.file}, rules); owner != test.owner {
+			t.Errorf("%s: want owner %s, got %s", test.file, test.owner, owner)
+		}
+	}
+}
+
+func TestOwnerNotifier(t *testing.T) {
+	var got []string
+	notifier := func(name string) Notifier {
+		return notifierFunc(func(ctx context.Context, a Alert) error {
+			got = append(got, name+":"+a.Owner)
+			return nil
+		})
+	}
+	n := &OwnerNotifier{
+		Owners:    []OwnerRule{{Prefix: "main.decode", Owner: "codec"}},
+		Notifiers: map[string]Notifier{"codec": notifier("codec")},
+		Default:   notifier("default"),
+	}
+
+	n.Notify(context.Background(), NewAlert("too much garbage", goldenProfile()))
+	n.Notify(context.Background(), NewAlert("no profile", nil))
+	if want := []string{"codec:codec", "default:" + Unowned}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want notified %q, got %q", want, got)
+	}
+}
+
+type notifierFunc func(context.Context, Alert) error
+
+func (f notifierFunc) Notify(ctx context.Context, a Alert) error { return f(ctx, a) }
@@ -0,0 +1,440 @@
+package garbage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultDuration is the collection window used when a request does not
+// specify one.
+const defaultDuration = 30 * time.Second
+
+// A DurationPolicy bounds the collection windows of the requests to a
+// Handler, or, set by SetDurationPolicy, of every collection in the process,
+// so the cost of profiling can be bounded fleet-wide.
+type DurationPolicy struct {
+	// Min and Max bound the window a request may ask for. Zero means no
+	// bound.
+	Min time.Duration
+	Max time.Duration
+
+	// Default is the window of requests that ask for none. Zero means 30
+	// seconds. It is clamped to the bounds.
+	Default time.Duration
+}
+
+// processDurations is the duration policy of every collection in the
+// process (see SetDurationPolicy).
+var processDurations struct {
+	sync.Mutex
+	DurationPolicy
+}
+
+// SetDurationPolicy bounds the collection window of every collection in the
+// process, whether started by a Handler, a Collector, Collect or
+// WriteGarbageProfile, so the cost of profiling is bounded whatever starts
+// it. A window out of bounds is clamped to them, and a collection that asks
+// for none, such as one of Options with no Duration, collects over the
+// Default of p, if set. The policy of a Handler is narrowed to fit within
+// p.
+func SetDurationPolicy(p DurationPolicy) {
+	processDurations.Lock()
+	defer processDurations.Unlock()
+	processDurations.DurationPolicy = p
+}
+
+// processPolicy returns the duration policy of the process.
+func processPolicy() DurationPolicy {
+	processDurations.Lock()
+	defer processDurations.Unlock()
+	return processDurations.DurationPolicy
+}
+
+// clamp returns window within the bounds of the policy, or its Default if
+// window is not positive and the policy has one.
+func (d DurationPolicy) clamp(window time.Duration) time.Duration {
+	if window <= 0 && d.Default > 0 {
+		window = d.Default
+	}
+	if d.Min > 0 && window < d.Min {
+		window = d.Min
+	}
+	if d.Max > 0 && window > d.Max {
+		window = d.Max
+	}
+	return window
+}
+
+// durations returns the duration policy of the handler, with its defaults
+// applied and narrowed to the policy of the process.
+func (h *Handler) durations() DurationPolicy {
+	d := h.Durations
+	if d.Min <= 0 {
+		d.Min = h.MinDuration
+	}
+	if d.Max <= 0 {
+		d.Max = h.MaxDuration
+	}
+	if pd := processPolicy(); pd.Min > 0 || pd.Max > 0 {
+		if pd.Min > d.Min {
+			d.Min = pd.Min
+		}
+		if pd.Max > 0 && (d.Max <= 0 || pd.Max < d.Max) {
+			d.Max = pd.Max
+		}
+		if d.Max > 0 && d.Min > d.Max {
+			d.Min = d.Max
+		}
+	}
+	if d.Default <= 0 {
+		d.Default = defaultDuration
+	}
+	if d.Min > 0 && d.Default < d.Min {
+		d.Default = d.Min
+	}
+	if d.Max > 0 && d.Default > d.Max {
+		d.Default = d.Max
+	}
+	return d
+}
+
+// defaultGCWait is the longest a request with the waitgc parameter waits for a
+// GC cycle, if the handler sets no MaxGCWait.
+const defaultGCWait = time.Minute
+
+// maxGCWait returns the longest a request waits for a GC cycle.
+func (h *Handler) maxGCWait() time.Duration {
+	if h.MaxGCWait > 0 {
+		return h.MaxGCWait
+	}
+	return defaultGCWait
+}
+
+// maxIntervals is the most sub-intervals a request can partition its window
+// into.
+const maxIntervals = 60
+
+// params are the parsed query parameters of a profile request.
+type params struct {
+	duration time.Duration
+	debug    int
+	format   string // "proto", "text", "json", "csv", "recording", "bundle" or "stream"
+	human    bool
+	compat   TextFormat
+	traceID  string
+	stream   time.Duration // interval of the profiles of a stream
+	anon     bool
+	rate     bool   // whether to normalize the profile to per-second rates
+	sample   string // default sample type, "objects", "bytes" or empty
+	baseline bool   // whether to subtract the handler's baseline
+
+	intervals int  // sub-intervals of the window profiled, for a bundle
+	isolate   bool // whether to cut the sub-intervals at the edges of bursts
+
+	waitGC bool // whether to wait past the window for a GC cycle
+}
+
+// A paramError reports an invalid query parameter. In strict mode it is
+// returned to the client as a JSON object with a 400 Bad Request status.
+type paramError struct {
+	Param  string `json:"param"`
+	Value  string `json:"value"`
+	Reason string `json:"error"`
+}
+
+func (e *paramError) Error() string {
+	return fmt.Sprintf("garbage: invalid %s %q: %s", e.Param, e.Value, e.Reason)
+}
+
+// params parses the query parameters of r. Invalid values are an error in
+// strict mode and replaced by defaults otherwise; out of range durations are
+// an error in strict mode and clamped otherwise.
+func (h *Handler) params(r *http.Request) (params, error) {
+	policy := h.durations()
+	p := params{duration: policy.Default}
+
+	param, v := "seconds", r.FormValue("seconds")
+	if d := r.FormValue("d"); d != "" {
+		if v != "" && h.Strict {
+			return p, &paramError{Param: "d", Value: d, Reason: "conflicts with seconds"}
+		}
+		param, v = "d", d
+	}
+
+	if v != "" {
+		d, err := parseDuration(param, v)
+		switch {
+		case err != nil:
+			if h.Strict {
+				return p, &paramError{Param: param, Value: v, Reason: err.Error()}
+			}
+		case d <= 0:
+			if h.Strict {
+				return p, &paramError{Param: param, Value: v, Reason: "must be positive"}
+			}
+		default:
+			p.duration = d
+		}
+	}
+
+	if policy.Min > 0 && p.duration < policy.Min {
+		if h.Strict {
+			return p, &paramError{Param: param, Value: v, Reason: fmt.Sprintf("below minimum of %s", policy.Min)}
+		}
+		p.duration = policy.Min
+	}
+	if policy.Max > 0 && p.duration > policy.Max {
+		if h.Strict {
+			return p, &paramError{Param: param, Value: v, Reason: fmt.Sprintf("above maximum of %s", policy.Max)}
+		}
+		p.duration = policy.Max
+	}
+
+	if v := r.FormValue("debug"); v == "json" {
+		p.format = "json"
+	} else if v != "" {
+		debug, err := strconv.Atoi(v)
+		switch {
+		case err != nil:
+			if h.Strict {
+				return p, &paramError{Param: "debug", Value: v, Reason: "not an integer"}
+			}
+		case debug < 0 || debug > 2:
+			if h.Strict {
+				return p, &paramError{Param: "debug", Value: v, Reason: "must be 0, 1, 2 or json"}
+			}
+			if debug > 2 {
+				p.debug = 2
+			}
+		default:
+			p.debug = debug
+		}
+	}
+
+	if v := r.FormValue("human"); v != "" {
+		human, err := strconv.ParseBool(v)
+		if err != nil && h.Strict {
+			return p, &paramError{Param: "human", Value: v, Reason: "not a boolean"}
+		}
+		p.human = human
+	}
+
+	p.compat = h.TextFormat
+	if v := r.FormValue("compat"); v != "" {
+		switch v {
+		case "v1":
+			p.compat = CompatV1
+		default:
+			if h.Strict {
+				return p, &paramError{Param: "compat", Value: v, Reason: "must be v1"}
+			}
+		}
+	}
+
+	if v := r.FormValue("record"); v != "" {
+		record, err := strconv.ParseBool(v)
+		if err != nil && h.Strict {
+			return p, &paramError{Param: "record", Value: v, Reason: "not a boolean"}
+		}
+		if record {
+			p.format = "recording"
+		}
+	}
+
+	if v := r.FormValue("format"); v != "" {
+		switch v {
+		case "csv", "multipart":
+			p.format = v
+		default:
+			if h.Strict {
+				return p, &paramError{Param: "format", Value: v, Reason: "must be csv or multipart"}
+			}
+		}
+	}
+
+	if v := r.FormValue("stream"); v != "" {
+		d, err := time.ParseDuration(v)
+		switch {
+		case err != nil:
+			if h.Strict {
+				return p, &paramError{Param: "stream", Value: v, Reason: "not a duration"}
+			}
+		case d <= 0:
+			if h.Strict {
+				return p, &paramError{Param: "stream", Value: v, Reason: "must be positive"}
+			}
+		default:
+			p.format = "stream"
+			p.stream = d
+			if p.stream > p.duration {
+				p.stream = p.duration
+			}
+		}
+	}
+
+	p.anon = h.Anonymize
+	if v := r.FormValue("anonymize"); v != "" {
+		anon, err := strconv.ParseBool(v)
+		if err != nil && h.Strict {
+			return p, &paramError{Param: "anonymize", Value: v, Reason: "not a boolean"}
+		}
+		p.anon = p.anon || anon
+	}
+
+	if v := r.FormValue("normalize"); v != "" {
+		switch v {
+		case "rate":
+			p.rate = true
+		default:
+			if h.Strict {
+				return p, &paramError{Param: "normalize", Value: v, Reason: "must be rate"}
+			}
+		}
+	}
+
+	p.sample = h.DefaultSample
+	if v := r.FormValue("sample"); v != "" {
+		switch {
+		case validSample(v):
+			p.sample = v
+		case h.Strict:
+			return p, &paramError{Param: "sample", Value: v, Reason: "must be objects or bytes"}
+		}
+	}
+
+	if v := r.FormValue("baseline"); v != "" {
+		baseline, err := strconv.ParseBool(v)
+		switch {
+		case err != nil:
+			if h.Strict {
+				return p, &paramError{Param: "baseline", Value: v, Reason: "not a boolean"}
+			}
+		case baseline && h.Baseline == "" && h.DeployBaseline == nil:
+			if h.Strict {
+				return p, &paramError{Param: "baseline", Value: v, Reason: "no baseline configured"}
+			}
+		default:
+			p.baseline = baseline
+		}
+	}
+
+	if v := r.FormValue("intervals"); v != "" {
+		n, err := strconv.Atoi(v)
+		switch {
+		case err != nil:
+			if h.Strict {
+				return p, &paramError{Param: "intervals", Value: v, Reason: "not an integer"}
+			}
+		case n < 1:
+			if h.Strict {
+				return p, &paramError{Param: "intervals", Value: v, Reason: "must be positive"}
+			}
+		case n > maxIntervals:
+			if h.Strict {
+				return p, &paramError{Param: "intervals", Value: v, Reason: fmt.Sprintf("above maximum of %d", maxIntervals)}
+			}
+			p.intervals = maxIntervals
+		default:
+			p.intervals = n
+		}
+		if p.intervals > 1 && p.format == "stream" {
+			if h.Strict {
+				return p, &paramError{Param: "intervals", Value: v, Reason: "conflicts with stream"}
+			}
+			p.intervals = 0
+		}
+		if p.intervals > 1 {
+			p.format = "bundle"
+		}
+	}
+
+	if v := r.FormValue("isolate_bursts"); v != "" {
+		isolate, err := strconv.ParseBool(v)
+		switch {
+		case err != nil:
+			if h.Strict {
+				return p, &paramError{Param: "isolate_bursts", Value: v, Reason: "not a boolean"}
+			}
+		case isolate && p.format == "stream":
+			if h.Strict {
+				return p, &paramError{Param: "isolate_bursts", Value: v, Reason: "conflicts with stream"}
+			}
+		default:
+			p.isolate = isolate
+		}
+		if p.isolate {
+			p.format = "bundle"
+		}
+	}
+
+	if v := r.FormValue("waitgc"); v != "" {
+		wait, err := strconv.ParseBool(v)
+		switch {
+		case err != nil:
+			if h.Strict {
+				return p, &paramError{Param: "waitgc", Value: v, Reason: "not a boolean"}
+			}
+		case wait && p.format == "stream":
+			if h.Strict {
+				return p, &paramError{Param: "waitgc", Value: v, Reason: "conflicts with stream"}
+			}
+		default:
+			p.waitGC = wait
+		}
+	}
+
+	p.traceID = requestTraceID(r)
+	if v := r.FormValue("trace_id"); v != "" {
+		switch {
+		case validTraceID(v):
+			p.traceID = v
+		case h.Strict:
+			return p, &paramError{Param: "trace_id", Value: v, Reason: "not a trace ID"}
+		}
+	}
+
+	if p.format == "" {
+		p.format = "proto"
+		if p.debug > 0 {
+			p.format = "text"
+		}
+	}
+
+	return p, nil
+}
+
+// parseDuration parses the collection window from the seconds parameter, a
+// possibly fractional number of seconds, or the d parameter, a duration string
+// such as "90s" or "1.5m".
+func parseDuration(param, v string) (time.Duration, error) {
+	if param == "d" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, errors.New("not a duration")
+		}
+		return d, nil
+	}
+
+	sec, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(sec) || math.IsInf(sec, 0) {
+		return 0, errors.New("not a number")
+	}
+	if sec > float64(math.MaxInt64/time.Second) {
+		return 0, errors.New("out of range")
+	}
+	return time.Duration(sec * float64(time.Second)), nil
+}
+
+// writeParamError responds to a request with invalid parameters.
+func writeParamError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(err)
+}
@@ -0,0 +1,182 @@
+package garbage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerParams(t *testing.T) {
+	lax := &Handler{MinDuration: 5 * time.Second, MaxDuration: time.Minute}
+	strict := &Handler{Strict: true, MinDuration: 5 * time.Second, MaxDuration: time.Minute}
+	policy := &Handler{Strict: true, Durations: DurationPolicy{Min: 5 * time.Second, Max: time.Minute, Default: 20 * time.Second}}
+	clamped := &Handler{Durations: DurationPolicy{Max: 10 * time.Second}}
+
+	tests := []struct {
+		handler  *Handler
+		query    string
+		duration time.Duration
+		debug    int
+		param    string
+	}{
+		{lax, "", defaultDuration, 0, ""},
+		{lax, "seconds=10&debug=1", 10 * time.Second, 1, ""},
+		{lax, "seconds=ten&debug=yes", defaultDuration, 0, ""},
+		{lax, "seconds=-1", defaultDuration, 0, ""},
+		{lax, "seconds=1", 5 * time.Second, 0, ""},
+		{lax, "seconds=3600", time.Minute, 0, ""},
+		{strict, "seconds=10&debug=1", 10 * time.Second, 1, ""},
+		{lax, "seconds=7.5", 7500 * time.Millisecond, 0, ""},
+		{lax, "d=45s", 45 * time.Second, 0, ""},
+		{lax, "d=0.75m&seconds=10", 45 * time.Second, 0, ""},
+		{lax, "d=soon", defaultDuration, 0, ""},
+		{strict, "seconds=0.5", 0, 0, "seconds"},
+		{strict, "d=0.75m", 45 * time.Second, 0, ""},
+		{strict, "d=0.75m&seconds=10", 0, 0, "d"},
+		{strict, "d=soon", 0, 0, "d"},
+		{strict, "d=-5s", 0, 0, "d"},
+		{strict, "seconds=NaN", 0, 0, "seconds"},
+		{strict, "seconds=1e30", 0, 0, "seconds"},
+		{strict, "seconds=ten", 0, 0, "seconds"},
+		{strict, "seconds=0", 0, 0, "seconds"},
+		{strict, "seconds=1", 0, 0, "seconds"},
+		{strict, "seconds=3600", 0, 0, "seconds"},
+		{strict, "debug=yes", 0, 0, "debug"},
+		{strict, "debug=-1", 0, 0, "debug"},
+		{lax, "debug=2", defaultDuration, 2, ""},
+		{lax, "debug=5", defaultDuration, 2, ""},
+		{strict, "debug=3", 0, 0, "debug"},
+		{strict, "human=maybe", 0, 0, "human"},
+		{strict, "record=maybe", 0, 0, "record"},
+		{strict, "compat=v0", 0, 0, "compat"},
+		{strict, "format=xml", 0, 0, "format"},
+		{strict, "trace_id=xyz", 0, 0, "trace_id"},
+		{strict, "stream=often", 0, 0, "stream"},
+		{strict, "stream=-1s", 0, 0, "stream"},
+		{strict, "normalize=bytes", 0, 0, "normalize"},
+		{strict, "sample=count", 0, 0, "sample"},
+		{strict, "baseline=1", 0, 0, "baseline"},
+		{strict, "intervals=0", 0, 0, "intervals"},
+		{strict, "intervals=100", 0, 0, "intervals"},
+		{strict, "intervals=4&stream=5s", 0, 0, "intervals"},
+		{strict, "isolate_bursts=x", 0, 0, "isolate_bursts"},
+		{strict, "isolate_bursts=1&stream=5s", 0, 0, "isolate_bursts"},
+		{strict, "waitgc=maybe", 0, 0, "waitgc"},
+		{strict, "waitgc=1&stream=5s", 0, 0, "waitgc"},
+		{policy, "", 20 * time.Second, 0, ""},
+		{policy, "seconds=1", 0, 0, "seconds"},
+		{policy, "d=2m", 0, 0, "d"},
+		{policy, "d=45s", 45 * time.Second, 0, ""},
+		{clamped, "", 10 * time.Second, 0, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/debug/pprof/garbage?"+test.query, nil)
+
+		p, err := test.handler.params(req)
+		if test.param != "" {
+			perr, ok := err.(*paramError)
+			if !ok || perr.Param != test.param {
+				t.Errorf("%q: want error for %s, got %v", test.query, test.param, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.query, err)
+			continue
+		}
+		if p.duration != test.duration || p.debug != test.debug {
+			t.Errorf("%q: want (%s, %d), got (%s, %d)", test.query, test.duration, test.debug, p.duration, p.debug)
+		}
+	}
+}
+
+func TestHandlerStrictResponse(t *testing.T) {
+	requireEnabled(t)
+
+	h := &Handler{Strict: true}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/garbage?seconds=forever", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("want code %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("want JSON content type, got %q", ct)
+	}
+
+	var body paramError
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if want := (paramError{Param: "seconds", Value: "forever", Reason: "not a number"}); body != want {
+		t.Errorf("want body %+v, got %+v", want, body)
+	}
+}
+
+func TestHandlerDurationPolicyResponse(t *testing.T) {
+	requireEnabled(t)
+
+	h := &Handler{Strict: true, Durations: DurationPolicy{Max: time.Minute}}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/garbage?d=1h", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("want code %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	var body paramError
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if want := (paramError{Param: "d", Value: "1h", Reason: "above maximum of 1m0s"}); body != want {
+		t.Errorf("want body %+v, got %+v", want, body)
+	}
+}
+
+func TestSetDurationPolicy(t *testing.T) {
+	SetDurationPolicy(DurationPolicy{Min: 50 * time.Millisecond, Max: 100 * time.Millisecond, Default: 80 * time.Millisecond})
+	defer SetDurationPolicy(DurationPolicy{})
+
+	for _, test := range []struct{ window, want time.Duration }{
+		{time.Hour, 100 * time.Millisecond},
+		{time.Millisecond, 50 * time.Millisecond},
+		{0, 80 * time.Millisecond},
+		{60 * time.Millisecond, 60 * time.Millisecond},
+	} {
+		j := startJob(test.window)
+		jobs.Lock()
+		delete(jobs.m, j.id)
+		jobs.Unlock()
+		if j.window != test.want {
+			t.Errorf("window %s: want %s, got %s", test.window, test.want, j.window)
+		}
+	}
+
+	// The policy of a handler is narrowed to that of the process.
+	h := &Handler{Strict: true, Durations: DurationPolicy{Max: time.Hour}}
+	if d := h.durations(); d.Min != 50*time.Millisecond || d.Max != 100*time.Millisecond {
+		t.Errorf("handler policy: want [50ms, 100ms], got [%s, %s]", d.Min, d.Max)
+	}
+
+	requireEnabled(t)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/garbage?d=1m", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("want code %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	start := time.Now()
+	p, err := NewCollector(Options{Duration: time.Hour}).Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Duration > time.Second || time.Since(start) > 10*time.Second {
+		t.Errorf("collection of an hour not clamped: window %s, took %s", p.Duration, time.Since(start))
+	}
+}
@@ -0,0 +1,274 @@
+package garbage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseText parses a profile in the legacy heap profile text format, as
+// written by MarshalText or by the endpoint with debug=1 or debug=2, so that
+// archived text profiles can be converted to the protocol buffer format.
+//
+// Stacks are taken from the symbolized comment lines under each record when
+// present, since the addresses in an archived profile only make sense to the
+// binary that wrote it. The comment sections other than the metadata, the
+// trace ID, the build and the truncation, degradation, normalization, baseline, stride
+// and merged window markers are ignored.
+//
+// The values of a profile whose header has no sampling rate, or that is
+// normalized, baselined or merged, are taken to be already scaled to
+// estimate all allocations, and its rate is taken from the metadata.
+func ParseText(r io.Reader) (*Profile, error) {
+	lp, err := parseLegacy(r)
+	if err != nil {
+		return nil, err
+	}
+
+	rate := int(lp.rate / 2)
+	scaled := lp.rate == 1 || lp.perSecond || lp.baselined || len(lp.windows) > 0
+	if scaled && lp.sampleRate > 0 {
+		rate = lp.sampleRate
+	}
+	p := &Profile{
+		Start:         lp.start,
+		Duration:      lp.window,
+		Kind:          lp.kind,
+		Rate:          rate,
+		Truncated:     lp.truncated,
+		Degraded:      lp.degraded,
+		Stride:        lp.stride,
+		Windows:       lp.windows,
+		TraceID:       lp.traceID,
+		Build:         lp.build,
+		DefaultSample: lp.sample,
+		frames:        lp.frames,
+		scaled:        scaled,
+		perSecond:     lp.perSecond,
+		baselined:     lp.baselined,
+	}
+	for _, lr := range lp.records {
+		p.Records = append(p.Records, Record{
+			Objects: lr.inuseObjects,
+			Bytes:   lr.inuseBytes,
+			Stack0:  lr.stack,
+		})
+	}
+	return p, nil
+}
+
+// legacyProfile is a profile in the legacy heap profile text format.
+type legacyProfile struct {
+	rate       int64 // from the header, twice runtime.MemProfileRate, or 1 if scaled
+	sampleRate int   // from the metadata
+	truncated  bool
+	degraded   bool
+	perSecond  bool
+	baselined  bool
+	stride     float64
+	windows    []Window
+	kind       string
+	start      time.Time
+	window     time.Duration
+	sample     string
+	traceID    string
+	build      string
+	records    []legacyRecord
+	frames     map[uintptr][]Frame
+}
+
+// legacyRecord is a record of the legacy heap profile text format. Garbage
+// profiles report the garbage as both the in-use and allocated values.
+type legacyRecord struct {
+	inuseObjects, inuseBytes int64
+	allocObjects, allocBytes int64
+	stack                    [32]uintptr
+}
+
+// parseMetadata reads the metadata comment written by printMetadata, if
+// comment is one. Malformed values are ignored.
+func (p *legacyProfile) parseMetadata(comment string) {
+	switch {
+	case strings.HasPrefix(comment, kindComment):
+		p.kind = strings.TrimPrefix(comment, kindComment)
+	case strings.HasPrefix(comment, startComment):
+		if t, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(comment, startComment)); err == nil {
+			p.start = t
+		}
+	case strings.HasPrefix(comment, windowComment):
+		if d, err := time.ParseDuration(strings.TrimPrefix(comment, windowComment)); err == nil {
+			p.window = d
+		}
+	case strings.HasPrefix(comment, rateComment):
+		if n, err := strconv.Atoi(strings.TrimPrefix(comment, rateComment)); err == nil && n > 0 {
+			p.sampleRate = n
+		}
+	case strings.HasPrefix(comment, sampleComment):
+		if s := strings.TrimPrefix(comment, sampleComment); validSample(s) {
+			p.sample = s
+		}
+	}
+}
+
+// parseLegacy parses a profile in the legacy heap profile text format.
+func parseLegacy(r io.Reader) (*legacyProfile, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("garbage: empty profile")
+	}
+
+	var objects, bytes int64
+	p := &legacyProfile{frames: make(map[uintptr][]Frame)}
+	if _, err := fmt.Sscanf(sc.Text(), "heap profile: %d: %d [%d: %d] @ heap/%d",
+		&objects, &bytes, &objects, &bytes, &p.rate); err != nil {
+		return nil, fmt.Errorf("garbage: bad profile header %q: %v", sc.Text(), err)
+	}
+
+	var (
+		rec      *legacyRecord // the record whose stack is being read, if any
+		symbolic bool          // whether rec's stack came from its comment lines
+		depth    int
+		fresh    bool // whether the frames of the last address are being read
+	)
+	for lineno := 2; sc.Scan(); lineno++ {
+		line := sc.Text()
+
+		switch {
+		case rec != nil && strings.HasPrefix(line, "#\t"):
+			pc, fr, ok := parseFrame(line)
+			if !ok {
+				continue
+			}
+			if !symbolic {
+				rec.stack = [32]uintptr{}
+				symbolic, depth = true, 0
+			}
+			if depth > 0 && rec.stack[depth-1] == pc {
+				// An inlined call at the same address.
+				if fresh {
+					p.frames[pc] = append(p.frames[pc], fr)
+				}
+				continue
+			}
+			if depth < len(rec.stack) {
+				rec.stack[depth] = pc
+				depth++
+				_, seen := p.frames[pc]
+				if fresh = !seen; fresh {
+					p.frames[pc] = []Frame{fr}
+				}
+			}
+
+		case strings.HasPrefix(line, "#"):
+			rec = nil
+			comment := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			if comment == truncatedComment {
+				p.truncated = true
+			}
+			if comment == degradedComment {
+				p.degraded = true
+			}
+			if comment == perSecondComment {
+				p.perSecond = true
+			}
+			if comment == baselineComment {
+				p.baselined = true
+			}
+			if stride, ok := parseStride(comment); ok {
+				p.stride = stride
+			}
+			if w, ok := parseMerged(comment); ok {
+				p.windows = append(p.windows, w)
+			}
+			p.parseMetadata(comment)
+			if strings.HasPrefix(comment, traceComment) {
+				p.traceID = strings.TrimPrefix(comment, traceComment)
+			}
+			if strings.HasPrefix(comment, buildComment) {
+				p.build = strings.TrimPrefix(comment, buildComment)
+			}
+
+		case strings.TrimSpace(line) == "":
+			rec = nil
+
+		default:
+			r, err := parseLegacyRecord(line)
+			if err != nil {
+				return nil, fmt.Errorf("garbage: line %d: %v", lineno, err)
+			}
+			p.records = append(p.records, r)
+			rec, symbolic = &p.records[len(p.records)-1], false
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseLegacyRecord parses a record line of the legacy heap profile text
+// format.
+func parseLegacyRecord(line string) (legacyRecord, error) {
+	var r legacyRecord
+
+	i := strings.Index(line, "@")
+	if i < 0 {
+		return r, fmt.Errorf("bad record %q", line)
+	}
+	if _, err := fmt.Sscanf(line[:i], "%d: %d [%d: %d]",
+		&r.inuseObjects, &r.inuseBytes, &r.allocObjects, &r.allocBytes); err != nil {
+		return r, fmt.Errorf("bad record %q: %v", line, err)
+	}
+
+	for j, f := range strings.Fields(line[i+1:]) {
+		if j == len(r.stack) {
+			break
+		}
+		pc, err := strconv.ParseUint(f, 0, 64)
+		if err != nil {
+			return r, fmt.Errorf("bad address %q", f)
+		}
+		r.stack[j] = uintptr(pc)
+	}
+	return r, nil
+}
+
+// parseFrame parses a symbolized comment line of the legacy heap profile text
+// format: the address, the function and offset, and the file and line, each
+// separated by one or more tabs.
+func parseFrame(line string) (uintptr, Frame, bool) {
+	var fields []string
+	for _, f := range strings.Split(line[1:], "\t") {
+		if f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) != 3 {
+		return 0, Frame{}, false
+	}
+
+	pc, err := strconv.ParseUint(fields[0], 0, 64)
+	if err != nil {
+		return 0, Frame{}, false
+	}
+
+	fr := Frame{Function: fields[1]}
+	if i := strings.LastIndex(fr.Function, "+0x"); i >= 0 {
+		fr.Function = fr.Function[:i]
+	}
+	fr.File = fields[2]
+	if i := strings.LastIndex(fr.File, ":"); i >= 0 {
+		fr.Line, _ = strconv.Atoi(fr.File[i+1:])
+		fr.File = fr.File[:i]
+	}
+	return uintptr(pc), fr, true
+}
@@ -0,0 +1,166 @@
+package garbage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseText(t *testing.T) {
+	orig := testProfile()
+	orig.Truncated = true
+	orig.Suspects = []Delta{{AllocObjects: 1, AllocBytes: 1024, Stack0: orig.Records[0].Stack0}}
+
+	var buf bytes.Buffer
+	if err := orig.writeText(&buf, textOptions{debug: 2}); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+
+	p, err := ParseText(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Rate != orig.Rate || !p.Truncated {
+		t.Errorf("want rate %d truncated, got rate %d truncated %v", orig.Rate, p.Rate, p.Truncated)
+	}
+	if len(p.Records) != 1 {
+		t.Fatalf("want 1 record, got %d", len(p.Records))
+	}
+	if r := p.Records[0]; r.Objects != 3 || r.Bytes != 3<<20 {
+		t.Errorf("want record 3: %d, got %d: %d", 3<<20, r.Objects, r.Bytes)
+	}
+
+	top := p.frames[p.Records[0].Stack()[0]]
+	if len(top) == 0 || top[0].Function != "github.com/benburkert/pprof-garbage.testProfile" {
+		t.Errorf("want testProfile at top of parsed stack, got %+v", top)
+	}
+	if !strings.HasSuffix(top[0].File, "profile_test.go") || top[0].Line == 0 {
+		t.Errorf("want profile_test.go:line, got %s:%d", top[0].File, top[0].Line)
+	}
+
+	if data := p.encode(); !bytes.Contains(data, []byte("garbage.testProfile")) {
+		t.Errorf("converted profile missing symbolized function")
+	}
+}
+
+func TestParseTextScaled(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	a := &Profile{Start: start, Duration: time.Minute, Rate: 512 * 1024, Records: []Record{testRecord(1, 80, 81920), testRecord(2, 40, 40960)}}
+	b := &Profile{Start: start, Duration: time.Minute, Rate: 512 * 1024, Records: []Record{testRecord(1, 8, 8192)}}
+	merged, err := Merge(MergeOptions{}, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, orig := range map[string]*Profile{"merged": merged, "baselined": a.Subtract(b)} {
+		for _, debug := range []int{0, 1} {
+			var buf bytes.Buffer
+			if err := orig.writeText(&buf, textOptions{debug: debug}); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), "@ heap/1\n") {
+				t.Errorf("%s, debug=%d: want an unscaled header, got %q", name, debug, strings.SplitN(buf.String(), "\n", 2)[0])
+			}
+
+			p, err := ParseText(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !p.scaled || p.Rate != orig.Rate {
+				t.Errorf("%s, debug=%d: want scaled at rate %d, got scaled %v at rate %d", name, debug, orig.Rate, p.scaled, p.Rate)
+			}
+			if len(p.Records) != len(orig.Records) {
+				t.Fatalf("%s, debug=%d: want %d records, got %d", name, debug, len(orig.Records), len(p.Records))
+			}
+			for i, r := range p.Records {
+				want := orig.weigh(orig.Records[i], 1)
+				if got := p.weigh(r, 1); got.Objects != want.Objects || got.Bytes != want.Bytes {
+					t.Errorf("%s, debug=%d: record %d: want %d: %d, got %d: %d", name, debug, i,
+						want.Objects, want.Bytes, got.Objects, got.Bytes)
+				}
+			}
+		}
+	}
+}
+
+func TestParseTextMetadata(t *testing.T) {
+	orig := goldenProfile()
+	orig.Kind = growthKind
+
+	text, err := orig.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(text, []byte("\n# cycles: 2\n")) {
+		t.Errorf("missing cycles metadata:\n%s", text)
+	}
+
+	p, err := ParseText(bytes.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.kind() != growthKind || !p.Start.Equal(orig.Start) || p.Duration != orig.Duration {
+		t.Errorf("want %s profile at %v for %v, got %s at %v for %v",
+			orig.Kind, orig.Start, orig.Duration, p.kind(), p.Start, p.Duration)
+	}
+}
+
+func TestParseTextErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"goroutine profile: total 4\n",
+		"heap profile: 1: 2 [1: 2] @ heap/1024\n1: 2 [1: 2] @ zz\n",
+	}
+
+	for _, test := range tests {
+		if _, err := ParseText(strings.NewReader(test)); err == nil {
+			t.Errorf("want error parsing %q", test)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	orig := testProfile()
+	orig.TraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	data, err := orig.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.kind() != garbageKind || p.Rate != orig.Rate || p.TraceID != orig.TraceID || !p.Start.Equal(orig.Start) {
+		t.Errorf("bad profile: kind %s rate %d trace %s start %v", p.kind(), p.Rate, p.TraceID, p.Start)
+	}
+	if len(p.Records) != 1 || p.Records[0].Stack0 != orig.Records[0].Stack0 {
+		t.Fatalf("want the stack of the original, got %+v", p.Records)
+	}
+	if r := p.Records[0]; r.Bytes < orig.Records[0].Bytes {
+		t.Errorf("want values scaled up from %d bytes, got %d", orig.Records[0].Bytes, r.Bytes)
+	}
+	if top := p.Frames(p.Records[0].Stack()[0]); len(top) == 0 || !strings.HasSuffix(top[0].Function, ".testProfile") {
+		t.Errorf("want testProfile at top of parsed stack, got %+v", top)
+	}
+
+	// The text format is read as by ParseText, and scaled alike.
+	text, err := orig.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, err := Parse(bytes.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tp.Records) != 1 || tp.Records[0].Bytes != p.Records[0].Bytes {
+		t.Errorf("want %d bytes from the text, got %+v", p.Records[0].Bytes, tp.Records)
+	}
+
+	if _, err := Parse(strings.NewReader("not a profile")); err == nil {
+		t.Error("want an error for garbage input")
+	}
+}
@@ -0,0 +1,158 @@
+package garbage
+
+import (
+	"runtime"
+	"testing"
+)
+
+// The pipeline tests feed synthetic reads of the memory profile through the
+// collector's aggregation, one GC cycle apart, and check its exact output.
+
+// site is the cumulative state of an allocation stack in a read of the memory
+// profile. Every object is 1 KiB.
+type site struct {
+	pc            uintptr
+	allocs, frees int64
+}
+
+func snapshot(sites ...site) []runtime.MemProfileRecord {
+	recs := make([]runtime.MemProfileRecord, len(sites))
+	for i, s := range sites {
+		recs[i] = runtime.MemProfileRecord{
+			AllocObjects: s.allocs,
+			AllocBytes:   s.allocs << 10,
+			FreeObjects:  s.frees,
+			FreeBytes:    s.frees << 10,
+		}
+		recs[i].Stack0[0] = s.pc
+	}
+	return recs
+}
+
+// replaySnapshots runs the reads through a collector of their own with a
+// single recording subscriber, whose window spans every read.
+func replaySnapshots(snaps ...[]runtime.MemProfileRecord) *subscription {
+	c := &collector{
+		subs: make(map[*subscription]struct{}),
+		last: snaps[0],
+		ages: make(ageTracker),
+	}
+	s := &subscription{record: true, first: snaps[0]}
+	c.subs[s] = struct{}{}
+
+	for i := 1; i < len(snaps); i++ {
+		c.observe(snaps[i-1], snaps[i], Cycle{NumGC: uint32(i)})
+	}
+	c.unsubscribe(s)
+	return s
+}
+
+const (
+	pcTemp  = 0x1 // temporaries, dead by the next GC
+	pcCache = 0x2 // a cache that only grows
+	pcSlow  = 0x3 // buffers freed a cycle or more after allocation
+	pcLate  = 0x4 // first allocates mid-window
+)
+
+var pipelineSnapshots = [][]runtime.MemProfileRecord{
+	snapshot(site{pcTemp, 10, 10}, site{pcCache, 5, 0}, site{pcSlow, 0, 0}),
+	snapshot(site{pcTemp, 20, 20}, site{pcCache, 10, 0}, site{pcSlow, 4, 0}),
+	snapshot(site{pcTemp, 30, 30}, site{pcCache, 15, 0}, site{pcSlow, 8, 0}, site{pcLate, 2, 0}),
+	snapshot(site{pcTemp, 40, 40}, site{pcCache, 20, 0}, site{pcSlow, 8, 4}, site{pcLate, 4, 2}),
+}
+
+func TestPipelineGarbage(t *testing.T) {
+	p := replaySnapshots(pipelineSnapshots...).profile(garbageKind)
+
+	want := map[uintptr]Record{
+		pcTemp: {Objects: 30, Bytes: 30 << 10, Cycles: 3, Ages: Ages{SameCycle: 30}, Sizes: Sizes{Small: 30}},
+		pcSlow: {Objects: 4, Bytes: 4 << 10, Cycles: 1, Ages: Ages{OneCycle: 4}, Sizes: Sizes{Small: 4}},
+		pcLate: {Objects: 2, Bytes: 2 << 10, Cycles: 1, Ages: Ages{SameCycle: 2}, Sizes: Sizes{Small: 2}},
+	}
+	if len(p.Records) != len(want) {
+		t.Fatalf("want %d records, got %+v", len(want), p.Records)
+	}
+	for _, r := range p.Records {
+		pc := r.Stack()[0]
+		w := want[pc]
+		w.Stack0 = r.Stack0
+		if r != w {
+			t.Errorf("%#x: want %+v, got %+v", pc, w, r)
+		}
+	}
+
+	wantCycles := []int64{10, 10, 16}
+	if len(p.Cycles) != len(wantCycles) {
+		t.Fatalf("want %d cycles, got %d", len(wantCycles), len(p.Cycles))
+	}
+	for i, c := range p.Cycles {
+		if c.Objects != wantCycles[i] || c.Bytes != wantCycles[i]<<10 {
+			t.Errorf("cycle %d: want %d objects, got %d: %d", i, wantCycles[i], c.Objects, c.Bytes)
+		}
+	}
+}
+
+func TestPipelineAnalyses(t *testing.T) {
+	s := replaySnapshots(pipelineSnapshots...)
+	p := s.profile(garbageKind)
+
+	// The slow buffers grow too, but free too much to be suspects.
+	if len(p.Suspects) != 1 {
+		t.Fatalf("want 1 suspect, got %+v", p.Suspects)
+	}
+	if d := p.Suspects[0]; d.Stack()[0] != pcCache || d.InUseObjects() != 15 {
+		t.Errorf("want cache suspect with 15 objects, got %#x with %d", d.Stack()[0], d.InUseObjects())
+	}
+
+	wantSurvival := map[uintptr][2]int64{
+		pcTemp:  {30, 0},
+		pcCache: {15, 15},
+		pcSlow:  {8, 8},
+		pcLate:  {4, 2},
+	}
+	for _, sv := range p.Survival {
+		pc := sv.Stack()[0]
+		if got := [2]int64{sv.Allocated, sv.Survived}; got != wantSurvival[pc] {
+			t.Errorf("%#x: want survival %v, got %v", pc, wantSurvival[pc], got)
+		}
+	}
+	if p.Survival[0].Stack()[0] != pcTemp {
+		t.Errorf("want survival sorted by allocations, got %#x first", p.Survival[0].Stack()[0])
+	}
+
+	g := s.profile(growthKind)
+	growth := make(map[uintptr]int64)
+	for _, r := range g.Records {
+		growth[r.Stack()[0]] = r.Objects
+	}
+	if want := map[uintptr]int64{pcCache: 15, pcSlow: 4, pcLate: 2}; len(growth) != len(want) ||
+		growth[pcCache] != 15 || growth[pcSlow] != 4 || growth[pcLate] != 2 {
+		t.Errorf("want growth %v, got %v", want, growth)
+	}
+}
+
+func TestPipelineRecording(t *testing.T) {
+	s := replaySnapshots(pipelineSnapshots...)
+	live := s.profile(garbageKind)
+
+	rec := &Recording{Cycles: s.recorded}
+	replayed := rec.Replay(ReplayOptions{})
+
+	if len(replayed.Records) != len(live.Records) {
+		t.Fatalf("want %d replayed records, got %d", len(live.Records), len(replayed.Records))
+	}
+	for _, lr := range live.Records {
+		var found bool
+		for _, rr := range replayed.Records {
+			if rr.Stack0 == lr.Stack0 {
+				found = true
+				if rr != lr {
+					t.Errorf("%#x: replayed %+v, collected %+v", lr.Stack()[0], rr, lr)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%#x: not replayed", lr.Stack()[0])
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package garbage
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// poolGet is the function through which the New function of a sync.Pool
+// allocates on a miss.
+const poolGet = "sync.(*Pool).Get"
+
+// A PoolUse summarizes the churn of the sync.Pools drawn on at a single call
+// site of sync.(*Pool).Get: the objects allocated by the pools' New function
+// on a miss, and how many of them became garbage within the window.
+//
+// Hits do not allocate, so they are not in the memory profile: a pool that
+// works shows few misses, and one whose objects are dropped by the GC
+// before they are reused shows misses that nearly all become garbage.
+type PoolUse struct {
+	Site    Frame // caller of sync.(*Pool).Get
+	Misses  int64 // objects allocated by New, if the profile has survival estimates
+	Objects int64 // number of garbage objects allocated by New
+	Bytes   int64 // number of garbage bytes allocated by New
+}
+
+// Churn returns the fraction of the objects allocated on a miss that became
+// garbage within the window, or 0 if the misses are unknown.
+func (u *PoolUse) Churn() float64 {
+	if u.Misses == 0 {
+		return 0
+	}
+	if u.Objects > u.Misses {
+		return 1
+	}
+	return float64(u.Objects) / float64(u.Misses)
+}
+
+// Pools returns the use of the sync.Pools whose New functions allocated the
+// garbage of the profile, by call site of sync.(*Pool).Get, the most garbage
+// bytes first. The misses are counted from the survival estimates, which
+// are kept only by collected profiles.
+func (p *Profile) Pools() []PoolUse {
+	var uses []PoolUse
+	index := make(map[Frame]int)
+	use := func(stk []uintptr) *PoolUse {
+		site, ok := p.poolSite(stk)
+		if !ok {
+			return nil
+		}
+		i, ok := index[site]
+		if !ok {
+			i = len(uses)
+			index[site] = i
+			uses = append(uses, PoolUse{Site: site})
+		}
+		return &uses[i]
+	}
+
+	for i := range p.Records {
+		r := &p.Records[i]
+		if u := use(r.Stack()); u != nil {
+			u.Objects += r.Objects
+			u.Bytes += r.Bytes
+		}
+	}
+	for i := range p.Survival {
+		s := &p.Survival[i]
+		if u := use(s.Stack()); u != nil {
+			u.Misses += s.Allocated
+		}
+	}
+
+	sort.SliceStable(uses, func(i, j int) bool { return uses[i].Bytes > uses[j].Bytes })
+	return uses
+}
+
+// poolSite returns the caller of sync.(*Pool).Get in stk, if stk allocated
+// in the New function of a pool.
+func (p *Profile) poolSite(stk []uintptr) (Frame, bool) {
+	get := false
+	for _, pc := range stk {
+		for _, fr := range p.Frames(pc) {
+			if get {
+				return fr, true
+			}
+			get = fr.Function == poolGet
+		}
+	}
+	return Frame{}, false
+}
+
+// printPools prints the use of the pools that allocated the profile's garbage
+// as a comment section of the legacy text format.
+func (p *Profile) printPools(w io.Writer, uses []PoolUse) {
+	fmt.Fprintf(w, "\n# sync.Pool: misses: garbage objects: garbage bytes\n")
+	for i := range uses {
+		u := &uses[i]
+		fmt.Fprintf(w, "# %d: %d: %d", u.Misses, u.Objects, u.Bytes)
+		if u.Misses > 0 {
+			fmt.Fprintf(w, " (%.1f%% churn)", 100*u.Churn())
+		}
+		fmt.Fprintf(w, " @ %s %s:%d\n", u.Site.Function, u.Site.File, u.Site.Line)
+	}
+}
@@ -0,0 +1,47 @@
+package garbage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPools(t *testing.T) {
+	stack := func(pcs ...uintptr) (stk [32]uintptr) {
+		copy(stk[:], pcs)
+		return stk
+	}
+	p := &Profile{
+		Records: []Record{
+			{Objects: 90, Bytes: 90 << 10, Cycles: 3, Stack0: stack(0x10, 0x20, 0x30)},
+			{Objects: 5, Bytes: 5 << 10, Cycles: 1, Stack0: stack(0x40, 0x30)},
+		},
+		Survival: []Survival{
+			{Allocated: 100, Survived: 10, Stack0: stack(0x10, 0x20, 0x30)},
+		},
+		frames: map[uintptr][]Frame{
+			0x10: {{Function: "main.newBuffer", File: "/src/main.go", Line: 8}},
+			0x20: {{Function: poolGet, File: "/go/src/sync/pool.go", Line: 148}},
+			0x30: {{Function: "main.handle", File: "/src/main.go", Line: 21}},
+			0x40: {{Function: "main.decode", File: "/src/main.go", Line: 30}},
+		},
+	}
+
+	uses := p.Pools()
+	if len(uses) != 1 {
+		t.Fatalf("want 1 pool, got %+v", uses)
+	}
+	u := uses[0]
+	if u.Site.Function != "main.handle" || u.Misses != 100 || u.Objects != 90 || u.Bytes != 90<<10 {
+		t.Errorf("unexpected pool use %+v", u)
+	}
+	if churn := u.Churn(); churn != 0.9 {
+		t.Errorf("want churn 0.9, got %v", churn)
+	}
+
+	var buf bytes.Buffer
+	p.writeText(&buf, textOptions{debug: 1})
+	if want := "# 100: 90: 92160 (90.0% churn) @ main.handle /src/main.go:21\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("missing %q:\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,94 @@
+package garbage
+
+import (
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// pressureThreshold is the fraction of the memory limit in use above
+	// which the process is under memory pressure.
+	pressureThreshold = 0.9
+
+	// pressureSlowdown is the factor the collector's polling interval is
+	// lengthened by under memory pressure.
+	pressureSlowdown = 10
+)
+
+const degradedComment = "degraded: collection slowed under memory pressure"
+
+// underPressure reports whether the memory mapped by the runtime is near the
+// soft memory limit (GOMEMLIMIT) or the memory limit of the container.
+func underPressure() bool {
+	limit := containerLimit()
+
+	samples := []metrics.Sample{
+		{Name: "/gc/gomemlimit:bytes"},
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	for _, s := range samples {
+		if s.Value.Kind() != metrics.KindUint64 {
+			return false
+		}
+	}
+	if l := samples[0].Value.Uint64(); limit == 0 || l < limit {
+		limit = l
+	}
+	// The runtime accounts for memory against the soft limit the same way.
+	used := samples[1].Value.Uint64() - samples[2].Value.Uint64()
+	return limit > 0 && float64(used) >= pressureThreshold*float64(limit)
+}
+
+var cgroupLimit struct {
+	once  sync.Once
+	limit uint64
+}
+
+// containerLimit returns the memory limit of the process's cgroup, or 0 if
+// there is none. It is read once.
+func containerLimit() uint64 {
+	cgroupLimit.once.Do(func() {
+		if runtime.GOOS != "linux" {
+			return
+		}
+		for _, name := range []string{
+			"/sys/fs/cgroup/memory.max",                   // cgroup v2
+			"/sys/fs/cgroup/memory/memory.limit_in_bytes", // cgroup v1
+		} {
+			b, err := os.ReadFile(name)
+			if err != nil {
+				continue
+			}
+			// v2 reports "max" and v1 a huge value if there is no limit.
+			n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+			if err == nil && n < 1<<62 {
+				cgroupLimit.limit = n
+			}
+			return
+		}
+	})
+	return cgroupLimit.limit
+}
+
+// leafStack returns stk cut after its first frame outside the runtime, so
+// that under memory pressure garbage is aggregated by allocation site
+// rather than by full stack.
+func leafStack(stk [32]uintptr) [32]uintptr {
+	var leaf [32]uintptr
+	for i, pc := range stk {
+		if pc == 0 {
+			break
+		}
+		leaf[i] = pc
+		if fn := runtime.FuncForPC(pc - 1); fn == nil || !strings.HasPrefix(fn.Name(), "runtime.") {
+			break
+		}
+	}
+	return leaf
+}
@@ -0,0 +1,59 @@
+package garbage
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLeafStack(t *testing.T) {
+	var pcs [32]uintptr
+	n := runtime.Callers(1, pcs[1:])
+	if n < 2 {
+		t.Fatalf("runtime.Callers: got %d frames", n)
+	}
+	// Return addresses are one past the call, as in the memory profile.
+	pcs[0] = reflect.ValueOf(runtime.GC).Pointer() + 1
+
+	leaf := leafStack(pcs)
+	if leaf[0] != pcs[0] || leaf[1] != pcs[1] || leaf[2] != 0 {
+		t.Errorf("leafStack: want %#x, got %#x", pcs[:2], leaf[:3])
+	}
+}
+
+func TestPipelineDegraded(t *testing.T) {
+	c := &collector{
+		subs:     make(map[*subscription]struct{}),
+		last:     pipelineSnapshots[0],
+		ages:     make(ageTracker),
+		degraded: true,
+	}
+	s := &subscription{first: pipelineSnapshots[0]}
+	c.subs[s] = struct{}{}
+	c.observe(pipelineSnapshots[0], pipelineSnapshots[1], Cycle{NumGC: 1})
+	c.unsubscribe(s)
+
+	p := s.profile(garbageKind)
+	if !p.Degraded {
+		t.Error("profile not degraded")
+	}
+	if len(p.Records) != 1 || p.Records[0].Objects != 10 {
+		t.Errorf("records: want 10 objects at one site, got %+v", p.Records)
+	}
+
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "# "+degradedComment+"\n") {
+		t.Errorf("text profile missing %q", degradedComment)
+	}
+	parsed, err := ParseText(strings.NewReader(string(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Degraded {
+		t.Error("parsed profile not degraded")
+	}
+}
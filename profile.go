@@ -0,0 +1,552 @@
+package garbage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"text/tabwriter"
+	"time"
+)
+
+// A Profile is a garbage profile: estimates of the allocations that became
+// garbage during a collection window, grouped by allocation stack.
+//
+// A Profile is an io.WriterTo, encoding.TextMarshaler and
+// encoding.BinaryMarshaler. The binary form is the gzip-compressed protocol
+// buffer expected by the pprof tool; the text form is the legacy heap profile
+// format with symbolized stacks.
+type Profile struct {
+	Start    time.Time     // time the collection window opened
+	Duration time.Duration // length of the collection window
+	Rate     int           // runtime.MemProfileRate during collection
+
+	// Kind is the kind of profile: "garbage" (or empty) for the allocations
+	// that became garbage, or "growth" for the net growth in memory in use.
+	Kind string
+
+	// Truncated is set if the collection was cancelled before the window
+	// closed.
+	Truncated bool
+
+	// Degraded is set if the collection was slowed under memory pressure,
+	// near GOMEMLIMIT or the container's memory limit, or because the
+	// collector's overhead exceeded Options.MaxOverhead: the collector
+	// polled less often, and attributed the garbage of the cycles it
+	// observed to the allocation site at the leaf of each stack rather than
+	// the full stack.
+	Degraded bool
+
+	// Stride is the mean number of GC cycles between the reads of the
+	// memory profile, if the collection adapted how often it read it to
+	// the garbage rate (see Options.AdaptiveStride), and zero otherwise.
+	Stride float64
+
+	// Windows are the collection windows of the profiles merged into the
+	// profile by Merge, in the order merged.
+	Windows []Window
+
+	// DefaultSample is the sample type pprof opens the profile on, "objects"
+	// or "bytes". Empty leaves the choice to pprof, which opens on the
+	// bytes. If set, the text format lists the records by it, most first.
+	DefaultSample string
+
+	// Build is the build of the binary profiled, if recorded: the path and
+	// version of its main module and its VCS revision (see DeployBaseline).
+	Build string
+
+	// Labels are static dimensions of the process profiled, such as its
+	// region, tenant or shard, written as a label of every sample in the
+	// protocol buffer format, so pprof's -tagfocus and -tagshow can slice
+	// profiles of a fleet merged by pprof. The stack and reclaim keys are
+	// reserved for the labels the profile writes itself.
+	Labels map[string]string
+
+	// Owners, if set, map the allocation sites of the profile to their
+	// owners for the ownership rollup of the text and JSON formats (see
+	// Ownership). They are not encoded in the protocol buffer format.
+	Owners []OwnerRule
+
+	// TraceID is the W3C trace ID of the request that started the
+	// collection, if any, so the profile can be linked to the traces
+	// captured at the same time.
+	TraceID string
+
+	Records []Record
+	Cycles  []Cycle // GC cycles observed, oldest first
+
+	// Suspects are the allocation stacks that grew rather than produced
+	// garbage: their allocations during the window greatly exceeded their
+	// frees. The largest growth is first.
+	Suspects []Delta
+
+	// Survival estimates, for each allocation stack, how many of its
+	// objects lived past one GC. The most allocations are first.
+	Survival []Survival
+
+	// Bursts are the intervals of the window in which the garbage rate
+	// reached twice the window's median, oldest first.
+	Bursts []Burst
+
+	// StackQuantiles summarize the garbage per GC cycle of the allocation
+	// stacks with the most garbage, the most first, so spiky producers can
+	// be told from steady ones (see CycleQuantiles). They are found only by
+	// collections.
+	StackQuantiles []StackQuantiles
+
+	// Overshoots are the GC cycles of the window whose heap grew past its
+	// goal, with the stacks responsible. They are found only by
+	// collections.
+	Overshoots []Overshoot
+
+	// Intervals are the profiles of the equal sub-intervals of the window,
+	// oldest first, if the collection partitioned it (see
+	// Options.Intervals), or cut them at the edges of bursts (see
+	// Options.IsolateBursts), or the profiles of the phases of a
+	// ManualCollector. They are written only to bundles.
+	Intervals []*Profile
+
+	// MemStats are the memory statistics at the end of the window, if
+	// available.
+	MemStats *runtime.MemStats
+
+	// StartStats and EndStats are the runtime metrics at the start and end
+	// of the window, if available.
+	StartStats, EndStats *RuntimeStats
+
+	// frames symbolizes the stacks of a profile parsed by ParseText, in
+	// place of the running binary.
+	frames map[uintptr][]Frame
+
+	// tops are the largest garbage stacks of each cycle of a collected
+	// profile, from which Bursts are found.
+	tops [][]Record
+
+	// anonymized and redacted are set by Anonymize and Redact.
+	anonymized, redacted bool
+
+	// scaled is set if the values already estimate all allocations, rather
+	// than those sampled at Rate.
+	scaled bool
+
+	// perSecond is set by PerSecond.
+	perSecond bool
+
+	// baselined is set by Subtract.
+	baselined bool
+
+	// isolatedBurst is set on the intervals of a collection that isolated
+	// a burst.
+	isolatedBurst bool
+}
+
+const truncatedComment = "truncated: collection cancelled before the window closed"
+
+// A Record describes the garbage attributed to a single allocation stack.
+type Record struct {
+	Objects int64       // number of garbage objects
+	Bytes   int64       // number of garbage bytes
+	Cycles  int         // number of GC cycles in which the stack produced garbage
+	Ages    Ages        // estimated ages of the garbage objects
+	Sizes   Sizes       // estimated sizes of the garbage objects
+	Stack0  [32]uintptr // stack trace for this record; ends at first 0 entry
+}
+
+// A Cycle describes the garbage observed in a single GC cycle, and the work
+// the GC did for it. The runtime does not export the heap size that
+// triggered the cycle or the time spent sweeping; HeapLive, the heap marked
+// live by the cycle, is the baseline its goal was computed from.
+type Cycle struct {
+	NumGC    uint32        // runtime.MemStats.NumGC after the cycle
+	Time     time.Time     // time the cycle was observed
+	Pause    time.Duration // stop-the-world pause of the most recent GC
+	MarkCPU  time.Duration // CPU time spent marking since the previous cycle
+	HeapLive uint64        // heap bytes marked live
+	HeapGoal uint64        // heap size goal for the next cycle
+	Objects  int64         // number of garbage objects
+	Bytes    int64         // number of garbage bytes
+}
+
+// Stack returns the stack trace associated with the record,
+// a prefix of r.Stack0.
+func (r *Record) Stack() []uintptr {
+	for i, v := range r.Stack0 {
+		if v == 0 {
+			return r.Stack0[0:i]
+		}
+	}
+	return r.Stack0[0:]
+}
+
+// A Frame is a symbolized frame of an allocation stack.
+type Frame struct {
+	Function string // fully qualified function name
+	File     string
+	Line     int
+}
+
+// Frames returns the frames at pc, an address in one of the profile's
+// stacks, innermost first with inlined calls expanded. A collected profile is
+// symbolized by the running binary; a profile read by ParseText,
+// GarbageFromHeap or Replay is symbolized by the data it was read from.
+func (p *Profile) Frames(pc uintptr) []Frame {
+	if p.frames != nil {
+		return p.frames[pc]
+	}
+	return symbolize(pc)
+}
+
+// Collect collects a garbage profile over duration. Like WriteGarbageProfile,
+// it runs twice as long as duration.
+func Collect(duration time.Duration) *Profile {
+	p, _ := NewCollector(Options{Duration: duration}).Collect(context.Background())
+	return p
+}
+
+// CollectGrowth collects a growth profile over duration: the net growth in
+// memory in use by each allocation stack, the memory in use at the end of the
+// window minus that at the start. The window is chosen as for Collect, so the
+// two profiles are comparable.
+func CollectGrowth(duration time.Duration) *Profile {
+	p, _ := NewCollector(Options{Duration: duration, Kind: growthKind}).Collect(context.Background())
+	return p
+}
+
+const (
+	garbageKind = "garbage"
+	growthKind  = "growth"
+)
+
+// kind returns the kind of the profile, defaulting to garbage.
+func (p *Profile) kind() string {
+	if p.Kind == "" {
+		return garbageKind
+	}
+	return p.Kind
+}
+
+// WriteTo writes the profile to w in the gzip-compressed protocol buffer
+// format expected by the pprof tool. The profile is encoded and written in
+// chunks, so a large profile is never held in memory in its encoded form.
+func (p *Profile) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	zw := gzip.NewWriter(cw)
+	if err := p.encodeTo(zw); err != nil {
+		return cw.n, err
+	}
+	err := zw.Close()
+	return cw.n, err
+}
+
+// MarshalBinary encodes the profile as a gzip-compressed protocol buffer.
+func (p *Profile) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// MarshalText encodes the profile in the legacy heap profile text format,
+// including symbolized stacks.
+func (p *Profile) MarshalText() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := p.writeText(&buf, textOptions{debug: 1}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// textOptions control the legacy text format.
+type textOptions struct {
+	// debug level 1 adds symbolized stacks, the retention suspects, the
+	// survival estimates, the ages and sizes of the top garbage stacks, the
+	// churn of the sync.Pools allocating garbage and the records reclaimed
+	// outside the GC, and level 2 adds a table of the GC cycles observed, the
+	// runtime.MemStats at the end of the window and the goroutine and
+	// scheduler metrics over the window.
+	debug int
+
+	// human prints the sizes and counts in the cycle table and MemStats in
+	// human-readable form. The profile records stay in the legacy format.
+	human bool
+
+	format TextFormat
+}
+
+// A TextFormat selects the layout of the legacy text format, so parsers of
+// the text can pin the layout they were written against.
+type TextFormat int
+
+const (
+	// TextCurrent is the current layout, which may gain comment sections in
+	// later releases.
+	TextCurrent TextFormat = iota
+
+	// CompatV1 is the layout of the first release: the header, the records
+	// and, with debug output, their symbolized stacks, and nothing else.
+	CompatV1
+)
+
+// writeText writes the profile in the legacy heap profile text format. The
+// garbage, or growth, is reported as both the in-use and allocated values.
+func (p *Profile) writeText(w io.Writer, opts textOptions) error {
+	debug := opts.debug
+
+	var tw *tabwriter.Writer
+	if debug > 0 {
+		tw = tabwriter.NewWriter(w, 1, 8, 1, '\t', 0)
+		w = tw
+	}
+
+	var total Record
+	for _, r := range p.Records {
+		total.Bytes += r.Bytes
+		total.Objects += r.Objects
+	}
+
+	// The header of a profile whose values are already scaled, such as a
+	// merged or baselined one, has no sampling rate, so readers do not
+	// scale them again; its rate is in the metadata.
+	rate := 2 * p.Rate
+	if p.scaled {
+		rate = 1
+	}
+	fmt.Fprintf(w, "heap profile: %d: %d [%d: %d] @ heap/%d\n",
+		total.Objects, total.Bytes,
+		total.Objects, total.Bytes,
+		rate)
+
+	for _, r := range p.textRecords() {
+		fmt.Fprintf(w, "%d: %d [%d: %d] @",
+			r.Objects, r.Bytes,
+			r.Objects, r.Bytes)
+		for _, pc := range r.Stack() {
+			fmt.Fprintf(w, " %#x", pc)
+		}
+		fmt.Fprintf(w, "\n")
+		if debug > 0 {
+			p.writeStack(w, r.Stack(), opts.format != CompatV1)
+		}
+	}
+
+	if opts.format == CompatV1 {
+		if tw != nil {
+			return tw.Flush()
+		}
+		return nil
+	}
+
+	if debug > 0 && len(p.Suspects) > 0 {
+		p.printSuspects(w)
+	}
+	if debug > 0 && len(p.Survival) > 0 {
+		p.printSurvival(w)
+	}
+	if debug > 0 && len(p.Records) > 0 && p.kind() == garbageKind {
+		p.printAges(w)
+		p.printSizes(w)
+	}
+	if debug > 0 && p.kind() == garbageKind {
+		if uses := p.Pools(); len(uses) > 0 {
+			p.printPools(w, uses)
+		}
+		p.printReclaimed(w)
+		if len(p.Owners) > 0 && len(p.Records) > 0 {
+			p.printOwnership(w, p.Ownership(p.Owners))
+		}
+	}
+	if debug > 0 && len(p.Bursts) > 0 {
+		p.printBursts(w)
+	}
+	if debug > 0 && len(p.Overshoots) > 0 {
+		p.printOvershoots(w)
+	}
+	if debug > 0 && p.kind() == garbageKind {
+		if q, ok := p.CycleQuantiles(); ok {
+			p.printQuantiles(w, q)
+		}
+	}
+
+	if debug > 1 {
+		u := units{human: opts.human}
+		p.printCycles(w, u)
+		if p.MemStats != nil {
+			printMemStats(w, p.MemStats, u)
+		}
+		if p.StartStats != nil && p.EndStats != nil {
+			printRuntimeStats(w, p.StartStats, p.EndStats)
+		}
+	}
+
+	p.printMetadata(w)
+	if p.TraceID != "" {
+		fmt.Fprintf(w, "# %s%s\n", traceComment, p.TraceID)
+	}
+	if p.Build != "" {
+		fmt.Fprintf(w, "# %s%s\n", buildComment, p.Build)
+	}
+	if p.Truncated {
+		fmt.Fprintf(w, "# %s\n", truncatedComment)
+	}
+	if p.Degraded {
+		fmt.Fprintf(w, "# %s\n", degradedComment)
+	}
+	if p.perSecond {
+		fmt.Fprintf(w, "# %s\n", perSecondComment)
+	}
+	if p.baselined {
+		fmt.Fprintf(w, "# %s\n", baselineComment)
+	}
+	if p.Stride > 0 {
+		fmt.Fprintf(w, "# %s\n", p.strideMarker())
+	}
+	if n, _ := p.TruncatedStacks(); n > 0 {
+		fmt.Fprintf(w, "# %s%d\n", truncatedStacksComment, n)
+	}
+	for _, win := range p.Windows {
+		fmt.Fprintf(w, "# %s\n", win.mergedMarker())
+	}
+	if note := p.emptyNote(); note != "" {
+		fmt.Fprintf(w, "# %s\n", note)
+	}
+	if note := p.accuracyNote(); note != "" {
+		fmt.Fprintf(w, "# %s\n", note)
+	}
+	if note := p.nativeNote(); note != "" {
+		fmt.Fprintf(w, "# %s\n", note)
+	}
+
+	if tw != nil {
+		return tw.Flush()
+	}
+	return nil
+}
+
+// Keys of the metadata comments of the text format.
+const (
+	kindComment   = "kind: "
+	startComment  = "start: "
+	windowComment = "window: "
+	cyclesComment = "cycles: "
+	rateComment   = "sample_rate: "
+)
+
+// printMetadata prints the collection metadata as "# key: value" comments, so
+// consumers of the text can read it without switching formats: the kind of
+// profile, the start of the window in RFC 3339 format, its length as a Go
+// duration, the GC cycles observed and runtime.MemProfileRate. The markers
+// that follow, such as truncated and degraded, are written only when set.
+func (p *Profile) printMetadata(w io.Writer) {
+	fmt.Fprintf(w, "# %s%s\n", kindComment, p.kind())
+	if !p.Start.IsZero() {
+		fmt.Fprintf(w, "# %s%s\n", startComment, p.Start.UTC().Format(time.RFC3339Nano))
+	}
+	if p.Duration > 0 {
+		fmt.Fprintf(w, "# %s%s\n", windowComment, p.Duration)
+	}
+	fmt.Fprintf(w, "# %s%d\n", cyclesComment, len(p.Cycles))
+	fmt.Fprintf(w, "# %s%d\n", rateComment, p.Rate)
+	if validSample(p.DefaultSample) {
+		fmt.Fprintf(w, "# %s%s\n", sampleComment, p.DefaultSample)
+	}
+}
+
+// printStack prints the function and source line information for stk, from
+// the running binary or, for a profile read from elsewhere, its own symbols.
+// A stack truncated at the depth of the memory profile ends in a
+// "(truncated)" root frame.
+func (p *Profile) printStack(w io.Writer, stk []uintptr) {
+	p.writeStack(w, stk, true)
+}
+
+// writeStack prints stk as for printStack, marking a truncated stack only if
+// mark is set.
+func (p *Profile) writeStack(w io.Writer, stk []uintptr, mark bool) {
+	mark = mark && stackTruncated(stk)
+	if p.frames == nil {
+		if !mark {
+			printStackRecord(w, stk, false)
+			return
+		}
+		var buf bytes.Buffer
+		printStackRecord(&buf, stk, false)
+		w.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+		fmt.Fprintf(w, "#\t%s\n\n", truncatedFrame)
+		return
+	}
+
+	for _, pc := range stk {
+		frames := p.frames[pc]
+		if len(frames) == 0 {
+			fmt.Fprintf(w, "#\t%#x\n", pc)
+		}
+		for _, fr := range frames {
+			fmt.Fprintf(w, "#\t%#x\t%s\t%s:%d\n", pc, fr.Function, fr.File, fr.Line)
+		}
+	}
+	if mark {
+		fmt.Fprintf(w, "#\t%s\n", truncatedFrame)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// printCycles prints a table of the garbage observed in each GC cycle.
+func (p *Profile) printCycles(w io.Writer, u units) {
+	fmt.Fprintf(w, "\n# GC cycles\n")
+	fmt.Fprintf(w, "# NumGC\tOffset\tPause\tMarkCPU\tHeapLive\tHeapGoal\tObjects\tBytes\n")
+	for _, c := range p.Cycles {
+		fmt.Fprintf(w, "# %d\t%v\t%v\t%v\t%s\t%s\t%s\t%s\n",
+			c.NumGC, c.Time.Sub(p.Start).Round(time.Millisecond), c.Pause,
+			c.MarkCPU.Round(time.Microsecond), u.ubytes(c.HeapLive), u.ubytes(c.HeapGoal),
+			u.count(c.Objects), u.bytes(c.Bytes))
+	}
+}
+
+// printMemStats prints s in the same form as the heap profile.
+func printMemStats(w io.Writer, s *runtime.MemStats, u units) {
+	fmt.Fprintf(w, "\n# runtime.MemStats\n")
+	fmt.Fprintf(w, "# Alloc = %s\n", u.ubytes(s.Alloc))
+	fmt.Fprintf(w, "# TotalAlloc = %s\n", u.ubytes(s.TotalAlloc))
+	fmt.Fprintf(w, "# Sys = %s\n", u.ubytes(s.Sys))
+	fmt.Fprintf(w, "# Lookups = %s\n", u.ucount(s.Lookups))
+	fmt.Fprintf(w, "# Mallocs = %s\n", u.ucount(s.Mallocs))
+	fmt.Fprintf(w, "# Frees = %s\n", u.ucount(s.Frees))
+
+	fmt.Fprintf(w, "# HeapAlloc = %s\n", u.ubytes(s.HeapAlloc))
+	fmt.Fprintf(w, "# HeapSys = %s\n", u.ubytes(s.HeapSys))
+	fmt.Fprintf(w, "# HeapIdle = %s\n", u.ubytes(s.HeapIdle))
+	fmt.Fprintf(w, "# HeapInuse = %s\n", u.ubytes(s.HeapInuse))
+	fmt.Fprintf(w, "# HeapReleased = %s\n", u.ubytes(s.HeapReleased))
+	fmt.Fprintf(w, "# HeapObjects = %s\n", u.ucount(s.HeapObjects))
+
+	fmt.Fprintf(w, "# Stack = %s / %s\n", u.ubytes(s.StackInuse), u.ubytes(s.StackSys))
+	fmt.Fprintf(w, "# MSpan = %s / %s\n", u.ubytes(s.MSpanInuse), u.ubytes(s.MSpanSys))
+	fmt.Fprintf(w, "# MCache = %s / %s\n", u.ubytes(s.MCacheInuse), u.ubytes(s.MCacheSys))
+	fmt.Fprintf(w, "# BuckHashSys = %s\n", u.ubytes(s.BuckHashSys))
+	fmt.Fprintf(w, "# GCSys = %s\n", u.ubytes(s.GCSys))
+	fmt.Fprintf(w, "# OtherSys = %s\n", u.ubytes(s.OtherSys))
+
+	fmt.Fprintf(w, "# NextGC = %s\n", u.ubytes(s.NextGC))
+	fmt.Fprintf(w, "# LastGC = %d\n", s.LastGC)
+	fmt.Fprintf(w, "# PauseNs = %d\n", s.PauseNs)
+	fmt.Fprintf(w, "# PauseEnd = %d\n", s.PauseEnd)
+	fmt.Fprintf(w, "# NumGC = %d\n", s.NumGC)
+	fmt.Fprintf(w, "# NumForcedGC = %d\n", s.NumForcedGC)
+	fmt.Fprintf(w, "# GCCPUFraction = %v\n", s.GCCPUFraction)
+	fmt.Fprintf(w, "# DebugGC = %v\n", s.DebugGC)
+}
@@ -0,0 +1,219 @@
+package garbage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	_ io.WriterTo              = (*Profile)(nil)
+	_ encoding.TextMarshaler   = (*Profile)(nil)
+	_ encoding.BinaryMarshaler = (*Profile)(nil)
+)
+
+func testProfile() *Profile {
+	r := Record{Objects: 3, Bytes: 3 << 20}
+	runtime.Callers(1, r.Stack0[:])
+
+	return &Profile{
+		Start:    time.Unix(1470000000, 0),
+		Duration: 10 * time.Second,
+		Rate:     512 * 1024,
+		Records:  []Record{r},
+	}
+}
+
+func TestProfileMarshalText(t *testing.T) {
+	text, err := testProfile().MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "heap profile: 3: 3145728 [3: 3145728] @ heap/1048576\n"; !strings.HasPrefix(string(text), want) {
+		t.Errorf("want header %q, got %q", want, text)
+	}
+	if !strings.Contains(string(text), "garbage.testProfile+") {
+		t.Errorf("missing symbolized stack in %q", text)
+	}
+}
+
+func TestProfileDebugLevels(t *testing.T) {
+	p := testProfile()
+	p.Cycles = []Cycle{{
+		NumGC:    42,
+		Time:     p.Start.Add(time.Second),
+		Pause:    time.Millisecond,
+		MarkCPU:  2 * time.Millisecond,
+		HeapLive: 4 << 20,
+		HeapGoal: 8 << 20,
+		Objects:  3,
+		Bytes:    3 << 20,
+	}}
+	p.MemStats = &runtime.MemStats{NumGC: 42}
+
+	tests := []struct {
+		debug         int
+		want, notWant []string
+	}{
+		{0, nil, []string{"garbage.testProfile", "# GC cycles", "# runtime.MemStats"}},
+		{1, []string{"garbage.testProfile"}, []string{"# GC cycles", "# runtime.MemStats"}},
+		{2, []string{"garbage.testProfile", "# GC cycles", "# 42\t1s\t1ms\t2ms\t4194304\t", "# NumGC = 42"}, nil},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := p.writeText(&buf, textOptions{debug: test.debug}); err != nil {
+			t.Fatal(err)
+		}
+		text := buf.String()
+
+		for _, s := range test.want {
+			if !strings.Contains(text, s) {
+				t.Errorf("debug=%d: want %q in:\n%s", test.debug, s, text)
+			}
+		}
+		for _, s := range test.notWant {
+			if strings.Contains(text, s) {
+				t.Errorf("debug=%d: unexpected %q in:\n%s", test.debug, s, text)
+			}
+		}
+	}
+}
+
+func TestProfileMarshalBinary(t *testing.T) {
+	p := testProfile()
+
+	data, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Error("WriteTo and MarshalBinary disagree")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := decodeFields(t, raw)
+	if n := len(fields[tagProfile_Sample]); n != 1 {
+		t.Errorf("want 1 sample, got %d", n)
+	}
+	if n := len(fields[tagProfile_Location]); n == 0 {
+		t.Error("want locations, got none")
+	}
+
+	strs := make(map[string]bool)
+	for _, s := range fields[tagProfile_StringTable] {
+		strs[string(s)] = true
+	}
+	for _, want := range []string{"garbage_objects", "garbage_bytes", "github.com/benburkert/pprof-garbage.testProfile"} {
+		if !strs[want] {
+			t.Errorf("string table missing %q", want)
+		}
+	}
+}
+
+// decodeFields splits a protocol buffer message into the raw values of its
+// length-delimited fields, by field number.
+func decodeFields(t *testing.T, data []byte) map[int][][]byte {
+	fields := make(map[int][][]byte)
+	for len(data) > 0 {
+		key, n := decodeVarint(data)
+		data = data[n:]
+
+		switch key & 7 {
+		case 0:
+			_, n = decodeVarint(data)
+			data = data[n:]
+		case 2:
+			l, n := decodeVarint(data)
+			data = data[n:]
+			fields[int(key>>3)] = append(fields[int(key>>3)], data[:l])
+			data = data[l:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+// maxWriter records the largest write.
+type maxWriter struct {
+	bytes.Buffer
+	max int
+}
+
+func (w *maxWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		w.max = len(p)
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestEncodeChunked(t *testing.T) {
+	const n = 5000
+
+	p := &Profile{Rate: 1, scaled: true, frames: make(map[uintptr][]Frame)}
+	for i := 0; i < n; i++ {
+		pc := uintptr(0x1000 + i)
+		p.frames[pc] = []Frame{{Function: fmt.Sprintf("main.f%d", i), File: "main.go", Line: i}}
+		p.Records = append(p.Records, Record{Objects: 1, Bytes: int64(i + 1), Stack0: [32]uintptr{pc, 0x1000}})
+	}
+
+	var w maxWriter
+	if err := p.encodeTo(&w); err != nil {
+		t.Fatal(err)
+	}
+	if w.max > 2*protoChunk {
+		t.Errorf("want writes of about %d bytes, got one of %d", protoChunk, w.max)
+	}
+
+	var samples int
+	var strs []string
+	err := decodeMessage(w.Bytes(), func(tag int, v uint64, b []byte) error {
+		switch tag {
+		case tagProfile_Sample:
+			samples++
+		case tagProfile_StringTable:
+			strs = append(strs, string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples != n {
+		t.Errorf("want %d samples, got %d", n, samples)
+	}
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table does not start with the empty string")
+	}
+	seen := make(map[string]bool)
+	for _, s := range strs {
+		if seen[s] {
+			t.Errorf("string %q written twice", s)
+		}
+		seen[s] = true
+	}
+	if !seen["main.f4999"] {
+		t.Error("string table is missing the last function")
+	}
+}
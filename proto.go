@@ -0,0 +1,529 @@
+package garbage
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+)
+
+// protobuf is a minimal protocol buffer encoder, sufficient for writing the
+// profile.proto messages understood by the pprof tool.
+type protobuf struct {
+	data []byte
+	tmp  [16]byte
+	nest int
+}
+
+type msgOffset int
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 128 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protobuf) length(tag int, len int) {
+	b.varint(uint64(tag)<<3 | 2)
+	b.varint(uint64(len))
+}
+
+func (b *protobuf) uint64(tag int, x uint64) {
+	// append varint to b.data
+	b.varint(uint64(tag)<<3 | 0)
+	b.varint(x)
+}
+
+func (b *protobuf) uint64s(tag int, x []uint64) {
+	if len(x) > 2 {
+		// Use packed encoding
+		n1 := len(b.data)
+		for _, u := range x {
+			b.varint(u)
+		}
+		n2 := len(b.data)
+		b.length(tag, n2-n1)
+		n3 := len(b.data)
+		copy(b.tmp[:], b.data[n2:n3])
+		copy(b.data[n1+(n3-n2):], b.data[n1:n2])
+		copy(b.data[n1:], b.tmp[:n3-n2])
+		return
+	}
+	for _, u := range x {
+		b.uint64(tag, u)
+	}
+}
+
+func (b *protobuf) uint64Opt(tag int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.uint64(tag, x)
+}
+
+func (b *protobuf) int64(tag int, x int64) {
+	u := uint64(x)
+	b.uint64(tag, u)
+}
+
+func (b *protobuf) int64Opt(tag int, x int64) {
+	if x == 0 {
+		return
+	}
+	b.int64(tag, x)
+}
+
+func (b *protobuf) int64s(tag int, x []int64) {
+	if len(x) > 2 {
+		// Use packed encoding
+		n1 := len(b.data)
+		for _, u := range x {
+			b.varint(uint64(u))
+		}
+		n2 := len(b.data)
+		b.length(tag, n2-n1)
+		n3 := len(b.data)
+		copy(b.tmp[:], b.data[n2:n3])
+		copy(b.data[n1+(n3-n2):], b.data[n1:n2])
+		copy(b.data[n1:], b.tmp[:n3-n2])
+		return
+	}
+	for _, u := range x {
+		b.int64(tag, u)
+	}
+}
+
+func (b *protobuf) string(tag int, x string) {
+	b.length(tag, len(x))
+	b.data = append(b.data, x...)
+}
+
+func (b *protobuf) strings(tag int, x []string) {
+	for _, s := range x {
+		b.string(tag, s)
+	}
+}
+
+func (b *protobuf) bool(tag int, x bool) {
+	if x {
+		b.uint64(tag, 1)
+	} else {
+		b.uint64(tag, 0)
+	}
+}
+
+func (b *protobuf) boolOpt(tag int, x bool) {
+	if !x {
+		return
+	}
+	b.bool(tag, x)
+}
+
+func (b *protobuf) startMessage() msgOffset {
+	b.nest++
+	return msgOffset(len(b.data))
+}
+
+func (b *protobuf) endMessage(tag int, start msgOffset) {
+	n1 := int(start)
+	n2 := len(b.data)
+	b.length(tag, n2-n1)
+	n3 := len(b.data)
+	copy(b.tmp[:], b.data[n2:n3])
+	copy(b.data[n1+(n3-n2):], b.data[n1:n2])
+	copy(b.data[n1:], b.tmp[:n3-n2])
+	b.nest--
+}
+
+// Field numbers from github.com/google/pprof/proto/profile.proto.
+const (
+	// message Profile
+	tagProfile_SampleType        = 1  // repeated ValueType
+	tagProfile_Sample            = 2  // repeated Sample
+	tagProfile_Mapping           = 3  // repeated Mapping
+	tagProfile_Location          = 4  // repeated Location
+	tagProfile_Function          = 5  // repeated Function
+	tagProfile_StringTable       = 6  // repeated string
+	tagProfile_DropFrames        = 7  // int64 (string table index)
+	tagProfile_KeepFrames        = 8  // int64 (string table index)
+	tagProfile_TimeNanos         = 9  // int64
+	tagProfile_DurationNanos     = 10 // int64
+	tagProfile_PeriodType        = 11 // ValueType
+	tagProfile_Period            = 12 // int64
+	tagProfile_Comment           = 13 // repeated int64
+	tagProfile_DefaultSampleType = 14 // int64
+
+	// message ValueType
+	tagValueType_Type = 1 // int64 (string table index)
+	tagValueType_Unit = 2 // int64 (string table index)
+
+	// message Sample
+	tagSample_Location = 1 // repeated uint64
+	tagSample_Value    = 2 // repeated int64
+	tagSample_Label    = 3 // repeated Label
+
+	// message Label
+	tagLabel_Key = 1 // int64 (string table index)
+	tagLabel_Str = 2 // int64 (string table index)
+	tagLabel_Num = 3 // int64
+
+	// message Mapping
+	tagMapping_ID              = 1  // uint64
+	tagMapping_Start           = 2  // uint64
+	tagMapping_Limit           = 3  // uint64
+	tagMapping_Offset          = 4  // uint64
+	tagMapping_Filename        = 5  // int64 (string table index)
+	tagMapping_BuildID         = 6  // int64 (string table index)
+	tagMapping_HasFunctions    = 7  // bool
+	tagMapping_HasFilenames    = 8  // bool
+	tagMapping_HasLineNumbers  = 9  // bool
+	tagMapping_HasInlineFrames = 10 // bool
+
+	// message Location
+	tagLocation_ID        = 1 // uint64
+	tagLocation_MappingID = 2 // uint64
+	tagLocation_Address   = 3 // uint64
+	tagLocation_Line      = 4 // repeated Line
+
+	// message Line
+	tagLine_FunctionID = 1 // uint64
+	tagLine_Line       = 2 // int64
+
+	// message Function
+	tagFunction_ID         = 1 // uint64
+	tagFunction_Name       = 2 // int64 (string table index)
+	tagFunction_SystemName = 3 // int64 (string table index)
+	tagFunction_Filename   = 4 // int64 (string table index)
+	tagFunction_StartLine  = 5 // int64
+)
+
+// protoChunk is the size of the encoded chunks a profileBuilder writes.
+const protoChunk = 32 << 10
+
+// profileBuilder encodes a Profile as a profile.proto message, symbolizing
+// stacks as it goes. The message is written in chunks of whole fields: the
+// repeated fields of a message may be interleaved, so the locations,
+// functions and strings are written as the samples first refer to them.
+type profileBuilder struct {
+	w   io.Writer
+	err error // first error writing to w
+
+	pb        protobuf
+	strings   []string // strings not yet written
+	nstrings  int      // strings written
+	stringMap map[string]int
+	locs      map[uintptr]uint64
+	funcs     map[string]uint64
+
+	// frames, if set, symbolizes locations instead of the running binary.
+	frames map[uintptr][]Frame
+}
+
+func newProfileBuilder(w io.Writer) *profileBuilder {
+	return &profileBuilder{
+		w:         w,
+		strings:   []string{""},
+		stringMap: map[string]int{"": 0},
+		locs:      make(map[uintptr]uint64),
+		funcs:     make(map[string]uint64),
+	}
+}
+
+// flush writes the fields encoded so far, along with the strings added since
+// the last flush, if they fill a chunk or force is set. It must only be called
+// between top-level fields.
+func (b *profileBuilder) flush(force bool) {
+	if !force && len(b.pb.data) < protoChunk {
+		return
+	}
+
+	b.pb.strings(tagProfile_StringTable, b.strings)
+	b.nstrings += len(b.strings)
+	b.strings = b.strings[:0]
+
+	if b.err == nil {
+		_, b.err = b.w.Write(b.pb.data)
+	}
+	b.pb.data = b.pb.data[:0]
+}
+
+// encode returns the profile.proto encoding of p, uncompressed.
+func (p *Profile) encode() []byte {
+	var buf bytes.Buffer
+	p.encodeTo(&buf)
+	return buf.Bytes()
+}
+
+// encodeTo writes the profile.proto encoding of p to w, uncompressed, in
+// chunks of about protoChunk bytes.
+func (p *Profile) encodeTo(w io.Writer) error {
+	b := newProfileBuilder(w)
+	b.frames = p.frames
+
+	b.pbValueType(tagProfile_SampleType, p.kind()+"_objects", "count")
+	b.pbValueType(tagProfile_SampleType, p.kind()+"_bytes", "bytes")
+	if !p.Start.IsZero() {
+		b.pb.int64Opt(tagProfile_TimeNanos, p.Start.UnixNano())
+	}
+	b.pb.int64Opt(tagProfile_DurationNanos, int64(p.Duration))
+	b.pbValueType(tagProfile_PeriodType, "space", "bytes")
+	b.pb.int64Opt(tagProfile_Period, int64(p.Rate))
+	if t := p.defaultSampleType(); t != "" {
+		b.pb.int64(tagProfile_DefaultSampleType, b.stringIndex(t))
+	}
+
+	b.pbMapping()
+
+	labels := p.labelKeys()
+	var locs []uint64
+	for i := range p.Records {
+		r := &p.Records[i]
+
+		locs = locs[:0]
+		for _, pc := range r.Stack() {
+			locs = append(locs, b.locationID(pc))
+		}
+		truncated := r.StackTruncated()
+		reclaim := p.Reclaim(r)
+		if truncated {
+			locs = append(locs, b.truncatedID())
+		}
+
+		objects, bytes := r.Objects, r.Bytes
+		if !p.scaled {
+			objects, bytes = scaleHeapSample(r.Objects, r.Bytes, int64(p.Rate))
+		}
+
+		start := b.pb.startMessage()
+		b.pb.uint64s(tagSample_Location, locs)
+		b.pb.int64s(tagSample_Value, []int64{objects, bytes})
+		if truncated {
+			label := b.pb.startMessage()
+			b.pb.int64(tagLabel_Key, b.stringIndex("stack"))
+			b.pb.int64(tagLabel_Str, b.stringIndex("truncated"))
+			b.pb.endMessage(tagSample_Label, label)
+		}
+		if reclaim != "" {
+			label := b.pb.startMessage()
+			b.pb.int64(tagLabel_Key, b.stringIndex("reclaim"))
+			b.pb.int64(tagLabel_Str, b.stringIndex(reclaim))
+			b.pb.endMessage(tagSample_Label, label)
+		}
+		for _, k := range labels {
+			label := b.pb.startMessage()
+			b.pb.int64(tagLabel_Key, b.stringIndex(k))
+			b.pb.int64(tagLabel_Str, b.stringIndex(p.Labels[k]))
+			b.pb.endMessage(tagSample_Label, label)
+		}
+		b.pb.endMessage(tagProfile_Sample, start)
+		b.flush(false)
+	}
+
+	for _, burst := range p.Bursts {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(p.burstComment(burst)))
+	}
+	for i := range p.Overshoots {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(p.overshootComment(&p.Overshoots[i])))
+	}
+	if q, ok := p.CycleQuantiles(); ok {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(q.marker()))
+	}
+	if p.TraceID != "" {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(traceComment+p.TraceID))
+	}
+	if p.Build != "" {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(buildComment+p.Build))
+	}
+	if p.Truncated {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(truncatedComment))
+	}
+	if p.Degraded {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(degradedComment))
+	}
+	if p.perSecond {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(perSecondComment))
+	}
+	if p.baselined {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(baselineComment))
+	}
+	if p.Stride > 0 {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(p.strideMarker()))
+	}
+	if n, _ := p.TruncatedStacks(); n > 0 {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(truncatedStacksComment+strconv.Itoa(n)))
+	}
+	for _, w := range p.Windows {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(w.mergedMarker()))
+	}
+	if note := p.emptyNote(); note != "" {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(note))
+	}
+	if note := p.accuracyNote(); note != "" {
+		b.pb.int64(tagProfile_Comment, b.stringIndex(note))
+	}
+
+	b.flush(true)
+	return b.err
+}
+
+// stringIndex adds s to the string table if not already present and returns
+// the index of s in the string table.
+func (b *profileBuilder) stringIndex(s string) int64 {
+	id, ok := b.stringMap[s]
+	if !ok {
+		id = b.nstrings + len(b.strings)
+		b.strings = append(b.strings, s)
+		b.stringMap[s] = id
+	}
+	return int64(id)
+}
+
+func (b *profileBuilder) pbValueType(tag int, typ, unit string) {
+	start := b.pb.startMessage()
+	b.pb.int64(tagValueType_Type, b.stringIndex(typ))
+	b.pb.int64(tagValueType_Unit, b.stringIndex(unit))
+	b.pb.endMessage(tag, start)
+}
+
+// pbMapping writes the single mapping shared by every location: the running
+// executable, already symbolized. The executable of a parsed profile is
+// unknown.
+func (b *profileBuilder) pbMapping() {
+	var file string
+	if b.frames == nil {
+		file, _ = os.Executable()
+	}
+
+	start := b.pb.startMessage()
+	b.pb.uint64Opt(tagMapping_ID, 1)
+	b.pb.int64Opt(tagMapping_Filename, b.stringIndex(file))
+	b.pb.bool(tagMapping_HasFunctions, true)
+	b.pb.bool(tagMapping_HasFilenames, true)
+	b.pb.bool(tagMapping_HasLineNumbers, true)
+	b.pb.bool(tagMapping_HasInlineFrames, true)
+	b.pb.endMessage(tagProfile_Mapping, start)
+}
+
+// locationID returns the ID of the location for pc, writing the location and
+// any new functions if it has not been seen before.
+func (b *profileBuilder) locationID(pc uintptr) uint64 {
+	if id, ok := b.locs[pc]; ok {
+		return id
+	}
+
+	type line struct {
+		funcID uint64
+		line   int64
+	}
+	var lines []line
+
+	frames := b.frames[pc]
+	if b.frames == nil {
+		frames = symbolize(pc)
+	}
+	for _, fr := range frames {
+		lines = append(lines, line{
+			funcID: b.functionID(fr.Function, fr.File),
+			line:   int64(fr.Line),
+		})
+	}
+
+	id := uint64(len(b.locs)) + 1
+	b.locs[pc] = id
+
+	start := b.pb.startMessage()
+	b.pb.uint64Opt(tagLocation_ID, id)
+	b.pb.uint64Opt(tagLocation_MappingID, 1)
+	b.pb.uint64Opt(tagLocation_Address, uint64(pc))
+	for _, ln := range lines {
+		start := b.pb.startMessage()
+		b.pb.uint64Opt(tagLine_FunctionID, ln.funcID)
+		b.pb.int64Opt(tagLine_Line, ln.line)
+		b.pb.endMessage(tagLocation_Line, start)
+	}
+	b.pb.endMessage(tagProfile_Location, start)
+	return id
+}
+
+// truncatedID returns the ID of the synthetic root location of the stacks
+// truncated at the depth of the memory profile, writing it if it has not been
+// seen before. It has no address, so it takes the place of pc 0.
+func (b *profileBuilder) truncatedID() uint64 {
+	if id, ok := b.locs[0]; ok {
+		return id
+	}
+
+	funcID := b.functionID(truncatedFrame, "")
+	id := uint64(len(b.locs)) + 1
+	b.locs[0] = id
+
+	start := b.pb.startMessage()
+	b.pb.uint64Opt(tagLocation_ID, id)
+	b.pb.uint64Opt(tagLocation_MappingID, 1)
+	line := b.pb.startMessage()
+	b.pb.uint64Opt(tagLine_FunctionID, funcID)
+	b.pb.endMessage(tagLocation_Line, line)
+	b.pb.endMessage(tagProfile_Location, start)
+	return id
+}
+
+// symbolize returns the frames of the running binary at pc, innermost first,
+// expanding inlined calls.
+func symbolize(pc uintptr) []Frame {
+	var frames []Frame
+	fs := runtime.CallersFrames([]uintptr{pc})
+	for {
+		f, more := fs.Next()
+		if f.Function != "" {
+			frames = append(frames, Frame{Function: f.Function, File: f.File, Line: f.Line})
+		}
+		if !more {
+			break
+		}
+	}
+	return frames
+}
+
+// functionID returns the ID of the named function, writing the function if it
+// has not been seen before.
+func (b *profileBuilder) functionID(name, file string) uint64 {
+	if id, ok := b.funcs[name]; ok {
+		return id
+	}
+
+	id := uint64(len(b.funcs)) + 1
+	b.funcs[name] = id
+
+	start := b.pb.startMessage()
+	b.pb.uint64Opt(tagFunction_ID, id)
+	b.pb.int64Opt(tagFunction_Name, b.stringIndex(name))
+	b.pb.int64Opt(tagFunction_SystemName, b.stringIndex(name))
+	b.pb.int64Opt(tagFunction_Filename, b.stringIndex(file))
+	b.pb.endMessage(tagProfile_Function, start)
+	return id
+}
+
+// scaleHeapSample adjusts the data from a heap Sample to account for its
+// probability of appearing in the collected data. Heap profiles are a sampling
+// of the memory allocations requests in a program; each object is sampled with
+// a probability that depends on its size and the sampling rate.
+func scaleHeapSample(count, size, rate int64) (int64, int64) {
+	if count == 0 || size == 0 {
+		return 0, 0
+	}
+
+	if rate <= 1 {
+		// if rate==1 all samples were collected so no adjustment is needed.
+		// if rate<1 treat as unknown and skip scaling.
+		return count, size
+	}
+
+	avgSize := float64(size) / float64(count)
+	scale := 1 / (1 - math.Exp(-avgSize/float64(rate)))
+
+	return int64(float64(count) * scale), int64(float64(size) * scale)
+}
@@ -0,0 +1,38 @@
+// Package proto converts garbage profiles to and from the profile.Profile of
+// github.com/google/pprof, to merge, filter or analyze them with the pprof
+// libraries:
+//
+//	pp, err := proto.Convert(garbage.Collect(30 * time.Second))
+//	...
+//	pp = pp.Compact()
+//
+// The garbage package encodes its profiles itself; this package is separate
+// so that programs serving or pushing them do not link the pprof libraries.
+package proto
+
+import (
+	"bytes"
+
+	garbage "github.com/benburkert/pprof-garbage"
+	"github.com/google/pprof/profile"
+)
+
+// Convert returns p as a pprof profile. Its samples, locations and metadata
+// are those of the protocol buffer the handler serves.
+func Convert(p *garbage.Profile) (*profile.Profile, error) {
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return profile.Parse(&buf)
+}
+
+// Profile returns the garbage profile of pp, such as one converted by Convert
+// and then filtered, as garbage.Parse decodes it.
+func Profile(pp *profile.Profile) (*garbage.Profile, error) {
+	var buf bytes.Buffer
+	if err := pp.Write(&buf); err != nil {
+		return nil, err
+	}
+	return garbage.Parse(&buf)
+}
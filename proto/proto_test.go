@@ -0,0 +1,47 @@
+package proto
+
+import (
+	"testing"
+	"time"
+
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+func TestConvert(t *testing.T) {
+	p := &garbage.Profile{
+		Rate:     1,
+		Start:    time.Unix(1700000000, 0),
+		Duration: 10 * time.Second,
+		Records: []garbage.Record{
+			{Objects: 2, Bytes: 64, Stack0: [32]uintptr{0x1}},
+			{Objects: 1, Bytes: 8, Stack0: [32]uintptr{0x2}},
+		},
+	}
+
+	pp, err := Convert(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pp.CheckValid(); err != nil {
+		t.Fatal(err)
+	}
+	if len(pp.Sample) != 2 {
+		t.Fatalf("want 2 samples, got %d", len(pp.Sample))
+	}
+	if pp.TimeNanos != p.Start.UnixNano() || pp.DurationNanos != int64(p.Duration) {
+		t.Errorf("want the window of the profile, got %d for %d", pp.TimeNanos, pp.DurationNanos)
+	}
+
+	got, err := Profile(pp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var objects, bytes int64
+	for _, r := range got.Records {
+		objects += r.Objects
+		bytes += r.Bytes
+	}
+	if len(got.Records) != 2 || objects != 3 || bytes != 72 {
+		t.Errorf("want 2 records of 3 objects and 72 bytes, got %d of %d and %d", len(got.Records), objects, bytes)
+	}
+}
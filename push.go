@@ -0,0 +1,468 @@
+package garbage
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A PushFormat is the protocol a Pusher pushes profiles with.
+type PushFormat int
+
+const (
+	// PushPprof POSTs each profile as the body of the request, a
+	// gzip-compressed protocol buffer.
+	PushPprof PushFormat = iota
+
+	// PushPyroscope POSTs each profile to the ingest endpoint of a
+	// Pyroscope server, such as "https://pyroscope.example.com/ingest",
+	// as the profile field of a multipart form. The application is named
+	// by the Name of the pusher and the kind and labels of the profile,
+	// such as "api.garbage{env=prod}".
+	PushPyroscope
+
+	// PushParca POSTs each profile to the WriteRaw endpoint of the HTTP
+	// API of a Parca server, such as
+	// "https://parca.example.com/profiles/writeraw", labeled with the kind
+	// of the profile as __name__, the Name of the pusher as job, and the
+	// labels of the profile.
+	PushParca
+)
+
+// A Sink stores profiles pushed by a Pusher, such as in a bucket of a cloud
+// store. Sinks that need other modules are in subpackages of sinks, such as
+// sinks/s3.
+type Sink interface {
+	// Push stores a profile encoded as by Profile.WriteTo.
+	Push(ctx context.Context, body []byte) error
+}
+
+// A Pusher collects profiles back to back and pushes each to an HTTP
+// endpoint, or to a Sink, for continuous profiling without a scraper. Each profile is the
+// body of a POST request, a gzip-compressed protocol buffer. For example, to
+// push a profile of every minute:
+//
+//	p := &garbage.Pusher{
+//		URL:     "https://profiles.example.com/ingest",
+//		Options: garbage.Options{Duration: 30 * time.Second},
+//	}
+//	go p.Run(ctx)
+//
+// Endpoints on zero-trust networks can require the client certificates in
+// Certificates and be verified against the CA pool in RootCAs, whatever the
+// Format.
+type Pusher struct {
+	// URL is the endpoint profiles are POSTed to.
+	URL string
+
+	// Format is the protocol of the endpoint. The zero value POSTs each
+	// profile as it is.
+	Format PushFormat
+
+	// Name names the application profiled to Pyroscope and Parca. Empty
+	// means the base name of the program.
+	Name string
+
+	// Sink, if set, stores the profiles in place of the endpoint, and URL,
+	// Format and the fields of the HTTP client are ignored.
+	Sink Sink
+
+	// Options configure the collection of each profile. Like Collect, a
+	// collection runs twice as long as Options.Duration.
+	Options Options
+
+	// Header holds additional request headers, such as credentials.
+	Header http.Header
+
+	// Certificates are the client certificates presented to the endpoint,
+	// for mutual TLS.
+	Certificates []tls.Certificate
+
+	// RootCAs is the pool of CAs the endpoint's certificate is verified
+	// against. Nil means the host's root CAs.
+	RootCAs *x509.CertPool
+
+	// SpoolDir, if set, is the directory of a bounded on-disk queue of the
+	// profiles that failed to push. Run retries the queue, oldest first,
+	// with exponential backoff, so transient network failures do not lose
+	// profiles. Without a SpoolDir, a profile that fails to push is dropped.
+	SpoolDir string
+
+	// SpoolSize bounds the bytes of profiles in SpoolDir: the oldest are
+	// dropped to make room for new ones. Zero means 64 MiB.
+	SpoolSize int64
+
+	// MaxBackoff bounds the delay between retries of the queue, which
+	// starts at one second and doubles with each failure. Zero means five
+	// minutes.
+	MaxBackoff time.Duration
+
+	// Parallelism is the number of spooled profiles uploaded at once when
+	// the endpoint is reachable again. The queue is uploaded in batches of
+	// its oldest profiles: a batch starts once every profile of the batch
+	// before it has been pushed, so profiles are never pushed ahead of
+	// those more than a batch older. Zero means 1, which pushes them in
+	// order.
+	Parallelism int
+
+	// Client sends the requests. Nil means a client using Certificates and
+	// RootCAs; a Client of its own ignores them.
+	Client *http.Client
+
+	// OnError, if set, is called with the error of each profile Run fails
+	// to collect, encode, push or spool, including each failed retry of the
+	// spool. It may be called concurrently.
+	OnError func(error)
+
+	once   sync.Once
+	client *http.Client
+	spool  *spool
+
+	pushed, failed uint64 // atomic
+}
+
+// PushStats are the statistics of a Pusher.
+type PushStats struct {
+	Pushed      uint64 // profiles pushed
+	Failed      uint64 // failed attempts to push a profile
+	Queued      int    // profiles spooled awaiting retry
+	QueuedBytes int64  // size of the spooled profiles
+}
+
+// Stats returns the statistics of the pusher, including the depth of its
+// queue.
+func (p *Pusher) Stats() PushStats {
+	s := PushStats{
+		Pushed: atomic.LoadUint64(&p.pushed),
+		Failed: atomic.LoadUint64(&p.failed),
+	}
+	p.once.Do(p.init)
+	if p.spool != nil {
+		s.Queued, s.QueuedBytes = p.spool.len()
+	}
+	return s
+}
+
+const (
+	minPushBackoff     = time.Second
+	defaultPushBackoff = 5 * time.Minute
+)
+
+// Run collects and pushes profiles until ctx is done, returning ctx.Err(). A
+// profile that fails to push is reported to OnError and spooled to SpoolDir,
+// if set, or dropped. A collection that fails, such as one aborted over
+// Options.MaxOverhead, is reported to OnError and the next one started.
+func (p *Pusher) Run(ctx context.Context) error {
+	if !enabled {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if p.SpoolDir != "" {
+		p.once.Do(p.init)
+		go p.retry(ctx)
+	}
+
+	c := NewCollector(p.Options)
+	for {
+		prof, err := c.Collect(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			// Such as an *OverheadError: the next collection may not
+			// exceed the limit.
+			p.fail(ctx, err)
+			if prof == nil {
+				// The options cannot collect a profile at all.
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			continue
+		}
+
+		var buf bytes.Buffer
+		if _, err := prof.WriteTo(&buf); err != nil {
+			p.fail(ctx, err)
+			continue
+		}
+		if p.spool != nil {
+			if n, _ := p.spool.len(); n > 0 {
+				// Queue behind the spooled profiles, to push in order.
+				p.queue(ctx, buf.Bytes())
+				continue
+			}
+		}
+		if err := p.post(ctx, buf.Bytes()); err != nil {
+			p.fail(ctx, err)
+			if p.spool != nil && ctx.Err() == nil {
+				p.queue(ctx, buf.Bytes())
+			}
+		}
+	}
+}
+
+// queue spools an encoded profile, reporting the failure to OnError.
+func (p *Pusher) queue(ctx context.Context, body []byte) {
+	if err := p.spool.put(body); err != nil {
+		p.fail(ctx, fmt.Errorf("garbage: spool profile: %w", err))
+	}
+}
+
+// fail reports the failure of a push to OnError, unless ctx is done.
+func (p *Pusher) fail(ctx context.Context, err error) {
+	if p.OnError != nil && ctx.Err() == nil {
+		p.OnError(err)
+	}
+}
+
+// retry pushes the spooled profiles in batches of the oldest, Parallelism at
+// a time, until ctx is done. After a batch with a failure it backs off
+// exponentially, up to MaxBackoff, and retries the failed profiles first.
+func (p *Pusher) retry(ctx context.Context) {
+	parallelism := p.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultPushBackoff
+	}
+	backoff := minPushBackoff
+
+	for {
+		batch := p.spool.peek(parallelism)
+		if len(batch) == 0 {
+			select {
+			case <-p.spool.ready:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		var wg sync.WaitGroup
+		var failed int32
+		for _, sp := range batch {
+			wg.Add(1)
+			go func(sp spooled) {
+				defer wg.Done()
+				if err := p.post(ctx, sp.body); err != nil {
+					atomic.StoreInt32(&failed, 1)
+					p.fail(ctx, err)
+					return
+				}
+				p.spool.remove(sp.name)
+			}(sp)
+		}
+		wg.Wait()
+
+		if atomic.LoadInt32(&failed) == 0 {
+			backoff = minPushBackoff
+			continue
+		}
+		if !sleep(backoff, ctx.Done()) {
+			return
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Push pushes a single profile.
+func (p *Pusher) Push(ctx context.Context, prof *Profile) error {
+	var buf bytes.Buffer
+	if _, err := prof.WriteTo(&buf); err != nil {
+		return err
+	}
+	return p.post(ctx, buf.Bytes())
+}
+
+// PushEncoded pushes a profile already encoded as by Profile.WriteTo, such as
+// one read from the endpoint of another process.
+func (p *Pusher) PushEncoded(ctx context.Context, body []byte) error {
+	return p.post(ctx, body)
+}
+
+// post POSTs an encoded profile to the endpoint, or stores it in the Sink.
+func (p *Pusher) post(ctx context.Context, body []byte) error {
+	if p.Sink != nil {
+		if err := p.Sink.Push(ctx, body); err != nil {
+			atomic.AddUint64(&p.failed, 1)
+			return err
+		}
+		atomic.AddUint64(&p.pushed, 1)
+		return nil
+	}
+
+	req, err := p.request(ctx, body)
+	if err != nil {
+		atomic.AddUint64(&p.failed, 1)
+		return err
+	}
+
+	res, err := p.httpClient().Do(req)
+	if err != nil {
+		atomic.AddUint64(&p.failed, 1)
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		atomic.AddUint64(&p.failed, 1)
+		return fmt.Errorf("garbage: push to %s: %s", p.URL, res.Status)
+	}
+	atomic.AddUint64(&p.pushed, 1)
+	return nil
+}
+
+// request returns the request pushing an encoded profile in the format of the
+// endpoint.
+func (p *Pusher) request(ctx context.Context, body []byte) (*http.Request, error) {
+	target, contentType := p.URL, "application/octet-stream"
+	if p.Format == PushPyroscope || p.Format == PushParca {
+		prof, err := Parse(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if p.Format == PushPyroscope {
+			target, body, contentType, err = p.pyroscope(prof, body)
+		} else {
+			body, err = p.parca(prof, body)
+			contentType = "application/json"
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range p.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
+
+// name returns the name of the application profiled.
+func (p *Pusher) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// pyroscope returns the URL, body and content type of the Pyroscope ingest
+// request of the profile prof, encoded as body.
+func (p *Pusher) pyroscope(prof *Profile, body []byte) (string, []byte, string, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	var labels []string
+	for k, v := range prof.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	end := prof.Start.Add(prof.Duration)
+	if prof.Start.IsZero() {
+		end = time.Now()
+	}
+
+	q := u.Query()
+	q.Set("name", p.name()+"."+prof.kind()+"{"+strings.Join(labels, ",")+"}")
+	q.Set("from", strconv.FormatInt(prof.Start.Unix(), 10))
+	q.Set("until", strconv.FormatInt(end.Unix(), 10))
+	q.Set("format", "pprof")
+	q.Set("spyName", "gospy")
+	u.RawQuery = q.Encode()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("profile", "profile.pb.gz")
+	if err == nil {
+		_, err = fw.Write(body)
+	}
+	if err == nil {
+		err = mw.Close()
+	}
+	return u.String(), buf.Bytes(), mw.FormDataContentType(), err
+}
+
+// parca returns the body of the Parca WriteRaw request of the profile prof,
+// encoded as body.
+func (p *Pusher) parca(prof *Profile, body []byte) ([]byte, error) {
+	type label struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	labels := []label{{"__name__", prof.kind()}, {"job", p.name()}}
+	var keys []string
+	for k := range prof.Labels {
+		if k != "__name__" && k != "job" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		labels = append(labels, label{k, prof.Labels[k]})
+	}
+
+	type sample struct {
+		RawProfile []byte `json:"raw_profile"`
+	}
+	type series struct {
+		Labels struct {
+			Labels []label `json:"labels"`
+		} `json:"labels"`
+		Samples []sample `json:"samples"`
+	}
+	s := series{Samples: []sample{{body}}}
+	s.Labels.Labels = labels
+	return json.Marshal(struct {
+		Series []series `json:"series"`
+	}{[]series{s}})
+}
+
+func (p *Pusher) httpClient() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+
+	p.once.Do(p.init)
+	return p.client
+}
+
+func (p *Pusher) init() {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		Certificates: p.Certificates,
+		RootCAs:      p.RootCAs,
+	}
+	p.client = &http.Client{Transport: transport}
+
+	if p.SpoolDir != "" {
+		p.spool = newSpool(p.SpoolDir, p.SpoolSize)
+	}
+}
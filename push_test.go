@@ -0,0 +1,251 @@
+package garbage
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClientCert returns a self-signed client certificate.
+func testClientCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pusher"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestPusherMutualTLS(t *testing.T) {
+	var body []byte
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "pusher" {
+			http.Error(w, "no client certificate", http.StatusForbidden)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	prof := &Profile{Rate: 1, Records: []Record{{Objects: 1, Bytes: 8, Stack0: [32]uintptr{0x1}}}}
+
+	p := &Pusher{URL: srv.URL, RootCAs: roots, Certificates: []tls.Certificate{testClientCert(t)}}
+	if err := p.Push(context.Background(), prof); err != nil {
+		t.Fatal(err)
+	}
+	if len(body) < 2 || body[0] != 0x1f || body[1] != 0x8b {
+		t.Errorf("pushed body is not gzip-compressed: % x", body)
+	}
+
+	p = &Pusher{URL: srv.URL, RootCAs: roots}
+	if err := p.Push(context.Background(), prof); err == nil {
+		t.Error("push without a client certificate: want error")
+	}
+}
+
+func TestPusherPyroscope(t *testing.T) {
+	var query map[string][]string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		f, _, err := r.FormFile("profile")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, _ = io.ReadAll(f)
+	}))
+	defer srv.Close()
+
+	start := time.Unix(1700000000, 0)
+	prof := &Profile{
+		Rate:     1,
+		Start:    start,
+		Duration: 10 * time.Second,
+		Labels:   map[string]string{"env": "prod", "az": "a"},
+		Records:  []Record{{Objects: 1, Bytes: 8, Stack0: [32]uintptr{0x1}}},
+	}
+
+	p := &Pusher{URL: srv.URL + "/ingest", Format: PushPyroscope, Name: "api"}
+	if err := p.Push(context.Background(), prof); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"name":    "api.garbage{az=a,env=prod}",
+		"from":    "1700000000",
+		"until":   "1700000010",
+		"format":  "pprof",
+		"spyName": "gospy",
+	}
+	for k, v := range want {
+		if got := query[k]; len(got) != 1 || got[0] != v {
+			t.Errorf("%s: want %q, got %q", k, v, got)
+		}
+	}
+	if _, err := Parse(bytes.NewReader(body)); err != nil {
+		t.Errorf("pushed profile: %v", err)
+	}
+}
+
+func TestPusherParca(t *testing.T) {
+	var req struct {
+		Series []struct {
+			Labels struct {
+				Labels []struct{ Name, Value string }
+			}
+			Samples []struct {
+				RawProfile []byte `json:"raw_profile"`
+			}
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			http.Error(w, ct, http.StatusUnsupportedMediaType)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	prof := &Profile{
+		Kind:    "growth",
+		Rate:    1,
+		Labels:  map[string]string{"env": "prod"},
+		Records: []Record{{Objects: 1, Bytes: 8, Stack0: [32]uintptr{0x1}}},
+	}
+
+	p := &Pusher{URL: srv.URL + "/profiles/writeraw", Format: PushParca, Name: "api"}
+	if err := p.Push(context.Background(), prof); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Series) != 1 || len(req.Series[0].Samples) != 1 {
+		t.Fatalf("want 1 series of 1 sample, got %+v", req)
+	}
+	var labels []string
+	for _, l := range req.Series[0].Labels.Labels {
+		labels = append(labels, l.Name+"="+l.Value)
+	}
+	if got, want := strings.Join(labels, ","), "__name__=growth,job=api,env=prod"; got != want {
+		t.Errorf("labels: want %s, got %s", want, got)
+	}
+	got, err := Parse(bytes.NewReader(req.Series[0].Samples[0].RawProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Kind != "growth" || len(got.Records) != 1 {
+		t.Errorf("pushed profile: want 1 growth record, got %q with %d", got.Kind, len(got.Records))
+	}
+}
+
+type sinkFunc func(ctx context.Context, body []byte) error
+
+func (f sinkFunc) Push(ctx context.Context, body []byte) error { return f(ctx, body) }
+
+func TestPusherSink(t *testing.T) {
+	var stored []byte
+	p := &Pusher{Sink: sinkFunc(func(ctx context.Context, body []byte) error {
+		if stored != nil {
+			return errors.New("full")
+		}
+		stored = body
+		return nil
+	})}
+
+	prof := &Profile{Rate: 1, Records: []Record{{Objects: 1, Bytes: 8, Stack0: [32]uintptr{0x1}}}}
+	if err := p.Push(context.Background(), prof); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Parse(bytes.NewReader(stored)); err != nil || len(got.Records) != 1 {
+		t.Errorf("want the profile stored, got %v", err)
+	}
+	if err := p.Push(context.Background(), prof); err == nil {
+		t.Error("want the error of the sink")
+	}
+	if s := p.Stats(); s.Pushed != 1 || s.Failed != 1 {
+		t.Errorf("stats: want 1 pushed and 1 failed, got %+v", s)
+	}
+}
+
+func TestPusherRunOverhead(t *testing.T) {
+	requireEnabled(t)
+
+	if testing.Short() {
+		t.Skip("collects for a few seconds")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				heapSink = make([]byte, 4096)
+			}
+		}
+	}()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	errs := make(chan error, 8)
+	p := &Pusher{
+		URL:     srv.URL,
+		Options: Options{Duration: 200 * time.Millisecond, MaxOverhead: 1e-9},
+		OnError: func(err error) { errs <- err },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	// Run keeps collecting after a collection is aborted.
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if _, ok := err.(*OverheadError); !ok {
+				t.Fatalf("want an *OverheadError, got %v", err)
+			}
+		case err := <-done:
+			t.Fatalf("Run returned %v", err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("overhead not reported")
+		}
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("want context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package garbage
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// quantileStacks is the number of stacks whose garbage per cycle is
+// summarized.
+const quantileStacks = 5
+
+// quantilesComment prefixes the quantiles of the garbage per cycle in the
+// comments of the protocol buffer format.
+const quantilesComment = "cycle_quantiles: "
+
+// Quantiles summarize the distribution of the garbage bytes of the GC cycles
+// of a window: a producer of steady garbage has quantiles close together,
+// and a spiky one a P99 far above its P50.
+type Quantiles struct {
+	P50, P90, P99 int64
+}
+
+// A StackQuantiles summarizes the garbage per GC cycle of an allocation
+// stack.
+type StackQuantiles struct {
+	Quantiles
+	Stack0 [32]uintptr // stack trace; ends at first 0 entry
+}
+
+// Stack returns the stack trace of the quantiles.
+func (q *StackQuantiles) Stack() []uintptr {
+	for i, v := range q.Stack0 {
+		if v == 0 {
+			return q.Stack0[:i]
+		}
+	}
+	return q.Stack0[:]
+}
+
+// CycleQuantiles returns the quantiles of the garbage bytes per GC cycle over
+// the window, or false if no cycles were observed.
+func (p *Profile) CycleQuantiles() (Quantiles, bool) {
+	if len(p.Cycles) == 0 {
+		return Quantiles{}, false
+	}
+	bytes := make([]int64, len(p.Cycles))
+	for i, c := range p.Cycles {
+		bytes[i] = c.Bytes
+	}
+	return quantiles(bytes), true
+}
+
+// findStackQuantiles summarizes the garbage per cycle of the stacks of a
+// collected profile with the most garbage, from the largest stacks of each
+// cycle kept for bursts. A stack that was not among the largest of a cycle
+// counts as producing no garbage in it.
+func (p *Profile) findStackQuantiles() []StackQuantiles {
+	if p.kind() != garbageKind || len(p.tops) == 0 || len(p.tops) != len(p.Cycles) {
+		return nil
+	}
+
+	top := topRecords(p.Records, quantileStacks)
+	var sq []StackQuantiles
+	for _, r := range top {
+		bytes := make([]int64, len(p.tops))
+		for i, recs := range p.tops {
+			for _, t := range recs {
+				if t.Stack0 == r.Stack0 {
+					bytes[i] = t.Bytes
+					break
+				}
+			}
+		}
+		sq = append(sq, StackQuantiles{Quantiles: quantiles(bytes), Stack0: r.Stack0})
+	}
+	return sq
+}
+
+// quantiles returns the quantiles of values by the nearest rank. It sorts
+// values.
+func quantiles(values []int64) Quantiles {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	rank := func(q float64) int64 {
+		i := int(q*float64(len(values))+0.5) - 1
+		if i < 0 {
+			i = 0
+		}
+		if i >= len(values) {
+			i = len(values) - 1
+		}
+		return values[i]
+	}
+	return Quantiles{P50: rank(0.5), P90: rank(0.9), P99: rank(0.99)}
+}
+
+// marker returns the comment of the quantiles in the protocol buffer format.
+func (q Quantiles) marker() string {
+	return fmt.Sprintf("%sp50=%d p90=%d p99=%d", quantilesComment, q.P50, q.P90, q.P99)
+}
+
+// printQuantiles prints the quantiles of the garbage per cycle, overall and
+// of the stacks with the most garbage, as a comment section of the legacy
+// text format.
+func (p *Profile) printQuantiles(w io.Writer, overall Quantiles) {
+	fmt.Fprintf(w, "\n# garbage bytes per GC cycle: p50: p90: p99\n")
+	fmt.Fprintf(w, "# %d: %d: %d @ all\n", overall.P50, overall.P90, overall.P99)
+	for i := range p.StackQuantiles {
+		q := &p.StackQuantiles[i]
+		fmt.Fprintf(w, "# %d: %d: %d @", q.P50, q.P90, q.P99)
+		for _, pc := range q.Stack() {
+			fmt.Fprintf(w, " %#x", pc)
+		}
+		fmt.Fprintf(w, "\n")
+		p.printStack(w, q.Stack())
+	}
+}
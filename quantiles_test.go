@@ -0,0 +1,66 @@
+package garbage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuantiles(t *testing.T) {
+	// Stack 1 allocates steadily, and stack 2 in one cycle of ten.
+	p := &Profile{Start: time.Unix(1700000000, 0), Duration: 10 * time.Second}
+	for i := 0; i < 10; i++ {
+		top := []Record{testRecord(1, 62, 1000)}
+		if i == 7 {
+			top = append(top, testRecord(2, 1250, 20000))
+		}
+		var c Cycle
+		for _, r := range top {
+			c.Bytes += r.Bytes
+			p.Records = merge(p.Records, r)
+		}
+		p.Cycles = append(p.Cycles, c)
+		p.tops = append(p.tops, top)
+	}
+
+	q, ok := p.CycleQuantiles()
+	if !ok || q != (Quantiles{P50: 1000, P90: 1000, P99: 21000}) {
+		t.Errorf("overall: got %+v, %v", q, ok)
+	}
+
+	p.StackQuantiles = p.findStackQuantiles()
+	want := map[uintptr]Quantiles{
+		1: {P50: 1000, P90: 1000, P99: 1000},
+		2: {P50: 0, P90: 0, P99: 20000},
+	}
+	if len(p.StackQuantiles) != len(want) {
+		t.Fatalf("want %d stacks, got %+v", len(want), p.StackQuantiles)
+	}
+	for _, sq := range p.StackQuantiles {
+		if w := want[sq.Stack0[0]]; sq.Quantiles != w {
+			t.Errorf("stack %d: want %+v, got %+v", sq.Stack0[0], w, sq.Quantiles)
+		}
+	}
+	if p.StackQuantiles[0].Stack0[0] != 2 {
+		t.Errorf("want the stack with the most garbage first, got %+v", p.StackQuantiles)
+	}
+
+	var buf bytes.Buffer
+	if err := p.writeText(&buf, textOptions{debug: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"# 1000: 1000: 21000 @ all", "# 0: 0: 20000 @ 0x2"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("%q missing from text:\n%s", line, buf.String())
+		}
+	}
+	if m := q.marker(); m != "cycle_quantiles: p50=1000 p90=1000 p99=21000" {
+		t.Errorf("bad marker %q", m)
+	}
+
+	// Quantiles of no cycles are not reported.
+	if _, ok := (&Profile{}).CycleQuantiles(); ok {
+		t.Errorf("want no quantiles without cycles")
+	}
+}
@@ -0,0 +1,99 @@
+package garbage
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A RateLimiter limits how often each client may start a collection, using a
+// token bucket per client. For example, to allow one collection every five
+// minutes per client:
+//
+//	h := &garbage.Handler{RateLimit: &garbage.RateLimiter{Every: 5 * time.Minute}}
+type RateLimiter struct {
+	// Every is the interval at which each client's bucket gains a token.
+	Every time.Duration
+
+	// Burst is the number of tokens a bucket holds. Zero means 1.
+	Burst int
+
+	// Key identifies the client of a request. If nil, clients are identified
+	// by the host of the request's RemoteAddr.
+	Key func(*http.Request) string
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	now func() time.Time // for testing
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Allow reports whether the client of r may start a collection now, taking a
+// token from its bucket if so. Otherwise it returns how long until a token is
+// available.
+func (l *RateLimiter) Allow(r *http.Request) (bool, time.Duration) {
+	if l.Every <= 0 {
+		return true, 0
+	}
+
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	now := time.Now()
+	if l.now != nil {
+		now = l.now()
+	}
+	key := l.key(r)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+
+	// Drop the buckets that have refilled; they are the same as new ones.
+	for k, b := range l.buckets {
+		if k != key && b.tokens+float64(now.Sub(b.last))/float64(l.Every) >= burst {
+			delete(l.buckets, k)
+		}
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += float64(now.Sub(b.last)) / float64(l.Every)
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(l.Every))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *RateLimiter) key(r *http.Request) string {
+	if l.Key != nil {
+		return l.Key(r)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
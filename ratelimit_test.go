@@ -0,0 +1,70 @@
+package garbage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1470000000, 0)
+	l := &RateLimiter{
+		Every: time.Minute,
+		Burst: 2,
+		now:   func() time.Time { return now },
+	}
+
+	req := func(addr string) *http.Request {
+		r := httptest.NewRequest("GET", "/debug/pprof/garbage", nil)
+		r.RemoteAddr = addr
+		return r
+	}
+
+	tests := []struct {
+		advance time.Duration
+		addr    string
+		ok      bool
+		wait    time.Duration
+	}{
+		{0, "192.0.2.1:1000", true, 0},
+		{0, "192.0.2.1:1001", true, 0},
+		{0, "192.0.2.1:1002", false, time.Minute},
+		{0, "192.0.2.2:1000", true, 0},
+		{30 * time.Second, "192.0.2.1:1003", false, 30 * time.Second},
+		{30 * time.Second, "192.0.2.1:1004", true, 0},
+		{0, "192.0.2.1:1005", false, time.Minute},
+		{time.Hour, "192.0.2.1:1006", true, 0},
+		{0, "192.0.2.1:1007", true, 0},
+	}
+
+	for i, test := range tests {
+		now = now.Add(test.advance)
+
+		ok, wait := l.Allow(req(test.addr))
+		if ok != test.ok || wait != test.wait {
+			t.Errorf("%d: want (%t, %s), got (%t, %s)", i, test.ok, test.wait, ok, wait)
+		}
+	}
+
+	if n := len(l.buckets); n != 1 {
+		t.Errorf("want refilled buckets dropped, got %d buckets", n)
+	}
+}
+
+func TestHandlerRateLimit(t *testing.T) {
+	requireEnabled(t)
+
+	h := &Handler{RateLimit: &RateLimiter{Every: time.Hour}}
+	h.RateLimit.Allow(httptest.NewRequest("GET", "/debug/pprof/garbage", nil))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/garbage", nil))
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("want code %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("want Retry-After 3600, got %q", got)
+	}
+}
@@ -0,0 +1,80 @@
+package garbage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The memory profile counts as freed the memory of a Go arena when the arena
+// is freed, and the objects allocated by the runtime for weak pointers and
+// cleanups when the runtime reclaims them, neither of which is ordinary GC
+// garbage. The records of such stacks are labeled with how their memory was
+// reclaimed: in a section of the text form, by a reclaim label on their
+// samples in the protocol buffer form and by a field of their JSON lines.
+
+// The ways the garbage of a record can be reclaimed other than by the GC.
+const (
+	ReclaimArena   = "arena"   // freed with its arena.Arena
+	ReclaimWeak    = "weak"    // a weak pointer's handle, freed with its object
+	ReclaimCleanup = "cleanup" // allocated by a cleanup or finalizer
+)
+
+// reclaimFuncs are the prefixes of the functions whose allocations are
+// reclaimed other than by the GC, and how.
+var reclaimFuncs = []struct {
+	prefix, reclaim string
+}{
+	{"arena.", ReclaimArena},
+	{"runtime.arena_", ReclaimArena},
+	{"runtime.(*userArena).", ReclaimArena},
+	{"weak.Make", ReclaimWeak},
+	{"internal/weak.Make", ReclaimWeak},
+	{"runtime.getOrAddWeakHandle", ReclaimWeak},
+	{"runtime.AddCleanup", ReclaimCleanup},
+	{"runtime.SetFinalizer", ReclaimCleanup},
+}
+
+// Reclaim returns how the garbage of r, a record of the profile, was
+// reclaimed if not by the GC: ReclaimArena, ReclaimWeak or ReclaimCleanup.
+// It returns "" for ordinary garbage.
+func (p *Profile) Reclaim(r *Record) string {
+	return p.reclaim(r.Stack())
+}
+
+// reclaim returns how the allocations of stk are reclaimed if not by the GC.
+func (p *Profile) reclaim(stk []uintptr) string {
+	for _, pc := range stk {
+		for _, fr := range p.Frames(pc) {
+			for _, f := range reclaimFuncs {
+				if strings.HasPrefix(fr.Function, f.prefix) {
+					return f.reclaim
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// printReclaimed prints the records whose garbage was not reclaimed by the
+// GC as a comment section of the legacy text format, if there are any.
+func (p *Profile) printReclaimed(w io.Writer) {
+	header := false
+	for i := range p.Records {
+		r := &p.Records[i]
+		reclaim := p.Reclaim(r)
+		if reclaim == "" {
+			continue
+		}
+		if !header {
+			fmt.Fprintf(w, "\n# reclaimed outside the GC: how: objects: bytes\n")
+			header = true
+		}
+		fmt.Fprintf(w, "# %s: %d: %d @", reclaim, r.Objects, r.Bytes)
+		for _, pc := range r.Stack() {
+			fmt.Fprintf(w, " %#x", pc)
+		}
+		fmt.Fprintf(w, "\n")
+		p.printStack(w, r.Stack())
+	}
+}
@@ -0,0 +1,52 @@
+package garbage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReclaim(t *testing.T) {
+	stack := func(pcs ...uintptr) (stk [32]uintptr) {
+		copy(stk[:], pcs)
+		return stk
+	}
+	p := &Profile{
+		Records: []Record{
+			{Objects: 1, Bytes: 8 << 20, Cycles: 1, Stack0: stack(0x10, 0x20)},
+			{Objects: 4, Bytes: 32, Cycles: 1, Stack0: stack(0x30, 0x40, 0x20)},
+			{Objects: 2, Bytes: 128, Cycles: 1, Stack0: stack(0x50, 0x20)},
+		},
+		frames: map[uintptr][]Frame{
+			0x10: {{Function: "arena.(*Arena).New", File: "/go/src/arena/arena.go", Line: 60}},
+			0x20: {{Function: "main.main", File: "/src/main.go", Line: 9}},
+			0x30: {{Function: "runtime.getOrAddWeakHandle", File: "/go/src/runtime/mheap.go", Line: 2100}},
+			0x40: {{Function: "weak.Make[...]", File: "/go/src/weak/pointer.go", Line: 70}},
+			0x50: {{Function: "main.decode", File: "/src/main.go", Line: 20}},
+		},
+	}
+
+	for i, want := range []string{ReclaimArena, ReclaimWeak, ""} {
+		if got := p.Reclaim(&p.Records[i]); got != want {
+			t.Errorf("record %d: want reclaim %q, got %q", i, want, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	p.writeText(&buf, textOptions{debug: 1})
+	for _, want := range []string{"# arena: 1: 8388608 @ 0x10 0x20\n", "# weak: 4: 32 @ 0x30 0x40 0x20\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("missing %q:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "# : 2: 128") {
+		t.Errorf("ordinary garbage listed as reclaimed:\n%s", buf.String())
+	}
+
+	data := p.encode()
+	for _, s := range []string{"reclaim", ReclaimArena, ReclaimWeak} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("protocol buffer missing %q", s)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package garbage
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// A CycleDelta is the raw data of a single GC cycle, before it is aggregated
+// into a profile: the two reads of the memory profile a cycle apart and the
+// garbage computed from them.
+//
+// A CycleDelta is shared by every Recorder, and its Curr is the Prev of the
+// next cycle, so its slices must not be modified.
+type CycleDelta struct {
+	Cycle
+
+	// Prev and Curr are the reads of runtime.MemProfile at the start and
+	// end of the cycle.
+	Prev, Curr []runtime.MemProfileRecord
+
+	// Garbage is the garbage of each allocation stack in the cycle, the
+	// objects freed between Prev and Curr, with their estimated ages.
+	Garbage []Record
+}
+
+// Deltas returns the allocations and frees of each stack active in the
+// cycle.
+func (d *CycleDelta) Deltas() []Delta {
+	return windowDeltas(d.Prev, d.Curr)
+}
+
+// A Recorder hands the raw data of each GC cycle to a function, for
+// attribution logic of its own, such as weighting the garbage by allocation
+// size class. It shares the collector of the profiles, so recording does not
+// force extra GCs or reads of the memory profile.
+type Recorder struct {
+	// Interval is how often to check for a completed GC cycle. Cycles that
+	// complete within one interval are observed as one. Zero means one
+	// second.
+	Interval time.Duration
+
+	// Stride, if greater than one, reads the memory profile only every
+	// Stride GC cycles, as for Monitor.Stride.
+	Stride int
+
+	mu  sync.Mutex
+	sub *subscription
+}
+
+// Start starts the recorder, calling fn with each GC cycle observed until
+// Stop. The calls are made one at a time on the collector's goroutine, so a
+// slow fn delays the observation of later cycles. Start does nothing if the
+// recorder is already running.
+func (r *Recorder) Start(fn func(*CycleDelta)) {
+	if !enabled {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sub != nil {
+		return
+	}
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultMonitorInterval
+	}
+	// The collector polls at a tenth of the shortest subscription period.
+	r.sub = shared.watch(10*interval, r.Stride, fn)
+}
+
+// Stop stops the recorder. After Stop returns, fn is called at most once
+// more, for a cycle already being observed.
+func (r *Recorder) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sub == nil {
+		return
+	}
+	shared.unsubscribe(r.sub)
+	r.sub = nil
+}
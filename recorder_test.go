@@ -0,0 +1,91 @@
+package garbage
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+var recorderSink []byte
+
+func TestRecorder(t *testing.T) {
+	requireEnabled(t)
+
+	deltas := make(chan *CycleDelta, 16)
+
+	r := &Recorder{Interval: 10 * time.Millisecond}
+	r.Start(func(d *CycleDelta) {
+		select {
+		case deltas <- d:
+		default:
+		}
+	})
+	defer r.Stop()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		for i := 0; i < 64; i++ {
+			recorderSink = make([]byte, 64<<10)
+		}
+		runtime.GC()
+
+		select {
+		case d := <-deltas:
+			if len(d.Curr) == 0 {
+				t.Fatal("empty read of the memory profile")
+			}
+			if len(d.Garbage) == 0 {
+				continue
+			}
+			var objects int64
+			for _, g := range d.Garbage {
+				objects += g.Objects
+			}
+			if objects != d.Objects {
+				t.Errorf("cycle reports %d objects, its garbage %d", d.Objects, objects)
+			}
+			if len(d.Deltas()) == 0 {
+				t.Error("no deltas for a cycle with garbage")
+			}
+			return
+		case <-timeout:
+			t.Fatal("recorder observed no GC cycle with garbage")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestRecorderStride(t *testing.T) {
+	requireEnabled(t)
+
+	deltas := make(chan *CycleDelta, 16)
+
+	r := &Recorder{Interval: 10 * time.Millisecond, Stride: 3}
+	r.Start(func(d *CycleDelta) {
+		select {
+		case deltas <- d:
+		default:
+		}
+	})
+	defer r.Stop()
+
+	var prev *CycleDelta
+	timeout := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+
+		select {
+		case d := <-deltas:
+			if prev != nil {
+				if n := d.NumGC - prev.NumGC; n < 3 {
+					t.Fatalf("read the memory profile %d GC cycles apart, want at least 3", n)
+				}
+				return
+			}
+			prev = d
+		case <-timeout:
+			t.Fatal("recorder observed fewer than two reads")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package garbage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+// A Recording is the raw data of a collection: the allocations and frees of
+// each stack in each GC cycle observed. One expensive collection can be
+// recorded and then replayed offline with different options.
+//
+// A Recording is an io.WriterTo, and ReadRecording reads one back. The
+// recording is symbolized when collected, so it can be replayed without the
+// binary that recorded it.
+type Recording struct {
+	Start     time.Time     // time the collection window opened
+	Duration  time.Duration // length of the collection window
+	Rate      int           // runtime.MemProfileRate during collection
+	Truncated bool          // whether the collection was cancelled
+	Cycles    []RecordedCycle
+
+	frames map[uintptr][]Frame
+}
+
+// A RecordedCycle is a GC cycle of a Recording, with the allocations and frees
+// of each stack active during the cycle.
+type RecordedCycle struct {
+	Cycle
+	Deltas []Delta
+}
+
+// CollectRecording collects a Recording over duration. Like Collect, it runs
+// twice as long as duration.
+func CollectRecording(duration time.Duration) *Recording {
+	rec, _ := NewCollector(Options{Duration: duration}).Record(context.Background())
+	return rec
+}
+
+// newRecording returns the recording of the collection of p, symbolizing the
+// stacks of the recorded cycles.
+func newRecording(p *Profile, cycles []RecordedCycle) *Recording {
+	rec := &Recording{
+		Start:     p.Start,
+		Duration:  p.Duration,
+		Rate:      p.Rate,
+		Truncated: p.Truncated,
+		Cycles:    cycles,
+		frames:    make(map[uintptr][]Frame),
+	}
+	for _, c := range cycles {
+		for i := range c.Deltas {
+			for _, pc := range c.Deltas[i].Stack() {
+				if _, ok := rec.frames[pc]; !ok {
+					rec.frames[pc] = symbolize(pc)
+				}
+			}
+		}
+	}
+	return rec
+}
+
+// recordingFormat identifies the recording file format and its version.
+const recordingFormat = "pprof-garbage recording v1"
+
+// Field numbers of the recording file format, a gzip-compressed protocol
+// buffer.
+const (
+	// message Recording
+	tagRecording_Format    = 1 // string
+	tagRecording_Start     = 2 // int64 (Unix nanoseconds)
+	tagRecording_Duration  = 3 // int64
+	tagRecording_Rate      = 4 // int64
+	tagRecording_Truncated = 5 // bool
+	tagRecording_Cycle     = 6 // repeated Cycle
+	tagRecording_Frame     = 7 // repeated Frame
+
+	// message Cycle
+	tagCycle_NumGC    = 1 // uint64
+	tagCycle_Time     = 2 // int64 (Unix nanoseconds)
+	tagCycle_Pause    = 3 // int64
+	tagCycle_MarkCPU  = 4 // int64
+	tagCycle_HeapLive = 5 // uint64
+	tagCycle_HeapGoal = 6 // uint64
+	tagCycle_Objects  = 7 // int64
+	tagCycle_Bytes    = 8 // int64
+	tagCycle_Delta    = 9 // repeated Delta
+
+	// message Delta
+	tagDelta_Stack        = 1 // repeated uint64
+	tagDelta_AllocObjects = 2 // int64
+	tagDelta_AllocBytes   = 3 // int64
+	tagDelta_FreeObjects  = 4 // int64
+	tagDelta_FreeBytes    = 5 // int64
+
+	// message Frame, one per function at an address, innermost first
+	tagFrame_PC       = 1 // uint64
+	tagFrame_Function = 2 // string
+	tagFrame_File     = 3 // string
+	tagFrame_Line     = 4 // int64
+)
+
+// WriteTo writes the recording to w in its gzip-compressed file format.
+func (rec *Recording) WriteTo(w io.Writer) (int64, error) {
+	var b protobuf
+	b.string(tagRecording_Format, recordingFormat)
+	if !rec.Start.IsZero() {
+		b.int64Opt(tagRecording_Start, rec.Start.UnixNano())
+	}
+	b.int64Opt(tagRecording_Duration, int64(rec.Duration))
+	b.int64Opt(tagRecording_Rate, int64(rec.Rate))
+	b.boolOpt(tagRecording_Truncated, rec.Truncated)
+
+	var stack []uint64
+	for _, c := range rec.Cycles {
+		start := b.startMessage()
+		b.uint64Opt(tagCycle_NumGC, uint64(c.NumGC))
+		b.int64Opt(tagCycle_Time, c.Time.UnixNano())
+		b.int64Opt(tagCycle_Pause, int64(c.Pause))
+		b.int64Opt(tagCycle_MarkCPU, int64(c.MarkCPU))
+		b.uint64Opt(tagCycle_HeapLive, c.HeapLive)
+		b.uint64Opt(tagCycle_HeapGoal, c.HeapGoal)
+		b.int64Opt(tagCycle_Objects, c.Objects)
+		b.int64Opt(tagCycle_Bytes, c.Bytes)
+		for i := range c.Deltas {
+			d := &c.Deltas[i]
+
+			stack = stack[:0]
+			for _, pc := range d.Stack() {
+				stack = append(stack, uint64(pc))
+			}
+
+			start := b.startMessage()
+			b.uint64s(tagDelta_Stack, stack)
+			b.int64Opt(tagDelta_AllocObjects, d.AllocObjects)
+			b.int64Opt(tagDelta_AllocBytes, d.AllocBytes)
+			b.int64Opt(tagDelta_FreeObjects, d.FreeObjects)
+			b.int64Opt(tagDelta_FreeBytes, d.FreeBytes)
+			b.endMessage(tagCycle_Delta, start)
+		}
+		b.endMessage(tagRecording_Cycle, start)
+	}
+
+	for pc, frames := range rec.frames {
+		for _, fr := range frames {
+			start := b.startMessage()
+			b.uint64Opt(tagFrame_PC, uint64(pc))
+			b.string(tagFrame_Function, fr.Function)
+			b.string(tagFrame_File, fr.File)
+			b.int64Opt(tagFrame_Line, int64(fr.Line))
+			b.endMessage(tagRecording_Frame, start)
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b.data); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+// ReadRecording reads a recording written by Recording.WriteTo.
+func ReadRecording(r io.Reader) (*Recording, error) {
+	zr, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("garbage: not a recording: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Recording{frames: make(map[uintptr][]Frame)}
+	var format string
+	err = decodeMessage(data, func(tag int, v uint64, b []byte) error {
+		switch tag {
+		case tagRecording_Format:
+			format = string(b)
+		case tagRecording_Start:
+			rec.Start = time.Unix(0, int64(v))
+		case tagRecording_Duration:
+			rec.Duration = time.Duration(v)
+		case tagRecording_Rate:
+			rec.Rate = int(v)
+		case tagRecording_Truncated:
+			rec.Truncated = v != 0
+		case tagRecording_Cycle:
+			c, err := decodeRecordedCycle(b)
+			rec.Cycles = append(rec.Cycles, c)
+			return err
+		case tagRecording_Frame:
+			var pc uintptr
+			var fr Frame
+			err := decodeMessage(b, func(tag int, v uint64, b []byte) error {
+				switch tag {
+				case tagFrame_PC:
+					pc = uintptr(v)
+				case tagFrame_Function:
+					fr.Function = string(b)
+				case tagFrame_File:
+					fr.File = string(b)
+				case tagFrame_Line:
+					fr.Line = int(v)
+				}
+				return nil
+			})
+			rec.frames[pc] = append(rec.frames[pc], fr)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("garbage: bad recording: %v", err)
+	}
+	if format != recordingFormat {
+		return nil, fmt.Errorf("garbage: unsupported recording format %q", format)
+	}
+	return rec, nil
+}
+
+func decodeRecordedCycle(data []byte) (RecordedCycle, error) {
+	var c RecordedCycle
+	err := decodeMessage(data, func(tag int, v uint64, b []byte) error {
+		switch tag {
+		case tagCycle_NumGC:
+			c.NumGC = uint32(v)
+		case tagCycle_Time:
+			c.Time = time.Unix(0, int64(v))
+		case tagCycle_Pause:
+			c.Pause = time.Duration(v)
+		case tagCycle_MarkCPU:
+			c.MarkCPU = time.Duration(v)
+		case tagCycle_HeapLive:
+			c.HeapLive = v
+		case tagCycle_HeapGoal:
+			c.HeapGoal = v
+		case tagCycle_Objects:
+			c.Objects = int64(v)
+		case tagCycle_Bytes:
+			c.Bytes = int64(v)
+		case tagCycle_Delta:
+			var d Delta
+			var depth int
+			err := decodeMessage(b, func(tag int, v uint64, b []byte) error {
+				switch tag {
+				case tagDelta_Stack:
+					return decodeRepeated(v, b, func(pc uint64) {
+						if depth < len(d.Stack0) {
+							d.Stack0[depth] = uintptr(pc)
+							depth++
+						}
+					})
+				case tagDelta_AllocObjects:
+					d.AllocObjects = int64(v)
+				case tagDelta_AllocBytes:
+					d.AllocBytes = int64(v)
+				case tagDelta_FreeObjects:
+					d.FreeObjects = int64(v)
+				case tagDelta_FreeBytes:
+					d.FreeBytes = int64(v)
+				}
+				return nil
+			})
+			c.Deltas = append(c.Deltas, d)
+			return err
+		}
+		return nil
+	})
+	return c, err
+}
+
+// ReplayOptions select and aggregate the data of a Recording.
+type ReplayOptions struct {
+	// Focus, if set, keeps only the stacks with a function matching it.
+	Focus *regexp.Regexp
+
+	// Ignore, if set, drops the stacks with a function matching it.
+	Ignore *regexp.Regexp
+
+	// From and To, if set, keep only the cycles observed in that range.
+	From, To time.Time
+
+	// Depth, if positive, truncates each stack to its innermost Depth
+	// addresses, merging the stacks that then match.
+	Depth int
+
+	// Unscaled reports the sampled values as they are in the protocol
+	// buffer form, rather than scaled to estimate all allocations.
+	Unscaled bool
+}
+
+// Replay aggregates the recording into a profile, as if it had been collected
+// with the options applied.
+func (rec *Recording) Replay(opts ReplayOptions) *Profile {
+	p := &Profile{
+		Start:     rec.Start,
+		Duration:  rec.Duration,
+		Rate:      rec.Rate,
+		Truncated: rec.Truncated,
+		frames:    rec.frames,
+		scaled:    opts.Unscaled,
+	}
+	end := rec.Start.Add(rec.Duration)
+	if !opts.From.IsZero() && opts.From.After(p.Start) {
+		p.Start = opts.From
+	}
+	if !opts.To.IsZero() && opts.To.Before(end) {
+		end = opts.To
+	}
+	if d := end.Sub(p.Start); d < p.Duration {
+		p.Duration = d
+	}
+
+	var window []Delta
+	windowIndex, survivalIndex, recordIndex := make(map[[32]uintptr]int), make(map[[32]uintptr]int), make(map[[32]uintptr]int)
+	ages := make(ageTracker)
+	for _, rc := range rec.Cycles {
+		if (!opts.From.IsZero() && rc.Time.Before(opts.From)) || (!opts.To.IsZero() && !rc.Time.Before(opts.To)) {
+			continue
+		}
+
+		cycle := rc.Cycle
+		cycle.Objects, cycle.Bytes = 0, 0
+		ages.next()
+
+		var garbage []Record
+		index := make(map[[32]uintptr]int)
+		for _, d := range rc.Deltas {
+			if !rec.keep(d.Stack(), opts) {
+				continue
+			}
+			if opts.Depth > 0 && opts.Depth < len(d.Stack0) {
+				for i := opts.Depth; i < len(d.Stack0); i++ {
+					d.Stack0[i] = 0
+				}
+			}
+
+			window = mergeDelta(window, windowIndex, d)
+			if d.AllocObjects > 0 {
+				died := d.FreeObjects
+				if died > d.AllocObjects {
+					died = d.AllocObjects
+				}
+				p.Survival = mergeSurvivalIndexed(p.Survival, survivalIndex, Survival{
+					Allocated: d.AllocObjects,
+					Survived:  d.AllocObjects - died,
+					Stack0:    d.Stack0,
+				})
+			}
+			freed := ages.observe(d.Stack0, d.AllocObjects, d.FreeObjects)
+			if d.FreeObjects > 0 {
+				garbage = mergeIndexed(garbage, index, Record{
+					Objects: d.FreeObjects,
+					Bytes:   d.FreeBytes,
+					Ages:    freed,
+					Sizes:   sizesOf(d.FreeObjects, d.FreeBytes),
+					Stack0:  d.Stack0,
+				})
+				cycle.Objects += d.FreeObjects
+				cycle.Bytes += d.FreeBytes
+			}
+		}
+
+		for _, r := range garbage {
+			r.Cycles = 1
+			p.Records = mergeIndexed(p.Records, recordIndex, r)
+		}
+		p.Cycles = append(p.Cycles, cycle)
+	}
+
+	p.Suspects = suspects(window)
+	sortSurvival(p.Survival)
+	return p
+}
+
+// keep reports whether the stack passes the focus and ignore options.
+func (rec *Recording) keep(stk []uintptr, opts ReplayOptions) bool {
+	if opts.Focus == nil && opts.Ignore == nil {
+		return true
+	}
+
+	focused := opts.Focus == nil
+	for _, pc := range stk {
+		for _, fr := range rec.frames[pc] {
+			if opts.Ignore != nil && opts.Ignore.MatchString(fr.Function) {
+				return false
+			}
+			if opts.Focus != nil && opts.Focus.MatchString(fr.Function) {
+				focused = true
+			}
+		}
+	}
+	return focused
+}
+
+// mergeDelta adds d to the delta for the same stack in deltas, with index the
+// position of each stack of deltas, which it keeps up to date.
+func mergeDelta(deltas []Delta, index map[[32]uintptr]int, d Delta) []Delta {
+	if i, ok := index[d.Stack0]; ok {
+		deltas[i].AllocObjects += d.AllocObjects
+		deltas[i].AllocBytes += d.AllocBytes
+		deltas[i].FreeObjects += d.FreeObjects
+		deltas[i].FreeBytes += d.FreeBytes
+		return deltas
+	}
+	index[d.Stack0] = len(deltas)
+	return append(deltas, d)
+}
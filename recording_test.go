@@ -0,0 +1,107 @@
+package garbage
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func testRecording() *Recording {
+	start := time.Unix(1470000000, 0)
+	delta := func(pc uintptr, allocs, frees int64) Delta {
+		d := Delta{
+			AllocObjects: allocs,
+			AllocBytes:   allocs << 10,
+			FreeObjects:  frees,
+			FreeBytes:    frees << 10,
+		}
+		d.Stack0[0], d.Stack0[1] = pc, 0x100
+		return d
+	}
+
+	return &Recording{
+		Start:    start,
+		Duration: 3 * time.Second,
+		Rate:     512 * 1024,
+		Cycles: []RecordedCycle{
+			{Cycle{NumGC: 1, Time: start.Add(time.Second)}, []Delta{delta(1, 10, 10), delta(2, 10, 0)}},
+			{Cycle{NumGC: 2, Time: start.Add(2 * time.Second)}, []Delta{delta(1, 10, 10), delta(2, 10, 1)}},
+			{Cycle{NumGC: 3, Time: start.Add(3 * time.Second)}, []Delta{delta(1, 10, 8)}},
+		},
+		frames: map[uintptr][]Frame{
+			1:     {{Function: "main.temp", File: "main.go", Line: 1}},
+			2:     {{Function: "main.cache", File: "main.go", Line: 2}},
+			0x100: {{Function: "main.main", File: "main.go", Line: 3}},
+		},
+	}
+}
+
+func TestRecordingRoundTrip(t *testing.T) {
+	orig := testRecording()
+
+	var buf bytes.Buffer
+	if _, err := orig.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := ReadRecording(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rec.Start.Equal(orig.Start) || rec.Duration != orig.Duration || rec.Rate != orig.Rate {
+		t.Errorf("want recording of %v+%v at rate %d, got %v+%v at rate %d",
+			orig.Start, orig.Duration, orig.Rate, rec.Start, rec.Duration, rec.Rate)
+	}
+	if len(rec.Cycles) != 3 || len(rec.Cycles[1].Deltas) != 2 {
+		t.Fatalf("want 3 cycles, got %+v", rec.Cycles)
+	}
+	if d := rec.Cycles[1].Deltas[1]; d != orig.Cycles[1].Deltas[1] {
+		t.Errorf("want delta %+v, got %+v", orig.Cycles[1].Deltas[1], d)
+	}
+	if fr := rec.frames[2]; len(fr) != 1 || fr[0] != orig.frames[2][0] {
+		t.Errorf("want frames %+v, got %+v", orig.frames[2], fr)
+	}
+
+	if _, err := ReadRecording(bytes.NewReader([]byte("heap profile: 0: 0 [0: 0] @ heap/0"))); err == nil {
+		t.Error("want error reading a text profile as a recording")
+	}
+}
+
+func TestRecordingReplay(t *testing.T) {
+	rec := testRecording()
+
+	p := rec.Replay(ReplayOptions{})
+	if len(p.Records) != 2 || len(p.Cycles) != 3 {
+		t.Fatalf("want 2 records over 3 cycles, got %+v", p)
+	}
+	if r := p.Records[0]; r.Objects != 28 || r.Cycles != 3 {
+		t.Errorf("want 28 objects over 3 cycles, got %d over %d", r.Objects, r.Cycles)
+	}
+	if a := p.Records[0].Ages; a != (Ages{SameCycle: 28}) {
+		t.Errorf("want 28 objects freed the same cycle, got %+v", a)
+	}
+	if len(p.Suspects) != 1 || p.Suspects[0].Stack()[0] != 2 {
+		t.Errorf("want main.cache suspect, got %+v", p.Suspects)
+	}
+
+	p = rec.Replay(ReplayOptions{Focus: regexp.MustCompile(`cache`)})
+	if len(p.Records) != 1 || p.Records[0].Stack()[0] != 2 {
+		t.Errorf("focus: want main.cache record only, got %+v", p.Records)
+	}
+
+	p = rec.Replay(ReplayOptions{Ignore: regexp.MustCompile(`cache`)})
+	if len(p.Records) != 1 || p.Records[0].Stack()[0] != 1 {
+		t.Errorf("ignore: want main.temp record only, got %+v", p.Records)
+	}
+
+	p = rec.Replay(ReplayOptions{From: rec.Start.Add(1500 * time.Millisecond)})
+	if len(p.Cycles) != 2 || p.Duration != 1500*time.Millisecond {
+		t.Errorf("from: want 2 cycles over 1.5s, got %d over %v", len(p.Cycles), p.Duration)
+	}
+
+	p = rec.Replay(ReplayOptions{Depth: 1})
+	if len(p.Records[0].Stack()) != 1 {
+		t.Errorf("depth: want truncated stack, got %#x", p.Records[0].Stack())
+	}
+}
@@ -0,0 +1,61 @@
+package garbage
+
+import "regexp"
+
+// redactedFunction is the name that replaces the function of a redacted frame.
+const redactedFunction = "[redacted]"
+
+// Redact replaces each frame of the profile's stacks whose function name or
+// file matches one of the patterns with an opaque placeholder: a frame of the
+// function "[redacted]" with no file or line. The stacks keep their depth and
+// addresses, so the structure of the profile is preserved while the names of
+// confidential code are not.
+func (p *Profile) Redact(patterns ...*regexp.Regexp) {
+	if len(patterns) == 0 {
+		return
+	}
+	p.mapFrames(redactFrame(patterns))
+	p.redacted = true
+}
+
+// Redact replaces the matching frames of the recording's symbols, as
+// Profile.Redact does, including those of the profiles replayed from it.
+func (rec *Recording) Redact(patterns ...*regexp.Regexp) {
+	if len(patterns) == 0 {
+		return
+	}
+	rec.mapFrames(redactFrame(patterns))
+}
+
+func redactFrame(patterns []*regexp.Regexp) func(Frame) Frame {
+	return func(fr Frame) Frame {
+		for _, re := range patterns {
+			if re.MatchString(fr.Function) || re.MatchString(fr.File) {
+				return Frame{Function: redactedFunction}
+			}
+		}
+		return fr
+	}
+}
+
+// scrub redacts and then, if anonymize is set, anonymizes the profile and
+// recording of j.
+func (j *job) scrub(redact []*regexp.Regexp, anonymize bool) {
+	scrubProfile(j.profile, redact, anonymize)
+	if j.recording != nil {
+		j.recording.Redact(redact...)
+		if anonymize {
+			j.recording.Anonymize()
+		}
+	}
+}
+
+func scrubProfile(p *Profile, redact []*regexp.Regexp, anonymize bool) {
+	p.Redact(redact...)
+	if anonymize {
+		p.Anonymize()
+	}
+	for _, part := range p.Intervals {
+		scrubProfile(part, redact, anonymize)
+	}
+}
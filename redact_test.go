@@ -0,0 +1,49 @@
+package garbage
+
+import (
+	"bytes"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	var r Record
+	runtime.Callers(1, r.Stack0[:])
+	p := &Profile{Rate: 1, Records: []Record{{Objects: 1, Bytes: 8, Stack0: r.Stack0}}}
+
+	depth := make(map[uintptr]int)
+	for _, pc := range r.Stack() {
+		depth[pc] = len(p.Frames(pc))
+	}
+
+	p.Redact(regexp.MustCompile(`\.TestRedact$`), regexp.MustCompile(`/testing/`))
+
+	var redacted int
+	for _, pc := range r.Stack() {
+		frames := p.Frames(pc)
+		if len(frames) != depth[pc] {
+			t.Errorf("%#x: want %d frames, got %d", pc, depth[pc], len(frames))
+		}
+		for _, fr := range frames {
+			if fr.Function == redactedFunction {
+				redacted++
+				if fr.File != "" || fr.Line != 0 {
+					t.Errorf("%#x: redacted frame keeps %s:%d", pc, fr.File, fr.Line)
+				}
+			}
+		}
+	}
+	if redacted < 2 {
+		t.Errorf("want the test and testing frames redacted, got %d redacted", redacted)
+	}
+
+	var buf bytes.Buffer
+	if err := p.writeText(&buf, textOptions{debug: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if text := buf.String(); strings.Contains(text, "TestRedact") || strings.Contains(text, "tRunner") {
+		t.Errorf("text profile contains redacted frames:\n%s", text)
+	}
+}
@@ -0,0 +1,208 @@
+package garbage
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"time"
+)
+
+// RuntimeStats is a snapshot of runtime metrics taken at the start or end of
+// a collection window.
+type RuntimeStats struct {
+	Time       time.Time
+	Goroutines uint64 // live goroutines
+	GOMAXPROCS int
+
+	// SchedLatencies is the cumulative distribution of the time goroutines
+	// spent runnable before running, or nil if unavailable.
+	SchedLatencies *metrics.Float64Histogram
+
+	// Cumulative CPU time available to the process, spent by the GC, and
+	// spent by goroutines assisting the GC with marking.
+	TotalCPU  time.Duration
+	GCCPU     time.Duration
+	AssistCPU time.Duration
+
+	// Memory mapped by the Go runtime (as runtime.MemStats.Sys) and for
+	// the heap (as HeapSys), the resident set size of the process, or 0 if
+	// unknown, and the cumulative number of cgo calls.
+	Sys, HeapSys uint64
+	RSS          uint64
+	CgoCalls     int64
+}
+
+// readRuntimeStats takes a snapshot of the runtime metrics.
+func readRuntimeStats() *RuntimeStats {
+	samples := []metrics.Sample{
+		{Name: "/sched/goroutines:goroutines"},
+		{Name: "/sched/gomaxprocs:threads"},
+		{Name: "/sched/latencies:seconds"},
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/gc/total:cpu-seconds"},
+		{Name: "/cpu/classes/gc/mark/assist:cpu-seconds"},
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/objects:bytes"},
+		{Name: "/memory/classes/heap/unused:bytes"},
+		{Name: "/memory/classes/heap/free:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+
+	s := &RuntimeStats{
+		Time:     time.Now(),
+		RSS:      residentSize(),
+		CgoCalls: runtime.NumCgoCall(),
+	}
+	if v := samples[0].Value; v.Kind() == metrics.KindUint64 {
+		s.Goroutines = v.Uint64()
+	}
+	if v := samples[1].Value; v.Kind() == metrics.KindUint64 {
+		s.GOMAXPROCS = int(v.Uint64())
+	}
+	if v := samples[2].Value; v.Kind() == metrics.KindFloat64Histogram {
+		s.SchedLatencies = v.Float64Histogram()
+	}
+	if v := samples[3].Value; v.Kind() == metrics.KindFloat64 {
+		s.TotalCPU = secondsDuration(v.Float64())
+	}
+	if v := samples[4].Value; v.Kind() == metrics.KindFloat64 {
+		s.GCCPU = secondsDuration(v.Float64())
+	}
+	if v := samples[5].Value; v.Kind() == metrics.KindFloat64 {
+		s.AssistCPU = secondsDuration(v.Float64())
+	}
+	if v := samples[6].Value; v.Kind() == metrics.KindUint64 {
+		s.Sys = v.Uint64()
+	}
+	for _, sample := range samples[7:] {
+		if sample.Value.Kind() == metrics.KindUint64 {
+			s.HeapSys += sample.Value.Uint64()
+		}
+	}
+	return s
+}
+
+// gcCPU returns the fraction of the available CPU spent by the GC between two
+// snapshots, and the CPU time goroutines spent assisting it, or false if the
+// metrics are unavailable.
+func gcCPU(start, end *RuntimeStats) (fraction float64, assist time.Duration, ok bool) {
+	total := end.TotalCPU - start.TotalCPU
+	if total <= 0 {
+		return 0, 0, false
+	}
+	return float64(end.GCCPU-start.GCCPU) / float64(total), end.AssistCPU - start.AssistCPU, true
+}
+
+// gcMetrics are the runtime metrics read for each GC cycle observed.
+type gcMetrics struct {
+	markCPU  time.Duration // cumulative
+	heapLive uint64
+	heapGoal uint64
+}
+
+func readGCMetrics() gcMetrics {
+	samples := []metrics.Sample{
+		{Name: "/cpu/classes/gc/mark/assist:cpu-seconds"},
+		{Name: "/cpu/classes/gc/mark/dedicated:cpu-seconds"},
+		{Name: "/cpu/classes/gc/mark/idle:cpu-seconds"},
+		{Name: "/gc/heap/live:bytes"},
+		{Name: "/gc/heap/goal:bytes"},
+	}
+	metrics.Read(samples)
+
+	var m gcMetrics
+	for _, s := range samples[:3] {
+		if s.Value.Kind() == metrics.KindFloat64 {
+			m.markCPU += secondsDuration(s.Value.Float64())
+		}
+	}
+	if v := samples[3].Value; v.Kind() == metrics.KindUint64 {
+		m.heapLive = v.Uint64()
+	}
+	if v := samples[4].Value; v.Kind() == metrics.KindUint64 {
+		m.heapGoal = v.Uint64()
+	}
+	return m
+}
+
+// printRuntimeStats prints the goroutine and scheduler metrics at the start
+// and end of the window. The GC CPU usage and scheduler latency quantiles
+// cover only the window.
+func printRuntimeStats(w io.Writer, start, end *RuntimeStats) {
+	fmt.Fprintf(w, "\n# runtime/metrics\n")
+	fmt.Fprintf(w, "# Goroutines = %d -> %d\n", start.Goroutines, end.Goroutines)
+	fmt.Fprintf(w, "# GOMAXPROCS = %d -> %d\n", start.GOMAXPROCS, end.GOMAXPROCS)
+
+	if fraction, assist, ok := gcCPU(start, end); ok {
+		fmt.Fprintf(w, "# GCCPUFraction = %.4f\n", fraction)
+		fmt.Fprintf(w, "# GCCPU = %v\n", end.GCCPU-start.GCCPU)
+		fmt.Fprintf(w, "# AssistCPU = %v\n", assist)
+	}
+
+	if start.SchedLatencies == nil || end.SchedLatencies == nil {
+		return
+	}
+
+	h := subHistogram(end.SchedLatencies, start.SchedLatencies)
+	for _, q := range []struct {
+		name string
+		q    float64
+	}{{"p50", 0.5}, {"p99", 0.99}, {"max", 1}} {
+		if v, ok := quantile(h, q.q); ok {
+			fmt.Fprintf(w, "# SchedLatency %s = %v\n", q.name, secondsDuration(v))
+		}
+	}
+}
+
+// subHistogram returns the distribution of the observations made between
+// two snapshots of a cumulative histogram.
+func subHistogram(end, start *metrics.Float64Histogram) *metrics.Float64Histogram {
+	h := &metrics.Float64Histogram{
+		Counts:  make([]uint64, len(end.Counts)),
+		Buckets: end.Buckets,
+	}
+	for i, n := range end.Counts {
+		if i < len(start.Counts) {
+			n -= start.Counts[i]
+		}
+		h.Counts[i] = n
+	}
+	return h
+}
+
+// quantile returns the upper bound of the bucket holding the q-th quantile
+// of h, or false if h is empty.
+func quantile(h *metrics.Float64Histogram, q float64) (float64, bool) {
+	var total uint64
+	for _, n := range h.Counts {
+		total += n
+	}
+	if total == 0 {
+		return 0, false
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen >= rank {
+			upper := h.Buckets[i+1]
+			if math.IsInf(upper, 1) {
+				upper = h.Buckets[i]
+			}
+			return upper, true
+		}
+	}
+	return h.Buckets[len(h.Buckets)-1], true
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,89 @@
+package garbage
+
+import (
+	"bytes"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadRuntimeStats(t *testing.T) {
+	s := readRuntimeStats()
+
+	if s.Goroutines == 0 {
+		t.Error("want goroutines, got 0")
+	}
+	if s.GOMAXPROCS != runtime.GOMAXPROCS(0) {
+		t.Errorf("want GOMAXPROCS %d, got %d", runtime.GOMAXPROCS(0), s.GOMAXPROCS)
+	}
+	if s.SchedLatencies == nil {
+		t.Error("want scheduler latencies, got nil")
+	}
+	if s.HeapSys == 0 || s.HeapSys > s.Sys {
+		t.Errorf("want heap memory within runtime memory, got %d of %d", s.HeapSys, s.Sys)
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	start := &metrics.Float64Histogram{
+		Counts:  []uint64{5, 0, 0, 0},
+		Buckets: []float64{0, 1e-6, 1e-3, 1, math.Inf(1)},
+	}
+	end := &metrics.Float64Histogram{
+		Counts:  []uint64{55, 48, 1, 1},
+		Buckets: start.Buckets,
+	}
+	h := subHistogram(end, start)
+
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0, 1e-6},
+		{0.5, 1e-6},
+		{0.51, 1e-3},
+		{0.99, 1},
+		{1, 1},
+	}
+	for _, test := range tests {
+		if got, ok := quantile(h, test.q); !ok || got != test.want {
+			t.Errorf("quantile(%v): want %v, got %v", test.q, test.want, got)
+		}
+	}
+
+	if _, ok := quantile(subHistogram(start, start), 0.5); ok {
+		t.Error("want no quantile for empty histogram")
+	}
+}
+
+func TestPrintRuntimeStats(t *testing.T) {
+	start := &RuntimeStats{Goroutines: 10, GOMAXPROCS: 4, TotalCPU: 10 * time.Second, GCCPU: time.Second}
+	end := &RuntimeStats{Goroutines: 5000, GOMAXPROCS: 4, TotalCPU: 50 * time.Second, GCCPU: 11 * time.Second, AssistCPU: 3 * time.Second}
+
+	var buf bytes.Buffer
+	printRuntimeStats(&buf, start, end)
+
+	for _, want := range []string{
+		"# Goroutines = 10 -> 5000\n",
+		"# GOMAXPROCS = 4 -> 4\n",
+		"# GCCPUFraction = 0.2500\n",
+		"# GCCPU = 10s\n",
+		"# AssistCPU = 3s\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want %q in:\n%s", want, buf.String())
+		}
+	}
+
+	start.SchedLatencies = &metrics.Float64Histogram{Counts: []uint64{0}, Buckets: []float64{0, 1e-3}}
+	end.SchedLatencies = &metrics.Float64Histogram{Counts: []uint64{3}, Buckets: []float64{0, 1e-3}}
+
+	buf.Reset()
+	printRuntimeStats(&buf, start, end)
+	if want := "# SchedLatency p99 = " + time.Millisecond.String(); !strings.Contains(buf.String(), want) {
+		t.Errorf("want %q in:\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,55 @@
+package garbage
+
+import "sort"
+
+// The sample types a profile can open on (see Profile.DefaultSample).
+const (
+	sampleObjects = "objects"
+	sampleBytes   = "bytes"
+)
+
+// sampleComment marks the default sample type of a profile in the text
+// format.
+const sampleComment = "default_sample: "
+
+// validSample reports whether s names a sample type of a profile.
+func validSample(s string) bool {
+	return s == sampleObjects || s == sampleBytes
+}
+
+// defaultSampleType returns the sample type of the protocol buffer format
+// named by p.DefaultSample, or "" if it is unset.
+func (p *Profile) defaultSampleType() string {
+	if !validSample(p.DefaultSample) {
+		return ""
+	}
+	return p.kind() + "_" + p.DefaultSample
+}
+
+// ranked returns the records of p with the most garbage first, by objects if
+// p.DefaultSample is "objects" and by bytes otherwise.
+func (p *Profile) ranked() []*Record {
+	rs := make([]*Record, 0, len(p.Records))
+	for i := range p.Records {
+		rs = append(rs, &p.Records[i])
+	}
+	value := func(r *Record) int64 { return r.Bytes }
+	if p.DefaultSample == sampleObjects {
+		value = func(r *Record) int64 { return r.Objects }
+	}
+	sort.SliceStable(rs, func(i, j int) bool { return value(rs[i]) > value(rs[j]) })
+	return rs
+}
+
+// textRecords returns the records of p in the order of the text format:
+// ranked by the default sample if one is set, and as collected otherwise.
+func (p *Profile) textRecords() []*Record {
+	if validSample(p.DefaultSample) {
+		return p.ranked()
+	}
+	rs := make([]*Record, 0, len(p.Records))
+	for i := range p.Records {
+		rs = append(rs, &p.Records[i])
+	}
+	return rs
+}
@@ -0,0 +1,47 @@
+package garbage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDefaultSample(t *testing.T) {
+	p := goldenProfile()
+	p.Records = append(p.Records, Record{Objects: 1 << 20, Bytes: 1 << 20, Cycles: 1, Stack0: p.Records[0].Stack0})
+	p.Records[len(p.Records)-1].Stack0[0] = 0x1010
+	p.DefaultSample = sampleObjects
+
+	gz, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := Parse(bytes.NewReader(gz))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.DefaultSample != sampleObjects {
+		t.Errorf("want default sample %q parsed back, got %q", sampleObjects, q.DefaultSample)
+	}
+
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(text), "\n", 3)
+	if !strings.HasPrefix(lines[1], "1048576: 1048576 ") {
+		t.Errorf("want the most objects first, got %q", lines[1])
+	}
+	r, err := ParseText(bytes.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.DefaultSample != sampleObjects {
+		t.Errorf("want default sample %q parsed from text, got %q", sampleObjects, r.DefaultSample)
+	}
+
+	p.DefaultSample = ""
+	if q, _ := Parse(bytes.NewReader(p.encode())); q.DefaultSample != "" {
+		t.Errorf("want no default sample, got %q", q.DefaultSample)
+	}
+}
@@ -0,0 +1,66 @@
+package garbage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// signatureHeader is the response trailer holding the signature of the body
+// of a Handler with a SigningKey.
+const signatureHeader = "X-Profile-Signature"
+
+// signaturePrefix identifies the algorithm of a signature.
+const signaturePrefix = "sha256="
+
+// Sign returns the detached signature of a profile artifact: the HMAC-SHA256
+// of data under key, as "sha256=" followed by the hex-encoded MAC. It is the
+// signature a Handler with the SigningKey sends in the X-Profile-Signature
+// trailer of its responses.
+func Sign(key, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of data under key, so
+// pipelines can check an artifact was not changed between capture and
+// analysis.
+func Verify(key, data []byte, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+	sum, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hmac.Equal(sum, mac.Sum(nil))
+}
+
+// A signingWriter computes the signature of a response body as it is
+// written.
+type signingWriter struct {
+	http.ResponseWriter
+	mac hash.Hash
+}
+
+func newSigningWriter(w http.ResponseWriter, key []byte) *signingWriter {
+	return &signingWriter{ResponseWriter: w, mac: hmac.New(sha256.New, key)}
+}
+
+func (w *signingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.mac.Write(b[:n])
+	return n, err
+}
+
+// sign sets the signature trailer, which must have been declared before the
+// header was written.
+func (w *signingWriter) sign() {
+	w.Header().Set(signatureHeader, signaturePrefix+hex.EncodeToString(w.mac.Sum(nil)))
+}
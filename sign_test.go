@@ -0,0 +1,49 @@
+package garbage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	key, data := []byte("key"), []byte("profile")
+
+	sig := Sign(key, data)
+	if !Verify(key, data, sig) {
+		t.Errorf("Verify(%q): want true", sig)
+	}
+	if Verify([]byte("other"), data, sig) {
+		t.Error("Verify with another key: want false")
+	}
+	if Verify(key, []byte("tampered"), sig) {
+		t.Error("Verify of tampered data: want false")
+	}
+	if Verify(key, data, sig[len(signaturePrefix):]) {
+		t.Error("Verify without the algorithm: want false")
+	}
+}
+
+func TestHandlerSigningKey(t *testing.T) {
+	requireEnabled(t)
+
+	key := []byte("secret")
+	srv := httptest.NewServer(&Handler{SigningKey: key})
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/debug/pprof/garbage?seconds=0.1&debug=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := res.Trailer.Get(signatureHeader)
+	if !Verify(key, body, sig) {
+		t.Errorf("signature trailer %q does not verify the body", sig)
+	}
+}
@@ -0,0 +1,77 @@
+// Package s3 stores pushed garbage profiles in an Amazon S3 bucket, or any
+// store with the S3 API:
+//
+//	cfg, err := config.LoadDefaultConfig(ctx)
+//	...
+//	p := &garbage.Pusher{
+//		Sink: &s3.Sink{Client: awss3.NewFromConfig(cfg), Bucket: "profiles", Prefix: "api/"},
+//	}
+//	go p.Run(ctx)
+//
+// It is a package of its own so that programs not storing profiles in S3 do
+// not link the AWS SDK.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+// The API is the method of the S3 client a Sink calls, implemented by
+// *s3.Client of the AWS SDK.
+type API interface {
+	PutObject(ctx context.Context, in *awss3.PutObjectInput, opts ...func(*awss3.Options)) (*awss3.PutObjectOutput, error)
+}
+
+// A Sink stores each profile as an object of a bucket, keyed by the Prefix,
+// the kind and the start of the profile, such as
+// "api/garbage/20240102T150405Z.pb.gz".
+type Sink struct {
+	// Client puts the objects.
+	Client API
+
+	// Bucket is the name of the bucket.
+	Bucket string
+
+	// Prefix prefixes the key of each object, such as the name of the
+	// program and a trailing slash.
+	Prefix string
+}
+
+// Push stores a profile encoded as by garbage.Profile.WriteTo.
+func (s *Sink) Push(ctx context.Context, body []byte) error {
+	prof, err := garbage.Parse(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Client.PutObject(ctx, &awss3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.key(prof)),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/octet-stream"),
+	})
+	if err != nil {
+		return fmt.Errorf("garbage: push to s3://%s: %w", s.Bucket, err)
+	}
+	return nil
+}
+
+// key returns the key of the object storing prof.
+func (s *Sink) key(prof *garbage.Profile) string {
+	kind := prof.Kind
+	if kind == "" {
+		kind = "garbage"
+	}
+	start := prof.Start
+	if start.IsZero() {
+		start = time.Now()
+	}
+	return s.Prefix + kind + "/" + start.UTC().Format("20060102T150405Z") + ".pb.gz"
+}
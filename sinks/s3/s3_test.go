@@ -0,0 +1,67 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	garbage "github.com/benburkert/pprof-garbage"
+)
+
+type fakeAPI struct {
+	objects map[string][]byte
+	err     error
+}
+
+func (f *fakeAPI) PutObject(ctx context.Context, in *awss3.PutObjectInput, opts ...func(*awss3.Options)) (*awss3.PutObjectOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	body, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = body
+	return new(awss3.PutObjectOutput), nil
+}
+
+func TestSink(t *testing.T) {
+	api := &fakeAPI{objects: make(map[string][]byte)}
+	p := &garbage.Pusher{Sink: &Sink{Client: api, Bucket: "profiles", Prefix: "api/"}}
+
+	prof := &garbage.Profile{
+		Kind:     "growth",
+		Rate:     1,
+		Start:    time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+		Duration: time.Minute,
+		Records:  []garbage.Record{{Objects: 1, Bytes: 8, Stack0: [32]uintptr{0x1}}},
+	}
+	if err := p.Push(context.Background(), prof); err != nil {
+		t.Fatal(err)
+	}
+
+	body, ok := api.objects["profiles/api/growth/20240102T150405Z.pb.gz"]
+	if !ok {
+		t.Fatalf("want the profile stored by kind and start, got %d objects", len(api.objects))
+	}
+	got, err := garbage.Parse(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Records) != 1 {
+		t.Errorf("want 1 record stored, got %d", len(got.Records))
+	}
+
+	api.err = errors.New("throttled")
+	if err := p.Push(context.Background(), prof); !errors.Is(err, api.err) {
+		t.Errorf("want the error of the client, got %v", err)
+	}
+	if s := p.Stats(); s.Pushed != 1 || s.Failed != 1 {
+		t.Errorf("stats: want 1 pushed and 1 failed, got %+v", s)
+	}
+}
@@ -0,0 +1,72 @@
+package garbage
+
+import (
+	"fmt"
+	"io"
+)
+
+// Sizes is a coarse histogram of the sizes of garbage objects, by the ranges
+// of the runtime's size classes, to tell the stacks whose garbage is best
+// pooled from those whose buffers are best right-sized.
+//
+// The memory profile records only the totals of each stack, so the objects a
+// stack freed in a cycle are counted at their mean size in that cycle: a stack
+// that allocates a single type is binned exactly, one that allocates mixed
+// sizes approximately.
+type Sizes struct {
+	Tiny   int64 // up to 16 bytes, combined by the tiny allocator
+	Small  int64 // 17 bytes to 1KB
+	Medium int64 // over 1KB to 8KB
+	Large  int64 // over 8KB to 32KB, the largest size class
+	Huge   int64 // over 32KB, allocated directly from the heap
+}
+
+func (s *Sizes) add(b Sizes) {
+	s.Tiny += b.Tiny
+	s.Small += b.Small
+	s.Medium += b.Medium
+	s.Large += b.Large
+	s.Huge += b.Huge
+}
+
+// sizesOf returns the histogram of objects freed in a cycle, totalling bytes.
+func sizesOf(objects, bytes int64) Sizes {
+	var s Sizes
+	if objects <= 0 {
+		return s
+	}
+	switch size := (bytes + objects - 1) / objects; {
+	case size <= 16:
+		s.Tiny = objects
+	case size <= 1<<10:
+		s.Small = objects
+	case size <= 8<<10:
+		s.Medium = objects
+	case size <= 32<<10:
+		s.Large = objects
+	default:
+		s.Huge = objects
+	}
+	return s
+}
+
+// printSizes prints the sizes of the garbage from the stacks producing the
+// most garbage, by the default sample, as a comment section of the legacy
+// text format.
+func (p *Profile) printSizes(w io.Writer) {
+	top := p.ranked()
+	if len(top) > topAges {
+		top = top[:topAges]
+	}
+
+	fmt.Fprintf(w, "\n# garbage sizes: <=16B: <=1KB: <=8KB: <=32KB: larger\n")
+	for _, r := range top {
+		s := r.Sizes
+		fmt.Fprintf(w, "# %d: %d: %d: %d: %d @", s.Tiny, s.Small, s.Medium, s.Large, s.Huge)
+		for _, pc := range r.Stack() {
+			fmt.Fprintf(w, " %#x", pc)
+		}
+		fmt.Fprintf(w, "\n")
+		p.printStack(w, r.Stack())
+	}
+}
@@ -0,0 +1,30 @@
+package garbage
+
+import "testing"
+
+func TestSizesOf(t *testing.T) {
+	tests := []struct {
+		objects, bytes int64
+		want           Sizes
+	}{
+		{0, 0, Sizes{}},
+		{4, 64, Sizes{Tiny: 4}},
+		{4, 65, Sizes{Small: 4}},
+		{2, 2048, Sizes{Small: 2}},
+		{1, 4096, Sizes{Medium: 1}},
+		{1, 32 << 10, Sizes{Large: 1}},
+		{3, 3 << 20, Sizes{Huge: 3}},
+	}
+	for _, test := range tests {
+		if got := sizesOf(test.objects, test.bytes); got != test.want {
+			t.Errorf("sizesOf(%d, %d) = %+v, want %+v", test.objects, test.bytes, got, test.want)
+		}
+	}
+
+	var s Sizes
+	s.add(Sizes{Tiny: 1, Huge: 2})
+	s.add(Sizes{Tiny: 3})
+	if want := (Sizes{Tiny: 4, Huge: 2}); s != want {
+		t.Errorf("add = %+v, want %+v", s, want)
+	}
+}
@@ -0,0 +1,172 @@
+package garbage
+
+import (
+	"bufio"
+	"encoding/gob"
+	"os"
+	"sort"
+)
+
+// A spill keeps the garbage a subscription has aggregated within a budget of
+// stacks held in memory. Past the budget, the aggregated garbage is written
+// to a temporary file as a run of records sorted by stack, and the runs are
+// merged with the garbage still in memory when the profile is emitted.
+type spill struct {
+	max int    // stacks held in memory before spilling
+	dir string // directory of the runs; os.TempDir if empty
+
+	runs   []string // files of the runs, oldest first
+	stacks int      // records in the runs, counting a stack once per run
+}
+
+// spillTo sets the most stacks s keeps in memory, spilling the rest to runs
+// in dir.
+func (c *collector) spillTo(s *subscription, max int, dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.spill = &spill{max: max, dir: dir}
+}
+
+// add spills garbage to a new run if it is over the budget, returning the
+// garbage left in memory. If the run cannot be written, garbage is kept in
+// memory.
+func (sp *spill) add(garbage []Record) []Record {
+	if len(garbage) <= sp.max {
+		return garbage
+	}
+	if err := sp.write(garbage); err != nil {
+		return garbage
+	}
+	return nil
+}
+
+// write writes recs, sorted by stack, to a new run.
+func (sp *spill) write(recs []Record) error {
+	sort.Slice(recs, func(i, j int) bool { return stackLess(recs[i].Stack0, recs[j].Stack0) })
+
+	f, err := os.CreateTemp(sp.dir, "pprof-garbage-spill-")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	for i := range recs {
+		if err = enc.Encode(&recs[i]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	sp.runs = append(sp.runs, f.Name())
+	sp.stacks += len(recs)
+	return nil
+}
+
+// merge merges the runs with the garbage held in memory, combining the
+// garbage of the same stack, and removes the runs. The records returned are
+// sorted by stack. A run that cannot be read back is lost from the point of
+// the error.
+func (sp *spill) merge(garbage []Record) []Record {
+	if len(sp.runs) == 0 {
+		return garbage
+	}
+
+	mem := append([]Record(nil), garbage...)
+	sort.Slice(mem, func(i, j int) bool { return stackLess(mem[i].Stack0, mem[j].Stack0) })
+
+	runs := make([]*run, 0, len(sp.runs)+1)
+	runs = append(runs, &run{next: sliceRecords(mem)})
+	for _, name := range sp.runs {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		defer os.Remove(name)
+		runs = append(runs, &run{next: decodeRecords(gob.NewDecoder(bufio.NewReader(f)))})
+	}
+	sp.runs, sp.stacks = nil, 0
+
+	for _, r := range runs {
+		r.advance()
+	}
+	var merged []Record
+	for {
+		// The runs are few, so the least stack is found by a scan.
+		var least *run
+		for _, r := range runs {
+			if r.ok && (least == nil || stackLess(r.head.Stack0, least.head.Stack0)) {
+				least = r
+			}
+		}
+		if least == nil {
+			return merged
+		}
+		if n := len(merged); n > 0 && merged[n-1].Stack0 == least.head.Stack0 {
+			m := &merged[n-1]
+			m.Objects += least.head.Objects
+			m.Bytes += least.head.Bytes
+			m.Cycles += least.head.Cycles
+			m.Ages.add(least.head.Ages)
+			m.Sizes.add(least.head.Sizes)
+		} else {
+			merged = append(merged, least.head)
+		}
+		least.advance()
+	}
+}
+
+// A run is a sequence of records sorted by stack, being merged.
+type run struct {
+	next func() (Record, bool)
+	head Record
+	ok   bool // whether head is valid
+}
+
+func (r *run) advance() {
+	r.head, r.ok = r.next()
+}
+
+// sliceRecords returns the records of recs in turn.
+func sliceRecords(recs []Record) func() (Record, bool) {
+	return func() (Record, bool) {
+		if len(recs) == 0 {
+			return Record{}, false
+		}
+		r := recs[0]
+		recs = recs[1:]
+		return r, true
+	}
+}
+
+// decodeRecords returns the records decoded by dec in turn, until the end of
+// the run or an error.
+func decodeRecords(dec *gob.Decoder) func() (Record, bool) {
+	return func() (Record, bool) {
+		var r Record
+		if err := dec.Decode(&r); err != nil {
+			return Record{}, false
+		}
+		return r, true
+	}
+}
+
+// stackLess orders stacks by their addresses, frame by frame.
+func stackLess(a, b [32]uintptr) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
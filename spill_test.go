@@ -0,0 +1,34 @@
+package garbage
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSpill(t *testing.T) {
+	dir := t.TempDir()
+	sp := &spill{max: 2, dir: dir}
+
+	var garbage []Record
+	for _, r := range []Record{testRecord(3, 1, 8), testRecord(1, 1, 8), testRecord(2, 1, 8), testRecord(1, 2, 16), testRecord(3, 4, 32), testRecord(4, 1, 8)} {
+		garbage = sp.add(merge(garbage, r))
+	}
+	if len(sp.runs) == 0 {
+		t.Fatal("want garbage spilled")
+	}
+
+	merged := sp.merge(garbage)
+	want := []Record{testRecord(1, 3, 24), testRecord(2, 1, 8), testRecord(3, 5, 40), testRecord(4, 1, 8)}
+	if len(merged) != len(want) {
+		t.Fatalf("want %d records, got %d: %+v", len(want), len(merged), merged)
+	}
+	for i, r := range merged {
+		if r.Stack0 != want[i].Stack0 || r.Objects != want[i].Objects || r.Bytes != want[i].Bytes {
+			t.Errorf("record %d: want %+v, got %+v", i, want[i], r)
+		}
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("want runs removed, got %d files", len(entries))
+	}
+}
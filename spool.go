@@ -0,0 +1,152 @@
+package garbage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSpoolSize bounds a spool whose Pusher sets no SpoolSize.
+const defaultSpoolSize = 64 << 20
+
+// spoolExt is the extension of spooled profiles.
+const spoolExt = ".pb.gz"
+
+// A spool is a bounded on-disk queue of encoded profiles, oldest first. The
+// file names order the queue, so it survives restarts of the process.
+type spool struct {
+	dir string
+	max int64 // bytes
+
+	mu    sync.Mutex
+	seq   int64
+	ready chan struct{} // signalled by put
+}
+
+func newSpool(dir string, max int64) *spool {
+	if max <= 0 {
+		max = defaultSpoolSize
+	}
+	return &spool{dir: dir, max: max, ready: make(chan struct{}, 1)}
+}
+
+// put adds an encoded profile to the end of the queue, dropping the oldest
+// profiles if the queue would exceed its size.
+func (s *spool) put(body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+
+	// Names sort by time, and by sequence within the same nanosecond.
+	s.seq++
+	name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), s.seq%1e6, spoolExt)
+	tmp := filepath.Join(s.dir, "."+name)
+	if err := os.WriteFile(tmp, body, 0o600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	s.trim()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// trim removes the oldest profiles until the queue fits its size. The
+// newest profile is always kept.
+func (s *spool) trim() {
+	names, sizes := s.list()
+	var total int64
+	for _, n := range sizes {
+		total += n
+	}
+	for i := 0; total > s.max && i < len(names)-1; i++ {
+		if os.Remove(filepath.Join(s.dir, names[i])) == nil {
+			total -= sizes[i]
+		}
+	}
+}
+
+// list returns the names and sizes of the spooled profiles, oldest first.
+func (s *spool) list() ([]string, []int64) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, nil
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), spoolExt) && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	sizes := make([]int64, len(names))
+	for i, name := range names {
+		if fi, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+			sizes[i] = fi.Size()
+		}
+	}
+	return names, sizes
+}
+
+// len returns the number and total size of the spooled profiles.
+func (s *spool) len() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names, sizes := s.list()
+	var total int64
+	for _, n := range sizes {
+		total += n
+	}
+	return len(names), total
+}
+
+// A spooled is a profile read from the queue.
+type spooled struct {
+	name string
+	body []byte
+}
+
+// peek returns up to n of the oldest spooled profiles, oldest first.
+func (s *spool) peek(n int) []spooled {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var batch []spooled
+	names, _ := s.list()
+	for _, name := range names {
+		if len(batch) == n {
+			break
+		}
+		body, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err == nil {
+			batch = append(batch, spooled{name, body})
+		}
+	}
+	return batch
+}
+
+// remove removes a spooled profile once it has been pushed.
+func (s *spool) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	os.Remove(filepath.Join(s.dir, name))
+}
@@ -0,0 +1,133 @@
+package garbage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSpoolBounded(t *testing.T) {
+	s := newSpool(t.TempDir(), 25)
+	for _, body := range []string{"0123456789", "abcdefghij", "ABCDEFGHIJ"} {
+		if err := s.put([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, size := s.len(); n != 2 || size != 20 {
+		t.Errorf("want 2 spooled profiles of 20 bytes, got %d of %d", n, size)
+	}
+	batch := s.peek(1)
+	if len(batch) != 1 || string(batch[0].body) != "abcdefghij" {
+		t.Fatalf("peek: want the second profile, got %q", batch)
+	}
+	s.remove(batch[0].name)
+	if batch := s.peek(2); len(batch) != 1 || string(batch[0].body) != "ABCDEFGHIJ" {
+		t.Errorf("peek after remove: want the third profile, got %q", batch)
+	}
+}
+
+func TestPusherRetry(t *testing.T) {
+	var requests int32
+	received := make(chan []byte, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer srv.Close()
+
+	var errs int32
+	p := &Pusher{URL: srv.URL, SpoolDir: t.TempDir(), MaxBackoff: time.Second, OnError: func(error) { atomic.AddInt32(&errs, 1) }}
+	p.once.Do(p.init)
+	p.spool.put([]byte("first"))
+	p.spool.put([]byte("second"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.retry(ctx)
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case body := <-received:
+			if !bytes.Equal(body, []byte(want)) {
+				t.Errorf("want %q pushed, got %q", want, body)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%q not pushed", want)
+		}
+	}
+
+	// The spooled profile is removed after its push is answered.
+	for deadline := time.Now().Add(5 * time.Second); p.Stats().Queued > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s := p.Stats(); s.Queued != 0 || s.Pushed != 2 || s.Failed != 1 {
+		t.Errorf("stats: want 0 queued, 2 pushed and 1 failed, got %+v", s)
+	}
+	if n := atomic.LoadInt32(&errs); n != 1 {
+		t.Errorf("want 1 error reported, got %d", n)
+	}
+}
+
+func TestPusherBatches(t *testing.T) {
+	var inFlight, maxInFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	p := &Pusher{URL: srv.URL, SpoolDir: t.TempDir(), Parallelism: 3}
+	p.once.Do(p.init)
+	for i := 0; i < 7; i++ {
+		p.spool.put([]byte{byte(i)})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.retry(ctx)
+
+	for deadline := time.Now().Add(10 * time.Second); p.Stats().Queued > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s := p.Stats(); s.Queued != 0 || s.Pushed != 7 {
+		t.Errorf("stats: want 0 queued and 7 pushed, got %+v", s)
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max < 2 || max > 3 {
+		t.Errorf("want batches of up to 3 uploads at once, got %d", max)
+	}
+}
+
+func TestPusherSpoolError(t *testing.T) {
+	// SpoolDir is a file, so no profile can be spooled to it.
+	dir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(dir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	p := &Pusher{SpoolDir: dir, OnError: func(err error) { errs = append(errs, err) }}
+	p.once.Do(p.init)
+
+	p.queue(context.Background(), []byte("profile"))
+	if len(errs) != 1 {
+		t.Errorf("want the spool error reported, got %v", errs)
+	}
+}
@@ -0,0 +1,123 @@
+package garbage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// stream runs the collection as a sequence of windows of interval, emitting
+// the profile of each as it closes, and unregisters the job. The GC period is
+// measured over one interval. The stream ends early if the job is cancelled,
+// with a truncated profile of the partial window, or if emit fails.
+func (j *job) stream(interval time.Duration, emit func(*Profile) error) {
+	defer func() {
+		jobs.Lock()
+		delete(jobs.m, j.id)
+		jobs.Unlock()
+
+		close(j.done)
+	}()
+
+	if j.replay != nil {
+		emit(j.replayed())
+		return
+	}
+
+	periodGC, ok := calcPeriod(interval, j.cancel)
+	if !ok {
+		j.profile = &Profile{
+			Start:     time.Now(),
+			Rate:      runtime.MemProfileRate,
+			Kind:      j.kind,
+			Truncated: true,
+			TraceID:   j.traceID,
+		}
+		emit(j.profile)
+		return
+	}
+
+	sub := shared.subscribe(periodGC, false)
+	j.guard(sub)
+	j.limit(sub)
+	j.trim(sub)
+	j.mu.Lock()
+	j.sub = sub
+	j.mu.Unlock()
+	defer shared.unsubscribe(sub)
+
+	end := time.Now().Add(j.window)
+	for start := time.Now(); start.Before(end); start = time.Now() {
+		d := interval
+		if rest := end.Sub(start); rest < d {
+			d = rest
+		}
+		finished := sleep(d, j.cancel)
+
+		p := shared.cut(sub, j.kind)
+		p.Start = start
+		p.Duration = time.Since(start)
+		p.Rate = runtime.MemProfileRate
+		p.Truncated = !finished
+		p.TraceID = j.traceID
+		p.Bursts = p.findBursts()
+		p.StackQuantiles = p.findStackQuantiles()
+		p.Overshoots = p.findOvershoots()
+		j.profile = p
+
+		if err := emit(p); err != nil || !finished {
+			return
+		}
+	}
+}
+
+// writeDelimited writes p to w as a gzip-compressed protocol buffer preceded
+// by its length as a varint, so a sequence of profiles can be written to one
+// stream and split by the reader.
+func writeDelimited(w io.Writer, p *Profile) error {
+	data, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	var n [binary.MaxVarintLen64]byte
+	if _, err := w.Write(n[:binary.PutUvarint(n[:], uint64(len(data)))]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// maxDelimited bounds the length of a profile read by ReadDelimited, to
+// guard against reading a stream that is not one.
+const maxDelimited = 1 << 30
+
+// ReadDelimited reads the profiles of a stream served with the stream
+// parameter, calling fn with the gzip-compressed protocol buffer of each.
+// It returns the first error from fn, or nil at the end of the stream.
+func ReadDelimited(r io.Reader, fn func(data []byte) error) error {
+	br := bufio.NewReader(r)
+	for {
+		n, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n > maxDelimited {
+			return fmt.Errorf("garbage: delimited profile of %d bytes is too large", n)
+		}
+
+		data := make([]byte, n)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return err
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+}
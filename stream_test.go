@@ -0,0 +1,42 @@
+package garbage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerStream(t *testing.T) {
+	requireEnabled(t)
+
+	rec := httptest.NewRecorder()
+	new(Handler).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/garbage?seconds=0.6&stream=200ms", nil))
+	if got := rec.Header().Get("X-Profile-Format"); got != "stream" {
+		t.Errorf("want format stream, got %q", got)
+	}
+
+	var profiles int
+	err := ReadDelimited(rec.Body, func(data []byte) error {
+		profiles++
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		pb, err := io.ReadAll(zr)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(pb, []byte("garbage_bytes")) {
+			t.Errorf("profile %d is not a garbage profile", profiles)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profiles != 3 {
+		t.Errorf("want 3 profiles of 200ms, got %d", profiles)
+	}
+}
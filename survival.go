@@ -0,0 +1,122 @@
+package garbage
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+)
+
+// A Survival estimates how many of the objects allocated by a single stack
+// lived past the first GC cycle after their allocation.
+//
+// The memory profile does not track objects individually, so the estimate
+// assumes the young die first: the frees observed for a stack in a cycle are
+// attributed to that cycle's allocations before any older ones. Stacks that
+// build caches survive; stacks that produce temporaries do not.
+type Survival struct {
+	Allocated int64       // number of objects allocated
+	Survived  int64       // number of objects estimated to survive one GC
+	Stack0    [32]uintptr // stack trace for this survival; ends at first 0 entry
+}
+
+// Fraction returns the fraction of allocated objects that survived one GC.
+func (s *Survival) Fraction() float64 {
+	if s.Allocated == 0 {
+		return 0
+	}
+	return float64(s.Survived) / float64(s.Allocated)
+}
+
+// Stack returns the stack trace associated with the survival,
+// a prefix of s.Stack0.
+func (s *Survival) Stack() []uintptr {
+	for i, v := range s.Stack0 {
+		if v == 0 {
+			return s.Stack0[0:i]
+		}
+	}
+	return s.Stack0[0:]
+}
+
+// survival returns the survival of the objects each stack allocated between
+// two reads of the memory profile, taken a GC cycle apart. The throttle, if
+// any, paces the comparison.
+func survival(prev, curr []runtime.MemProfileRecord, t *throttle) []Survival {
+	var ss []Survival
+	prevs := byStack(prev)
+	for _, cr := range curr {
+		t.tick()
+		pr := prevs[cr.Stack0]
+
+		allocs := cr.AllocObjects - pr.AllocObjects
+		if allocs <= 0 {
+			continue
+		}
+		died := cr.FreeObjects - pr.FreeObjects
+		if died > allocs {
+			died = allocs
+		}
+
+		ss = append(ss, Survival{
+			Allocated: allocs,
+			Survived:  allocs - died,
+			Stack0:    cr.Stack0,
+		})
+	}
+	return ss
+}
+
+// mergeSurvivals adds the survival of each of add, its stack trimmed by trim,
+// to the entry for the same stack in ss, in time linear in the entries of
+// both.
+func mergeSurvivals(ss, add []Survival, trim func([32]uintptr) [32]uintptr) []Survival {
+	if len(add) == 0 {
+		return ss
+	}
+	index := make(map[[32]uintptr]int, len(ss)+len(add))
+	for i := range ss {
+		index[ss[i].Stack0] = i
+	}
+	for _, s := range add {
+		s.Stack0 = trim(s.Stack0)
+		ss = mergeSurvivalIndexed(ss, index, s)
+	}
+	return ss
+}
+
+// mergeSurvivalIndexed adds the survival of s to the entry for the same stack
+// in ss, with index the position of each stack of ss, which it keeps up to
+// date.
+func mergeSurvivalIndexed(ss []Survival, index map[[32]uintptr]int, s Survival) []Survival {
+	if i, ok := index[s.Stack0]; ok {
+		ss[i].Allocated += s.Allocated
+		ss[i].Survived += s.Survived
+		return ss
+	}
+	index[s.Stack0] = len(ss)
+	return append(ss, s)
+}
+
+// sortSurvival sorts ss by the number of objects allocated, most first.
+func sortSurvival(ss []Survival) {
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].Allocated > ss[j].Allocated
+	})
+}
+
+// printSurvival prints the survival of each stack as a comment section of the
+// legacy text format.
+func (p *Profile) printSurvival(w io.Writer) {
+	ss := p.Survival
+	fmt.Fprintf(w, "\n# survival: objects allocated: surviving one GC\n")
+	for i := range ss {
+		s := &ss[i]
+		fmt.Fprintf(w, "# %d: %d (%.1f%%) @", s.Allocated, s.Survived, 100*s.Fraction())
+		for _, pc := range s.Stack() {
+			fmt.Fprintf(w, " %#x", pc)
+		}
+		fmt.Fprintf(w, "\n")
+		p.printStack(w, s.Stack())
+	}
+}
@@ -0,0 +1,62 @@
+package garbage
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSurvival(t *testing.T) {
+	rec := func(pc uintptr, allocs, frees int64) runtime.MemProfileRecord {
+		r := runtime.MemProfileRecord{AllocObjects: allocs, FreeObjects: frees}
+		r.Stack0[0] = pc
+		return r
+	}
+
+	prev := []runtime.MemProfileRecord{
+		rec(1, 100, 100),
+		rec(2, 100, 0),
+	}
+	curr := []runtime.MemProfileRecord{
+		rec(1, 200, 200), // temporaries: every allocation freed
+		rec(2, 200, 10),  // cache: most allocations kept
+		rec(3, 50, 60),   // more frees than allocations
+	}
+
+	ss := survival(prev, curr, nil)
+	trim := func(stk [32]uintptr) [32]uintptr { return stk }
+	ss = mergeSurvivals(ss, []Survival{{Allocated: 100, Survived: 100, Stack0: ss[1].Stack0}}, trim)
+	sortSurvival(ss)
+
+	want := []struct {
+		pc                  uintptr
+		allocated, survived int64
+	}{
+		{2, 200, 190},
+		{1, 100, 0},
+		{3, 50, 0},
+	}
+	if len(ss) != len(want) {
+		t.Fatalf("want %d survivals, got %+v", len(want), ss)
+	}
+	for i, w := range want {
+		s := ss[i]
+		if s.Stack()[0] != w.pc || s.Allocated != w.allocated || s.Survived != w.survived {
+			t.Errorf("%d: want %#x %d: %d, got %#x %d: %d", i,
+				w.pc, w.allocated, w.survived, s.Stack()[0], s.Allocated, s.Survived)
+		}
+	}
+	if f := ss[0].Fraction(); f != 0.95 {
+		t.Errorf("want fraction 0.95, got %v", f)
+	}
+
+	p := testProfile()
+	p.Survival = ss
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# 200: 190 (95.0%) @ 0x2\n"; !strings.Contains(string(text), want) {
+		t.Errorf("want survival line %q in %q", want, text)
+	}
+}
@@ -0,0 +1,42 @@
+package garbage
+
+import (
+	"net/http"
+	"strings"
+)
+
+// traceComment prefixes the trace ID in the comments of the text and protocol
+// buffer formats.
+const traceComment = "trace_id: "
+
+// requestTraceID returns the trace ID of the W3C traceparent header of r, if
+// it has a valid one.
+func requestTraceID(r *http.Request) string {
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	parts := strings.Split(strings.TrimSpace(r.Header.Get("Traceparent")), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isHex(parts[0]) {
+		return ""
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return ""
+	}
+	if !validTraceID(parts[1]) || len(parts[2]) != 16 || !isHex(parts[2]) {
+		return ""
+	}
+	return parts[1]
+}
+
+// validTraceID reports whether id is a W3C trace ID: 32 lowercase hex digits,
+// not all zero.
+func validTraceID(id string) bool {
+	return len(id) == 32 && isHex(id) && strings.Trim(id, "0") != ""
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
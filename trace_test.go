@@ -0,0 +1,57 @@
+package garbage
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestTraceID(t *testing.T) {
+	const id = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	tests := []struct {
+		traceparent string
+		want        string
+	}{
+		{"", ""},
+		{"00-" + id + "-00f067aa0ba902b7-01", id},
+		{"01-" + id + "-00f067aa0ba902b7-01-future", id},
+		{"00-" + id + "-00f067aa0ba902b7-01-extra", ""},
+		{"ff-" + id + "-00f067aa0ba902b7-01", ""},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"00-" + strings.ToUpper(id) + "-00f067aa0ba902b7-01", ""},
+		{"00-" + id + "-00f067aa0ba9-01", ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/debug/pprof/garbage", nil)
+		r.Header.Set("Traceparent", test.traceparent)
+		if got := requestTraceID(r); got != test.want {
+			t.Errorf("traceparent %q: want %q, got %q", test.traceparent, test.want, got)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/debug/pprof/garbage?trace_id="+id, nil)
+	p, err := new(Handler).params(r)
+	if err != nil || p.traceID != id {
+		t.Errorf("trace_id parameter: want %q, got %q (%v)", id, p.traceID, err)
+	}
+}
+
+func TestTraceIDText(t *testing.T) {
+	p := goldenProfile()
+	p.TraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	var buf bytes.Buffer
+	if err := p.writeText(&buf, textOptions{debug: 1}); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseText(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.TraceID != p.TraceID {
+		t.Errorf("want trace ID %q, got %q", p.TraceID, parsed.TraceID)
+	}
+}
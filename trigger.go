@@ -0,0 +1,185 @@
+package garbage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTriggerFor      = 30 * time.Second
+	defaultTriggerDuration = 30 * time.Second
+	defaultTriggerCooldown = 10 * time.Minute
+)
+
+// A Trigger captures a garbage profile whenever the GC runs more often than
+// a threshold for a sustained period, such as more than 2 cycles a second for
+// 30 seconds, so the evidence of a transient allocation storm is kept for
+// later.
+type Trigger struct {
+	// Rate is the GC frequency, in cycles per second, above which the GC is
+	// running too often.
+	Rate float64
+
+	// For is how long the frequency must stay above Rate, measured over a
+	// sliding window of that length. Zero means 30 seconds.
+	For time.Duration
+
+	// Duration is the collection window of the profile captured. Zero
+	// means 30 seconds.
+	Duration time.Duration
+
+	// Cooldown is the minimum time between captures. Zero means ten
+	// minutes.
+	Cooldown time.Duration
+
+	// Dir, if set, is the directory the profiles captured are written to,
+	// named for the time of the capture.
+	Dir string
+
+	// OnCapture, if set, is called with each profile captured, on a
+	// goroutine of its own. A Notifier can send its alert (see NewAlert)
+	// to Slack or PagerDuty.
+	OnCapture func(*Profile)
+
+	// Interval is how often to check for a completed GC cycle, as for a
+	// Monitor. Zero means one second.
+	Interval time.Duration
+
+	rec    Recorder
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	start    time.Time       // time the trigger started
+	cycles   []triggerSample // cycles in the sliding window, oldest first
+	captured time.Time       // start of the last capture
+}
+
+// A triggerSample is a GC cycle observed by a Trigger.
+type triggerSample struct {
+	time  time.Time
+	numGC uint32
+}
+
+// Start starts the trigger if it is not already running.
+func (t *Trigger) Start() {
+	if !enabled || t.Rate <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	if t.cancel != nil {
+		t.mu.Unlock()
+		return
+	}
+	var ctx context.Context
+	ctx, t.cancel = context.WithCancel(context.Background())
+	t.start, t.cycles = time.Now(), nil
+	t.mu.Unlock()
+
+	t.rec.Interval = t.Interval
+	t.rec.Start(func(c *CycleDelta) {
+		if t.observe(c.Time, c.NumGC) {
+			go t.capture(ctx)
+		}
+	})
+}
+
+// Stop stops the trigger, cancelling any capture in progress.
+func (t *Trigger) Stop() {
+	t.rec.Stop()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cancel != nil {
+		t.cancel()
+		t.cancel = nil
+	}
+}
+
+// observe adds a GC cycle observed at now to the sliding window and reports
+// whether the GC frequency has stayed above the threshold for the window, so
+// a profile should be captured.
+func (t *Trigger) observe(now time.Time, numGC uint32) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	window := t.For
+	if window <= 0 {
+		window = defaultTriggerFor
+	}
+
+	t.cycles = append(t.cycles, triggerSample{now, numGC})
+	// Keep the last cycle before the window, the baseline of its count.
+	i := 0
+	for i+1 < len(t.cycles) && now.Sub(t.cycles[i+1].time) >= window {
+		i++
+	}
+	t.cycles = t.cycles[i:]
+
+	if now.Sub(t.start) < window {
+		return false
+	}
+	rate := float64(numGC-t.cycles[0].numGC) / window.Seconds()
+	if rate <= t.Rate {
+		return false
+	}
+
+	cooldown := t.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultTriggerCooldown
+	}
+	if !t.captured.IsZero() && now.Sub(t.captured) < cooldown {
+		return false
+	}
+	t.captured = now
+	return true
+}
+
+// capture collects a profile and stores it.
+func (t *Trigger) capture(ctx context.Context) {
+	duration := t.Duration
+	if duration <= 0 {
+		duration = defaultTriggerDuration
+	}
+
+	p, err := NewCollector(Options{Duration: duration}).Collect(ctx)
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	if t.Dir != "" {
+		t.store(p)
+	}
+	if t.OnCapture != nil {
+		t.OnCapture(p)
+	}
+}
+
+// store writes p to a file in Dir named for the start of its window.
+func (t *Trigger) store(p *Profile) error {
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.pb.gz", p.kind(), p.Start.UTC().Format("20060102T150405.000Z"))
+	tmp := filepath.Join(t.Dir, "."+name)
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := p.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(t.Dir, name))
+}
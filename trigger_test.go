@@ -0,0 +1,55 @@
+package garbage
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTriggerObserve(t *testing.T) {
+	start := time.Unix(0, 0)
+	tr := &Trigger{Rate: 2, For: 10 * time.Second, Cooldown: time.Minute, start: start}
+
+	// One cycle a second, below the threshold.
+	now, numGC := start, uint32(0)
+	for i := 0; i < 20; i++ {
+		now, numGC = now.Add(time.Second), numGC+1
+		if tr.observe(now, numGC) {
+			t.Fatalf("%v: capture at 1 cycle/s", now.Sub(start))
+		}
+	}
+
+	// Four cycles a second, observed coalesced, must last long enough to
+	// raise the frequency over the window above the threshold.
+	var fired time.Duration
+	for i := 0; i < 20 && fired == 0; i++ {
+		now, numGC = now.Add(time.Second), numGC+4
+		if tr.observe(now, numGC) {
+			fired = now.Sub(start)
+		}
+	}
+	if fired < 24*time.Second || fired > 27*time.Second {
+		t.Errorf("want capture 4s into the storm, got at %v", fired)
+	}
+
+	now, numGC = now.Add(time.Second), numGC+4
+	if tr.observe(now, numGC) {
+		t.Error("capture within cooldown")
+	}
+}
+
+func TestTriggerStore(t *testing.T) {
+	tr := &Trigger{Dir: t.TempDir()}
+	p := &Profile{Start: time.Unix(1, 0), Rate: 1}
+	if err := tr.store(p); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(tr.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "garbage-19700101T000001.000Z.pb.gz" {
+		t.Errorf("want one stored profile, got %v", entries)
+	}
+}
@@ -0,0 +1,43 @@
+package garbage
+
+// collapse maps the stack of each record of a cycle's garbage with f, merging
+// the records whose stacks become identical. Each record is of a single
+// cycle.
+func collapse(garbage []Record, f func([32]uintptr) [32]uintptr) []Record {
+	var recs []Record
+	index := make(map[[32]uintptr]int, len(garbage))
+	for _, r := range garbage {
+		r.Stack0 = f(r.Stack0)
+		recs = mergeIndexed(recs, index, r)
+	}
+	for i := range recs {
+		recs[i].Cycles = 1
+	}
+	return recs
+}
+
+// trimStack returns the innermost depth frames of stk.
+func trimStack(stk [32]uintptr, depth int) [32]uintptr {
+	var trimmed [32]uintptr
+	if depth > len(stk) {
+		depth = len(stk)
+	}
+	copy(trimmed[:depth], stk[:depth])
+	return trimmed
+}
+
+// trim trims stk to the depth of s, if it has one.
+func (s *subscription) trim(stk [32]uintptr) [32]uintptr {
+	if s.depth <= 0 {
+		return stk
+	}
+	return trimStack(stk, s.depth)
+}
+
+// trimTo trims the stacks s aggregates to their innermost depth frames.
+func (c *collector) trimTo(s *subscription, depth int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.depth = depth
+}
@@ -0,0 +1,56 @@
+package garbage
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestPipelineStackDepth(t *testing.T) {
+	// Two handlers allocate through the same two middleware frames.
+	read := func(n int64) []runtime.MemProfileRecord {
+		recs := make([]runtime.MemProfileRecord, 2)
+		for i := range recs {
+			recs[i] = runtime.MemProfileRecord{
+				AllocObjects: n, AllocBytes: n << 10,
+				FreeObjects: n, FreeBytes: n << 10,
+			}
+			copy(recs[i].Stack0[:], []uintptr{0x10, 0x20, 0x30 + uintptr(i)})
+		}
+		return recs
+	}
+	snaps := [][]runtime.MemProfileRecord{read(0), read(5), read(10)}
+
+	c := &collector{
+		subs: make(map[*subscription]struct{}),
+		last: snaps[0],
+		ages: make(ageTracker),
+	}
+	full := &subscription{first: snaps[0]}
+	trimmed := &subscription{first: snaps[0], depth: 2}
+	c.subs[full] = struct{}{}
+	c.subs[trimmed] = struct{}{}
+	for i := 1; i < len(snaps); i++ {
+		c.observe(snaps[i-1], snaps[i], Cycle{NumGC: uint32(i)})
+	}
+	c.unsubscribe(full)
+	c.unsubscribe(trimmed)
+
+	if p := full.profile(garbageKind); len(p.Records) != 2 {
+		t.Errorf("untrimmed: want 2 records, got %+v", p.Records)
+	}
+
+	p := trimmed.profile(garbageKind)
+	if len(p.Records) != 1 {
+		t.Fatalf("trimmed: want 1 record, got %+v", p.Records)
+	}
+	r := p.Records[0]
+	if r.Objects != 20 || r.Cycles != 2 {
+		t.Errorf("trimmed: want 20 objects over 2 cycles, got %d over %d", r.Objects, r.Cycles)
+	}
+	if stk := r.Stack(); len(stk) != 2 || stk[0] != 0x10 || stk[1] != 0x20 {
+		t.Errorf("trimmed: want stack [0x10 0x20], got %#x", stk)
+	}
+	if len(p.tops) != 2 || len(p.tops[0]) != 1 {
+		t.Errorf("trimmed: want one top stack per cycle, got %+v", p.tops)
+	}
+}
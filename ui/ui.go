@@ -0,0 +1,37 @@
+// Package ui serves a web page viewing the garbage profile, for a look at
+// a running program without the pprof tool:
+//
+//	http.Handle("/debug/pprof/garbage", garbage.Garbage)
+//	http.Handle("/debug/pprof/garbage-ui", ui.Handler("/debug/pprof/garbage"))
+//
+// The page collects a profile of the window it is asked for from the handler
+// in the JSON form and lists the stacks with the most garbage. Its assets are
+// a package of their own so that programs serving only the profile do not
+// embed them.
+package ui
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed index.html
+var index string
+
+var page = template.Must(template.New("index.html").Parse(index))
+
+// Handler returns a handler serving the page viewing the profile served at
+// path, such as "/debug/pprof/garbage".
+func Handler(path string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		page.Execute(w, path)
+	})
+}
@@ -0,0 +1,30 @@
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	h := Handler("/debug/pprof/garbage")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/garbage-ui", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want code %d, got %d", http.StatusOK, rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("want HTML, got %q", ct)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `const profilePath = "/debug/pprof/garbage";`) {
+		t.Errorf("page does not fetch the profile path:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/debug/pprof/garbage-ui", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: want code %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
@@ -0,0 +1,62 @@
+package garbage
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// units formats sizes and counts for text output: as plain integers, or if
+// human is set, as sizes with binary prefixes and counts with thousands
+// separators.
+type units struct {
+	human bool
+}
+
+func (u units) bytes(n int64) string {
+	if !u.human {
+		return strconv.FormatInt(n, 10)
+	}
+
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	v, prefix := float64(n)/unit, 0
+	for (v >= unit || v <= -unit) && prefix < len("KMGTPE")-1 {
+		v /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %ciB", v, "KMGTPE"[prefix])
+}
+
+func (u units) ubytes(n uint64) string {
+	if !u.human {
+		return strconv.FormatUint(n, 10)
+	}
+	return u.bytes(int64(n))
+}
+
+func (u units) count(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	if !u.human {
+		return s
+	}
+
+	var sign string
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
+
+func (u units) ucount(n uint64) string {
+	if !u.human {
+		return strconv.FormatUint(n, 10)
+	}
+	return u.count(int64(n))
+}
@@ -0,0 +1,43 @@
+package garbage
+
+import "testing"
+
+func TestUnits(t *testing.T) {
+	raw, human := units{}, units{human: true}
+
+	bytesTests := []struct {
+		n         int64
+		raw, want string
+	}{
+		{0, "0", "0 B"},
+		{1023, "1023", "1023 B"},
+		{1024, "1024", "1.0 KiB"},
+		{3 << 20, "3145728", "3.0 MiB"},
+		{1536 << 20, "1610612736", "1.5 GiB"},
+		{-2048, "-2048", "-2.0 KiB"},
+	}
+	for _, test := range bytesTests {
+		if got := raw.bytes(test.n); got != test.raw {
+			t.Errorf("bytes(%d): want %q, got %q", test.n, test.raw, got)
+		}
+		if got := human.bytes(test.n); got != test.want {
+			t.Errorf("human bytes(%d): want %q, got %q", test.n, test.want, got)
+		}
+	}
+
+	countTests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1000, "1,000"},
+		{1234567, "1,234,567"},
+		{-1234567, "-1,234,567"},
+	}
+	for _, test := range countTests {
+		if got := human.count(test.n); got != test.want {
+			t.Errorf("human count(%d): want %q, got %q", test.n, test.want, got)
+		}
+	}
+}